@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Confirmation tokens for account deletion are valid for this long
+const deletionConfirmationTTL = 10 * time.Minute
+
+// Audit records of deleted accounts, newest first
+const accountDeletionsAuditKey = "audit:account_deletions"
+
+// AccountDeletion is the audit record kept after an account has been deleted. It holds no personal
+// data besides the key's ID and name.
+type AccountDeletion struct {
+	KeyID            string `json:"key_id"`
+	KeyName          string `json:"key_name"`
+	DeletedAt        string `json:"deleted_at"`
+	LinksDeleted     int    `json:"links_deleted"`
+	CampaignsDeleted int    `json:"campaigns_deleted"`
+}
+
+func deletionMessage(keyID string, expires int64) string {
+	return "delete-account:" + keyID + ":" + strconv.FormatInt(expires, 10)
+}
+
+// The function checks a confirmation token issued by requestAccountDeletionHandler for the key.
+func validDeletionConfirmation(keyID, token string) bool {
+	expiresText, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresText, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return validSignature(deletionMessage(keyID, expires), signature)
+}
+
+// The `deleteOwnedLinks` function deletes every link created with an API key along with its click
+// log, rollups and summary, in Redis and in cold storage.
+func deleteOwnedLinks(ctx context.Context, rdb *redis.Client, owner string) (int, error) {
+	keys, err := rdb.SMembers(ctx, ownerIndexKey(owner)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for len(keys) > 0 {
+		batch := keys[:min(100, len(keys))]
+		keys = keys[len(batch):]
+
+		values, err := rdb.MGet(ctx, batch...).Result()
+		if err != nil {
+			return deleted, err
+		}
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range batch {
+				pipe.Del(ctx, key, clickLogKey(key), clickRollupKey(key), uniquesKey(key), clickSeriesKey(key), accessCountsKey(key), remainingUsesKey(key), linkHistoryKey(key), summaryKey(key), tombstoneKey(key), archiveSnapshotKey(key), eventsKey(key))
+				linkCache.invalidate(key)
+				data, ok := values[i].(string)
+				if !ok {
+					continue
+				}
+				var urlEntry URL
+				if json.Unmarshal([]byte(data), &urlEntry) != nil {
+					continue
+				}
+				for _, index := range indexKeys(urlEntry) {
+					pipe.SRem(ctx, index, key)
+				}
+				deleted++
+			}
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+	invalidateListings(ctx, rdb)
+
+	if coldStore != nil {
+		cold, err := coldStore.DeleteOwned(owner)
+		deleted += cold
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// The function deletes the campaigns of an API key with their click counters.
+func deleteOwnedCampaigns(ctx context.Context, rdb *redis.Client, owner string) (int, error) {
+	ids, err := rdb.SMembers(ctx, ownerCampaignsKey(owner)).Result()
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, campaignKey(id), campaignClicksKey(id), campaignUniquesKey(id), campaignIndexKey(id), campaignJourneysKey(id), campaignConversionsKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// The `requestAccountDeletionHandler` function starts the deletion of the requesting API key's account
+// by issuing a confirmation token. Nothing is deleted until the token is sent back.
+func requestAccountDeletionHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	if apiKey.ID == adminAPIKey.ID {
+		c.JSON(http.StatusForbidden, gin.H{"message": "The admin key can't be deleted"})
+		return
+	}
+
+	expires := time.Now().Add(deletionConfirmationTTL)
+	token := strconv.FormatInt(expires.Unix(), 10) + "." + sign(deletionMessage(apiKey.ID, expires.Unix()))
+	c.Set(auditTargetKey, apiKey.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"confirmation_token": token,
+		"expires_at":         expires.Format(time.RFC3339),
+		"message":            "Send DELETE /api/account with this confirmation_token to delete the API key, its links, their analytics and its campaigns. This can't be undone.",
+	})
+}
+
+// The `deleteAccountHandler` function deletes the requesting API key's account once the deletion is
+// confirmed: its links with their analytics, its campaigns and finally the key itself. An audit record
+// of the deletion is kept.
+func deleteAccountHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	if apiKey.ID == adminAPIKey.ID {
+		c.JSON(http.StatusForbidden, gin.H{"message": "The admin key can't be deleted"})
+		return
+	}
+	if !validDeletionConfirmation(apiKey.ID, c.Query("confirmation_token")) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired confirmation_token, request a new one with POST /api/account/delete"})
+		return
+	}
+
+	// The cleanup can take a while for large accounts and must not stop halfway because the client
+	// went away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), time.Minute)
+	defer cancel()
+
+	links, err := deleteOwnedLinks(ctx, rdb, apiKey.ID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	campaigns, err := deleteOwnedCampaigns(ctx, rdb, apiKey.ID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	record := AccountDeletion{
+		KeyID:            apiKey.ID,
+		KeyName:          apiKey.Name,
+		DeletedAt:        time.Now().Format(time.RFC3339),
+		LinksDeleted:     links,
+		CampaignsDeleted: campaigns,
+	}
+	data, _ := json.Marshal(record)
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, apiKeyRedisKey(apiKey.secret), apiKeyIDKey(apiKey.ID), ownerIndexKey(apiKey.ID), ownerCreatedIndexKey(apiKey.ID), ownerClicksIndexKey(apiKey.ID), ownerCampaignsKey(apiKey.ID), destinationStatsKey(apiKey.ID), brandingKey(apiKey.ID), activeLinksKey(apiKey.ID))
+		pipe.LPush(ctx, accountDeletionsAuditKey, data)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	// The key of a workspace pinned to a region lives in the home Redis
+	if home := homeClient(rdb); home != rdb {
+		if err := home.Del(ctx, apiKeyRedisKey(apiKey.secret), apiKeyIDKey(apiKey.ID)).Err(); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+	}
+
+	c.Set(auditTargetKey, apiKey.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted", "links_deleted": links, "campaigns_deleted": campaigns})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=leaving", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	owner := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/api/campaigns", "name=Spring", owner)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+
+	var owned map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/mine&tags=private&campaign_id="+campaign.ID, owner)
+	json.Unmarshal(w.Body.Bytes(), &owned)
+	performRequest(router, "GET", "/"+owned["token"], "", nil)
+	time.Sleep(50 * time.Millisecond)
+
+	var other map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/other", nil)
+	json.Unmarshal(w.Body.Bytes(), &other)
+
+	// Deleting needs a confirmation token issued to the same key
+	w = performRequest(router, "DELETE", "/api/account", "", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/api/account/delete", "", admin)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "POST", "/api/account/delete", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var confirmation map[string]string
+	json.Unmarshal(w.Body.Bytes(), &confirmation)
+	assert.NotEmpty(t, confirmation["confirmation_token"])
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, owned["token"]).Val())
+
+	w = performRequest(router, "DELETE", "/api/account?confirmation_token=1.forged", "", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "DELETE", "/api/account?confirmation_token="+url.QueryEscape(confirmation["confirmation_token"]), "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message": "Account deleted", "links_deleted": 1, "campaigns_deleted": 1}`, w.Body.String())
+
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, owned["token"], clickLogKey(owned["token"]), campaignKey(campaign.ID), apiKeyRedisKey(key.Key)).Val())
+	assert.False(t, rdb.SIsMember(testCtx, tagIndexKey("private"), owned["token"]).Val())
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, other["token"]).Val())
+
+	// The key no longer works
+	w = performRequest(router, "POST", "/api/account/delete", "", owner)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var audit AccountDeletion
+	json.Unmarshal([]byte(rdb.LIndex(testCtx, accountDeletionsAuditKey, 0).Val()), &audit)
+	assert.Equal(t, key.ID, audit.KeyID)
+	assert.Equal(t, 1, audit.LinksDeleted)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// The `listURLsHandler` function lists stored links, optionally filtered by the API key that created them
+// (`owner`), a tag, a category, or the creator's IP address. Filters are combined with AND, as an
+// intersection of the index sets. Operators list every link through the admin API; other API keys only
+// list their own, and can't filter by owner or IP. Results are ordered by token and paginated with the
+// `cursor` returned by the previous page.
+func listURLsHandler(c *gin.Context, rdb *redis.Client, adminAPI bool) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	var keys []string
+	if adminAPI && apiKey.ID == adminAPIKey.ID {
+		if owner := c.Query("owner"); owner != "" {
+			keys = append(keys, ownerIndexKey(owner))
+		}
+		if ip := c.Query("ip"); ip != "" {
+			keys = append(keys, ipIndexKey(ip))
+		}
+	} else {
+		if c.Query("owner") != "" || c.Query("ip") != "" {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only the admin API key can filter by owner or IP"})
+			return
+		}
+		keys = append(keys, ownerIndexKey(apiKey.ID))
+	}
+	// Tags are stored lowercase
+	if tag := strings.ToLower(c.Query("tag")); tag != "" {
+		keys = append(keys, tagIndexKey(tag))
+	}
+	if category := c.Query("category"); category != "" {
+		keys = append(keys, categoryIndexKey(category))
+	}
+	if len(keys) == 0 {
+		keys = []string{allURLsIndex}
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit parameter"})
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	tokens, err := listTokens(opCtx, rdb, keys)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		tokens = tokens[sort.SearchStrings(tokens, cursor+"\x00"):]
+	}
+
+	urls := []URL{}
+	var stale []interface{}
+	nextCursor := ""
+	for len(tokens) > 0 && len(urls) < limit {
+		batch := tokens[:min(limit-len(urls), len(tokens))]
+		tokens = tokens[len(batch):]
+
+		values, err := rdb.MGet(opCtx, batch...).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				stale = append(stale, batch[i])
+				continue
+			}
+			var urlEntry URL
+			if json.Unmarshal([]byte(data), &urlEntry) == nil {
+				urls = append(urls, urlEntry)
+				nextCursor = batch[i]
+			}
+		}
+	}
+	if len(tokens) == 0 {
+		nextCursor = ""
+	}
+
+	// Drop index entries of links that have expired since they were indexed
+	if len(stale) > 0 {
+		cleanCtx, cleanCancel := writeContext(c.Request.Context())
+		defer cleanCancel()
+		pipe := rdb.Pipeline()
+		for _, key := range keys {
+			pipe.SRem(cleanCtx, key, stale...)
+		}
+		pipe.Exec(cleanCtx)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"urls": urls, "next_cursor": nextCursor})
+}
+
+// The `deleteURLHandler` function deletes a link together with its index entries. Links of a custom
+// short domain are addressed with the `domain` query parameter.
+func deleteURLHandler(c *gin.Context, rdb *redis.Client) {
+	token := c.Param("token")
+	key := linkKey(strings.ToLower(c.Query("domain")), token)
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	var urlEntry URL
+	json.Unmarshal([]byte(val), &urlEntry)
+	if err := deleteLink(opCtx, rdb, urlEntry); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted", "token": token})
+}
+
+// The `deleteLink` function archives a link and deletes it along with the data kept next to it, its
+// quota usage and index entries.
+func deleteLink(ctx context.Context, rdb *redis.Client, urlEntry URL) error {
+	key := urlEntry.key()
+	archiveLink(ctx, rdb, urlEntry, "deleted")
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key, clickLogKey(key), clickRollupKey(key), uniquesKey(key), clickSeriesKey(key), accessCountsKey(key), remainingUsesKey(key), linkHistoryKey(key), tombstoneKey(key))
+		releaseQuota(ctx, pipe, urlEntry)
+		recordEvent(ctx, pipe, urlEntry, "deleted")
+		unindexOwnedLink(ctx, pipe, urlEntry)
+		invalidateListings(ctx, pipe)
+		linkCache.invalidate(key)
+		for _, index := range indexKeys(urlEntry) {
+			pipe.SRem(ctx, index, key)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListURLsByOwnerAndTag(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=newsletter", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var key struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&tags=Launch,news", map[string]string{apiKeyHeader: key.Key})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.org&tags=launch", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		URLs []URL `json:"urls"`
+	}
+	w = performRequest(router, "GET", "/api/urls?tag=launch", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.URLs, 2)
+
+	// Tags match regardless of case
+	w = performRequest(router, "GET", "/api/urls?tag=Launch", "", admin)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.URLs, 2)
+
+	w = performRequest(router, "GET", "/api/urls?tag=launch&owner="+key.ID, "", admin)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.URLs, 1)
+	assert.Equal(t, key.ID, response.URLs[0].CreatorAPIKey)
+	assert.Equal(t, []string{"launch", "news"}, response.URLs[0].Tags)
+
+	// Other API keys only list their own links, and anonymous or unknown ones nothing
+	user := map[string]string{apiKeyHeader: key.Key}
+	w = performRequest(router, "GET", "/api/urls?tag=launch", "", user)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.URLs, 1)
+	assert.Equal(t, key.ID, response.URLs[0].CreatorAPIKey)
+	w = performRequest(router, "GET", "/api/urls?tag=launch&owner=admin", "", user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "GET", "/api/urls", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", map[string]string{apiKeyHeader: "nope"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Alert is an operator-facing notification about the health of the shortener. Alerts are triggered
+// when a check crosses its threshold and resolved once it recovers, so an ongoing problem is reported
+// once rather than on every check.
+type Alert struct {
+	// Stable identifier of the problem, e.g. "redis_down", used to deduplicate in the alerting service
+	Key      string
+	Summary  string
+	Severity string
+	Resolved bool
+}
+
+// AlertSink delivers alerts to an alerting service. These are separate from anything users see.
+type AlertSink interface {
+	Name() string
+	Send(ctx context.Context, alert Alert) error
+}
+
+// Endpoints of the alerting services, variables so tests can point them elsewhere
+var (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieAlertsURL  = "https://api.opsgenie.com/v2/alerts"
+)
+
+// Alerts go to the operator's own services, not to link destinations, so they don't use outboundClient
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// Redirect saves in flight, the backlog of the asynchronous writes of redirectHandler
+var pendingSaves atomic.Int64
+
+// Links flagged as malicious since the last alert check
+var flaggedLinks atomic.Int64
+
+func postAlert(ctx context.Context, endpoint string, headers map[string]string, body interface{}) error {
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// pagerDutySink sends alerts through the PagerDuty Events API v2.
+type pagerDutySink struct {
+	routingKey string
+}
+
+func (pagerDutySink) Name() string { return "pagerduty" }
+
+func (s pagerDutySink) Send(ctx context.Context, alert Alert) error {
+	action := "trigger"
+	if alert.Resolved {
+		action = "resolve"
+	}
+	return postAlert(ctx, pagerDutyEventsURL, nil, map[string]interface{}{
+		"routing_key":  s.routingKey,
+		"event_action": action,
+		"dedup_key":    "url-shortener:" + alert.Key,
+		"payload": map[string]string{
+			"summary":  alert.Summary,
+			"source":   "url-shortener",
+			"severity": alert.Severity,
+		},
+	})
+}
+
+// opsgenieSink sends alerts through the Opsgenie Alert API.
+type opsgenieSink struct {
+	apiKey string
+}
+
+func (opsgenieSink) Name() string { return "opsgenie" }
+
+func (s opsgenieSink) Send(ctx context.Context, alert Alert) error {
+	headers := map[string]string{"Authorization": "GenieKey " + s.apiKey}
+	alias := "url-shortener:" + alert.Key
+	if alert.Resolved {
+		return postAlert(ctx, opsgenieAlertsURL+"/"+url.PathEscape(alias)+"/close?identifierType=alias", headers, map[string]string{})
+	}
+	priority := "P3"
+	if alert.Severity == "critical" {
+		priority = "P1"
+	}
+	return postAlert(ctx, opsgenieAlertsURL, headers, map[string]string{
+		"message":  alert.Summary,
+		"alias":    alias,
+		"priority": priority,
+	})
+}
+
+// emailSink sends alerts by email through an SMTP relay.
+type emailSink struct {
+	addr string
+	from string
+	to   []string
+}
+
+func (emailSink) Name() string { return "email" }
+
+func (s emailSink) Send(ctx context.Context, alert Alert) error {
+	subject := "[" + strings.ToUpper(alert.Severity) + "] " + alert.Summary
+	if alert.Resolved {
+		subject = "[RESOLVED] " + alert.Summary
+	}
+	message := "From: " + s.from + "\r\n" +
+		"To: " + strings.Join(s.to, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n\r\n" +
+		alert.Summary + "\r\n"
+	return smtp.SendMail(s.addr, nil, s.from, s.to, []byte(message))
+}
+
+// The function returns the alerting services configured by the operator.
+func alertSinks() []AlertSink {
+	var sinks []AlertSink
+	if config.AlertPagerDutyKey != "" {
+		sinks = append(sinks, pagerDutySink{routingKey: config.AlertPagerDutyKey})
+	}
+	if config.AlertOpsgenieKey != "" {
+		sinks = append(sinks, opsgenieSink{apiKey: config.AlertOpsgenieKey})
+	}
+	if config.AlertSMTPAddr != "" && len(config.AlertEmailTo) > 0 {
+		sinks = append(sinks, emailSink{addr: config.AlertSMTPAddr, from: config.AlertEmailFrom, to: config.AlertEmailTo})
+	}
+	return sinks
+}
+
+// alertMonitor checks the health of the shortener and keeps track of which alerts are firing.
+type alertMonitor struct {
+	sinks         []AlertSink
+	firing        map[string]bool
+	redisFailures int
+}
+
+func newAlertMonitor(sinks []AlertSink) *alertMonitor {
+	return &alertMonitor{sinks: sinks, firing: map[string]bool{}}
+}
+
+// The function triggers or resolves an alert when its state changes.
+func (m *alertMonitor) update(ctx context.Context, alert Alert, firing bool) {
+	if m.firing[alert.Key] == firing {
+		return
+	}
+	m.firing[alert.Key] = firing
+	alert.Resolved = !firing
+	for _, sink := range m.sinks {
+		if err := sink.Send(ctx, alert); err != nil {
+			log.Printf("alerts: %s: %v", sink.Name(), err)
+		}
+	}
+}
+
+// The `check` function runs the health checks against their thresholds: Redis failing several pings
+// in a row, a backlog of redirect saves piling up, and a spike of links flagged as malicious.
+func (m *alertMonitor) check(ctx context.Context, rdb *redis.Client) {
+	opCtx, cancel := readContext(ctx)
+	err := rdb.Ping(opCtx).Err()
+	cancel()
+	if err != nil {
+		m.redisFailures++
+	} else {
+		m.redisFailures = 0
+	}
+	m.update(ctx, Alert{
+		Key:      "redis_down",
+		Summary:  "Redis is unreachable: " + strconv.Itoa(m.redisFailures) + " failed checks in a row",
+		Severity: "critical",
+	}, m.redisFailures >= config.AlertRedisFailures)
+
+	backlog := pendingSaves.Load()
+	m.update(ctx, Alert{
+		Key:      "save_backlog",
+		Summary:  strconv.FormatInt(backlog, 10) + " redirect saves are waiting for Redis",
+		Severity: "warning",
+	}, backlog >= int64(config.AlertSaveBacklog))
+
+	flagged := flaggedLinks.Swap(0)
+	m.update(ctx, Alert{
+		Key:      "abuse_spike",
+		Summary:  strconv.FormatInt(flagged, 10) + " links were flagged as malicious in the last " + config.AlertInterval.String(),
+		Severity: "warning",
+	}, flagged >= int64(config.AlertAbuseThreshold))
+}
+
+// The function runs the alert checks at the configured interval for the lifetime of the process.
+func runAlertJob(rdb *redis.Client, sinks []AlertSink) {
+	monitor := newAlertMonitor(sinks)
+	ticker := time.NewTicker(config.AlertInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		monitor.check(context.Background(), rdb)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	alerts []Alert
+}
+
+func (*recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(ctx context.Context, alert Alert) error {
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func TestAlertMonitor(t *testing.T) {
+	previous := config
+	config.AlertRedisFailures = 2
+	config.AlertSaveBacklog = 1000
+	config.AlertAbuseThreshold = 3
+	defer func() { config = previous }()
+
+	sink := &recordingSink{}
+	monitor := newAlertMonitor([]AlertSink{sink})
+	down := redis.NewClient(&redis.Options{Addr: "localhost:1"})
+	defer down.Close()
+
+	// The first failure stays below the threshold, the second triggers the alert once
+	monitor.check(testCtx, down)
+	assert.Empty(t, sink.alerts)
+	monitor.check(testCtx, down)
+	monitor.check(testCtx, down)
+	if assert.Len(t, sink.alerts, 1) {
+		assert.Equal(t, "redis_down", sink.alerts[0].Key)
+		assert.False(t, sink.alerts[0].Resolved)
+	}
+
+	rdb := setupTestRedis()
+	defer rdb.Close()
+	flaggedLinks.Store(3)
+	monitor.check(testCtx, rdb)
+	assert.Len(t, sink.alerts, 3)
+	assert.Equal(t, Alert{Key: "redis_down", Summary: sink.alerts[1].Summary, Severity: "critical", Resolved: true}, sink.alerts[1])
+	assert.Equal(t, "abuse_spike", sink.alerts[2].Key)
+
+	// The flag count starts over with every check
+	monitor.check(testCtx, rdb)
+	if assert.Len(t, sink.alerts, 4) {
+		assert.Equal(t, "abuse_spike", sink.alerts[3].Key)
+		assert.True(t, sink.alerts[3].Resolved)
+	}
+}
+
+func TestPagerDutySink(t *testing.T) {
+	var event map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	previous := pagerDutyEventsURL
+	pagerDutyEventsURL = server.URL
+	defer func() { pagerDutyEventsURL = previous }()
+
+	sink := pagerDutySink{routingKey: "routing"}
+	err := sink.Send(testCtx, Alert{Key: "redis_down", Summary: "Redis is unreachable", Severity: "critical"})
+	assert.NoError(t, err)
+	assert.Equal(t, "routing", event["routing_key"])
+	assert.Equal(t, "trigger", event["event_action"])
+	assert.Equal(t, "url-shortener:redis_down", event["dedup_key"])
+
+	assert.NoError(t, sink.Send(testCtx, Alert{Key: "redis_down", Resolved: true}))
+	assert.Equal(t, "resolve", event["event_action"])
+}
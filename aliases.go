@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Besides /:token, links can be resolved under path prefixes (/r/:token) and with a query parameter of
+// the root path (/?t=token), so the shortener can be mounted under a sub-path of an existing site. The
+// functions below keep pages and cookies in the form the link was requested with.
+
+// The function returns the token of the link a request is for: the :token path parameter, or on the
+// root path, the configured query parameter. Emoji tokens are normalized.
+func requestToken(c *gin.Context) string {
+	if token := c.Param("token"); token != "" {
+		return normalizeToken(token)
+	}
+	if config.TokenQueryParam != "" && c.FullPath() == basePath()+"/" {
+		return normalizeToken(c.Query(config.TokenQueryParam))
+	}
+	return ""
+}
+
+// The `linkPath` function returns the address of the link a request is for, relative to the host, in
+// the form the visitor used: "/abc", "/r/abc" or "/?t=abc".
+func linkPath(c *gin.Context) string {
+	if c.Param("token") == "" {
+		return basePath() + "/?" + url.Values{config.TokenQueryParam: {requestToken(c)}}.Encode()
+	}
+	// Escaped, so emoji tokens are valid in cookie paths and form actions
+	if strings.HasSuffix(c.FullPath(), "/:token/challenge") {
+		return strings.TrimSuffix(c.Request.URL.EscapedPath(), "/challenge")
+	}
+	return c.Request.URL.EscapedPath()
+}
+
+// The function adds a query parameter to the address of a link returned by linkPath.
+func linkPathWith(c *gin.Context, name, value string) string {
+	path := linkPath(c)
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + name + "=" + url.QueryEscape(value)
+}
+
+// The function returns the normalized path prefixes links are resolved under, e.g. "/r".
+func tokenPathPrefixes() []string {
+	var prefixes []string
+	for _, prefix := range config.TokenPathPrefixes {
+		if prefix = strings.Trim(prefix, "/"); prefix != "" {
+			prefixes = append(prefixes, "/"+prefix)
+		}
+	}
+	return prefixes
+}
+
+// The `basePath` function returns the normalized path all routes are served under, e.g. "/s", or an
+// empty string when the service is served from the root.
+func basePath() string {
+	if path := strings.Trim(config.BasePath, "/"); path != "" {
+		return "/" + path
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkPath(t *testing.T) {
+	previous := config
+	config.TokenPathPrefixes = []string{"/r/", "go"}
+	config.TokenQueryParam = "t"
+	defer func() { config = previous }()
+	assert.Equal(t, []string{"/r", "/go"}, tokenPathPrefixes())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	echo := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"token": requestToken(c), "path": linkPath(c), "continue": linkPathWith(c, "continue", "1.a")})
+	}
+	router.GET("/:token", echo)
+	router.GET("/r/:token", echo)
+	router.POST("/r/:token/challenge", echo)
+	router.GET("/", echo)
+
+	cases := map[string][3]string{
+		"/abc":          {"abc", "/abc", "/abc?continue=1.a"},
+		"/r/abc":        {"abc", "/r/abc", "/r/abc?continue=1.a"},
+		"/?t=abc&utm=x": {"abc", "/?t=abc", "/?t=abc&continue=1.a"},
+		"/r/challenge":  {"challenge", "/r/challenge", "/r/challenge?continue=1.a"},
+	}
+	for path, expected := range cases {
+		w := performRequest(router, "GET", path, "", nil)
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, expected, [3]string{body["token"], body["path"], body["continue"]}, path)
+	}
+
+	w := performRequest(router, "POST", "/r/abc/challenge", "", nil)
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "/r/abc", body["path"])
+}
+
+func TestLinkAliases(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.TokenPathPrefixes = []string{"/r"}
+	config.TokenQueryParam = "t"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/aliased", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	for _, path := range []string{"/" + created["token"], "/r/" + created["token"], "/?t=" + created["token"]} {
+		w = performRequest(router, "GET", path, "", nil)
+		assert.Equal(t, "https://example.com/aliased", w.Header().Get("Location"), path)
+	}
+	w = performRequest(router, "GET", "/r/"+created["token"]+"/preview", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", "/?t=missing", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestBasePath(t *testing.T) {
+	previous := config
+	config.BasePath = "/s/"
+	config.TokenQueryParam = "t"
+	defer func() { config = previous }()
+	assert.Equal(t, "/s", basePath())
+
+	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+	defer rdb.Close()
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "GET", "/s/ui", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<body data-base="/s">`)
+	assert.Regexp(t, `src="/s/ui/dashboard/app\.[0-9a-f]{8}\.js"`, w.Body.String())
+
+	w = performRequest(router, "GET", "/s/.well-known/share-target", "", nil)
+	assert.Contains(t, w.Body.String(), `"action":"/s/api/v1/share"`)
+
+	w = performRequest(router, "GET", "/ui", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	router = gin.New()
+	router.GET("/s/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"token": requestToken(c), "path": linkPath(c)})
+	})
+	w = performRequest(router, "GET", "/s/?t=abc", "", nil)
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, map[string]string{"token": "abc", "path": "/s/?t=abc"}, body)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// APIKey identifies a client of the API. The secret key is only known to the client and used to look
+// the record up; links and indexes refer to the public ID so the secret never ends up in link records.
+type APIKey struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	// Links created with a trusted key skip the interstitial warning page in "untrusted" mode
+	Trusted bool `json:"trusted"`
+	// Short domain the key is bound to; links created with it always live on this domain
+	Domain string `json:"domain,omitempty"`
+	// Data residency region the key's workspace is pinned to, empty for the home region
+	Region string `json:"region,omitempty"`
+	// Keys for semi-trusted clients must sign their requests instead of sending the secret
+	SignedOnly bool `json:"signed_only,omitempty"`
+	// Tier of LINK_POLICIES whose defaults and caps apply to the key's links, the deployment's if empty
+	Tier string `json:"tier,omitempty"`
+	// Quotas of the key, overriding QUOTA_LINKS_PER_DAY and QUOTA_ACTIVE_LINKS when set; -1 is no limit
+	MaxLinksPerDay int `json:"max_links_per_day,omitempty"`
+	MaxActiveLinks int `json:"max_active_links,omitempty"`
+	// Where the digest of the key's links nearing expiry is sent, if anywhere
+	DigestWebhookURL string `json:"digest_webhook_url,omitempty"`
+	DigestEmail      string `json:"digest_email,omitempty"`
+	// Set for the read-only keys standing in for impersonation tokens, never stored
+	Impersonated bool `json:"-"`
+	// The secret the request was authenticated with, never stored
+	secret string
+}
+
+const apiKeyHeader = "X-API-Key"
+
+func apiKeyRedisKey(secret string) string {
+	return "apikey:" + secret
+}
+
+func randomHex(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The operator's admin key acts as a trusted API key of its own
+var adminAPIKey = APIKey{ID: "admin", Name: "admin", Trusted: true}
+
+func isAdminKey(secret string) bool {
+	return config.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(config.AdminAPIKey)) == 1
+}
+
+// The `authenticate` function resolves the API key sent with the request, if any. It returns nil when
+// no key was sent, so anonymous use keeps working. When an unknown key is sent, or the key can't be
+// checked, it responds with an error and aborts the request. The key is kept in the request's
+// context, so later handlers and the audit log don't resolve it again.
+func authenticate(c *gin.Context, rdb *redis.Client) (*APIKey, bool) {
+	if key, ok := c.Get(apiKeyContextKey); ok {
+		return key.(*APIKey), true
+	}
+	key, ok := resolveAPIKey(c, rdb)
+	if ok && key != nil {
+		c.Set(apiKeyContextKey, key)
+	}
+	return key, ok
+}
+
+func resolveAPIKey(c *gin.Context, rdb *redis.Client) (*APIKey, bool) {
+	if c.GetHeader(keyIDHeader) != "" {
+		return authenticateSigned(c, rdb)
+	}
+	if token, ok := bearerToken(c); ok {
+		return authenticateBearer(c, token)
+	}
+	secret := c.GetHeader(apiKeyHeader)
+	if secret == "" {
+		return nil, true
+	}
+	if isAdminKey(secret) {
+		return &adminAPIKey, true
+	}
+	if strings.HasPrefix(secret, impersonationPrefix) {
+		return authenticateImpersonation(c, secret)
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := rdb.Get(opCtx, apiKeyRedisKey(secret)).Result()
+	if err == redis.Nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid API key"})
+		return nil, false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return nil, false
+	}
+
+	var key APIKey
+	if err := json.Unmarshal([]byte(val), &key); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Error parsing JSON"})
+		return nil, false
+	}
+	if key.SignedOnly {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "This API key must sign its requests"})
+		return nil, false
+	}
+	key.secret = secret
+	return &key, true
+}
+
+// The function is like authenticate, but anonymous requests are rejected as well.
+func requireAPIKey(c *gin.Context, rdb *redis.Client) (*APIKey, bool) {
+	key, ok := authenticate(c, rdb)
+	if ok && key == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "API key required"})
+		return nil, false
+	}
+	return key, ok
+}
+
+// The function reports whether the key may manage a resource owned by owner. The admin key may
+// manage everything.
+func (k *APIKey) owns(owner string) bool {
+	return k != nil && (k.ID == adminAPIKey.ID || k.ID == owner)
+}
+
+// The `adminOnly` middleware only lets through requests carrying the operator's admin key. The admin API
+// is disabled entirely when no admin key is configured.
+func adminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdminKey(c.GetHeader(apiKeyHeader)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Admin API key required"})
+			return
+		}
+		c.Set(apiKeyContextKey, &adminAPIKey)
+		c.Next()
+	}
+}
+
+// The `createAPIKeyHandler` function mints a new API key for a client. The secret is returned once and
+// can't be retrieved afterwards.
+func createAPIKeyHandler(c *gin.Context, rdb *redis.Client) {
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing name parameter"})
+		return
+	}
+
+	key := APIKey{
+		ID:         "key_" + randomHex(6),
+		Name:       name,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Trusted:    c.PostForm("trusted") == "true",
+		SignedOnly: c.PostForm("signed_only") == "true",
+		Domain:     strings.ToLower(c.PostForm("domain")),
+		Region:     c.PostForm("region"),
+		Tier:       c.PostForm("tier"),
+
+		DigestWebhookURL: c.PostForm("digest_webhook_url"),
+		DigestEmail:      c.PostForm("digest_email"),
+	}
+	if _, ok := config.Domains[key.Domain]; key.Domain != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid domain parameter"})
+		return
+	}
+	if _, ok := config.Regions[key.Region]; key.Region != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid region parameter"})
+		return
+	}
+	if _, ok := config.LinkPolicies[key.Tier]; key.Tier != "" && (!ok || key.Tier == anonymousTier) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid tier parameter"})
+		return
+	}
+	if u, err := url.Parse(key.DigestWebhookURL); key.DigestWebhookURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid digest_webhook_url parameter"})
+		return
+	}
+	if _, err := mail.ParseAddress(key.DigestEmail); key.DigestEmail != "" && err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid digest_email parameter"})
+		return
+	}
+	var err error
+	if key.MaxLinksPerDay, err = strconv.Atoi(c.DefaultPostForm("max_links_per_day", "0")); err != nil || key.MaxLinksPerDay < -1 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_links_per_day parameter"})
+		return
+	}
+	if key.MaxActiveLinks, err = strconv.Atoi(c.DefaultPostForm("max_active_links", "0")); err != nil || key.MaxActiveLinks < -1 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_active_links parameter"})
+		return
+	}
+	secret := randomHex(24)
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	_, err = rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		pipe.Set(opCtx, apiKeyRedisKey(secret), data, 0)
+		pipe.Set(opCtx, apiKeyIDKey(key.ID), secret, 0)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	c.Set(auditTargetKey, key.ID)
+	c.JSON(http.StatusOK, gin.H{"id": key.ID, "name": key.Name, "trusted": key.Trusted, "domain": key.Domain, "region": key.Region, "tier": key.Tier, "signed_only": key.SignedOnly, "max_links_per_day": key.MaxLinksPerDay, "max_active_links": key.MaxActiveLinks, "digest_webhook_url": key.DigestWebhookURL, "digest_email": key.DigestEmail, "key": secret})
+}
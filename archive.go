@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkArchive keeps the final record and statistics of links that are gone, for auditing and
+// reporting after their data has left Redis.
+type LinkArchive interface {
+	Append(entry ArchivedLink) error
+	Close() error
+}
+
+// ArchivedLink is the entry archived when a link expires or is removed.
+type ArchivedLink struct {
+	Key string `json:"key"`
+	// "expired", "max_access_reached", "consumed" (one-time links), "deleted" or "rejected" (screening)
+	Reason     string      `json:"reason"`
+	ArchivedAt string      `json:"archived_at"`
+	Link       URL         `json:"link"`
+	Summary    LinkSummary `json:"summary"`
+}
+
+// The archive in use, nil when archiving is disabled.
+var linkArchive LinkArchive
+
+// Counters of the archive, published at /debug/vars
+var archiveStats = expvar.NewMap("archive")
+
+// fileArchive appends archived links to a local file, one JSON object per line. Files are never
+// rewritten, so they can be shipped to object storage with the usual log tooling.
+type fileArchive struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openFileArchive(path string) (*fileArchive, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileArchive{file: file}, nil
+}
+
+func (a *fileArchive) Append(entry ArchivedLink) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+func (a *fileArchive) Close() error {
+	return a.file.Close()
+}
+
+// Links by expiry time, so the archive job finds the links about to expire without a scan
+const archiveExpiringKey = "archive:expiring"
+
+// Redis expires links silently, so the archive job copies links shortly before they expire and
+// archives the copy once the link is gone.
+func archiveSnapshotKey(key string) string {
+	return "archive:snapshot:" + key
+}
+
+// The `trackExpiry` function is called when a link is created, so it is archived once it expires.
+func trackExpiry(ctx context.Context, rdb redis.Cmdable, urlEntry URL) {
+	if linkArchive == nil {
+		return
+	}
+	rdb.ZAdd(ctx, archiveExpiringKey, redis.Z{Score: float64(urlEntry.expiry().Unix()), Member: urlEntry.key()})
+}
+
+// The `archiveLink` function archives a link along with the summary of its clicks. It is called before
+// the click log of the link is deleted. Errors are logged, they don't fail the removal of the link.
+func archiveLink(ctx context.Context, rdb *redis.Client, urlEntry URL, reason string) {
+	if linkArchive == nil {
+		return
+	}
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	summary, err := summarizeLink(opCtx, rdb, urlEntry)
+	if err != nil {
+		log.Printf("archive: summarizing %s: %v", urlEntry.key(), err)
+	}
+	err = linkArchive.Append(ArchivedLink{
+		Key:        urlEntry.key(),
+		Reason:     reason,
+		ArchivedAt: time.Now().UTC().Format(time.RFC3339),
+		Link:       urlEntry,
+		Summary:    summary,
+	})
+	if err != nil {
+		archiveStats.Add("errors", 1)
+		log.Printf("archive: %s: %v", urlEntry.key(), err)
+		return
+	}
+	archiveStats.Add("archived", 1)
+	rdb.ZRem(ctx, archiveExpiringKey, urlEntry.key())
+	rdb.Del(ctx, archiveSnapshotKey(urlEntry.key()))
+}
+
+// The function reads the stored record of a link, in Redis or in cold storage, without moving it back
+// into Redis.
+func peekLink(ctx context.Context, rdb *redis.Client, key string) (string, error) {
+	val, err := rdb.Get(ctx, key).Result()
+	if err != redis.Nil || coldStore == nil {
+		return val, err
+	}
+	record, _, err := coldStore.Get(key)
+	if err != nil {
+		return "", redis.Nil
+	}
+	return string(record), nil
+}
+
+// The `archiveExpiredLinks` function snapshots the links expiring before the next run and archives
+// the snapshots of links that have expired since. Clicks made after the last snapshot are only in the
+// click summary, not in the access count of the archived record.
+func archiveExpiredLinks(ctx context.Context, rdb *redis.Client, now time.Time) (int, error) {
+	lead := 2 * config.ArchiveInterval
+	keys, err := rdb.ZRangeByScore(ctx, archiveExpiringKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Add(lead).Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	for _, key := range keys {
+		val, err := peekLink(ctx, rdb, key)
+		if err != nil && err != redis.Nil {
+			return archived, err
+		}
+		if err == nil {
+			var urlEntry URL
+			json.Unmarshal([]byte(val), &urlEntry)
+			// Links whose lifetime was extended are tracked with their new expiry
+			if urlEntry.expiry().After(now.Add(lead)) {
+				trackExpiry(ctx, rdb, urlEntry)
+				continue
+			}
+			rdb.Set(ctx, archiveSnapshotKey(key), val, time.Until(urlEntry.expiry())+2*lead)
+			continue
+		}
+
+		snapshot, err := rdb.Get(ctx, archiveSnapshotKey(key)).Result()
+		if err == redis.Nil {
+			// Removed without being archived, e.g. with its account
+			rdb.ZRem(ctx, archiveExpiringKey, key)
+			continue
+		}
+		if err != nil {
+			return archived, err
+		}
+		// Runs archive at most ReaperBatchSize links, the others keep their snapshot until the next run
+		if config.ReaperBatchSize > 0 && archived >= config.ReaperBatchSize {
+			rdb.Expire(ctx, archiveSnapshotKey(key), 2*lead)
+			archiveStats.Add("deferred", 1)
+			continue
+		}
+		// Another instance may be archiving the link as well, only the one removing it from the set does
+		if removed, err := rdb.ZRem(ctx, archiveExpiringKey, key).Result(); err != nil || removed == 0 {
+			continue
+		}
+		var urlEntry URL
+		json.Unmarshal([]byte(snapshot), &urlEntry)
+		archiveLink(ctx, rdb, urlEntry, "expired")
+		archived++
+	}
+	return archived, nil
+}
+
+// The function runs archiveExpiredLinks at the configured interval for the lifetime of the process.
+func runArchiveJob(rdb *redis.Client) {
+	staggerStart(config.ArchiveInterval)
+	ticker := time.NewTicker(config.ArchiveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := archiveExpiredLinks(context.Background(), rdb, time.Now()); err != nil {
+			log.Printf("archive: %v", err)
+		}
+	}
+}
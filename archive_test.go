@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func readArchive(t *testing.T, path string) []ArchivedLink {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var entries []ArchivedLink
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry ArchivedLink
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestArchive(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+	rdb.Del(testCtx, archiveExpiringKey)
+
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	archive, err := openFileArchive(path)
+	assert.NoError(t, err)
+	defer archive.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.ArchiveInterval = time.Minute
+	linkArchive = archive
+	defer func() { config, linkArchive = previous, nil }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+	create := func(form string) string {
+		var created map[string]string
+		w := performRequest(router, "POST", "/create", form, nil)
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+
+	expiring := create("long_url=https://example.com/expiring&max_age=60")
+	lasting := create("long_url=https://example.com/lasting")
+	performRequest(router, "GET", "/"+expiring, "", nil)
+	time.Sleep(50 * time.Millisecond)
+
+	// Links expiring before the next run are copied, the others are left alone
+	archived, err := archiveExpiredLinks(testCtx, rdb, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, archived)
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, archiveSnapshotKey(expiring)).Val())
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, archiveSnapshotKey(lasting)).Val())
+
+	// Once the link has expired the copy is archived, and its clicks outlive it until then
+	rdb.Del(testCtx, expiring)
+	exists, _ := linkExists(testCtx, rdb, expiring)
+	assert.True(t, exists)
+	archived, err = archiveExpiredLinks(testCtx, rdb, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archived)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, archiveSnapshotKey(expiring)).Val())
+	archived, _ = archiveExpiredLinks(testCtx, rdb, time.Now())
+	assert.Equal(t, 0, archived)
+
+	w := performRequest(router, "DELETE", "/api/urls/"+lasting, "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	entries := readArchive(t, path)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "expired", entries[0].Reason)
+	assert.Equal(t, "https://example.com/expiring", entries[0].Link.LongURL)
+	assert.Equal(t, 1, entries[0].Link.CurrentAccessCount)
+	assert.Equal(t, 1, entries[0].Summary.TotalClicks)
+	assert.Equal(t, "deleted", entries[1].Reason)
+	assert.Equal(t, lasting, entries[1].Link.Token)
+	assert.Zero(t, rdb.ZCard(testCtx, archiveExpiringKey).Val())
+}
+
+func TestArchiveBatchSize(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+	rdb.Del(testCtx, archiveExpiringKey)
+
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	archive, err := openFileArchive(path)
+	assert.NoError(t, err)
+	defer archive.Close()
+
+	previous := config
+	config.ArchiveInterval = time.Minute
+	config.ReaperBatchSize = 2
+	linkArchive = archive
+	defer func() { config, linkArchive = previous, nil }()
+
+	// Three links that expired at the same time
+	for _, token := range []string{"batch1", "batch2", "batch3"} {
+		urlEntry := URL{Token: token, LongURL: "https://example.com/" + token, ExpiresAt: time.Now().Add(-time.Second).Format(time.RFC3339)}
+		data, _ := json.Marshal(urlEntry)
+		rdb.Set(testCtx, archiveSnapshotKey(urlEntry.key()), data, time.Hour)
+		trackExpiry(testCtx, rdb, urlEntry)
+	}
+
+	archived, err := archiveExpiredLinks(testCtx, rdb, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, archived)
+	archived, err = archiveExpiredLinks(testCtx, rdb, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archived)
+	assert.Len(t, readArchive(t, path), 3)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Administrative actions, the creation, editing, disabling and deletion of links and the operator's
+// changes to keys and exemptions, are appended to an audit stream in the home Redis, capped at
+// AUDIT_MAX_LEN entries, and with AUDIT_LOG_PATH also to a file.
+const auditStreamKey = "audit:log"
+
+// AuditEntry is an administrative action: who did what to which resource, when and from where.
+type AuditEntry struct {
+	// Position of the entry in the audit stream
+	ID string `json:"id"`
+	At string `json:"at"`
+	// e.g. "link.create", "link.update", "link.disable", "link.delete", "key.create"
+	Action string `json:"action"`
+	// ID of the API key that did it, "admin" for the admin key, "anonymous" without a key
+	Actor string `json:"actor"`
+	IP    string `json:"ip"`
+	// The link key, API key ID or exemption acted on, if any
+	Target string `json:"target,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+}
+
+// Where handlers put the resource they acted on, when it isn't the link of the route, and the action,
+// when it depends on the request
+const (
+	auditTargetKey = "audit_target"
+	auditActionKey = "audit_action"
+)
+
+// auditFile appends audit entries to a local file, one JSON object per line, like the link archive.
+type auditFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// The audit file in use, nil when entries only go to Redis
+var auditLog *auditFile
+
+func openAuditFile(path string) (*auditFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditFile{file: file}, nil
+}
+
+func (a *auditFile) Append(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+func (a *auditFile) Close() error {
+	return a.file.Close()
+}
+
+// The `audit` middleware records a successful request of an audited route as the given action, after
+// the handler has run. Failed requests changed nothing and aren't recorded.
+func audit(rdb *redis.Client, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest || (config.AuditMaxLen <= 0 && auditLog == nil) {
+			return
+		}
+		entry := AuditEntry{
+			At:     time.Now().UTC().Format(time.RFC3339),
+			Action: c.GetString(auditActionKey),
+			Actor:  "anonymous",
+			IP:     c.ClientIP(),
+			Target: c.GetString(auditTargetKey),
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Status: c.Writer.Status(),
+		}
+		if entry.Action == "" {
+			entry.Action = action
+		}
+		if key, ok := c.Get(apiKeyContextKey); ok {
+			entry.Actor = key.(*APIKey).ID
+		}
+		if token := c.Param("token"); entry.Target == "" && token != "" {
+			entry.Target = linkKey(strings.ToLower(c.Query("domain")), token)
+		}
+		recordAudit(context.WithoutCancel(c.Request.Context()), rdb, entry)
+	}
+}
+
+// The function appends an entry to the audit stream and the audit file. Failures are logged, the
+// action has already happened.
+func recordAudit(ctx context.Context, rdb *redis.Client, entry AuditEntry) {
+	if config.AuditMaxLen > 0 {
+		opCtx, cancel := writeContext(ctx)
+		defer cancel()
+		err := rdb.XAdd(opCtx, &redis.XAddArgs{
+			Stream: auditStreamKey,
+			MaxLen: int64(config.AuditMaxLen),
+			Approx: true,
+			Values: map[string]interface{}{
+				"action": entry.Action,
+				"actor":  entry.Actor,
+				"ip":     entry.IP,
+				"target": entry.Target,
+				"method": entry.Method,
+				"path":   entry.Path,
+				"status": entry.Status,
+			},
+		}).Err()
+		if err != nil {
+			log.Printf("audit: %s %s: %v", entry.Action, entry.Target, err)
+		}
+	}
+	if auditLog != nil {
+		if err := auditLog.Append(entry); err != nil {
+			log.Printf("audit: %v", err)
+		}
+	}
+}
+
+func auditEntryFrom(message redis.XMessage) AuditEntry {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+	status, _ := strconv.Atoi(field("status"))
+	return AuditEntry{
+		ID:     message.ID,
+		At:     eventTime(message.ID).UTC().Format(time.RFC3339),
+		Action: field("action"),
+		Actor:  field("actor"),
+		IP:     field("ip"),
+		Target: field("target"),
+		Method: field("method"),
+		Path:   field("path"),
+		Status: status,
+	}
+}
+
+// The `auditLogHandler` function returns the audit stream, newest first, optionally filtered by
+// `action`, `actor` and `target` and limited to the time range `from`-`to` (RFC 3339). Results are
+// paged with `limit` and the `next_cursor` of the previous page.
+func auditLogHandler(c *gin.Context, rdb *redis.Client) {
+	start, end := "-", "+"
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from parameter, expected an RFC 3339 time"})
+			return
+		}
+		start = strconv.FormatInt(from.UnixMilli(), 10)
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid to parameter, expected an RFC 3339 time"})
+			return
+		}
+		end = strconv.FormatInt(to.UnixMilli(), 10)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		end = "(" + cursor
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit parameter, expected 1 to 1000"})
+		return
+	}
+	action, actor, target := c.Query("action"), c.Query("actor"), c.Query("target")
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	entries := []AuditEntry{}
+	nextCursor := ""
+	// Filtered entries are read in batches until a page is full or the range is exhausted
+	for len(entries) < limit {
+		messages, err := rdb.XRevRangeN(opCtx, auditStreamKey, end, start, int64(limit)).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		for _, message := range messages {
+			entry := auditEntryFrom(message)
+			if (action != "" && entry.Action != action) || (actor != "" && entry.Actor != actor) || (target != "" && entry.Target != target) {
+				continue
+			}
+			entries = append(entries, entry)
+			if len(entries) == limit {
+				nextCursor = entry.ID
+				break
+			}
+		}
+		if len(messages) < limit || nextCursor != "" {
+			break
+		}
+		end = "(" + messages[len(messages)-1].ID
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "next_cursor": nextCursor})
+}
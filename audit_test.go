@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var apiKey struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=audited", admin)
+	json.Unmarshal(w.Body.Bytes(), &apiKey)
+	owner := map[string]string{apiKeyHeader: apiKey.Key}
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/audited", owner)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := "/api/urls/" + created["token"]
+
+	performRequest(router, "PATCH", path, "title=Audited", owner)
+	// Failed requests aren't recorded
+	performRequest(router, "PATCH", path, "max_access=-5", owner)
+	performRequest(router, "DELETE", path, "", admin)
+
+	w = performRequest(router, "GET", "/api/admin/audit", "", owner)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var page struct {
+		Entries    []AuditEntry `json:"entries"`
+		NextCursor string       `json:"next_cursor"`
+	}
+	w = performRequest(router, "GET", "/api/admin/audit", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if assert.Len(t, page.Entries, 4) {
+		assert.Equal(t, "link.delete", page.Entries[0].Action)
+		assert.Equal(t, "admin", page.Entries[0].Actor)
+		assert.Equal(t, created["token"], page.Entries[0].Target)
+		assert.Equal(t, "link.update", page.Entries[1].Action)
+		assert.Equal(t, apiKey.ID, page.Entries[1].Actor)
+		assert.Equal(t, "link.create", page.Entries[2].Action)
+		assert.Equal(t, created["token"], page.Entries[2].Target)
+		assert.Equal(t, "key.create", page.Entries[3].Action)
+		assert.Equal(t, apiKey.ID, page.Entries[3].Target)
+	}
+
+	w = performRequest(router, "GET", "/api/admin/audit?actor="+apiKey.ID, "", admin)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Len(t, page.Entries, 2)
+
+	// Pages continue after the cursor of the previous one
+	w = performRequest(router, "GET", "/api/admin/audit?limit=3", "", admin)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Len(t, page.Entries, 3)
+	if assert.NotEmpty(t, page.NextCursor) {
+		w = performRequest(router, "GET", "/api/admin/audit?limit=3&cursor="+page.NextCursor, "", admin)
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if assert.Len(t, page.Entries, 1) {
+			assert.Equal(t, "key.create", page.Entries[0].Action)
+		}
+	}
+
+	w = performRequest(router, "GET", "/api/admin/audit?from=yesterday", "", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuditFile(t *testing.T) {
+	previous, previousLog := config, auditLog
+	config.AuditMaxLen = 0
+	defer func() { config, auditLog = previous, previousLog }()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := openAuditFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	auditLog = file
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/urls/:token/freeze", audit(nil, "link.freeze"), func(c *gin.Context) {
+		if c.PostForm("disable") == "true" {
+			c.Set(auditActionKey, "link.disable")
+		}
+		c.Status(http.StatusOK)
+	})
+	router.POST("/fail", audit(nil, "link.create"), func(c *gin.Context) {
+		c.Status(http.StatusBadRequest)
+	})
+
+	performRequest(router, "POST", "/api/urls/abc/freeze?domain=Go.Example.com", "disable=true", nil)
+	performRequest(router, "POST", "/fail", "", nil)
+
+	data, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer data.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		var entry AuditEntry
+		json.Unmarshal(scanner.Bytes(), &entry)
+		entries = append(entries, entry)
+	}
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "link.disable", entries[0].Action)
+		assert.Equal(t, "anonymous", entries[0].Actor)
+		assert.Equal(t, linkKey("go.example.com", "abc"), entries[0].Target)
+		assert.Equal(t, http.StatusOK, entries[0].Status)
+	}
+}
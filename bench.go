@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// benchOptions are the settings of a load test against a running instance.
+type benchOptions struct {
+	server      string
+	key         string
+	concurrency int
+	duration    time.Duration
+	maxP99      time.Duration
+}
+
+// benchResult holds the latencies of the requests of one operation of a load test.
+type benchResult struct {
+	name      string
+	latencies []time.Duration
+	errors    int
+	elapsed   time.Duration
+}
+
+// The function returns the latency that the given share of requests (0 to 1) didn't exceed.
+func (r *benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(p*float64(len(r.latencies)-1))]
+}
+
+// The `benchLoad` function calls op from concurrency workers until duration has passed, and records
+// the latency of every successful call.
+func benchLoad(name string, opts benchOptions, op func(worker, i int) error) *benchResult {
+	result := &benchResult{name: name}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(opts.duration)
+	for worker := 0; worker < opts.concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var latencies []time.Duration
+			failures := 0
+			for i := 0; time.Now().Before(deadline); i++ {
+				began := time.Now()
+				if err := op(worker, i); err != nil {
+					failures++
+					continue
+				}
+				latencies = append(latencies, time.Since(began))
+			}
+			mu.Lock()
+			result.latencies = append(result.latencies, latencies...)
+			result.errors += failures
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	result.elapsed = time.Since(start)
+	slices.Sort(result.latencies)
+	return result
+}
+
+// The function sends a request and drains the response, so the connection is reused.
+func benchRequest(client *http.Client, req *http.Request, key string) (*http.Response, []byte, error) {
+	if key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// The `runBench` function load tests the create and redirect paths of an instance, one after the
+// other, and writes the throughput and latency percentiles of each to out. Redirects are measured on
+// the links created in the first phase. It fails when an operation's p99 exceeds opts.maxP99.
+func runBench(opts benchOptions, out io.Writer) error {
+	server := strings.TrimSuffix(opts.server, "/")
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.concurrency},
+		// Redirects are what's measured, not followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var mu sync.Mutex
+	var tokens []string
+	create := benchLoad("create", opts, func(worker, i int) error {
+		form := url.Values{"long_url": {fmt.Sprintf("https://example.com/bench/%d/%d", worker, i)}}
+		req, _ := http.NewRequest(http.MethodPost, server+"/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, body, err := benchRequest(client, req, opts.key)
+		if err != nil {
+			return err
+		}
+		var created struct {
+			Token string `json:"token"`
+		}
+		if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &created) != nil {
+			return errors.New(resp.Status)
+		}
+		mu.Lock()
+		tokens = append(tokens, created.Token)
+		mu.Unlock()
+		return nil
+	})
+	if len(tokens) == 0 {
+		return errors.New("no links could be created, is the instance running and the API key valid?")
+	}
+
+	redirect := benchLoad("redirect", opts, func(worker, i int) error {
+		token := tokens[(worker*7919+i)%len(tokens)]
+		req, _ := http.NewRequest(http.MethodGet, server+"/"+token, nil)
+		resp, _, err := benchRequest(client, req, "")
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 400 {
+			return errors.New(resp.Status)
+		}
+		return nil
+	})
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "OPERATION\tREQUESTS\tERRORS\tREQ/S\tP50\tP90\tP99\tMAX")
+	var slow []string
+	for _, result := range []*benchResult{create, redirect} {
+		rate := float64(len(result.latencies)) / result.elapsed.Seconds()
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.0f\t%v\t%v\t%v\t%v\n", result.name, len(result.latencies), result.errors, rate,
+			result.percentile(0.5), result.percentile(0.9), result.percentile(0.99), result.percentile(1))
+		if opts.maxP99 > 0 && result.percentile(0.99) > opts.maxP99 {
+			slow = append(slow, result.name)
+		}
+	}
+	table.Flush()
+	if len(slow) > 0 {
+		return fmt.Errorf("p99 latency of %s above %v", strings.Join(slow, " and "), opts.maxP99)
+	}
+	return nil
+}
+
+// The `benchMain` function runs the bench command, a load test of a running instance for measuring
+// performance regressions.
+func benchMain(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	server := flags.String("server", "http://localhost:8080", "address of the running instance")
+	key := flags.String("key", os.Getenv("API_KEY"), "API key links are created with (defaults to $API_KEY, anonymous if empty)")
+	concurrency := flags.Int("concurrency", 16, "number of concurrent requests")
+	duration := flags.Duration("duration", 10*time.Second, "duration of each phase")
+	maxP99 := flags.Duration("max-p99", 0, "fail when the p99 latency of an operation exceeds this")
+	flags.Parse(args)
+
+	if *concurrency < 1 || *duration <= 0 {
+		return errors.New("-concurrency and -duration must be positive")
+	}
+	return runBench(benchOptions{server: *server, key: *key, concurrency: *concurrency, duration: *duration, maxP99: *maxP99}, os.Stdout)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBench(t *testing.T) {
+	var created atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/create" {
+			fmt.Fprintf(w, `{"token":"t%d"}`, created.Add(1))
+			return
+		}
+		http.Redirect(w, r, "https://example.com/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	opts := benchOptions{server: server.URL, concurrency: 2, duration: 50 * time.Millisecond}
+	assert.NoError(t, runBench(opts, &out))
+	assert.Contains(t, out.String(), "P99")
+	assert.Contains(t, out.String(), "create")
+	assert.Contains(t, out.String(), "redirect")
+
+	// Regressions beyond the latency budget fail the run
+	opts.maxP99 = time.Nanosecond
+	assert.Error(t, runBench(opts, &out))
+
+	result := &benchResult{latencies: []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+	assert.Equal(t, time.Duration(5), result.percentile(0.5))
+	assert.Equal(t, time.Duration(10), result.percentile(1))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// User agents of link unfurlers, crawlers and command-line clients, matched case-insensitively as
+// substrings. BOT_USER_AGENTS replaces the list.
+var defaultBotUserAgents = []string{
+	"slackbot", "twitterbot", "facebookexternalhit", "facebot", "linkedinbot", "discordbot",
+	"telegrambot", "whatsapp", "skypeuripreview", "googlebot", "bingbot", "applebot", "bot/", "crawler",
+	"spider", "curl/", "wget/", "python-requests", "go-http-client",
+}
+
+var botPreviewTemplate = template.Must(template.New("bot-preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<meta property="og:type" content="website">
+<meta property="og:url" content="{{.ShortURL}}">
+<meta property="og:title" content="{{.DisplayURL}}">
+<meta property="og:description" content="Short link to {{.DisplayURL}}">
+<meta name="twitter:card" content="summary">
+<title>{{.DisplayURL}}</title>
+</head>
+<body>
+<p>Short link to <a href="{{.ShortURL}}">{{.DisplayURL}}</a></p>
+</body>
+</html>
+`))
+
+// The function reports whether a request comes from a bot, going by its user agent.
+func isBot(c *gin.Context) bool {
+	agent := strings.ToLower(c.Request.UserAgent())
+	if agent == "" {
+		return false
+	}
+	for _, bot := range config.BotUserAgents {
+		if strings.Contains(agent, strings.ToLower(bot)) {
+			return true
+		}
+	}
+	return false
+}
+
+// The `serveBotPreview` function answers a bot with a page carrying Open Graph tags about the link
+// instead of the redirect, so unfurlers can render a card without visiting the destination.
+func serveBotPreview(c *gin.Context, urlEntry URL) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	botPreviewTemplate.Execute(c.Writer, gin.H{
+		"ShortURL":   shortURLFor(c, urlEntry),
+		"DisplayURL": displayURL(urlEntry.LongURL),
+	})
+}
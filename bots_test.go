@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotFiltering(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	previous := config
+	defer func() { config = previous }()
+
+	create := func() string {
+		w := performRequest(router, "POST", "/create", "long_url=https://example.com/page&one_time=true", nil)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+	slack := map[string]string{"User-Agent": "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"}
+
+	// Unfurlers don't consume one-time links
+	config.BotMode = "ignore"
+	token := create()
+	w := performRequest(router, "GET", "/"+token, "", slack)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, token).Val())
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, clickLogKey(token)).Val())
+
+	config.BotMode = "preview"
+	w = performRequest(router, "GET", "/"+token, "", slack)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<meta property="og:title" content="https://example.com/page">`)
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, token).Val())
+
+	// People still use it up
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"})
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, token).Val())
+
+	config.BotMode = "count"
+	token = create()
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{"User-Agent": "curl/8.5.0"})
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, token).Val())
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestIsBot(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	for agent, bot := range map[string]bool{
+		"facebookexternalhit/1.1":                  true,
+		"Mozilla/5.0 (compatible; Twitterbot/1.0)": true,
+		"curl/8.5.0": true,
+		"Mozilla/5.0 (Macintosh) Safari/605.1.15": false,
+		"": false,
+	} {
+		c, _ := gin.CreateTestContext(nil)
+		c.Request, _ = http.NewRequest("GET", "/abc", nil)
+		c.Request.Header.Set("User-Agent", agent)
+		assert.Equal(t, bot, isBot(c), agent)
+	}
+
+	config.BotUserAgents = []string{"MyChecker"}
+	c, _ := gin.CreateTestContext(nil)
+	c.Request, _ = http.NewRequest("GET", "/abc", nil)
+	c.Request.Header.Set("User-Agent", "mychecker/2")
+	assert.True(t, isBot(c))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Longest footer text accepted, in characters
+const maxFooterLength = 500
+
+// Colors are CSS hex colors, e.g. #0a5 or #00aa55
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Branding holds the look of the pages visitors of a workspace's links see: interstitials, challenge
+// pages and error pages. A workspace is everything created with one API key.
+type Branding struct {
+	LogoURL         string `json:"logo_url,omitempty"`
+	PrimaryColor    string `json:"primary_color,omitempty"`
+	BackgroundColor string `json:"background_color,omitempty"`
+	FooterText      string `json:"footer_text,omitempty"`
+}
+
+// Shared parts of the built-in pages, rendered with the branding of the link's workspace if it has one
+const brandingPartials = `{{define "branding_style"}}{{with .Branding}}<style>
+{{if .BackgroundColor}}body { background: {{.BackgroundColor}}; }{{end}}
+{{if .PrimaryColor}}h1, a, button { color: {{.PrimaryColor}}; }{{end}}
+.logo { max-height: 4em; }
+</style>{{end}}{{end}}
+{{define "branding_header"}}{{with .Branding}}{{if .LogoURL}}<header><img class="logo" src="{{.LogoURL}}" alt=""></header>{{end}}{{end}}{{end}}
+{{define "branding_footer"}}{{with .Branding}}{{if .FooterText}}<footer><p>{{.FooterText}}</p></footer>{{end}}{{end}}{{end}}
+`
+
+func brandingKey(owner string) string {
+	return "branding:" + owner
+}
+
+// The `loadBranding` function returns the branding of a workspace, nil if it has none. Branding is
+// decoration, so pages are rendered without it when Redis can't be reached.
+func loadBranding(ctx context.Context, rdb *redis.Client, owner string) *Branding {
+	if owner == "" {
+		return nil
+	}
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	val, err := rdb.Get(opCtx, brandingKey(owner)).Result()
+	if err != nil {
+		return nil
+	}
+	var branding Branding
+	if json.Unmarshal([]byte(val), &branding) != nil {
+		return nil
+	}
+	return &branding
+}
+
+// The `parseBranding` function reads and validates the branding settings of a request. The logo must
+// be an absolute http(s) URL and colors CSS hex colors, so nothing else ends up in the pages' markup.
+func parseBranding(c *gin.Context) (Branding, error) {
+	branding := Branding{
+		LogoURL:         strings.TrimSpace(c.PostForm("logo_url")),
+		PrimaryColor:    strings.TrimSpace(c.PostForm("primary_color")),
+		BackgroundColor: strings.TrimSpace(c.PostForm("background_color")),
+		FooterText:      strings.TrimSpace(c.PostForm("footer_text")),
+	}
+	if branding.LogoURL != "" {
+		parsed, err := url.Parse(branding.LogoURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(branding.LogoURL) > 2048 {
+			return Branding{}, newAPIError(http.StatusBadRequest, "Invalid logo_url parameter")
+		}
+	}
+	if branding.PrimaryColor != "" && !hexColor.MatchString(branding.PrimaryColor) {
+		return Branding{}, newAPIError(http.StatusBadRequest, "Invalid primary_color parameter")
+	}
+	if branding.BackgroundColor != "" && !hexColor.MatchString(branding.BackgroundColor) {
+		return Branding{}, newAPIError(http.StatusBadRequest, "Invalid background_color parameter")
+	}
+	if !utf8.ValidString(branding.FooterText) || utf8.RuneCountInString(branding.FooterText) > maxFooterLength {
+		return Branding{}, newAPIError(http.StatusBadRequest, "Invalid footer_text parameter")
+	}
+	return branding, nil
+}
+
+// The `brandingHandler` function returns the branding of the requesting API key's workspace.
+func brandingHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := rdb.Get(opCtx, brandingKey(apiKey.ID)).Result()
+	if err == redis.Nil {
+		c.JSON(http.StatusOK, Branding{})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(val))
+}
+
+// The `updateBrandingHandler` function replaces the branding of the requesting API key's workspace.
+// Settings that aren't sent are cleared.
+func updateBrandingHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	branding, err := parseBranding(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	data, _ := json.Marshal(branding)
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	if err := rdb.Set(opCtx, brandingKey(apiKey.ID), data, 0).Err(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	c.JSON(http.StatusOK, branding)
+}
+
+// The `deleteBrandingHandler` function removes the branding of the requesting API key's workspace, so
+// its pages look like the deployment's again.
+func deleteBrandingHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	if err := rdb.Del(opCtx, brandingKey(apiKey.ID)).Err(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranding(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.InterstitialMode = "untrusted"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=acme", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &key)
+	acme := map[string]string{apiKeyHeader: key.Key}
+
+	for _, form := range []string{
+		"logo_url=javascript:alert(1)",
+		"primary_color=red",
+		"background_color=%23abcd",
+	} {
+		w = performRequest(router, "PUT", "/api/branding", form, acme)
+		assert.Equal(t, http.StatusBadRequest, w.Code, form)
+	}
+
+	w = performRequest(router, "PUT", "/api/branding", "logo_url=https://acme.example/logo.png&primary_color=%23ff6600&background_color=%23fff&footer_text=Acme+Inc.", acme)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "GET", "/api/branding", "", acme)
+	assert.JSONEq(t, `{"logo_url":"https://acme.example/logo.png","primary_color":"#ff6600","background_color":"#fff","footer_text":"Acme Inc."}`, w.Body.String())
+
+	// Interstitials of the workspace's links are branded, others aren't
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", acme)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `src="https://acme.example/logo.png"`)
+	assert.Contains(t, w.Body.String(), "#ff6600")
+	assert.Contains(t, w.Body.String(), "<footer><p>Acme Inc.</p></footer>")
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Acme")
+
+	w = performRequest(router, "DELETE", "/api/branding", "", acme)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "GET", "/api/branding", "", acme)
+	assert.JSONEq(t, `{}`, w.Body.String())
+
+	w = performRequest(router, "GET", "/api/branding", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBrandedErrorPage(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "expired.html"), []byte(`{{with .Branding}}{{.FooterText}}{{else}}unbranded{{end}}`), 0644)
+	pages, err := loadErrorPages(dir)
+	assert.NoError(t, err)
+	previousPages := errorPages
+	defer func() { errorPages = previousPages }()
+	errorPages = pages
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	browser := map[string]string{"Accept": browserAccept}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=acme", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &key)
+	acme := map[string]string{apiKeyHeader: key.Key}
+	performRequest(router, "PUT", "/api/branding", "footer_text=Acme+Inc.", acme)
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&one_time=true", acme)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	performRequest(router, "GET", "/"+created["token"], "", nil)
+	w = performRequest(router, "GET", "/"+created["token"], "", browser)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "Acme Inc.", w.Body.String())
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&one_time=true", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	performRequest(router, "GET", "/"+created["token"], "", nil)
+	w = performRequest(router, "GET", "/"+created["token"], "", browser)
+	assert.Equal(t, "unbranded", w.Body.String())
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Openings of the circuit breaker, commands and redirects it turned away and redirects served from the
+// link cache because Redis failed, published at /debug/vars
+var breakerStats = expvar.NewMap("redis_breaker")
+
+// The error of commands the circuit breaker doesn't send to Redis
+var errBreakerOpen = errors.New("redis: circuit breaker is open")
+
+// circuitBreaker is a go-redis hook failing commands at once while Redis is down. Without it, every
+// request waits out the timeouts and retries of its commands while new ones keep arriving, so handlers
+// and their goroutines pile up until Redis is back.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// The `guardRedis` function puts a circuit breaker in front of a Redis client, if one is configured.
+func guardRedis(rdb *redis.Client) {
+	if config.BreakerThreshold > 0 {
+		rdb.AddHook(&circuitBreaker{})
+	}
+}
+
+// The function reports whether a command may be sent. Once the cooldown of an open breaker is over, a
+// single command is let through to probe Redis; the others fail until it has answered.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < config.BreakerThreshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		breakerStats.Add("rejected_commands", 1)
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// The function records the outcome of a command. Replies of Redis, errors included, show that it's up;
+// commands canceled by their caller say nothing either way.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.probing
+	b.probing = false
+	var redisErr redis.Error
+	switch {
+	case err == nil || err == redis.Nil || errors.As(err, &redisErr):
+		if b.failures >= config.BreakerThreshold {
+			log.Printf("redis: circuit breaker closed")
+		}
+		b.failures = 0
+	case errors.Is(err, context.Canceled):
+	default:
+		b.failures++
+		if b.failures == config.BreakerThreshold || probe {
+			b.openUntil = time.Now().Add(config.BreakerCooldown)
+			breakerStats.Add("opened", 1)
+			log.Printf("redis: circuit breaker open for %v after %d failures: %v", config.BreakerCooldown, b.failures, err)
+		}
+	}
+}
+
+func (b *circuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (b *circuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !b.allow() {
+			cmd.SetErr(errBreakerOpen)
+			return errBreakerOpen
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *circuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !b.allow() {
+			for _, cmd := range cmds {
+				cmd.SetErr(errBreakerOpen)
+			}
+			return errBreakerOpen
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
+
+// The function serves a link from an expired link cache entry when Redis couldn't be read, e.g. while
+// the circuit breaker is open, so the links the process has seen keep redirecting during an outage.
+func fallBackToCache(key, val string, err error) (string, error) {
+	if err == nil || err == redis.Nil {
+		return val, err
+	}
+	if stale, ok := linkCache.stale(key); ok && liveRecord(stale) {
+		breakerStats.Add("fallback_links", 1)
+		return stale, nil
+	}
+	return val, err
+}
+
+// redirectSlots bounds the redirects in progress, nil when they are unbounded.
+type redirectSlots chan struct{}
+
+func newRedirectSlots() redirectSlots {
+	if config.MaxConcurrentRedirects <= 0 {
+		return nil
+	}
+	return make(redirectSlots, config.MaxConcurrentRedirects)
+}
+
+// The function takes a slot for a redirect, or answers it with a 503 when there is none left.
+func (s redirectSlots) acquire(c *gin.Context) bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		breakerStats.Add("rejected_redirects", 1)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Too many requests in progress, please try again later."})
+		return false
+	}
+}
+
+func (s redirectSlots) release() {
+	if s != nil {
+		<-s
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// The function returns a client of an address nothing listens on.
+func unreachableRedis(t *testing.T) *redis.Client {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	previous := config
+	config.BreakerThreshold = 2
+	config.BreakerCooldown = 50 * time.Millisecond
+	defer func() { config = previous }()
+
+	rdb := unreachableRedis(t)
+	guardRedis(rdb)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		err := rdb.Get(ctx, "key").Err()
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, errBreakerOpen)
+	}
+	assert.ErrorIs(t, rdb.Get(ctx, "key").Err(), errBreakerOpen)
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "counter")
+		return nil
+	})
+	assert.ErrorIs(t, err, errBreakerOpen)
+
+	// After the cooldown a probe reaches Redis, and its failure opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	err = rdb.Get(ctx, "key").Err()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errBreakerOpen)
+	assert.ErrorIs(t, rdb.Get(ctx, "key").Err(), errBreakerOpen)
+}
+
+func TestCircuitBreakerCloses(t *testing.T) {
+	previous := config
+	config.BreakerThreshold = 1
+	config.BreakerCooldown = time.Hour
+	defer func() { config = previous }()
+
+	breaker := &circuitBreaker{}
+	breaker.record(context.Canceled)
+	assert.True(t, breaker.allow())
+	breaker.record(context.DeadlineExceeded)
+	assert.False(t, breaker.allow())
+
+	breaker.openUntil = time.Now()
+	assert.True(t, breaker.allow())
+	// Only one probe at a time
+	assert.False(t, breaker.allow())
+	breaker.record(redis.Nil)
+	assert.True(t, breaker.allow())
+	assert.True(t, breaker.allow())
+}
+
+func TestFallBackToCache(t *testing.T) {
+	previousCache := linkCache
+	linkCache = newLRUCache(10, time.Millisecond, linkCacheStats)
+	defer func() { linkCache = previousCache }()
+
+	live, _ := json.Marshal(URL{Token: "live", LongURL: "https://example.com", MaxAccess: -1, ExpiresAt: time.Now().Add(time.Hour).Format(time.RFC3339)})
+	linkCache.set("live", string(live))
+
+	val, err := fallBackToCache("live", "", errBreakerOpen)
+	assert.NoError(t, err)
+	assert.Equal(t, string(live), val)
+	_, err = fallBackToCache("unknown", "", errBreakerOpen)
+	assert.ErrorIs(t, err, errBreakerOpen)
+	// Links that are gone stay gone
+	_, err = fallBackToCache("live", "", redis.Nil)
+	assert.Equal(t, redis.Nil, err)
+}
+
+func TestMaxConcurrentRedirects(t *testing.T) {
+	previous := config
+	config.MaxConcurrentRedirects = 1
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	slots := newRedirectSlots()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.True(t, slots.acquire(c))
+
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	assert.False(t, slots.acquire(c))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	slots.release()
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	assert.True(t, slots.acquire(c))
+
+	config.MaxConcurrentRedirects = 0
+	assert.Nil(t, newRedirectSlots())
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Links changed per pipeline of a bulk operation
+const bulkBatchSize = 100
+
+// BulkResult is the summary of a bulk operation: how many active links matched the selector, how many
+// were changed, and how many were left alone because they already were in the requested state.
+type BulkResult struct {
+	Action   string `json:"action"`
+	Selector string `json:"selector"`
+	Matched  int    `json:"matched"`
+	Changed  int    `json:"changed"`
+	Skipped  int    `json:"skipped"`
+	// Seconds added to the lifetime of the links, for extend
+	ExtendBy int `json:"extend_by,omitempty"`
+}
+
+// The `bulkHandler` function disables, deletes or extends the expiry of all links with a tag or in a
+// campaign in one call. `action` is `disable`, `delete` or `extend`, the links are selected with `tag`
+// or `campaign_id`, and `extend` takes the seconds to add to each link's lifetime as `extend_by`. API
+// keys act on their own links, the admin key on all matching links. Links are processed in pipelines
+// of up to 100.
+func bulkHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	action := c.PostForm("action")
+	if action != "disable" && action != "delete" && action != "extend" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid action parameter, expected disable, delete or extend"})
+		return
+	}
+	tag, campaignID := strings.ToLower(c.PostForm("tag")), c.PostForm("campaign_id")
+	var index, selector string
+	switch {
+	case tag != "" && campaignID == "":
+		index, selector = tagIndexKey(tag), "tag:"+tag
+	case campaignID != "" && tag == "":
+		index, selector = campaignIndexKey(campaignID), "campaign:"+campaignID
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Pass either tag or campaign_id"})
+		return
+	}
+	extendBy := 0
+	if action == "extend" {
+		var err error
+		extendBy, err = strconv.Atoi(c.PostForm("extend_by"))
+		if err != nil || extendBy < 1 || extendBy > maxMaxAge {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid extend_by parameter"})
+			return
+		}
+	}
+	c.Set(auditActionKey, "links.bulk_"+action)
+	c.Set(auditTargetKey, selector)
+
+	// A bulk operation must not stop halfway because the client went away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), time.Minute)
+	defer cancel()
+
+	var keys []string
+	var err error
+	if apiKey.ID == adminAPIKey.ID {
+		keys, err = rdb.SMembers(ctx, index).Result()
+	} else {
+		keys, err = rdb.SInter(ctx, index, ownerIndexKey(apiKey.ID)).Result()
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	result := BulkResult{Action: action, Selector: selector, ExtendBy: extendBy}
+	for len(keys) > 0 {
+		batch := keys[:min(bulkBatchSize, len(keys))]
+		keys = keys[len(batch):]
+		if err := bulkBatch(ctx, rdb, action, extendBy, linkPolicy("", apiKey), batch, &result); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later.", "result": result})
+			return
+		}
+	}
+	if result.Changed > 0 {
+		invalidateListings(ctx, rdb)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// The function applies a bulk action to a batch of links: their records and access counts are read in
+// one pipeline and changed in a second one. Extended links live no longer than policy allows.
+func bulkBatch(ctx context.Context, rdb *redis.Client, action string, extendBy int, policy LinkPolicy, batch []string, result *BulkResult) error {
+	records := make([]*redis.StringCmd, len(batch))
+	counts := make([]*redis.StringCmd, len(batch))
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range batch {
+			records[i] = pipe.Get(ctx, key)
+			counts[i] = pipe.HGet(ctx, accessCountsKey(key), "count")
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	var links []URL
+	for i := range batch {
+		var urlEntry URL
+		data, err := records[i].Result()
+		// Index entries of links that are gone are left to the readers of the indexes to clean up
+		if err != nil || json.Unmarshal([]byte(data), &urlEntry) != nil {
+			continue
+		}
+		result.Matched++
+		if action == "disable" && urlEntry.Frozen && urlEntry.Disabled {
+			result.Skipped++
+			continue
+		}
+		if count, err := counts[i].Int(); err == nil {
+			urlEntry.CurrentAccessCount = count
+		}
+		links = append(links, urlEntry)
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	switch action {
+	case "disable":
+		err = bulkDisable(ctx, rdb, links)
+	case "delete":
+		for _, urlEntry := range links {
+			archiveLink(ctx, rdb, urlEntry, "deleted")
+		}
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, urlEntry := range links {
+				key := urlEntry.key()
+				pipe.Del(ctx, key, clickLogKey(key), clickRollupKey(key), uniquesKey(key), clickSeriesKey(key), accessCountsKey(key), remainingUsesKey(key), linkHistoryKey(key), tombstoneKey(key))
+				releaseQuota(ctx, pipe, urlEntry)
+				recordEvent(ctx, pipe, urlEntry, "deleted")
+				unindexOwnedLink(ctx, pipe, urlEntry)
+				linkCache.invalidate(key)
+				for _, index := range indexKeys(urlEntry) {
+					pipe.SRem(ctx, index, key)
+				}
+			}
+			return nil
+		})
+	case "extend":
+		err = bulkExtend(ctx, rdb, links, time.Duration(extendBy)*time.Second, time.Duration(policy.maxAge())*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	result.Changed += len(links)
+	return nil
+}
+
+// The function freezes and disables links like freezeURLHandler with `disable=true`, snapshotting
+// their summaries.
+func bulkDisable(ctx context.Context, rdb *redis.Client, links []URL) error {
+	summaries, err := summarizeLinks(ctx, rdb, links)
+	if err != nil {
+		return err
+	}
+	frozenAt := time.Now().Format(time.RFC3339)
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, urlEntry := range links {
+			key := urlEntry.key()
+			summaries[i].FrozenAt = frozenAt
+			summaries[i].Disabled = true
+			urlEntry.Frozen = true
+			urlEntry.Disabled = true
+			data, _ := json.Marshal(urlEntry)
+			summaryData, _ := json.Marshal(summaries[i])
+			pipe.Set(ctx, summaryKey(key), summaryData, 0)
+			pipe.Set(ctx, key, data, redis.KeepTTL)
+			recordEvent(ctx, pipe, urlEntry, "frozen")
+			linkCache.invalidate(key)
+		}
+		return nil
+	})
+	return err
+}
+
+// The function moves the expiry of links and of the data kept next to them by extendBy, but no further
+// than maxAge from now, the longest lifetime a new link can have.
+func bulkExtend(ctx context.Context, rdb *redis.Client, links []URL, extendBy, maxAge time.Duration) error {
+	latest := time.Now().Add(maxAge).Truncate(time.Second)
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, urlEntry := range links {
+			key := urlEntry.key()
+			expiry := urlEntry.expiry().Add(extendBy)
+			if expiry.After(latest) {
+				expiry = latest
+			}
+			urlEntry.ExpiresAt = expiry.Format(time.RFC3339)
+			data, _ := json.Marshal(urlEntry)
+			pipe.Set(ctx, key, data, redis.KeepTTL)
+			for _, related := range []string{key, clickLogKey(key), clickRollupKey(key), uniquesKey(key), clickSeriesKey(key), accessCountsKey(key), remainingUsesKey(key), linkHistoryKey(key)} {
+				pipe.ExpireAt(ctx, related, expiry)
+			}
+			if urlEntry.CreatorAPIKey != "" {
+				pipe.ZAddXX(ctx, activeLinksKey(urlEntry.CreatorAPIKey), redis.Z{Score: float64(expiry.Unix()), Member: key})
+			}
+			trackExpiry(ctx, pipe, urlEntry)
+			recordEvent(ctx, pipe, urlEntry, "updated")
+			linkCache.invalidate(key)
+		}
+		return nil
+	})
+	return err
+}
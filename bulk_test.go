@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkOperations(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var apiKey map[string]string
+	w := performRequest(router, "POST", "/api/admin/keys", "name=bulk", admin)
+	json.Unmarshal(w.Body.Bytes(), &apiKey)
+	owner := map[string]string{apiKeyHeader: apiKey["key"]}
+
+	var tokens []string
+	for _, form := range []string{"long_url=https://example.com/1&tags=launch", "long_url=https://example.com/2&tags=launch,press", "long_url=https://example.com/3&tags=press"} {
+		var created map[string]string
+		w = performRequest(router, "POST", "/create", form+"&max_age=3600", owner)
+		json.Unmarshal(w.Body.Bytes(), &created)
+		tokens = append(tokens, created["token"])
+	}
+	// Links of other keys with the same tag aren't touched
+	var other map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/other&tags=launch", nil)
+	json.Unmarshal(w.Body.Bytes(), &other)
+
+	bulk := func(form string, headers map[string]string) BulkResult {
+		var result BulkResult
+		w := performRequest(router, "POST", "/api/bulk", form, headers)
+		assert.Equal(t, http.StatusOK, w.Code, form)
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+
+	result := bulk("action=extend&tag=launch&extend_by=86400", owner)
+	assert.Equal(t, BulkResult{Action: "extend", Selector: "tag:launch", Matched: 2, Changed: 2, ExtendBy: 86400}, result)
+	ttl := rdb.TTL(testCtx, tokens[0]).Val()
+	assert.True(t, ttl > 24*time.Hour && ttl <= 25*time.Hour, ttl)
+	assert.True(t, rdb.TTL(testCtx, tokens[2]).Val() <= time.Hour)
+
+	result = bulk("action=disable&tag=launch", owner)
+	assert.Equal(t, 2, result.Changed)
+	w = performRequest(router, "GET", "/"+tokens[1], "", nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+	w = performRequest(router, "GET", "/api/urls/"+tokens[1]+"/summary", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "GET", "/"+other["token"], "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	// Links already disabled are skipped
+	result = bulk("action=disable&tag=press", owner)
+	assert.Equal(t, BulkResult{Action: "disable", Selector: "tag:press", Matched: 2, Changed: 1, Skipped: 1}, result)
+
+	result = bulk("action=delete&tag=launch", admin)
+	assert.Equal(t, 3, result.Changed)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, tokens[0], tokens[1], other["token"]).Val())
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, tokens[2]).Val())
+
+	for _, form := range []string{"action=archive&tag=press", "action=delete", "action=delete&tag=press&campaign_id=c", "action=extend&tag=press&extend_by=0"} {
+		w = performRequest(router, "POST", "/api/bulk", form, owner)
+		assert.Equal(t, http.StatusBadRequest, w.Code, form)
+	}
+	w = performRequest(router, "POST", "/api/bulk", "action=delete&tag=press", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
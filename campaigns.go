@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Campaign groups links so their statistics can be rolled up together.
+type Campaign struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	CreatedAt string `json:"created_at"`
+}
+
+func campaignKey(id string) string {
+	return "campaign:" + id
+}
+
+// Clicks are also counted per campaign, so the totals survive the expiry of individual links
+func campaignClicksKey(id string) string {
+	return "campaign:" + id + ":clicks"
+}
+
+func campaignIndexKey(id string) string {
+	return "index:campaign:" + id
+}
+
+// Campaigns of an API key, so they can be removed together with the key
+func ownerCampaignsKey(owner string) string {
+	return "index:owner:" + owner + ":campaigns"
+}
+
+// The function loads a campaign, returning redis.Nil if it doesn't exist.
+func loadCampaign(ctx context.Context, rdb *redis.Client, id string) (Campaign, error) {
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	val, err := rdb.Get(opCtx, campaignKey(id)).Result()
+	if err != nil {
+		return Campaign{}, err
+	}
+	var campaign Campaign
+	err = json.Unmarshal([]byte(val), &campaign)
+	return campaign, err
+}
+
+// The `checkCampaign` function makes sure links can be attached to the campaign by the given key.
+func checkCampaign(ctx context.Context, rdb *redis.Client, id string, key *APIKey) error {
+	campaign, err := loadCampaign(ctx, rdb, id)
+	if err == redis.Nil || (err == nil && !key.owns(campaign.Owner)) {
+		return newAPIError(http.StatusBadRequest, "Invalid campaign_id parameter")
+	}
+	if err != nil {
+		return newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+	}
+	return nil
+}
+
+// The `createCampaignHandler` function creates a campaign owned by the requesting API key.
+func createCampaignHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing name parameter"})
+		return
+	}
+
+	campaign := Campaign{
+		ID:        "cmp_" + randomHex(6),
+		Name:      name,
+		Owner:     apiKey.ID,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	data, _ := json.Marshal(campaign)
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	_, err := rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		pipe.Set(opCtx, campaignKey(campaign.ID), data, 0)
+		pipe.SAdd(opCtx, ownerCampaignsKey(apiKey.ID), campaign.ID)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// The `campaignStatsHandler` function returns a campaign with its statistics rolled up over its links:
+// lifetime clicks (including links that have since expired) and per-link counts of active links.
+func campaignStatsHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	campaign, err := loadCampaign(c.Request.Context(), rdb, c.Param("id"))
+	if err == redis.Nil || (err == nil && !apiKey.owns(campaign.Owner)) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Campaign not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	tokens, err := rdb.SMembers(opCtx, campaignIndexKey(campaign.ID)).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	totalClicks, _ := rdb.Get(opCtx, campaignClicksKey(campaign.ID)).Int()
+	uniqueVisitors, _ := rdb.PFCount(opCtx, campaignUniquesKey(campaign.ID)).Result()
+
+	links := []gin.H{}
+	activeClicks := 0
+	if len(tokens) > 0 {
+		values, err := rdb.MGet(opCtx, tokens...).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		uniques := make([]*redis.IntCmd, len(tokens))
+		rdb.Pipelined(opCtx, func(pipe redis.Pipeliner) error {
+			for i, token := range tokens {
+				uniques[i] = pipe.PFCount(opCtx, uniquesKey(token))
+			}
+			return nil
+		})
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var urlEntry URL
+			if json.Unmarshal([]byte(data), &urlEntry) != nil {
+				continue
+			}
+			activeClicks += urlEntry.CurrentAccessCount
+			links = append(links, gin.H{
+				"token":           urlEntry.Token,
+				"long_url":        urlEntry.LongURL,
+				"clicks":          urlEntry.CurrentAccessCount,
+				"unique_visitors": uniques[i].Val(),
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaign":        campaign,
+		"total_clicks":    totalClicks,
+		"unique_visitors": uniqueVisitors,
+		"active_links":    len(links),
+		"active_clicks":   activeClicks,
+		"links":           links,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaignStats(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=marketing", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	marketing := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/api/campaigns", "name=Spring+launch", marketing)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+
+	var tokens []string
+	for _, destination := range []string{"https://example.com/a", "https://example.com/b"} {
+		w = performRequest(router, "POST", "/create", "long_url="+destination+"&campaign_id="+campaign.ID, marketing)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]string
+		json.Unmarshal(w.Body.Bytes(), &response)
+		tokens = append(tokens, response["token"])
+	}
+
+	// Links can only be attached to campaigns of the same key
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&campaign_id="+campaign.ID, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Access counts are saved in the background, give each save time to land
+	for _, token := range []string{tokens[0], tokens[0], tokens[1]} {
+		performRequest(router, "GET", "/"+token, "", nil)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID, "", marketing)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats struct {
+		TotalClicks  int `json:"total_clicks"`
+		ActiveLinks  int `json:"active_links"`
+		ActiveClicks int `json:"active_clicks"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	assert.Equal(t, 3, stats.TotalClicks)
+	assert.Equal(t, 2, stats.ActiveLinks)
+	assert.Equal(t, 3, stats.ActiveClicks)
+
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestCampaignFunnel(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.VisitorCookie = true
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=marketing", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	marketing := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/api/campaigns", "name=Spring+launch", marketing)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+
+	var tokens []string
+	for _, destination := range []string{"https://example.com/a", "https://example.com/b"} {
+		w = performRequest(router, "POST", "/create", "long_url="+destination+"&campaign_id="+campaign.ID, marketing)
+		var response map[string]string
+		json.Unmarshal(w.Body.Bytes(), &response)
+		tokens = append(tokens, response["token"])
+	}
+
+	// The first visit assigns the cookie
+	w = performRequest(router, "GET", "/"+tokens[0], "", nil)
+	var visitor string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == visitorCookie {
+			visitor = cookie.Value
+		}
+	}
+	assert.Len(t, visitor, 32)
+	time.Sleep(50 * time.Millisecond)
+
+	// The same visitor opens the first link again, then the second one
+	returning := map[string]string{"Cookie": visitorCookie + "=" + visitor}
+	for _, token := range []string{tokens[0], tokens[1]} {
+		w = performRequest(router, "GET", "/"+token, "", returning)
+		assert.Empty(t, w.Result().Cookies())
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Another visitor only opens the second link, and one opting out isn't identified
+	performRequest(router, "GET", "/"+tokens[1], "", nil)
+	time.Sleep(50 * time.Millisecond)
+	w = performRequest(router, "GET", "/"+tokens[0], "", map[string]string{"Sec-GPC": "1"})
+	assert.Empty(t, w.Result().Cookies())
+	time.Sleep(50 * time.Millisecond)
+
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID+"/funnel", "", marketing)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var funnel struct {
+		Visitors          int          `json:"visitors"`
+		MultiLinkVisitors int          `json:"multi_link_visitors"`
+		Paths             []FunnelPath `json:"paths"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &funnel)
+	assert.Equal(t, 2, funnel.Visitors)
+	assert.Equal(t, 1, funnel.MultiLinkVisitors)
+	assert.ElementsMatch(t, []FunnelPath{
+		{Path: []string{tokens[0], tokens[1]}, Visitors: 1},
+		{Path: []string{tokens[1]}, Visitors: 1},
+	}, funnel.Paths)
+
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID+"/funnel", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CAPTCHA tokens that passed and failed verification, and verifications that errored, published at
+// /debug/vars
+var captchaStats = expvar.NewMap("captcha")
+
+var captchaClient = &http.Client{Timeout: 5 * time.Second}
+
+// Verification endpoints of the CAPTCHA providers, variables so tests can point them at a fake server.
+var captchaEndpoints = map[string]string{
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Form fields the widgets of the providers submit their token in. `captcha_token` is accepted for both,
+// for clients that don't submit the widget's own form.
+var captchaFields = map[string]string{
+	"hcaptcha":  "h-captcha-response",
+	"turnstile": "cf-turnstile-response",
+}
+
+const captchaTokenField = "captcha_token"
+
+// CaptchaInfo tells frontends which CAPTCHA widget to render for anonymous requests.
+type CaptchaInfo struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+	Field    string `json:"field"`
+}
+
+// The function returns the CAPTCHA anonymous requests must pass, nil when none is configured.
+func captchaInfo() *CaptchaInfo {
+	if config.CaptchaProvider == "" {
+		return nil
+	}
+	return &CaptchaInfo{Provider: config.CaptchaProvider, SiteKey: config.CaptchaSiteKey, Field: captchaTokenField}
+}
+
+// The `verifyCaptcha` function checks a CAPTCHA token with the configured provider's siteverify API.
+// Tokens are single use, so a token that was already verified is rejected.
+func verifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {config.CaptchaSecret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, captchaEndpoints[config.CaptchaProvider], strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := captchaClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned %s", config.CaptchaProvider, resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// The `requireCaptcha` function makes requests without an API key pass the configured CAPTCHA,
+// answering those that don't with 403, or 503 when the provider can't be reached. Requests with an
+// API key, and all requests when no provider is configured, pass.
+func requireCaptcha(c *gin.Context, apiKey *APIKey) bool {
+	if apiKey != nil || config.CaptchaProvider == "" {
+		return true
+	}
+	token := c.PostForm(captchaTokenField)
+	if token == "" {
+		token = c.PostForm(captchaFields[config.CaptchaProvider])
+	}
+	if token == "" {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Solve the CAPTCHA or send an API key to create links", "captcha": captchaInfo()})
+		return false
+	}
+
+	passed, err := verifyCaptcha(c.Request.Context(), token, c.ClientIP())
+	if err != nil {
+		captchaStats.Add("errors", 1)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error verifying the CAPTCHA, please try again later."})
+		return false
+	}
+	if !passed {
+		captchaStats.Add("failed", 1)
+		c.JSON(http.StatusForbidden, gin.H{"message": "CAPTCHA verification failed, please solve it again", "captcha": captchaInfo()})
+		return false
+	}
+	captchaStats.Add("passed", 1)
+	return true
+}
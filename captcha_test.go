@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// A siteverify API accepting the token "solved" for the secret "secret"
+func fakeCaptchaServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("response") == "solved" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+}
+
+func TestVerifyCaptcha(t *testing.T) {
+	server := fakeCaptchaServer()
+	defer server.Close()
+
+	previous, previousEndpoint := config, captchaEndpoints["turnstile"]
+	captchaEndpoints["turnstile"] = server.URL
+	defer func() { config, captchaEndpoints["turnstile"] = previous, previousEndpoint }()
+	config.CaptchaProvider = "turnstile"
+	config.CaptchaSecret = "secret"
+
+	passed, err := verifyCaptcha(testCtx, "solved", "203.0.113.7")
+	assert.NoError(t, err)
+	assert.True(t, passed)
+	passed, err = verifyCaptcha(testCtx, "guessed", "")
+	assert.NoError(t, err)
+	assert.False(t, passed)
+
+	config.CaptchaSecret = "wrong"
+	_, err = verifyCaptcha(testCtx, "solved", "")
+	assert.Error(t, err)
+}
+
+func TestRequireCaptcha(t *testing.T) {
+	server := fakeCaptchaServer()
+	defer server.Close()
+
+	previous, previousEndpoint := config, captchaEndpoints["hcaptcha"]
+	captchaEndpoints["hcaptcha"] = server.URL
+	defer func() { config, captchaEndpoints["hcaptcha"] = previous, previousEndpoint }()
+	config.CaptchaProvider = "hcaptcha"
+	config.CaptchaSiteKey = "site"
+	config.CaptchaSecret = "secret"
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/create", func(c *gin.Context) {
+		var apiKey *APIKey
+		if c.GetHeader(apiKeyHeader) != "" {
+			apiKey = &APIKey{ID: "key_1"}
+		}
+		if requireCaptcha(c, apiKey) {
+			c.Status(http.StatusOK)
+		}
+	})
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var reply struct {
+		Captcha CaptchaInfo `json:"captcha"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	assert.Equal(t, CaptchaInfo{Provider: "hcaptcha", SiteKey: "site", Field: "captcha_token"}, reply.Captcha)
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&captcha_token=guessed", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&captcha_token=solved", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The field of the provider's widget is accepted too
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&h-captcha-response=solved", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Requests with an API key don't need to solve it
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", map[string]string{apiKeyHeader: "secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The provider being down doesn't let requests through
+	captchaEndpoints["hcaptcha"] = "http://127.0.0.1:1"
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&captcha_token=solved", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	assert.Equal(t, "hcaptcha", createFormSchema().Captcha.Provider)
+	config.CaptchaProvider = ""
+	assert.Nil(t, createFormSchema().Captcha)
+}
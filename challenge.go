@@ -0,0 +1,127 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Name of the cookie proving a visitor passed the challenge of a link
+const challengeCookie = "challenge"
+
+var challengeTemplate = template.Must(template.New("challenge").Parse(brandingPartials + `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Checking your browser</title>
+{{template "branding_style" .}}
+</head>
+<body>
+{{template "branding_header" .}}
+<main>
+<h1>Checking your browser</h1>
+<p role="status">You will be redirected in a moment.</p>
+<script>
+document.cookie = {{.Cookie}};
+location.replace(location.href);
+</script>
+<noscript>
+<p>JavaScript is disabled. Confirm that you want to follow this link:</p>
+<form method="post" action="{{.FallbackURL}}"><button type="submit">Continue to the link</button></form>
+</noscript>
+</main>
+{{template "branding_footer" .}}
+</body>
+</html>
+`))
+
+func challengeMessage(key string, issued int64) string {
+	return "challenge:" + key + ":" + strconv.FormatInt(issued, 10)
+}
+
+// The function returns a fresh cookie value proving the challenge of a link was passed.
+func challengeValue(key string) string {
+	issued := time.Now().Unix()
+	return strconv.FormatInt(issued, 10) + "." + sign(challengeMessage(key, issued))
+}
+
+// The `passedChallenge` function reports whether a request carries a valid challenge cookie for the
+// link. Cookies are signed for a single link and only valid for CHALLENGE_TTL.
+func passedChallenge(c *gin.Context, key string) bool {
+	value, err := c.Cookie(challengeCookie)
+	if err != nil {
+		return false
+	}
+	issuedText, signature, found := strings.Cut(value, ".")
+	if !found {
+		return false
+	}
+	issued, err := strconv.ParseInt(issuedText, 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > config.ChallengeTTL {
+		return false
+	}
+	return validSignature(challengeMessage(key, issued), signature)
+}
+
+// The function returns the cookie of a passed challenge, scoped to the link's path.
+func challengeCookieFor(c *gin.Context, key string) *http.Cookie {
+	return &http.Cookie{
+		Name:     challengeCookie,
+		Value:    challengeValue(key),
+		Path:     challengeCookiePath(c),
+		MaxAge:   int(config.ChallengeTTL.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+		Secure:   c.Request.TLS != nil,
+	}
+}
+
+// The `serveChallenge` function renders the page protected links show first. Its script sets the
+// challenge cookie and reloads the link, so clients that don't run JavaScript never get redirected
+// and can't use up the link's accesses. Visitors without JavaScript can confirm with a button instead.
+func serveChallenge(c *gin.Context, rdb *redis.Client, urlEntry URL) {
+	cookie := challengeCookieFor(c, urlEntry.key())
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	challengeTemplate.Execute(c.Writer, gin.H{
+		"Cookie":      cookie.String(),
+		"FallbackURL": challengeFallbackPath(c),
+		"Branding":    loadBranding(c.Request.Context(), rdb, urlEntry.CreatorAPIKey),
+	})
+}
+
+// The `challengeFallbackHandler` function is the accessibility fallback of the challenge page: a
+// visitor without JavaScript confirms with a form, gets the challenge cookie from the server and is
+// sent back to the link.
+func challengeFallbackHandler(c *gin.Context) {
+	if malformedToken(requestToken(c)) {
+		respondLinkError(c, http.StatusNotFound, pageNotFound, "Error finding your short URL. It may have expired or never existed.")
+		return
+	}
+	key := linkKey(requestDomain(c), requestToken(c))
+	http.SetCookie(c.Writer, challengeCookieFor(c, key))
+	c.Redirect(http.StatusSeeOther, linkPath(c))
+}
+
+// The cookie is scoped to the path of the link, which links resolved with the query parameter share
+// with every other page of the root path.
+func challengeCookiePath(c *gin.Context) string {
+	path, _, _ := strings.Cut(linkPath(c), "?")
+	return path
+}
+
+// The fallback form posts to /:token/challenge, or to the link itself for links resolved with the
+// query parameter.
+func challengeFallbackPath(c *gin.Context) string {
+	if c.Param("token") == "" {
+		return linkPath(c)
+	}
+	return linkPath(c) + "/challenge"
+}
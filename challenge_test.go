@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallenge(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.ChallengeTTL = 10 * time.Minute
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&challenge=true&max_access=5", nil)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+
+	// Clients that don't run JavaScript never get past the challenge page, and don't use up accesses
+	for i := 0; i < 3; i++ {
+		w = performRequest(router, "GET", "/"+token, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "document.cookie")
+	}
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	assert.Equal(t, 0, urlEntry.CurrentAccessCount)
+
+	// The fallback form sets the cookie and sends the visitor back
+	w = performRequest(router, "POST", "/"+token+"/challenge", "", nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/"+token, w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "/"+token, cookies[0].Path)
+		w = performRequest(router, "GET", "/"+token, "", map[string]string{"Cookie": cookies[0].Name + "=" + cookies[0].Value})
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+
+	// A cookie of another link doesn't count
+	other := challengeValue("other")
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{"Cookie": challengeCookie + "=" + other})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
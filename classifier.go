@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Classifier assigns a link to a category from its destination when it is created. Links that fit no
+// category get "". Implementations are registered in classifiers and chosen with CLASSIFIER.
+type Classifier interface {
+	Classify(ctx context.Context, longURL string) string
+}
+
+var classifiers = map[string]Classifier{
+	"keywords": keywordClassifier{},
+}
+
+// The function returns the configured classifier, nil when links aren't classified.
+func activeClassifier() Classifier {
+	return classifiers[config.Classifier]
+}
+
+// The function returns the category of a new link, "" without a classifier.
+func classifyDestination(ctx context.Context, longURL string) string {
+	if classifier := activeClassifier(); classifier != nil {
+		return classifier.Classify(ctx, longURL)
+	}
+	return ""
+}
+
+// Well-known sites of each category, matched with their subdomains
+var categoryDomains = map[string]string{
+	"twitter.com":           "social",
+	"x.com":                 "social",
+	"facebook.com":          "social",
+	"instagram.com":         "social",
+	"linkedin.com":          "social",
+	"reddit.com":            "social",
+	"tiktok.com":            "social",
+	"mastodon.social":       "social",
+	"threads.net":           "social",
+	"bsky.app":              "social",
+	"youtube.com":           "video",
+	"youtu.be":              "video",
+	"vimeo.com":             "video",
+	"twitch.tv":             "video",
+	"dailymotion.com":       "video",
+	"loom.com":              "video",
+	"readthedocs.io":        "docs",
+	"readthedocs.org":       "docs",
+	"wikipedia.org":         "docs",
+	"notion.site":           "docs",
+	"gitbook.io":            "docs",
+	"pkg.go.dev":            "docs",
+	"developer.mozilla.org": "docs",
+	"amazon.com":            "commerce",
+	"ebay.com":              "commerce",
+	"etsy.com":              "commerce",
+	"aliexpress.com":        "commerce",
+	"myshopify.com":         "commerce",
+	"walmart.com":           "commerce",
+}
+
+// Words in the host name or the first path segment hinting at a category, for sites that aren't known
+var categoryKeywords = []struct {
+	keyword  string
+	category string
+}{
+	{"docs", "docs"},
+	{"documentation", "docs"},
+	{"wiki", "docs"},
+	{"manual", "docs"},
+	{"video", "video"},
+	{"watch", "video"},
+	{"shop", "commerce"},
+	{"store", "commerce"},
+	{"product", "commerce"},
+	{"products", "commerce"},
+	{"cart", "commerce"},
+	{"checkout", "commerce"},
+}
+
+// keywordClassifier classifies links by the domain of their destination: the operator's
+// CATEGORY_DOMAINS first, then well-known sites, then keywords in the host name and path.
+type keywordClassifier struct{}
+
+func (keywordClassifier) Classify(ctx context.Context, longURL string) string {
+	parsed, err := url.Parse(longURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, entry := range config.CategoryDomains {
+		domain, category, ok := strings.Cut(entry, "=")
+		if ok && hostMatchesDomain(host, domain) {
+			return category
+		}
+	}
+	for domain, category := range categoryDomains {
+		if hostMatchesDomain(host, domain) {
+			return category
+		}
+	}
+
+	labels := strings.Split(host, ".")
+	segment, _, _ := strings.Cut(strings.Trim(strings.ToLower(parsed.Path), "/"), "/")
+	for _, hint := range categoryKeywords {
+		if segment == hint.keyword || (len(labels) > 2 && labels[0] == hint.keyword) {
+			return hint.category
+		}
+	}
+	return ""
+}
+
+func categoryIndexKey(category string) string {
+	return "index:category:" + category
+}
+
+// The function returns the key of the per-category counters of an API key's links, or of all links for
+// an empty owner, with the same fields and lifetime as the destination counters.
+func categoryStatsKey(owner string) string {
+	if owner == "" {
+		return "stats:categories"
+	}
+	return "stats:categories:" + owner
+}
+
+// The `countCategory` function increments a counter ("links" or "clicks") of the category of a link,
+// for the whole deployment and for the link's owner.
+func countCategory(ctx context.Context, rdb redis.Cmdable, urlEntry URL, counter string) {
+	if urlEntry.Category == "" {
+		return
+	}
+	rdb.HIncrBy(ctx, categoryStatsKey(""), counter+":"+urlEntry.Category, 1)
+	if urlEntry.CreatorAPIKey != "" {
+		rdb.HIncrBy(ctx, categoryStatsKey(urlEntry.CreatorAPIKey), counter+":"+urlEntry.Category, 1)
+	}
+}
+
+// CategoryStats are the aggregate counts of the links of one category.
+type CategoryStats struct {
+	Category string `json:"category"`
+	Links    int64  `json:"links"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// The `categoryReportHandler` function reports links and clicks per category over the links of the
+// requesting API key, or over all links for the admin key, most clicked first.
+func categoryReportHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	owner := apiKey.ID
+	if apiKey.ID == adminAPIKey.ID {
+		owner = ""
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	fields, err := rdb.HGetAll(opCtx, categoryStatsKey(owner)).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	// The counters have the layout of the destination counters, keyed by category instead of domain
+	report := []CategoryStats{}
+	for _, stats := range destinationStatsFrom(fields) {
+		report = append(report, CategoryStats{Category: stats.Domain, Links: stats.Links, Clicks: stats.Clicks})
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": report})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordClassifier(t *testing.T) {
+	previous := config
+	config.CategoryDomains = []string{"acme.dev=docs", "invalid"}
+	defer func() { config = previous }()
+
+	classifier := keywordClassifier{}
+	cases := map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ": "video",
+		"https://m.facebook.com/events/1":             "social",
+		"https://en.wikipedia.org/wiki/URL":           "docs",
+		"https://www.amazon.com/dp/B0":                "commerce",
+		"https://docs.example.org/getting-started":    "docs",
+		"https://shop.example.com/espresso":           "commerce",
+		"https://example.com/products/espresso":       "commerce",
+		"https://blog.acme.dev/release":               "docs",
+		"https://example.com/blog/launch":             "",
+		"https://docs.io/":                            "",
+	}
+	for longURL, category := range cases {
+		assert.Equal(t, category, classifier.Classify(context.Background(), longURL), longURL)
+	}
+}
+
+func TestLinkCategories(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.Classifier = "keywords"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=categories", map[string]string{apiKeyHeader: "admin-secret"})
+	var key map[string]any
+	json.Unmarshal(w.Body.Bytes(), &key)
+	owner := map[string]string{apiKeyHeader: key["key"].(string)}
+
+	performRequest(router, "POST", "/create", "long_url=https://vimeo.com/12345", owner)
+	performRequest(router, "POST", "/create", "long_url=https://example.com/blog", owner)
+
+	w = performRequest(router, "GET", "/api/my/urls?category=video", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var own struct {
+		URLs []OwnLink `json:"urls"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &own)
+	if assert.Len(t, own.URLs, 1) {
+		assert.Equal(t, "video", own.URLs[0].Link.Category)
+	}
+
+	w = performRequest(router, "GET", "/api/urls?category=video&owner="+key["id"].(string), "", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var listing struct {
+		URLs []URL `json:"urls"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	assert.Len(t, listing.URLs, 1)
+
+	w = performRequest(router, "GET", "/api/analytics/categories", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		Categories []CategoryStats `json:"categories"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Equal(t, []CategoryStats{{Category: "video", Links: 1}}, report.Categories)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ClickEvent is a single recorded redirect. ID is the position of the event in the link's click log
+// and serves as the pagination cursor.
+type ClickEvent struct {
+	ID        string `json:"id"`
+	ClickID   string `json:"click_id"`
+	Timestamp string `json:"timestamp"`
+	Country   string `json:"country"`
+	Referrer  string `json:"referrer"`
+	UserAgent string `json:"user_agent"`
+}
+
+// Raw click events of a link are kept in a Redis stream next to the link and expire with it.
+func clickLogKey(key string) string {
+	return "clicks:" + key
+}
+
+// The `recordClick` function appends a click event to the link's click log. The log is capped at the
+// configured length, dropping the oldest events first.
+func recordClick(ctx context.Context, rdb *redis.Client, urlEntry URL, event ClickEvent) {
+	if config.ClickLogMaxLen <= 0 {
+		return
+	}
+	logKey := clickLogKey(urlEntry.key())
+	rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: logKey,
+		MaxLen: int64(config.ClickLogMaxLen),
+		Approx: true,
+		Values: map[string]interface{}{
+			"click_id":   event.ClickID,
+			"timestamp":  event.Timestamp,
+			"country":    event.Country,
+			"referrer":   event.Referrer,
+			"user_agent": event.UserAgent,
+		},
+	})
+	rdb.ExpireAt(ctx, logKey, urlEntry.expiry())
+}
+
+func clickEventFrom(message redis.XMessage) ClickEvent {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+	return ClickEvent{
+		ID:        message.ID,
+		ClickID:   field("click_id"),
+		Timestamp: field("timestamp"),
+		Country:   field("country"),
+		Referrer:  field("referrer"),
+		UserAgent: field("user_agent"),
+	}
+}
+
+// The function converts an RFC 3339 time parameter into a stream ID bound. An empty parameter leaves
+// the range open.
+func streamBound(value, open string, end bool) (string, bool) {
+	if value == "" {
+		return open, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", false
+	}
+	ms := strconv.FormatInt(t.UnixMilli(), 10)
+	if end {
+		// Without a sequence number, an end bound includes every event of that millisecond
+		return ms, true
+	}
+	return ms + "-0", true
+}
+
+// The function returns the stream ID directly after id, to continue a listing after its last event.
+func nextStreamID(id string) (string, bool) {
+	ms, seq, found := strings.Cut(id, "-")
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if !found || err != nil {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return "", false
+	}
+	return ms + "-" + strconv.FormatUint(n+1, 10), true
+}
+
+// The `clickExportHandler` function exports the raw click events of a link as JSON or CSV, oldest
+// first, optionally limited to the `from`/`to` time range. Results are paginated with the `cursor`
+// returned by the previous page, in the body for JSON and in the X-Next-Cursor header for CSV.
+// Only the link's owner and the admin can export its clicks.
+func clickExportHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid format parameter, expected json or csv"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit < 1 || limit > 10000 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit parameter"})
+		return
+	}
+	start, okFrom := streamBound(c.Query("from"), "-", false)
+	end, okTo := streamBound(c.Query("to"), "+", true)
+	if !okFrom || !okTo {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from or to parameter, expected an RFC 3339 time"})
+		return
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if start, ok = nextStreamID(cursor); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor parameter"})
+			return
+		}
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	// One event more than requested tells whether there is another page
+	messages, err := rdb.XRangeN(opCtx, clickLogKey(key), start, end, int64(limit+1)).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	nextCursor := ""
+	if len(messages) > limit {
+		messages = messages[:limit]
+		nextCursor = messages[limit-1].ID
+	}
+
+	clicks := make([]ClickEvent, 0, len(messages))
+	for _, message := range messages {
+		clicks = append(clicks, clickEventFrom(message))
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{"clicks": clicks, "next_cursor": nextCursor})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+c.Param("token")+`-clicks.csv"`)
+	if nextCursor != "" {
+		c.Header("X-Next-Cursor", nextCursor)
+	}
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "click_id", "timestamp", "country", "referrer", "user_agent"})
+	for _, click := range clicks {
+		w.Write([]string{click.ID, click.ClickID, click.Timestamp, click.Country, click.Referrer, click.UserAgent})
+	}
+	w.Flush()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClickExport(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=bi", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	owner := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", owner)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	var clickIDs []string
+	for _, country := range []string{"DE", "FR", "US"} {
+		w = performRequest(router, "GET", "/"+token, "", map[string]string{"CF-IPCountry": country, "Referer": "https://news.example/"})
+		clickIDs = append(clickIDs, w.Header().Get("X-Click-ID"))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	var page struct {
+		Clicks     []ClickEvent `json:"clicks"`
+		NextCursor string       `json:"next_cursor"`
+	}
+	w = performRequest(router, "GET", "/api/urls/"+token+"/clicks?limit=2", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Len(t, page.Clicks, 2)
+	assert.Equal(t, clickIDs[0], page.Clicks[0].ClickID)
+	assert.Equal(t, "DE", page.Clicks[0].Country)
+	assert.Equal(t, "https://news.example/", page.Clicks[0].Referrer)
+	assert.NotEmpty(t, page.NextCursor)
+
+	w = performRequest(router, "GET", "/api/urls/"+token+"/clicks?format=csv&cursor="+page.NextCursor, "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "click_id", rows[0][1])
+	assert.Equal(t, clickIDs[2], rows[1][1])
+
+	// A range ending before the clicks is empty
+	w = performRequest(router, "GET", "/api/urls/"+token+"/clicks?to=2000-01-01T00:00:00Z", "", owner)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Empty(t, page.Clicks)
+
+	w = performRequest(router, "GET", "/api/urls/"+token+"/clicks?format=xml", "", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Other keys can't see the clicks
+	w = performRequest(router, "POST", "/api/admin/keys", "name=other", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	w = performRequest(router, "GET", "/api/urls/"+token+"/clicks", "", map[string]string{apiKeyHeader: key.Key})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performRequest(router, "GET", "/api/urls/"+token+"/clicks", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestNoTracking(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&no_tracking=true&max_access=1", map[string]string{"X-Forwarded-For": "203.0.113.7"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	assert.True(t, urlEntry.NoTracking)
+	assert.Empty(t, urlEntry.CreatorIP)
+	createdAt := urlEntry.LastAccessedAt
+
+	time.Sleep(time.Second)
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{"Referer": "https://mail.example/"})
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	assert.Equal(t, 1, urlEntry.CurrentAccessCount)
+	assert.Equal(t, createdAt, urlEntry.LastAccessedAt)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, clickLogKey(token)).Val())
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, ipIndexKey("203.0.113.7")).Val())
+}
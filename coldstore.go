@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ColdStore is a durable store for dormant links, so they don't occupy memory in Redis. Records are
+// stored as they are in Redis, with the time the link expires.
+type ColdStore interface {
+	Put(key string, record []byte, expiresAt time.Time) error
+	// Get returns errColdNotFound for unknown and expired links
+	Get(key string) ([]byte, time.Time, error)
+	Delete(key string) error
+	// PurgeExpired deletes the links that have expired while in cold storage
+	PurgeExpired(now time.Time) (int, error)
+	// DeleteOwned deletes the links created with an API key
+	DeleteOwned(owner string) (int, error)
+	// ForEach calls fn with every link that hasn't expired, stopping at the first error
+	ForEach(fn func(key string, record []byte, expiresAt time.Time) error) error
+}
+
+var errColdNotFound = errors.New("link not found in cold storage")
+
+// The cold store in use, nil when cold storage is disabled.
+var coldStore ColdStore
+
+var coldLinksBucket = []byte("links")
+
+// boltColdStore keeps dormant links in a local Bolt database file.
+type boltColdStore struct {
+	db *bolt.DB
+}
+
+type coldRecord struct {
+	Record    json.RawMessage `json:"record"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+func openBoltColdStore(path string) (*boltColdStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(coldLinksBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltColdStore{db: db}, nil
+}
+
+func (s *boltColdStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltColdStore) Put(key string, record []byte, expiresAt time.Time) error {
+	data, err := json.Marshal(coldRecord{Record: record, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(coldLinksBucket).Put([]byte(key), data)
+	})
+}
+
+func (s *boltColdStore) Get(key string) ([]byte, time.Time, error) {
+	var stored coldRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(coldLinksBucket).Get([]byte(key))
+		if data == nil {
+			return errColdNotFound
+		}
+		return json.Unmarshal(data, &stored)
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !time.Now().Before(stored.ExpiresAt) {
+		return nil, time.Time{}, errColdNotFound
+	}
+	return stored.Record, stored.ExpiresAt, nil
+}
+
+func (s *boltColdStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(coldLinksBucket).Delete([]byte(key))
+	})
+}
+
+func (s *boltColdStore) PurgeExpired(now time.Time) (int, error) {
+	purged := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(coldLinksBucket).Cursor()
+		for key, data := cursor.First(); key != nil; key, data = cursor.Next() {
+			var stored coldRecord
+			if json.Unmarshal(data, &stored) == nil && now.Before(stored.ExpiresAt) {
+				continue
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (s *boltColdStore) ForEach(fn func(key string, record []byte, expiresAt time.Time) error) error {
+	now := time.Now()
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(coldLinksBucket).ForEach(func(key, data []byte) error {
+			var stored coldRecord
+			if json.Unmarshal(data, &stored) != nil || !now.Before(stored.ExpiresAt) {
+				return nil
+			}
+			return fn(string(key), stored.Record, stored.ExpiresAt)
+		})
+	})
+}
+
+func (s *boltColdStore) DeleteOwned(owner string) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(coldLinksBucket).Cursor()
+		for key, data := cursor.First(); key != nil; key, data = cursor.Next() {
+			var stored coldRecord
+			var urlEntry URL
+			if json.Unmarshal(data, &stored) != nil || json.Unmarshal(stored.Record, &urlEntry) != nil || urlEntry.CreatorAPIKey != owner {
+				continue
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// The `loadLink` function returns the stored record of a link. A link that isn't in Redis but in cold
+// storage is moved back into Redis, with its remaining lifetime and its index entries, so it is hot
+// again for the following accesses.
+func loadLink(ctx context.Context, rdb *redis.Client, key string) (string, error) {
+	val, err := rdb.Get(ctx, key).Result()
+	if err != redis.Nil || coldStore == nil {
+		return val, err
+	}
+
+	record, expiresAt, coldErr := coldStore.Get(key)
+	if coldErr != nil {
+		if coldErr != errColdNotFound {
+			log.Printf("cold storage: %s: %v", key, coldErr)
+		}
+		return "", redis.Nil
+	}
+	var urlEntry URL
+	if json.Unmarshal(record, &urlEntry) != nil {
+		return "", redis.Nil
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, record, time.Until(expiresAt))
+		for _, index := range indexKeys(urlEntry) {
+			pipe.SAdd(ctx, index, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := coldStore.Delete(key); err != nil {
+		log.Printf("cold storage: %s: %v", key, err)
+	}
+	return string(record), nil
+}
+
+// The function reports whether a link hasn't been accessed (or, if it never was, created) since cutoff.
+func isDormant(urlEntry URL, cutoff time.Time) bool {
+	last := urlEntry.LastAccessedAt
+	if last == "" {
+		last = urlEntry.CreatedAt
+	}
+	t, err := time.Parse(time.RFC3339, last)
+	return err == nil && t.Before(cutoff)
+}
+
+// The `tierDormantLink` function moves a link to cold storage if it is dormant. The link is only
+// removed from Redis if it didn't change in the meantime, otherwise the cold copy is dropped again.
+func tierDormantLink(ctx context.Context, rdb *redis.Client, store ColdStore, key string, cutoff time.Time) (bool, error) {
+	moved := false
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		val, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var urlEntry URL
+		if json.Unmarshal([]byte(val), &urlEntry) != nil || !isDormant(urlEntry, cutoff) {
+			return nil
+		}
+		ttl, err := tx.PTTL(ctx, key).Result()
+		if err != nil || ttl <= 0 {
+			return err
+		}
+
+		if err := store.Put(key, []byte(val), time.Now().Add(ttl)); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			for _, index := range indexKeys(urlEntry) {
+				pipe.SRem(ctx, index, key)
+			}
+			return nil
+		})
+		if err != nil {
+			store.Delete(key)
+			return err
+		}
+		moved = true
+		return nil
+	}, key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return moved, err
+}
+
+// The `tierDormantLinks` function moves every link not accessed within the configured period to cold
+// storage and purges links that expired in cold storage.
+func tierDormantLinks(ctx context.Context, rdb *redis.Client, store ColdStore) {
+	cutoff := time.Now().Add(-config.ColdAfter)
+	moved := 0
+	iter := rdb.SScan(ctx, allURLsIndex, 0, "", 100).Iterator()
+	for iter.Next(ctx) {
+		ok, err := tierDormantLink(ctx, rdb, store, iter.Val(), cutoff)
+		if err != nil {
+			log.Printf("cold storage: %s: %v", iter.Val(), err)
+			continue
+		}
+		if ok {
+			moved++
+		}
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("cold storage: %v", err)
+	}
+
+	purged, err := store.PurgeExpired(time.Now())
+	if err != nil {
+		log.Printf("cold storage: %v", err)
+	}
+	if moved > 0 || purged > 0 {
+		log.Printf("cold storage: moved %d dormant links, purged %d expired ones", moved, purged)
+	}
+}
+
+// The function runs tierDormantLinks at the configured interval for the lifetime of the process.
+func runTieringJob(rdb *redis.Client, store ColdStore) {
+	ticker := time.NewTicker(config.TieringInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		tierDormantLinks(context.Background(), rdb, store)
+	}
+}
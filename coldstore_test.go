@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoltColdStore(t *testing.T) {
+	store, err := openBoltColdStore(filepath.Join(t.TempDir(), "cold.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, store.Put("live", []byte(`{"token":"live"}`), time.Now().Add(time.Hour)))
+	assert.NoError(t, store.Put("gone", []byte(`{"token":"gone"}`), time.Now().Add(-time.Second)))
+
+	record, _, err := store.Get("live")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"token":"live"}`, string(record))
+
+	_, _, err = store.Get("gone")
+	assert.Equal(t, errColdNotFound, err)
+	_, _, err = store.Get("missing")
+	assert.Equal(t, errColdNotFound, err)
+
+	purged, err := store.PurgeExpired(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
+
+func TestColdStorageTiering(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	store, err := openBoltColdStore(filepath.Join(t.TempDir(), "cold.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	previous, previousStore := config, coldStore
+	config.ColdAfter = 24 * time.Hour
+	coldStore = store
+	defer func() { config, coldStore = previous, previousStore }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/dormant&tags=archive&max_age=86400", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Recently created links stay hot
+	moved, err := tierDormantLink(testCtx, rdb, store, token, time.Now().Add(-config.ColdAfter))
+	assert.NoError(t, err)
+	assert.False(t, moved)
+
+	moved, err = tierDormantLink(testCtx, rdb, store, token, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, moved)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, token).Val())
+	assert.False(t, rdb.SIsMember(testCtx, tagIndexKey("archive"), token).Val())
+
+	// The next access brings the link back with its remaining lifetime
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/dormant", w.Header().Get("Location"))
+
+	ttl := rdb.TTL(testCtx, token).Val()
+	assert.InDelta(t, 86400, ttl.Seconds(), 10)
+	assert.True(t, rdb.SIsMember(testCtx, tagIndexKey("archive"), token).Val())
+	_, _, err = store.Get(token)
+	assert.Equal(t, errColdNotFound, err)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Click events older than the retention period are rolled up into a hash of counters per link, with
+// fields "total", "day:<date>", "country:<code>" and "referrer:<host>", and removed from the click log.
+func clickRollupKey(key string) string {
+	return "clicks:rollup:" + key
+}
+
+// The function lists the rollup counters a click event counts towards, besides the total.
+func clickRollupFields(click ClickEvent) []string {
+	day := ""
+	if t, err := time.Parse(time.RFC3339, click.Timestamp); err == nil {
+		day = t.UTC().Format("2006-01-02")
+	} else if ms, err := strconv.ParseInt(strings.Split(click.ID, "-")[0], 10, 64); err == nil {
+		day = time.UnixMilli(ms).UTC().Format("2006-01-02")
+	}
+
+	country := click.Country
+	if country == "" {
+		country = "unknown"
+	}
+	referrer := "direct"
+	if u, err := url.Parse(click.Referrer); err == nil && u.Hostname() != "" {
+		referrer = strings.ToLower(u.Hostname())
+	}
+	return []string{"day:" + day, "country:" + country, "referrer:" + referrer}
+}
+
+// The `compactClickLog` function rolls the click events of a link recorded before cutoff into its
+// rollup counters and deletes them from the click log. Each batch is rolled up and deleted in one
+// transaction, so an event is never counted twice or lost.
+func compactClickLog(ctx context.Context, rdb *redis.Client, key string, cutoff time.Time) (int, error) {
+	const batchSize = 1000
+	logKey := clickLogKey(key)
+	end := strconv.FormatInt(cutoff.UnixMilli()-1, 10)
+
+	compacted := 0
+	for {
+		messages, err := rdb.XRangeN(ctx, logKey, "-", end, batchSize).Result()
+		if err != nil || len(messages) == 0 {
+			return compacted, err
+		}
+
+		counts := map[string]int64{}
+		ids := make([]string, len(messages))
+		for i, message := range messages {
+			ids[i] = message.ID
+			counts["total"]++
+			for _, field := range clickRollupFields(clickEventFrom(message)) {
+				counts[field]++
+			}
+		}
+		// The rollup expires together with the click log, which expires with the link
+		ttl := rdb.PTTL(ctx, logKey).Val()
+
+		rollupKey := clickRollupKey(key)
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for field, count := range counts {
+				pipe.HIncrBy(ctx, rollupKey, field, count)
+			}
+			if ttl > 0 {
+				pipe.PExpire(ctx, rollupKey, ttl)
+			}
+			pipe.XDel(ctx, logKey, ids...)
+			return nil
+		})
+		if err != nil {
+			return compacted, err
+		}
+		compacted += len(messages)
+
+		if len(messages) < batchSize {
+			return compacted, nil
+		}
+	}
+}
+
+// The `compactClickLogs` function compacts the click logs of every stored link and drops the periods
+// of their click series that have left the charted range.
+func compactClickLogs(ctx context.Context, rdb *redis.Client) {
+	now := time.Now()
+	cutoff := now.Add(-config.ClickRetention)
+	total := 0
+	iter := rdb.SScan(ctx, allURLsIndex, 0, "", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := pruneClickSeries(ctx, rdb, iter.Val(), now); err != nil {
+			log.Printf("compaction: %s: %v", iter.Val(), err)
+		}
+		compacted, err := compactClickLog(ctx, rdb, iter.Val(), cutoff)
+		if err != nil {
+			log.Printf("compaction: %s: %v", iter.Val(), err)
+			continue
+		}
+		total += compacted
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("compaction: %v", err)
+	}
+	if total > 0 {
+		log.Printf("compaction: rolled up %d click events", total)
+	}
+}
+
+// The function runs compactClickLogs at the configured interval for the lifetime of the process.
+func runCompactionJob(rdb *redis.Client) {
+	ticker := time.NewTicker(config.CompactionInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		compactClickLogs(context.Background(), rdb)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactClickLog(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", admin)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Three events from 40 days ago and one recent click
+	old := time.Now().Add(-40 * 24 * time.Hour).UTC()
+	for i, country := range []string{"DE", "DE", "FR"} {
+		rdb.XAdd(testCtx, &redis.XAddArgs{
+			Stream: clickLogKey(token),
+			ID:     fmt.Sprintf("%d-%d", old.UnixMilli(), i+1),
+			Values: map[string]interface{}{"click_id": "old", "timestamp": old.Format(time.RFC3339), "country": country, "referrer": "https://news.example/", "user_agent": ""},
+		})
+	}
+	performRequest(router, "GET", "/"+token, "", map[string]string{"CF-IPCountry": "DE"})
+	time.Sleep(50 * time.Millisecond)
+
+	compacted, err := compactClickLog(testCtx, rdb, token, time.Now().Add(-30*24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, compacted)
+
+	assert.Equal(t, int64(1), rdb.XLen(testCtx, clickLogKey(token)).Val())
+	rollup := rdb.HGetAll(testCtx, clickRollupKey(token)).Val()
+	assert.Equal(t, "3", rollup["total"])
+	assert.Equal(t, "2", rollup["country:DE"])
+	assert.Equal(t, "3", rollup["day:"+old.Format("2006-01-02")])
+	assert.Equal(t, "3", rollup["referrer:news.example"])
+	assert.True(t, rdb.TTL(testCtx, clickRollupKey(token)).Val() > 0)
+
+	// Compacting again finds nothing new
+	compacted, _ = compactClickLog(testCtx, rdb, token, time.Now().Add(-30*24*time.Hour))
+	assert.Equal(t, 0, compacted)
+
+	// Summaries combine the rollup with the remaining events
+	w = performRequest(router, "POST", "/api/urls/"+token+"/freeze", "", admin)
+	var summary LinkSummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	assert.Equal(t, 4, summary.LoggedClicks)
+	assert.Equal(t, map[string]int{"DE": 3, "FR": 1}, summary.ClicksByCountry)
+	assert.Equal(t, 3, summary.ClicksByDay[old.Format("2006-01-02")])
+	assert.Equal(t, 1, summary.ClicksByDay[time.Now().UTC().Format("2006-01-02")])
+}
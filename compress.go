@@ -0,0 +1,118 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Content types worth compressing. Images, archives and the like are already compressed.
+var compressibleTypes = []string{
+	"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml",
+	"application/manifest+json", "application/x-ndjson",
+}
+
+// compressWriter compresses the response body on the fly once it knows the response is of a
+// compressible type. Until then (and for other types) writes go straight through.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	encoder  io.WriteCloser
+	decided  bool
+}
+
+func (w *compressWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || !isCompressible(header.Get("Content-Type")) {
+		return
+	}
+
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", w.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	if w.encoding == "br" {
+		w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+	} else {
+		w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func isCompressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// The function picks the best encoding the client accepts, preferring brotli over gzip. It returns an
+// empty string if the client accepts neither.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// The `compressResponses` middleware compresses text-like responses with brotli or gzip, depending on
+// what the client accepts.
+func compressResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = writer
+		c.Next()
+		if writer.encoder != nil {
+			writer.encoder.Close()
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "br", negotiateEncoding("gzip, deflate, br"))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, br;q=0"))
+	assert.Equal(t, "", negotiateEncoding("identity"))
+}
+
+func TestCompressResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(compressResponses())
+	body := strings.Repeat("hello ", 100)
+	router.GET("/text", func(c *gin.Context) {
+		c.String(http.StatusOK, body)
+	})
+	router.GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(body))
+	})
+
+	w := performRequest(router, "GET", "/text", "", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	decoded, _ := io.ReadAll(reader)
+	assert.Equal(t, body, string(decoded))
+
+	w = performRequest(router, "GET", "/text", "", map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	decoded, _ = io.ReadAll(brotli.NewReader(w.Body))
+	assert.Equal(t, body, string(decoded))
+
+	w = performRequest(router, "GET", "/image", "", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+}
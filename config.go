@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings that can be changed per deployment through environment variables.
+// Anything not set falls back to the defaults below.
+type Config struct {
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// Read replicas of the Redis at RedisAddr. Link lookups of redirects and batch resolves are spread
+	// over them, everything else goes to the primary.
+	RedisReplicaAddrs []string
+	// Upper bounds for a single Redis read (GET, EXISTS, ...) and write (SET, DEL, ...). A slow or
+	// unreachable Redis makes the request fail after this long instead of hanging the handler.
+	RedisReadTimeout  time.Duration
+	RedisWriteTimeout time.Duration
+	// Connection pool and retries of the Redis client. Zero pool settings keep the go-redis defaults
+	// (10 connections per CPU, no idle connections kept open); RedisMaxRetries of -1 disables retries.
+	RedisPoolSize        int
+	RedisMinIdleConns    int
+	RedisPoolTimeout     time.Duration
+	RedisDialTimeout     time.Duration
+	RedisMaxRetries      int
+	RedisMinRetryBackoff time.Duration
+	RedisMaxRetryBackoff time.Duration
+	// Key granting access to the operator endpoints (API key management, link listings). Empty
+	// disables them.
+	AdminAPIKey string
+	// Public base URL short links are served under, e.g. "https://sho.rt". Derived from the request
+	// when empty.
+	PublicURL string
+	// Additional short domains by host name, e.g. {"go.acme.com": {"default_max_age": 86400}}
+	Domains map[string]DomainConfig
+	// Data residency regions by name, e.g. {"eu": {"redis_addr": "redis.eu.internal:6379"}}. API keys
+	// pinned to a region keep all data of their workspace in its Redis.
+	Regions map[string]RegionConfig
+	// Addresses the service listens on, e.g. "0.0.0.0:8080" and "[::]:8080". With AdminListenAddr set,
+	// the admin API is only served on that address (e.g. "localhost:9090").
+	ListenAddrs     []string
+	AdminListenAddr string
+	// TLS of the public listeners: a certificate and key file, or with Autocert, certificates from
+	// Let's Encrypt for the host of PublicURL and the Domains, cached in AutocertCacheDir. Without
+	// either, plain HTTP is served. HTTPRedirectAddr (e.g. ":80") redirects plain HTTP to HTTPS and
+	// answers the ACME challenges.
+	TLSCertFile      string
+	TLSKeyFile       string
+	Autocert         bool
+	AutocertCacheDir string
+	AutocertEmail    string
+	HTTPRedirectAddr string
+	// Timeouts and limits of the listeners (0 for none): reading a request and its headers, writing a
+	// response, and how long idle keep-alive connections are kept open. H2C accepts HTTP/2 without TLS,
+	// HTTP2MaxStreams limits the concurrent requests on one HTTP/2 connection.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	KeepAlives        bool
+	H2C               bool
+	HTTP2MaxStreams   int
+	// Key for signing values handed out to clients. A random one is used if it's not set.
+	SecretKey string
+	// When to show the interstitial warning page: "off", "flagged" (flagged links only) or
+	// "untrusted" (also links created anonymously or with an untrusted API key)
+	InterstitialMode string
+	// Count HEAD requests of short links as accesses (they get the same redirect either way)
+	CountHeadRequests bool
+	// What bots (requests whose user agent contains one of BotUserAgents) get: "count" (a counted
+	// redirect like everyone else), "ignore" (a redirect that isn't counted or logged) or "preview"
+	// (a page with Open Graph tags describing the link)
+	BotMode       string
+	BotUserAgents []string
+	// Client networks (CIDR notation) and API key IDs exempt from bot filtering (bot modes and link
+	// challenges) and rate limiting. More can be added at runtime through the admin API.
+	ExemptCIDRs   []string
+	ExemptAPIKeys []string
+	// Alternative access limit engine evaluated on live traffic next to the one in use, logging where
+	// their decisions diverge ("" disables shadow evaluation)
+	ShadowEngine string
+	// Attribute conversions reported with a click ID to the campaign link click, if they happen within
+	// the attribution window. ConversionDedupe is "click" (one conversion per click), "order" (one per
+	// order ID) or "none".
+	ConversionTracking bool
+	AttributionWindow  time.Duration
+	ConversionDedupe   string
+	// Identify visitors of campaign links with a first-party cookie, so campaign funnels can be
+	// reported. Visitors sending Do Not Track or Global Privacy Control are never identified.
+	VisitorCookie       bool
+	VisitorCookieMaxAge time.Duration
+	// Number of raw click events kept per link for export, 0 disables the click log
+	ClickLogMaxLen int
+	// Raw click events older than ClickRetention are rolled up into daily aggregates by a job running
+	// every CompactionInterval (0 disables the job)
+	ClickRetention     time.Duration
+	CompactionInterval time.Duration
+	// How often the janitor deletes the analytics of links that no longer exist and stale index entries
+	// (0 disables the job)
+	JanitorInterval time.Duration
+	// Reverse proxies (CIDRs or addresses) whose RealIPHeaders are believed for the client IP, and a
+	// platform ("cloudflare", "appengine", "flyio" or a header name) whose client IP header is believed
+	// on every request
+	TrustedProxies  []string
+	RealIPHeaders   []string
+	TrustedPlatform string
+	// Aliases of the link routes for deployments mounted under a sub-path of another site: path prefixes
+	// such as "/r" resolving /r/:token, and a query parameter resolving /?t=token (empty for none)
+	TokenPathPrefixes []string
+	TokenQueryParam   string
+	// Path all routes are served under, e.g. "/s" for a reverse proxy passing example.com/s/ on
+	// unchanged (empty to serve from the root)
+	BasePath string
+	// Classifier tagging new links with a category ("keywords", empty to not classify links), and
+	// "domain=category" entries taking precedence over its built-in list of sites
+	Classifier      string
+	CategoryDomains []string
+	// API keys with a digest webhook or email get the links they own that expire within
+	// ExpiryDigestWindow in one digest every ExpiryDigestInterval (0 disables the job). Emails go
+	// through the SMTP relay of operator alerts.
+	ExpiryDigestInterval time.Duration
+	ExpiryDigestWindow   time.Duration
+	// Links not accessed for ColdAfter are moved from Redis to the Bolt database at ColdStorePath by a
+	// job running every TieringInterval. Cold storage is disabled when no path is set.
+	ColdStorePath   string
+	ColdAfter       time.Duration
+	TieringInterval time.Duration
+	// Links that expire or are removed are appended to the file at ArchivePath with their click
+	// summary. Links about to expire are picked up by a job running every ArchiveInterval. Archiving
+	// is disabled when no path is set.
+	ArchivePath     string
+	ArchiveInterval time.Duration
+	// New links live up to TTLJitter longer than requested, so links created in bulk don't all expire
+	// at once, and a run of the archive job archives at most ReaperBatchSize expired links (0 for all)
+	TTLJitter       time.Duration
+	ReaperBatchSize int
+	// Record the lifecycle of every link as events in a Redis stream, kept for EventRetention after
+	// the link expired, so its history and past states can be queried
+	EventSourcing  bool
+	EventRetention time.Duration
+	// Administrative actions are appended to an audit stream capped at about AuditMaxLen entries (0
+	// disables it) and, when AuditLogPath is set, to that file
+	AuditMaxLen  int
+	AuditLogPath string
+	// Default length and charset preset of generated tokens
+	TokenLength  int
+	TokenCharset string
+	// Phrase tokens are made of TokenPhraseWords words from the word list at TokenWordlist, or the
+	// built-in one
+	TokenPhraseWords int
+	TokenWordlist    string
+	// Source of tokens: "math" or "crypto" randomness, or "hashids" to encode a sequential counter
+	// with HashidsSalt. One-time links always use "crypto".
+	TokenGenerator string
+	HashidsSalt    string
+	// TokenSigning is "off", "sign" (new tokens end in an HMAC signature segment of
+	// TokenSignatureLength characters) or "enforce" (requests for tokens with an invalid signature are
+	// rejected without a lookup). New tokens are signed with the first of TokenSigningKeys, all of them
+	// are accepted, so keys can be rotated.
+	TokenSigning         string
+	TokenSigningKeys     []string
+	TokenSignatureLength int
+	// Bearer tokens (JWTs) of an identity provider are accepted in place of API keys when JWTJWKSURL,
+	// the provider's key set, is set. Tokens must be issued by JWTIssuer and, if set, for JWTAudience;
+	// their subject owns the links created with them.
+	JWTJWKSURL     string
+	JWTIssuer      string
+	JWTAudience    string
+	JWTJWKSRefresh time.Duration
+	// Clock skew allowed when checking the expiry of bearer tokens
+	JWTLeeway time.Duration
+	// How long the destination check of a link health report is reused, and how close to certificate
+	// expiry or link expiry a link is reported as degraded
+	HealthCheckTTL           time.Duration
+	HealthCertificateWarning time.Duration
+	HealthExpiryWarning      time.Duration
+	// Links an API key may create per UTC day and keep active at once (0 for no limit). Keys can have
+	// their own quotas; anonymous links and the admin key aren't limited.
+	QuotaLinksPerDay int
+	QuotaActiveLinks int
+	// Maximum number of tokens per batch resolve request
+	ResolveBatchMax int
+	// Request header carrying the visitor's ISO country code, set by a CDN or proxy in front of the service
+	CountryHeader string
+	// How long the tombstone of an expired or exhausted link is kept, so requests for it get 410 Gone
+	// instead of 404 (0 disables tombstones)
+	TombstoneTTL time.Duration
+	// How far the timestamp of a signed request may be from the server's clock; nonces are remembered
+	// for twice as long
+	RequestSignatureTolerance time.Duration
+	// Number of link records kept in process memory for hot links, and for how long (0 disables the
+	// cache). Replicas don't see each other's updates to cached links until the entries expire.
+	LinkCacheSize int
+	LinkCacheTTL  time.Duration
+	// Heavy list queries (the admin link listing and destination reports) are cached for
+	// ListCacheTTL, in ListCacheSize entries per process. Creating and deleting links invalidates
+	// cached listings.
+	ListCacheSize int
+	ListCacheTTL  time.Duration
+	// Longest a redirect waits for the link lookup and its access limit counters (0 for no limit). Past
+	// it, links are served from expired link cache entries and their limits are checked, and accesses
+	// counted, in the background. Needs the link cache for the former.
+	RedirectLatencyBudget time.Duration
+	// Circuit breaker of the Redis clients: after BreakerThreshold consecutive failed commands (0
+	// disables it), commands fail at once for BreakerCooldown, then a single one probes whether Redis is
+	// back. Redirects are served from the link cache while it is open, where possible.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Redirects served at once (0 for no bound). Redirects beyond it get a 503 right away instead of
+	// queueing up behind a slow Redis.
+	MaxConcurrentRedirects int
+	// Access counts and clicks of redirects are queued for WriteBehindWorkers workers, which flush the
+	// counts every WriteBehindInterval. A full queue of WriteBehindQueueSize clicks (0 disables the
+	// queue) makes redirects process their clicks themselves.
+	WriteBehindQueueSize int
+	WriteBehindWorkers   int
+	WriteBehindInterval  time.Duration
+	// How long passing the JavaScript challenge of a protected link lasts
+	ChallengeTTL time.Duration
+	// How long the response to a /create request with an Idempotency-Key is replayed to retries
+	IdempotencyTTL time.Duration
+	// Where browsers are sent when a short link can't be followed, and the directory with custom HTML
+	// pages for these errors (not_found.html, expired.html, rate_limited.html), which take precedence
+	ErrorPagesDir string
+	FallbackURL   string
+	// Address visitors can write to about a link, available to custom error pages
+	ContactEmail string
+	// Compress text responses with brotli or gzip when the client supports it
+	Compression bool
+	// Export traces of requests and Redis commands with OpenTelemetry, under TracingServiceName. The
+	// exporter is configured with the standard OTEL_EXPORTER_OTLP_* variables.
+	Tracing            bool
+	TracingServiceName string
+	// Names of the registered middleware applied to every request, and to the routes of the public
+	// (redirects and link creation), api and admin groups, in order. "none" empties a chain.
+	MiddlewareGlobal []string
+	MiddlewarePublic []string
+	MiddlewareAPI    []string
+	MiddlewareAdmin  []string
+	// Origins browsers may call the service from with the cors middleware, "*" for any
+	CORSAllowedOrigins []string
+	// Requests a client IP may make per minute with the ratelimit middleware
+	RateLimitPerMinute int
+	// Links an API key may create per minute through GET /api/quick (0 for no limit)
+	QuickCreatePerMinute int
+	// Signing secret of the Slack app and hex public key of the Discord application whose /shorten
+	// commands are answered (empty disables the integration), and the ID of the API key the links they
+	// create belong to (anonymous if empty)
+	SlackSigningSecret  string
+	DiscordPublicKey    string
+	IntegrationAPIKeyID string
+	// Etiquette for requests the shortener makes to link destinations
+	OutboundUserAgent      string
+	OutboundRespectRobots  bool
+	OutboundRobotsCacheTTL time.Duration
+	OutboundHostInterval   time.Duration
+	// Let destination fetches reach loopback, private and link-local addresses, for intranet deployments
+	OutboundAllowPrivate bool
+	// Screening of destinations for phishing and malware. Allowlisted domains (and their subdomains)
+	// skip screening, blocklisted ones are always treated as malicious. ScreeningAction is "reject"
+	// (refuse/delete the link) or "flag" (keep it but mark it as suspicious).
+	ScreeningAllowlist []string
+	ScreeningBlocklist []string
+	SafeBrowsingAPIKey string
+	URLhausAuthKey     string
+	ScreeningAction    string
+	ScreeningInterval  time.Duration
+	// Destination domains that may be shortened at all. With DestinationAllowlist set, only matching
+	// destinations are accepted; DestinationDenylist matches are always refused. Patterns may use `*`.
+	DestinationAllowlist []string
+	DestinationDenylist  []string
+	// Links created without an API key require a solved CAPTCHA of CaptchaProvider, "hcaptcha" or
+	// "turnstile", when one is set. CaptchaSiteKey is passed to frontends rendering the widget.
+	CaptchaProvider string
+	CaptchaSiteKey  string
+	CaptchaSecret   string
+	// Defaults and caps of the lifetime and access limit of new links, for the whole deployment and by
+	// tier: "anonymous" for links created without an API key, or the tier assigned to an API key, e.g.
+	// {"anonymous": {"max_age_limit": 7776000}, "pro": {"default_max_age": 2592000}}
+	LinkPolicy   LinkPolicy
+	LinkPolicies map[string]LinkPolicy
+	// Status of redirects refused by the per-hour, per-day or per-month limit of a link: 429 with a
+	// Retry-After header, or 400 without one like older versions
+	WindowLimitStatus int
+
+	// Operator alerts go to PagerDuty, Opsgenie and/or email. They are checked every AlertInterval and
+	// fire when Redis failed AlertRedisFailures checks in a row, AlertSaveBacklog redirect saves are in
+	// flight, or AlertAbuseThreshold links were flagged as malicious since the previous check.
+	AlertPagerDutyKey   string
+	AlertOpsgenieKey    string
+	AlertSMTPAddr       string
+	AlertEmailFrom      string
+	AlertEmailTo        []string
+	AlertInterval       time.Duration
+	AlertRedisFailures  int
+	AlertSaveBacklog    int
+	AlertAbuseThreshold int
+}
+
+var config = loadConfig()
+
+// The function builds the configuration from environment variables, using the built-in defaults for
+// anything that is missing or malformed.
+func loadConfig() Config {
+	return Config{
+		RedisAddr:                 envString("REDIS_ADDR", redisAddr),
+		RedisPassword:             envString("REDIS_PASSWORD", redisPassword),
+		RedisDB:                   envInt("REDIS_DB", redisDB),
+		RedisReplicaAddrs:         envList("REDIS_REPLICA_ADDRS"),
+		RedisReadTimeout:          envDuration("REDIS_READ_TIMEOUT", 500*time.Millisecond),
+		RedisWriteTimeout:         envDuration("REDIS_WRITE_TIMEOUT", time.Second),
+		RedisPoolSize:             envInt("REDIS_POOL_SIZE", 0),
+		RedisMinIdleConns:         envInt("REDIS_MIN_IDLE_CONNS", 0),
+		RedisPoolTimeout:          envDuration("REDIS_POOL_TIMEOUT", 0),
+		RedisDialTimeout:          envDuration("REDIS_DIAL_TIMEOUT", 5*time.Second),
+		RedisMaxRetries:           envInt("REDIS_MAX_RETRIES", 3),
+		RedisMinRetryBackoff:      envDuration("REDIS_MIN_RETRY_BACKOFF", 8*time.Millisecond),
+		RedisMaxRetryBackoff:      envDuration("REDIS_MAX_RETRY_BACKOFF", 512*time.Millisecond),
+		AdminAPIKey:               envString("ADMIN_API_KEY", ""),
+		PublicURL:                 envString("PUBLIC_URL", ""),
+		ListenAddrs:               envListDefault("LISTEN_ADDRS", []string{"localhost:8080"}),
+		AdminListenAddr:           envString("ADMIN_LISTEN_ADDR", ""),
+		TLSCertFile:               envString("TLS_CERT_FILE", ""),
+		TLSKeyFile:                envString("TLS_KEY_FILE", ""),
+		Autocert:                  envBool("AUTOCERT", false),
+		AutocertCacheDir:          envString("AUTOCERT_CACHE_DIR", "autocert"),
+		AutocertEmail:             envString("AUTOCERT_EMAIL", ""),
+		HTTPRedirectAddr:          envString("HTTP_REDIRECT_ADDR", ""),
+		ReadTimeout:               envDuration("READ_TIMEOUT", 30*time.Second),
+		ReadHeaderTimeout:         envDuration("READ_HEADER_TIMEOUT", 10*time.Second),
+		WriteTimeout:              envDuration("WRITE_TIMEOUT", 0),
+		IdleTimeout:               envDuration("IDLE_TIMEOUT", 2*time.Minute),
+		MaxHeaderBytes:            envInt("MAX_HEADER_BYTES", 1<<20),
+		KeepAlives:                envBool("KEEP_ALIVES", true),
+		H2C:                       envBool("H2C", false),
+		HTTP2MaxStreams:           envInt("HTTP2_MAX_STREAMS", 250),
+		Domains:                   envDomains("DOMAINS"),
+		Regions:                   envRegions("REGIONS"),
+		TokenLength:               envInt("TOKEN_LENGTH", 8),
+		TokenCharset:              envTokenCharset("TOKEN_CHARSET"),
+		TokenPhraseWords:          envInt("TOKEN_PHRASE_WORDS", 2),
+		TokenWordlist:             envString("TOKEN_WORDLIST", ""),
+		TokenGenerator:            envString("TOKEN_GENERATOR", "math"),
+		HashidsSalt:               envString("HASHIDS_SALT", ""),
+		TokenSigning:              envString("TOKEN_SIGNING", "off"),
+		TokenSigningKeys:          envList("TOKEN_SIGNING_KEYS"),
+		TokenSignatureLength:      envInt("TOKEN_SIGNATURE_LENGTH", 6),
+		JWTJWKSURL:                envString("JWT_JWKS_URL", ""),
+		JWTIssuer:                 envString("JWT_ISSUER", ""),
+		JWTAudience:               envString("JWT_AUDIENCE", ""),
+		JWTJWKSRefresh:            envDuration("JWT_JWKS_REFRESH", time.Hour),
+		JWTLeeway:                 envDuration("JWT_LEEWAY", time.Minute),
+		SecretKey:                 envString("SECRET_KEY", ""),
+		InterstitialMode:          envString("INTERSTITIAL_MODE", "flagged"),
+		CountHeadRequests:         envBool("COUNT_HEAD_REQUESTS", false),
+		BotMode:                   envString("BOT_MODE", "count"),
+		BotUserAgents:             envListDefault("BOT_USER_AGENTS", defaultBotUserAgents),
+		ExemptCIDRs:               envList("EXEMPT_CIDRS"),
+		ExemptAPIKeys:             envList("EXEMPT_API_KEYS"),
+		ShadowEngine:              envString("SHADOW_ENGINE", ""),
+		VisitorCookie:             envBool("VISITOR_COOKIE", false),
+		VisitorCookieMaxAge:       envDuration("VISITOR_COOKIE_MAX_AGE", 365*24*time.Hour),
+		ConversionTracking:        envBool("CONVERSION_TRACKING", false),
+		AttributionWindow:         envDuration("ATTRIBUTION_WINDOW", 7*24*time.Hour),
+		ConversionDedupe:          envString("CONVERSION_DEDUPE", "click"),
+		ClickLogMaxLen:            envInt("CLICK_LOG_MAX_LEN", 10000),
+		ClickRetention:            envDuration("CLICK_RETENTION", 30*24*time.Hour),
+		CompactionInterval:        envDuration("COMPACTION_INTERVAL", time.Hour),
+		JanitorInterval:           envDuration("JANITOR_INTERVAL", 6*time.Hour),
+		TrustedProxies:            envList("TRUSTED_PROXIES"),
+		RealIPHeaders:             envListDefault("REAL_IP_HEADERS", []string{"X-Forwarded-For", "X-Real-IP"}),
+		TrustedPlatform:           envString("TRUSTED_PLATFORM", ""),
+		TokenPathPrefixes:         envList("TOKEN_PATH_PREFIXES"),
+		TokenQueryParam:           envString("TOKEN_QUERY_PARAM", ""),
+		BasePath:                  envString("BASE_PATH", ""),
+		Classifier:                envString("CLASSIFIER", "keywords"),
+		CategoryDomains:           envList("CATEGORY_DOMAINS"),
+		ExpiryDigestInterval:      envDuration("EXPIRY_DIGEST_INTERVAL", 24*time.Hour),
+		ExpiryDigestWindow:        envDuration("EXPIRY_DIGEST_WINDOW", 7*24*time.Hour),
+		ColdStorePath:             envString("COLD_STORE_PATH", ""),
+		ColdAfter:                 envDuration("COLD_AFTER", 30*24*time.Hour),
+		TieringInterval:           envDuration("TIERING_INTERVAL", time.Hour),
+		ArchivePath:               envString("ARCHIVE_PATH", ""),
+		ArchiveInterval:           envDuration("ARCHIVE_INTERVAL", time.Minute),
+		TTLJitter:                 envDuration("TTL_JITTER", 0),
+		ReaperBatchSize:           envInt("REAPER_BATCH_SIZE", 1000),
+		EventSourcing:             envBool("EVENT_SOURCING", false),
+		EventRetention:            envDuration("EVENT_RETENTION", 90*24*time.Hour),
+		AuditMaxLen:               envInt("AUDIT_MAX_LEN", 100000),
+		AuditLogPath:              envString("AUDIT_LOG_PATH", ""),
+		ResolveBatchMax:           envInt("RESOLVE_BATCH_MAX", 100),
+		QuotaLinksPerDay:          envInt("QUOTA_LINKS_PER_DAY", 0),
+		QuotaActiveLinks:          envInt("QUOTA_ACTIVE_LINKS", 0),
+		HealthCheckTTL:            envDuration("HEALTH_CHECK_TTL", time.Minute),
+		HealthCertificateWarning:  envDuration("HEALTH_CERTIFICATE_WARNING", 14*24*time.Hour),
+		HealthExpiryWarning:       envDuration("HEALTH_EXPIRY_WARNING", 24*time.Hour),
+		CountryHeader:             envString("COUNTRY_HEADER", "CF-IPCountry"),
+		ErrorPagesDir:             envString("ERROR_PAGES_DIR", ""),
+		FallbackURL:               envString("FALLBACK_URL", ""),
+		ContactEmail:              envString("CONTACT_EMAIL", ""),
+		TombstoneTTL:              envDuration("TOMBSTONE_TTL", 7*24*time.Hour),
+		RequestSignatureTolerance: envDuration("REQUEST_SIGNATURE_TOLERANCE", 5*time.Minute),
+		LinkCacheSize:             envInt("LINK_CACHE_SIZE", 0),
+		LinkCacheTTL:              envDuration("LINK_CACHE_TTL", 2*time.Second),
+		ListCacheSize:             envInt("LIST_CACHE_SIZE", 64),
+		ListCacheTTL:              envDuration("LIST_CACHE_TTL", 5*time.Second),
+		RedirectLatencyBudget:     envDuration("REDIRECT_LATENCY_BUDGET", 0),
+		BreakerThreshold:          envInt("BREAKER_THRESHOLD", 5),
+		BreakerCooldown:           envDuration("BREAKER_COOLDOWN", 5*time.Second),
+		MaxConcurrentRedirects:    envInt("MAX_CONCURRENT_REDIRECTS", 0),
+		WriteBehindQueueSize:      envInt("WRITE_BEHIND_QUEUE_SIZE", 10000),
+		WriteBehindWorkers:        envInt("WRITE_BEHIND_WORKERS", 8),
+		WriteBehindInterval:       envDuration("WRITE_BEHIND_INTERVAL", 100*time.Millisecond),
+		ChallengeTTL:              envDuration("CHALLENGE_TTL", 10*time.Minute),
+		IdempotencyTTL:            envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		Compression:               envBool("COMPRESSION", true),
+		Tracing:                   envBool("TRACING", false),
+		TracingServiceName:        envString("OTEL_SERVICE_NAME", "url-shortener"),
+		MiddlewareGlobal:          envList("MIDDLEWARE_GLOBAL"),
+		MiddlewarePublic:          envList("MIDDLEWARE_PUBLIC"),
+		MiddlewareAPI:             envList("MIDDLEWARE_API"),
+		MiddlewareAdmin:           envList("MIDDLEWARE_ADMIN"),
+		CORSAllowedOrigins:        envList("CORS_ALLOWED_ORIGINS"),
+		RateLimitPerMinute:        envInt("RATE_LIMIT_PER_MINUTE", 120),
+		QuickCreatePerMinute:      envInt("QUICK_CREATE_PER_MINUTE", 10),
+		SlackSigningSecret:        envString("SLACK_SIGNING_SECRET", ""),
+		DiscordPublicKey:          envString("DISCORD_PUBLIC_KEY", ""),
+		IntegrationAPIKeyID:       envString("INTEGRATION_API_KEY_ID", ""),
+
+		OutboundUserAgent:      envString("OUTBOUND_USER_AGENT", "golang-url-shortener/1.0 (+https://github.com/Vadim-Karpenko/golang_url_shortener)"),
+		OutboundRespectRobots:  envBool("OUTBOUND_RESPECT_ROBOTS", false),
+		OutboundRobotsCacheTTL: envDuration("OUTBOUND_ROBOTS_CACHE_TTL", time.Hour),
+		OutboundHostInterval:   envDuration("OUTBOUND_HOST_INTERVAL", time.Second),
+		OutboundAllowPrivate:   envBool("OUTBOUND_ALLOW_PRIVATE", false),
+
+		ScreeningAllowlist: envList("SCREENING_ALLOWLIST"),
+		ScreeningBlocklist: envList("SCREENING_BLOCKLIST"),
+		SafeBrowsingAPIKey: envString("SAFE_BROWSING_API_KEY", ""),
+		URLhausAuthKey:     envString("URLHAUS_AUTH_KEY", ""),
+		ScreeningAction:    envString("SCREENING_ACTION", "reject"),
+		ScreeningInterval:  envDuration("SCREENING_INTERVAL", 0),
+
+		DestinationAllowlist: envList("DESTINATION_ALLOWLIST"),
+		DestinationDenylist:  envList("DESTINATION_DENYLIST"),
+
+		CaptchaProvider: envString("CAPTCHA_PROVIDER", ""),
+		CaptchaSiteKey:  envString("CAPTCHA_SITE_KEY", ""),
+		CaptchaSecret:   envString("CAPTCHA_SECRET", ""),
+
+		LinkPolicy: LinkPolicy{
+			DefaultMaxAge:    envInt("DEFAULT_MAX_AGE", defaultMaxAge),
+			DefaultMaxAccess: envInt("DEFAULT_MAX_ACCESS", -1),
+			MaxAgeLimit:      envInt("MAX_AGE_LIMIT", 0),
+			MaxAccessLimit:   envInt("MAX_ACCESS_LIMIT", 0),
+		},
+		LinkPolicies:      envLinkPolicies("LINK_POLICIES"),
+		WindowLimitStatus: envInt("WINDOW_LIMIT_STATUS", http.StatusTooManyRequests),
+
+		AlertPagerDutyKey:   envString("ALERT_PAGERDUTY_ROUTING_KEY", ""),
+		AlertOpsgenieKey:    envString("ALERT_OPSGENIE_API_KEY", ""),
+		AlertSMTPAddr:       envString("ALERT_SMTP_ADDR", ""),
+		AlertEmailFrom:      envString("ALERT_EMAIL_FROM", "url-shortener@localhost"),
+		AlertEmailTo:        envList("ALERT_EMAIL_TO"),
+		AlertInterval:       envDuration("ALERT_INTERVAL", time.Minute),
+		AlertRedisFailures:  envInt("ALERT_REDIS_FAILURES", 3),
+		AlertSaveBacklog:    envInt("ALERT_SAVE_BACKLOG", 1000),
+		AlertAbuseThreshold: envInt("ALERT_ABUSE_THRESHOLD", 20),
+	}
+}
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// The function reads a comma-separated list, ignoring empty items.
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// The function is envList with a default for when the variable is empty.
+func envListDefault(key string, fallback []string) []string {
+	if items := envList(key); len(items) > 0 {
+		return items
+	}
+	return fallback
+}
+
+// The function reads the JSON object of short domains, with host names lowercased.
+func envDomains(key string) map[string]DomainConfig {
+	domains := map[string]DomainConfig{}
+	if value := os.Getenv(key); value != "" {
+		var parsed map[string]DomainConfig
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			log.Fatalf("%s: %v", key, err)
+		}
+		for host, settings := range parsed {
+			domains[strings.ToLower(host)] = settings
+		}
+	}
+	return domains
+}
+
+// The function reads the JSON object of data residency regions.
+func envRegions(key string) map[string]RegionConfig {
+	regions := map[string]RegionConfig{}
+	if value := os.Getenv(key); value != "" {
+		if err := json.Unmarshal([]byte(value), &regions); err != nil {
+			log.Fatalf("%s: %v", key, err)
+		}
+	}
+	return regions
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// The functions derive a context for a single Redis operation from the caller's context (usually the
+// request's), bounded by the configured per-operation timeout.
+func readContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, config.RedisReadTimeout)
+}
+
+func writeContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, config.RedisWriteTimeout)
+}
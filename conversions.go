@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Late conversions are still recognized for this long after the attribution window, so they can be
+// reported as outside of it instead of as unknown clicks.
+const attributionGrace = 24 * time.Hour
+
+// ClickRef remembers which campaign link a click ID belongs to, so a conversion reported with the
+// click ID can be attributed to it.
+type ClickRef struct {
+	Token      string `json:"token"`
+	CampaignID string `json:"campaign_id"`
+	ClickedAt  string `json:"clicked_at"`
+}
+
+func clickRefKey(clickID string) string {
+	return "clickref:" + clickID
+}
+
+// Conversion counters of a campaign: conversions, value, duplicates and outside_window
+func campaignConversionsKey(id string) string {
+	return "campaign:" + id + ":conversions"
+}
+
+// The function records a click on a campaign link for later attribution.
+func recordClickRef(ctx context.Context, rdb *redis.Client, urlEntry URL, clickID string, clickedAt time.Time) {
+	data, _ := json.Marshal(ClickRef{
+		Token:      urlEntry.Token,
+		CampaignID: urlEntry.CampaignID,
+		ClickedAt:  clickedAt.UTC().Format(time.RFC3339),
+	})
+	rdb.Set(ctx, clickRefKey(clickID), data, config.AttributionWindow+attributionGrace)
+}
+
+// The function returns the key marking a conversion as counted under the configured dedupe rule, ""
+// if conversions aren't deduplicated.
+func conversionDedupeKey(campaignID, clickID, orderID string) string {
+	switch config.ConversionDedupe {
+	case "none":
+		return ""
+	case "order":
+		if orderID != "" {
+			return "conversion:dedupe:" + campaignID + ":order:" + orderID
+		}
+	}
+	return "conversion:dedupe:" + campaignID + ":click:" + clickID
+}
+
+// The `conversionHandler` function attributes a conversion, e.g. a purchase reported by the
+// destination's backend, to the campaign link click it came from. The click must belong to a campaign
+// of the caller and be within the attribution window, and the conversion must not be a duplicate under
+// the dedupe rule. Rejected conversions are counted in the campaign report too.
+func conversionHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	if !config.ConversionTracking {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Conversion tracking is not enabled"})
+		return
+	}
+
+	clickID := c.PostForm("click_id")
+	if clickID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "click_id is required"})
+		return
+	}
+	orderID := c.PostForm("order_id")
+	value := 0.0
+	if text := c.PostForm("value"); text != "" {
+		var err error
+		value, err = strconv.ParseFloat(text, 64)
+		if err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "value must be a non-negative number"})
+			return
+		}
+	}
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	var ref ClickRef
+	var campaign Campaign
+	val, err := rdb.Get(opCtx, clickRefKey(clickID)).Result()
+	if err == nil {
+		json.Unmarshal([]byte(val), &ref)
+		campaign, err = loadCampaign(opCtx, rdb, ref.CampaignID)
+	}
+	if err == redis.Nil || (err == nil && !apiKey.owns(campaign.Owner)) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Click not found. It may be too long ago to be attributed."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	stats := campaignConversionsKey(ref.CampaignID)
+	reject := func(reason, counter string) {
+		rdb.HIncrBy(opCtx, stats, counter, 1)
+		c.JSON(http.StatusOK, gin.H{"attributed": false, "reason": reason, "campaign_id": ref.CampaignID, "token": ref.Token})
+	}
+
+	clickedAt, _ := time.Parse(time.RFC3339, ref.ClickedAt)
+	if time.Since(clickedAt) > config.AttributionWindow {
+		reject("outside_window", "outside_window")
+		return
+	}
+	if dedupe := conversionDedupeKey(ref.CampaignID, clickID, orderID); dedupe != "" {
+		first, err := rdb.SetNX(opCtx, dedupe, 1, config.AttributionWindow+attributionGrace).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		if !first {
+			reject("duplicate", "duplicates")
+			return
+		}
+	}
+
+	_, err = rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(opCtx, stats, "conversions", 1)
+		if value > 0 {
+			pipe.HIncrByFloat(opCtx, stats, "value", value)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attributed": true, "campaign_id": ref.CampaignID, "token": ref.Token})
+}
+
+// The `campaignConversionsHandler` function reports the conversions attributed to a campaign under the
+// configured attribution window and dedupe rule, along with the conversions that were rejected.
+func campaignConversionsHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	campaign, err := loadCampaign(c.Request.Context(), rdb, c.Param("id"))
+	if err == redis.Nil || (err == nil && !apiKey.owns(campaign.Owner)) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Campaign not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	counters, err := rdb.HGetAll(opCtx, campaignConversionsKey(campaign.ID)).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	clicks, _ := rdb.Get(opCtx, campaignClicksKey(campaign.ID)).Int()
+	conversions, _ := strconv.Atoi(counters["conversions"])
+	duplicates, _ := strconv.Atoi(counters["duplicates"])
+	outsideWindow, _ := strconv.Atoi(counters["outside_window"])
+	value, _ := strconv.ParseFloat(counters["value"], 64)
+	rate := 0.0
+	if clicks > 0 {
+		rate = float64(conversions) / float64(clicks)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaign":           campaign,
+		"attribution_window": config.AttributionWindow.String(),
+		"dedupe":             config.ConversionDedupe,
+		"clicks":             clicks,
+		"conversions":        conversions,
+		"conversion_rate":    rate,
+		"value":              value,
+		"duplicates":         duplicates,
+		"outside_window":     outsideWindow,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversionAttribution(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.ConversionTracking = true
+	config.AttributionWindow = time.Hour
+	config.ConversionDedupe = "order"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=marketing", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	marketing := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/api/campaigns", "name=Spring+launch", marketing)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+	w = performRequest(router, "POST", "/create", "long_url=https://shop.example&campaign_id="+campaign.ID, marketing)
+	var link map[string]string
+	json.Unmarshal(w.Body.Bytes(), &link)
+
+	var clickIDs []string
+	for i := 0; i < 3; i++ {
+		w = performRequest(router, "GET", "/"+link["token"], "", nil)
+		clickIDs = append(clickIDs, w.Header().Get("X-Click-ID"))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	type outcome struct {
+		Attributed bool   `json:"attributed"`
+		Reason     string `json:"reason"`
+	}
+	convert := func(body string) outcome {
+		w := performRequest(router, "POST", "/api/conversions", body, marketing)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var result outcome
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+
+	assert.Equal(t, outcome{Attributed: true}, convert("click_id="+clickIDs[0]+"&order_id=A1&value=19.5"))
+	// The same order reported again, even for another click, is a duplicate
+	assert.Equal(t, outcome{Reason: "duplicate"}, convert("click_id="+clickIDs[1]+"&order_id=A1&value=19.5"))
+	assert.Equal(t, outcome{Attributed: true}, convert("click_id="+clickIDs[1]+"&order_id=A2&value=5"))
+
+	// A click older than the attribution window
+	config.AttributionWindow = 0
+	assert.Equal(t, outcome{Reason: "outside_window"}, convert("click_id="+clickIDs[2]+"&order_id=A3"))
+	config.AttributionWindow = time.Hour
+
+	w = performRequest(router, "POST", "/api/conversions", "click_id=unknown", marketing)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	// Clicks can only be converted by the campaign's owner
+	w = performRequest(router, "POST", "/api/conversions", "click_id="+clickIDs[2], nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID+"/conversions", "", marketing)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		AttributionWindow string  `json:"attribution_window"`
+		Dedupe            string  `json:"dedupe"`
+		Clicks            int     `json:"clicks"`
+		Conversions       int     `json:"conversions"`
+		Value             float64 `json:"value"`
+		Duplicates        int     `json:"duplicates"`
+		OutsideWindow     int     `json:"outside_window"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Equal(t, "1h0m0s", report.AttributionWindow)
+	assert.Equal(t, "order", report.Dedupe)
+	assert.Equal(t, 3, report.Clicks)
+	assert.Equal(t, 2, report.Conversions)
+	assert.Equal(t, 24.5, report.Value)
+	assert.Equal(t, 1, report.Duplicates)
+	assert.Equal(t, 1, report.OutsideWindow)
+}
+
+func TestConversionDedupeKey(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	config.ConversionDedupe = "click"
+	assert.Equal(t, "conversion:dedupe:cmp:click:c1", conversionDedupeKey("cmp", "c1", "A1"))
+	config.ConversionDedupe = "order"
+	assert.Equal(t, "conversion:dedupe:cmp:order:A1", conversionDedupeKey("cmp", "c1", "A1"))
+	assert.Equal(t, "conversion:dedupe:cmp:click:c1", conversionDedupeKey("cmp", "c1", ""))
+	config.ConversionDedupe = "none"
+	assert.Equal(t, "", conversionDedupeKey("cmp", "c1", "A1"))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scripts and styles of the dashboard, served under content-hashed names
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+var dashboardAssets = loadDashboardAssets()
+
+func loadDashboardAssets() *hashedAssets {
+	assets, err := newHashedAssets(dashboardFiles)
+	if err != nil {
+		log.Fatalf("dashboard assets: %v", err)
+	}
+	return assets
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>URL Shortener</title>
+<link rel="stylesheet" href="{{.Base}}/ui/{{.Assets.Path "dashboard/app.css"}}">
+</head>
+<body data-base="{{.Base}}">
+<main>
+<h1>URL Shortener</h1>
+
+<label for="api-key">API key</label>
+<input type="password" id="api-key" autocomplete="off" aria-describedby="api-key-hint">
+<p id="api-key-hint" class="hint">Links created with your key are listed below. The key is only kept in this browser.</p>
+
+<h2>Shorten a URL</h2>
+<form id="create-form">
+<div id="fields"></div>
+<details>
+<summary>More options</summary>
+<div id="advanced-fields"></div>
+</details>
+<button type="submit">Shorten</button>
+</form>
+<div id="result" class="result" role="status" aria-live="polite" hidden></div>
+
+<h2>Your links</h2>
+<p id="list-status" role="status"></p>
+<table>
+<thead><tr><th scope="col">Short URL</th><th scope="col">Destination</th><th scope="col">Uses</th><th scope="col">Expires</th><th scope="col">QR code</th></tr></thead>
+<tbody id="links"></tbody>
+</table>
+<button type="button" id="more" class="secondary" hidden>Load more</button>
+</main>
+<noscript><p>The dashboard needs JavaScript. The API is described in the README.</p></noscript>
+<script src="{{.Base}}/ui/{{.Assets.Path "dashboard/app.js"}}"></script>
+</body>
+</html>
+`))
+
+// The `dashboardHandler` function serves the page of the dashboard, a client of the public API for
+// people who don't want to call it themselves. Its assets are referenced by their hashed names, so
+// they can be cached for good while the page itself is always fetched again.
+func dashboardHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	dashboardTemplate.Execute(c.Writer, gin.H{"Base": basePath(), "Assets": dashboardAssets})
+}
@@ -0,0 +1,255 @@
+// Dashboard of the URL shortener. It only uses the public API: the create form is rendered from
+// /api/v1/schema/create, links are created with POST /create and listed with GET /api/my/urls, and
+// their QR codes come from GET /api/urls/:token/qr.
+(function () {
+  "use strict";
+
+  var storageKey = "url-shortener-api-key";
+  // Path the service is served under, see BASE_PATH
+  var basePath = document.body.getAttribute("data-base") || "";
+  var keyInput = document.getElementById("api-key");
+  var form = document.getElementById("create-form");
+  var fields = document.getElementById("fields");
+  var advanced = document.getElementById("advanced-fields");
+  var result = document.getElementById("result");
+  var rows = document.getElementById("links");
+  var more = document.getElementById("more");
+  var listStatus = document.getElementById("list-status");
+  var cursor = "";
+  var captcha = null;
+
+  // Fields shown without opening the advanced options
+  var primary = ["long_url", "max_access", "max_age", "title"];
+
+  keyInput.value = localStorage.getItem(storageKey) || "";
+  keyInput.addEventListener("change", function () {
+    localStorage.setItem(storageKey, keyInput.value.trim());
+    reload();
+  });
+
+  function headers() {
+    var key = keyInput.value.trim();
+    return key ? { "X-API-Key": key } : {};
+  }
+
+  function element(tag, attributes, text) {
+    var node = document.createElement(tag);
+    Object.keys(attributes || {}).forEach(function (name) {
+      node.setAttribute(name, attributes[name]);
+    });
+    if (text !== undefined) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  // The function renders an input for a field of the form schema, with its label and hint.
+  function renderField(field) {
+    var id = "field-" + field.name;
+    var wrapper = element("div");
+    var input;
+    if (field.type === "boolean") {
+      input = element("input", { type: "checkbox", id: id, name: field.name, value: "true" });
+      wrapper.appendChild(input);
+      wrapper.appendChild(element("label", { for: id, "class": "inline" }, " " + field.label));
+    } else {
+      wrapper.appendChild(element("label", { for: id }, field.label));
+      if (field.enum) {
+        input = element("select", { id: id, name: field.name });
+        field.enum.forEach(function (value) {
+          var option = element("option", { value: value }, value);
+          option.selected = value === field.default;
+          input.appendChild(option);
+        });
+      } else {
+        var type = { url: "url", integer: "number" }[field.type] || "text";
+        input = element("input", { type: type, id: id, name: field.name });
+        if (field.type === "integer" && field.default !== undefined && field.default !== -1) {
+          input.placeholder = field.default;
+        }
+        if (field.minimum !== undefined) input.min = field.minimum;
+        if (field.maximum !== undefined) input.max = field.maximum;
+        if (field.max_length) input.maxLength = field.max_length;
+      }
+      wrapper.appendChild(input);
+    }
+    if (field.required) {
+      input.required = true;
+    }
+    var hint = element("p", { id: id + "-hint", "class": "hint" }, field.description);
+    input.setAttribute("aria-describedby", hint.id);
+    wrapper.appendChild(hint);
+    return wrapper;
+  }
+
+  fetch(basePath + "/api/v1/schema/create")
+    .then(function (response) { return response.json(); })
+    .then(function (schema) {
+      schema.fields.forEach(function (field) {
+        if (field.in !== "form") {
+          return;
+        }
+        (primary.indexOf(field.name) >= 0 ? fields : advanced).appendChild(renderField(field));
+      });
+      if (schema.captcha) {
+        renderCaptcha(schema.captcha);
+      }
+    });
+
+  // Widgets of the CAPTCHA providers, which render into an element with their class and submit their
+  // token with the form. Links created with an API key don't need it.
+  var captchaWidgets = {
+    hcaptcha: { className: "h-captcha", script: "https://js.hcaptcha.com/1/api.js", global: "hcaptcha" },
+    turnstile: { className: "cf-turnstile", script: "https://challenges.cloudflare.com/turnstile/v0/api.js", global: "turnstile" }
+  };
+
+  function renderCaptcha(info) {
+    captcha = captchaWidgets[info.provider];
+    if (!captcha) {
+      return;
+    }
+    fields.appendChild(element("div", { "class": captcha.className, "data-sitekey": info.site_key }));
+    document.head.appendChild(element("script", { src: captcha.script, async: "", defer: "" }));
+  }
+
+  // Tokens are single use, a new one is needed for the next link
+  function resetCaptcha() {
+    if (captcha && window[captcha.global]) {
+      window[captcha.global].reset();
+    }
+  }
+
+  function shortURL(link) {
+    var base = link.domain ? "https://" + link.domain : window.location.origin;
+    // Emoji tokens are percent-encoded
+    return base + basePath + "/" + encodeURIComponent(link.token);
+  }
+
+  // The function returns the QR code of a link, which downloads the code in print size when clicked.
+  // The images need the API key, which an img element can't send, so they are fetched as blobs.
+  function qrCode(link, size) {
+    var domain = link.domain ? "&domain=" + encodeURIComponent(link.domain) : "";
+    var path = basePath + "/api/urls/" + encodeURIComponent(link.token) + "/qr?size=";
+    function fetchImage(pixels) {
+      return fetch(path + pixels + domain, { headers: headers() }).then(function (response) {
+        if (!response.ok) {
+          throw new Error(response.statusText);
+        }
+        return response.blob();
+      });
+    }
+
+    var anchor = element("a", { download: link.token + ".png", title: "Download the QR code" });
+    var image = element("img", { "class": "qr", alt: "QR code of " + shortURL(link), width: size, height: size });
+    anchor.appendChild(image);
+    fetchImage(size * 2)
+      .then(function (blob) { image.src = URL.createObjectURL(blob); })
+      .catch(function () { anchor.hidden = true; });
+    anchor.addEventListener("click", function (event) {
+      if (anchor.hasAttribute("href")) {
+        return;
+      }
+      event.preventDefault();
+      fetchImage(1024).then(function (blob) {
+        anchor.href = URL.createObjectURL(blob);
+        anchor.click();
+      });
+    });
+    return anchor;
+  }
+
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    var body = new URLSearchParams();
+    new FormData(form).forEach(function (value, name) {
+      if (value !== "") {
+        body.append(name, value);
+      }
+    });
+    result.hidden = false;
+    result.className = "result";
+    result.textContent = "Creating…";
+    fetch(basePath + "/create", { method: "POST", headers: headers(), body: body })
+      .then(function (response) {
+        return response.json().then(function (data) { return { ok: response.ok, data: data }; });
+      })
+      .then(function (reply) {
+        resetCaptcha();
+        if (!reply.ok) {
+          result.className = "result error";
+          result.textContent = reply.data.message;
+          return;
+        }
+        var url = shortURL(reply.data);
+        result.textContent = "";
+        result.appendChild(element("a", { href: url }, url));
+        var copy = element("button", { type: "button", "class": "secondary" }, "Copy");
+        copy.addEventListener("click", function () { navigator.clipboard.writeText(url); });
+        result.appendChild(document.createTextNode(" "));
+        result.appendChild(copy);
+        // Links created without an API key come with a page to manage them, the others with a QR code
+        if (reply.data.manage_url) {
+          result.appendChild(document.createTextNode(" "));
+          result.appendChild(element("a", { href: reply.data.manage_url }, "Manage"));
+        } else if (keyInput.value.trim()) {
+          result.appendChild(element("div", {})).appendChild(qrCode(reply.data, 128));
+        }
+        form.reset();
+        reload();
+      });
+  });
+
+  function limit(value) {
+    return value === -1 ? "∞" : value;
+  }
+
+  // The function appends a page of the API key's links to the table.
+  function loadLinks() {
+    if (!keyInput.value.trim()) {
+      listStatus.textContent = "Enter your API key to see your links.";
+      more.hidden = true;
+      return;
+    }
+    var query = basePath + "/api/my/urls?status=all&limit=20" + (cursor ? "&cursor=" + encodeURIComponent(cursor) : "");
+    fetch(query, { headers: headers() })
+      .then(function (response) {
+        return response.json().then(function (data) { return { ok: response.ok, data: data }; });
+      })
+      .then(function (reply) {
+        if (!reply.ok) {
+          listStatus.textContent = reply.data.message;
+          return;
+        }
+        reply.data.urls.forEach(function (link) {
+          var row = element("tr", link.status === "expired" ? { "class": "expired" } : {});
+          var cell = element("td");
+          cell.appendChild(element("a", { href: shortURL(link) }, link.token));
+          row.appendChild(cell);
+          if (link.link) {
+            row.appendChild(element("td", { "class": "destination" }, link.link.long_url));
+            row.appendChild(element("td", {}, link.link.current_access_count + " / " + limit(link.link.max_access)));
+            row.appendChild(element("td", {}, new Date(link.link.expires_at).toLocaleString()));
+            row.appendChild(element("td", {})).appendChild(qrCode(link, 64));
+          } else {
+            row.appendChild(element("td", { "class": "destination" }, ""));
+            row.appendChild(element("td", {}, ""));
+            row.appendChild(element("td", {}, "expired"));
+            row.appendChild(element("td", {}));
+          }
+          rows.appendChild(row);
+        });
+        cursor = reply.data.next_cursor;
+        more.hidden = !cursor;
+        listStatus.textContent = rows.children.length ? "" : "No links yet.";
+      });
+  }
+
+  function reload() {
+    rows.textContent = "";
+    cursor = "";
+    loadLinks();
+  }
+
+  more.addEventListener("click", loadLinks);
+  reload();
+})();
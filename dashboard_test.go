@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboard(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "GET", "/ui", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	script := regexp.MustCompile(`src="(/ui/dashboard/app\.[0-9a-f]{8}\.js)"`).FindStringSubmatch(w.Body.String())
+	assert.Len(t, script, 2)
+
+	// Assets are served under their hashed names for good
+	w = performRequest(router, "GET", script[1], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	assert.Contains(t, w.Body.String(), "/api/v1/schema/create")
+
+	w = performRequest(router, "GET", "/ui/dashboard/missing.js", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
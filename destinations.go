@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// DestinationStats are the aggregate counts of the links leading to one destination domain.
+type DestinationStats struct {
+	Domain string `json:"domain"`
+	Links  int64  `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+// The function returns the key of the per-destination-domain counters of an API key's links, or of all
+// links for an empty owner. The hash has the fields "links:<domain>" and "clicks:<domain>". The counts
+// are kept apart from the links, so they include links that have since expired.
+func destinationStatsKey(owner string) string {
+	if owner == "" {
+		return "stats:destinations"
+	}
+	return "stats:destinations:" + owner
+}
+
+// The function returns the domain a link leads to, without a "www." prefix.
+func destinationDomain(longURL string) string {
+	parsed, err := url.Parse(longURL)
+	if err != nil || parsed.Hostname() == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// The `countDestination` function increments a counter ("links" or "clicks") of the destination domain
+// of a link, for the whole deployment and for the link's owner.
+func countDestination(ctx context.Context, rdb redis.Cmdable, urlEntry URL, counter string) {
+	domain := destinationDomain(urlEntry.LongURL)
+	if domain == "" {
+		return
+	}
+	rdb.HIncrBy(ctx, destinationStatsKey(""), counter+":"+domain, 1)
+	if urlEntry.CreatorAPIKey != "" {
+		rdb.HIncrBy(ctx, destinationStatsKey(urlEntry.CreatorAPIKey), counter+":"+domain, 1)
+	}
+}
+
+// The function turns a counters hash into per-domain statistics, sorted by clicks.
+func destinationStatsFrom(fields map[string]string) []DestinationStats {
+	byDomain := make(map[string]*DestinationStats)
+	for field, value := range fields {
+		counter, domain, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		count, _ := strconv.ParseInt(value, 10, 64)
+		stats, ok := byDomain[domain]
+		if !ok {
+			stats = &DestinationStats{Domain: domain}
+			byDomain[domain] = stats
+		}
+		switch counter {
+		case "links":
+			stats.Links = count
+		case "clicks":
+			stats.Clicks = count
+		}
+	}
+
+	report := make([]DestinationStats, 0, len(byDomain))
+	for _, stats := range byDomain {
+		report = append(report, *stats)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Clicks != report[j].Clicks {
+			return report[i].Clicks > report[j].Clicks
+		}
+		return report[i].Domain < report[j].Domain
+	})
+	return report
+}
+
+// The `destinationReportHandler` function reports links and clicks per destination domain over the
+// links of the requesting API key, or over all links for the admin key. The `limit` parameter caps
+// the number of domains returned.
+func destinationReportHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit parameter"})
+			return
+		}
+	}
+
+	owner := apiKey.ID
+	if apiKey.ID == adminAPIKey.ID {
+		owner = ""
+	}
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	fields, err := destinationCounters(opCtx, rdb, owner)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	report := destinationStatsFrom(fields)
+	if len(report) > limit {
+		report = report[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"destinations": report})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestinationReport(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key map[string]string
+	w := performRequest(router, "POST", "/api/admin/keys", "name=team", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	team := map[string]string{apiKeyHeader: key["key"]}
+
+	create := func(longURL string, headers map[string]string) string {
+		w := performRequest(router, "POST", "/create", "long_url="+longURL, headers)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+	shop := create("https://shop.example/a", team)
+	create("https://www.Shop.example/b", team)
+	blog := create("https://blog.example/post", team)
+	other := create("https://blog.example/other", nil)
+
+	for _, token := range []string{blog, blog, shop, other} {
+		performRequest(router, "GET", "/"+token, "", nil)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	var report struct {
+		Destinations []DestinationStats `json:"destinations"`
+	}
+	w = performRequest(router, "GET", "/api/analytics/destinations", "", team)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Equal(t, []DestinationStats{
+		{Domain: "blog.example", Links: 1, Clicks: 2},
+		{Domain: "shop.example", Links: 2, Clicks: 1},
+	}, report.Destinations)
+
+	// The admin key sees all links, including anonymous ones
+	w = performRequest(router, "GET", "/api/analytics/destinations?limit=1", "", admin)
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Equal(t, []DestinationStats{{Domain: "blog.example", Links: 2, Clicks: 3}}, report.Destinations)
+
+	w = performRequest(router, "GET", "/api/analytics/destinations?limit=0", "", team)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "GET", "/api/analytics/destinations", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Digests delivered and failed deliveries, published at /debug/vars
+var digestStats = expvar.NewMap("expiry_digests")
+
+// ExpiringLink is a link listed in an expiry digest.
+type ExpiringLink struct {
+	Token     string `json:"token"`
+	Domain    string `json:"domain,omitempty"`
+	LongURL   string `json:"long_url"`
+	Title     string `json:"title,omitempty"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// ExpiryDigest is the "links.expiring" event, which lists all links of an owner expiring before Until
+// in a single notification instead of one per link.
+type ExpiryDigest struct {
+	Event       string         `json:"event"`
+	Owner       string         `json:"owner"`
+	GeneratedAt string         `json:"generated_at"`
+	Until       string         `json:"until"`
+	Links       []ExpiringLink `json:"links"`
+}
+
+// Set while an owner's digest of the current interval is being or was sent, so replicas running the
+// job don't send it twice
+func digestSentKey(owner string) string {
+	return "digest:expiry:" + owner
+}
+
+// The `expiringLinks` function lists the links of an owner that expire before until, soonest first.
+func expiringLinks(ctx context.Context, rdb *redis.Client, owner string, until time.Time) ([]ExpiringLink, error) {
+	if err := backfillOwnedLinks(ctx, rdb, owner); err != nil {
+		return nil, err
+	}
+	keys, err := rdb.ZRange(ctx, ownerCreatedIndexKey(owner), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	links := []ExpiringLink{}
+	for len(keys) > 0 {
+		batch := keys[:min(100, len(keys))]
+		keys = keys[len(batch):]
+		values, err := rdb.MGet(ctx, batch...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			var urlEntry URL
+			data, ok := value.(string)
+			if !ok || json.Unmarshal([]byte(data), &urlEntry) != nil {
+				continue
+			}
+			if urlEntry.ttl() <= 0 || !urlEntry.expiry().Before(until) {
+				continue
+			}
+			links = append(links, ExpiringLink{
+				Token:     urlEntry.Token,
+				Domain:    urlEntry.Domain,
+				LongURL:   urlEntry.LongURL,
+				Title:     urlEntry.Title,
+				ExpiresAt: urlEntry.ExpiresAt,
+			})
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool { return links[i].ExpiresAt < links[j].ExpiresAt })
+	return links, nil
+}
+
+// The `deliverDigest` function sends a digest to the owner's webhook and email address. Webhook
+// requests carry the hex HMAC-SHA256 of the body, keyed with the owner's API key secret, in the
+// X-Signature header, so receivers can tell them from forged ones.
+func deliverDigest(ctx context.Context, key APIKey, secret string, digest ExpiryDigest) error {
+	if key.DigestWebhookURL != "" {
+		body, _ := json.Marshal(digest)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		headers := map[string]string{"X-Signature": "sha256=" + hex.EncodeToString(mac.Sum(nil))}
+		if err := postAlert(ctx, key.DigestWebhookURL, headers, json.RawMessage(body)); err != nil {
+			return err
+		}
+	}
+
+	if key.DigestEmail != "" && config.AlertSMTPAddr != "" {
+		var lines strings.Builder
+		for _, link := range digest.Links {
+			fmt.Fprintf(&lines, "%s  %s -> %s\r\n", link.ExpiresAt, linkKey(link.Domain, link.Token), link.LongURL)
+		}
+		message := "From: " + config.AlertEmailFrom + "\r\n" +
+			"To: " + key.DigestEmail + "\r\n" +
+			fmt.Sprintf("Subject: %d of your short links expire before %s\r\n\r\n", len(digest.Links), digest.Until) +
+			lines.String()
+		if err := smtp.SendMail(config.AlertSMTPAddr, nil, config.AlertEmailFrom, []string{key.DigestEmail}, []byte(message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The `runExpiryDigest` function sends every API key with a digest webhook or email the links it owns
+// that expire within the digest window. Owners without such links get nothing. Each owner gets at most
+// one digest per interval, however many replicas run the job; failed deliveries are retried on the
+// next run.
+func runExpiryDigest(ctx context.Context, rdb *redis.Client) {
+	now := time.Now()
+	until := now.Add(config.ExpiryDigestWindow)
+	iter := rdb.Scan(ctx, 0, apiKeyRedisKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		if strings.HasPrefix(iter.Val(), apiKeyIDKey("")) {
+			continue
+		}
+		data, err := rdb.Get(ctx, iter.Val()).Result()
+		var key APIKey
+		if err != nil || json.Unmarshal([]byte(data), &key) != nil {
+			continue
+		}
+		if key.DigestWebhookURL == "" && key.DigestEmail == "" {
+			continue
+		}
+
+		claimed, err := rdb.SetNX(ctx, digestSentKey(key.ID), now.Format(time.RFC3339), config.ExpiryDigestInterval).Result()
+		if err != nil || !claimed {
+			continue
+		}
+		// Links of a workspace pinned to a region are stored there
+		links := rdb
+		if client, ok := regionClients[key.Region]; ok {
+			links = client
+		}
+		expiring, err := expiringLinks(ctx, links, key.ID, until)
+		if err == nil && len(expiring) == 0 {
+			continue
+		}
+		if err == nil {
+			err = deliverDigest(ctx, key, strings.TrimPrefix(iter.Val(), apiKeyRedisKey("")), ExpiryDigest{
+				Event:       "links.expiring",
+				Owner:       key.ID,
+				GeneratedAt: now.UTC().Format(time.RFC3339),
+				Until:       until.UTC().Format(time.RFC3339),
+				Links:       expiring,
+			})
+		}
+		if err != nil {
+			log.Printf("expiry digest: %s: %v", key.ID, err)
+			digestStats.Add("failed", 1)
+			rdb.Del(ctx, digestSentKey(key.ID))
+			continue
+		}
+		digestStats.Add("sent", 1)
+		digestStats.Add("links", int64(len(expiring)))
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("expiry digest: %v", err)
+	}
+}
+
+// The function sends the expiry digests at the configured interval for the lifetime of the process.
+func runExpiryDigestJob(rdb *redis.Client) {
+	ticker := time.NewTicker(config.ExpiryDigestInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		runExpiryDigest(context.Background(), rdb)
+	}
+}
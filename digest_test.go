@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryDigestParameters(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=ci&digest_webhook_url=ftp://example.com/hook", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/api/admin/keys", "name=ci&digest_email=not-an-address", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExpiryDigest(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	var digests []ExpiryDigest
+	var signatures []string
+	var bodies [][]byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var digest ExpiryDigest
+		json.Unmarshal(body, &digest)
+		digests = append(digests, digest)
+		signatures = append(signatures, r.Header.Get("X-Signature"))
+		bodies = append(bodies, body)
+	}))
+	defer hook.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.ExpiryDigestInterval = time.Hour
+	config.ExpiryDigestWindow = 48 * time.Hour
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=owner&digest_webhook_url="+hook.URL, map[string]string{apiKeyHeader: "admin-secret"})
+	var key map[string]any
+	json.Unmarshal(w.Body.Bytes(), &key)
+	secret, _ := key["key"].(string)
+	owner := map[string]string{apiKeyHeader: secret}
+
+	performRequest(router, "POST", "/create", "long_url=https://example.com/soon&max_age=3600", owner)
+	performRequest(router, "POST", "/create", "long_url=https://example.com/sooner&max_age=600", owner)
+	performRequest(router, "POST", "/create", "long_url=https://example.com/later&max_age=864000", owner)
+
+	runExpiryDigest(context.Background(), rdb)
+	if assert.Len(t, digests, 1) {
+		assert.Equal(t, "links.expiring", digests[0].Event)
+		assert.Equal(t, key["id"], digests[0].Owner)
+		// All expiring links in one digest, soonest first, without the link expiring later
+		if assert.Len(t, digests[0].Links, 2) {
+			assert.Equal(t, "https://example.com/sooner", digests[0].Links[0].LongURL)
+			assert.Equal(t, "https://example.com/soon", digests[0].Links[1].LongURL)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(bodies[0])
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), signatures[0])
+	}
+
+	// Once per interval, however often the job runs
+	runExpiryDigest(context.Background(), rdb)
+	assert.Len(t, digests, 1)
+}
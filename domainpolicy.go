@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// The function reports whether host matches a pattern of the destination domain policy. Patterns
+// without a wildcard match the domain and its subdomains, like the screening lists. Patterns with `*`
+// are matched against the whole host, where `*` stands for any run of characters, dots included:
+// `*.example.com` matches the subdomains of example.com only, `cdn-*.example.net` a family of hosts.
+func hostMatchesPattern(host, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if !strings.Contains(pattern, "*") {
+		return hostMatchesDomain(host, pattern)
+	}
+	matched, err := path.Match(pattern, strings.ToLower(host))
+	return err == nil && matched
+}
+
+// The `checkDestinationPolicy` function enforces the operator's destination domains: denylisted
+// domains can never be shortened, and with an allowlist, only the domains on it can. Unlike the
+// screening lists, the policy doesn't depend on SCREENING_ACTION.
+func checkDestinationPolicy(longURL string) error {
+	host := destinationHost(longURL)
+	for _, pattern := range config.DestinationDenylist {
+		if hostMatchesPattern(host, pattern) {
+			return newAPIError(http.StatusForbidden, "Links to "+host+" can't be created on this service")
+		}
+	}
+	if len(config.DestinationAllowlist) == 0 {
+		return nil
+	}
+	for _, pattern := range config.DestinationAllowlist {
+		if hostMatchesPattern(host, pattern) {
+			return nil
+		}
+	}
+	return newAPIError(http.StatusForbidden, "Links to "+host+" can't be created on this service")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostMatchesPattern(t *testing.T) {
+	tests := []struct {
+		host, pattern string
+		matches       bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"notexample.com", "example.com", false},
+		{"example.com", "*.example.com", false},
+		{"a.b.example.com", "*.example.com", true},
+		{"WWW.Example.com", "*.example.com", true},
+		{"cdn-eu.example.net", "cdn-*.example.net", true},
+		{"static.example.net", "cdn-*.example.net", false},
+		{"spam.example.xyz", "*.xyz", true},
+		{"anything.example", "*", true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.matches, hostMatchesPattern(test.host, test.pattern), "%s ~ %s", test.host, test.pattern)
+	}
+}
+
+func TestCheckDestinationPolicy(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	config.DestinationDenylist = []string{"*.xyz", "spam.example"}
+	assert.NoError(t, checkDestinationPolicy("https://example.com/"))
+	assert.Error(t, checkDestinationPolicy("https://free.prizes.xyz/"))
+	assert.Error(t, checkDestinationPolicy("https://www.spam.example/"))
+
+	// With an allowlist, only the listed domains can be shortened and the denylist still applies
+	config.DestinationAllowlist = []string{"corp.example", "*.intranet.example"}
+	assert.NoError(t, checkDestinationPolicy("https://wiki.corp.example/page"))
+	assert.NoError(t, checkDestinationPolicy("https://hr.intranet.example/"))
+	assert.Error(t, checkDestinationPolicy("https://intranet.example/"))
+	assert.Error(t, checkDestinationPolicy("https://example.com/"))
+	config.DestinationDenylist = []string{"secret.corp.example"}
+	assert.Error(t, checkDestinationPolicy("https://secret.corp.example/"))
+}
+
+func TestDestinationPolicyOnCreate(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.DestinationDenylist = []string{"*.spam.example"}
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://cheap.spam.example/offer", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DomainConfig holds the settings of an additional short domain served by the deployment.
+type DomainConfig struct {
+	// max_age used when the client doesn't send one
+	DefaultMaxAge int `json:"default_max_age"`
+	// Status code of redirects: 301, 302, 307 or 308
+	RedirectStatus int `json:"redirect_status"`
+}
+
+// The `linkKey` function returns the Redis key a link is stored under. Tokens are namespaced by
+// their short domain, so the same token can exist on several domains. Links of the default domain
+// keep using the bare token as key.
+func linkKey(domain, token string) string {
+	if domain == "" {
+		return token
+	}
+	return domain + "/" + token
+}
+
+// The function returns the key of a stored link.
+func (u URL) key() string {
+	return linkKey(u.Domain, u.Token)
+}
+
+// The function returns the configured short domain a request was sent to, or an empty string for the
+// default domain (any host that isn't configured as a short domain).
+func requestDomain(c *gin.Context) string {
+	host := c.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if _, ok := config.Domains[host]; ok {
+		return host
+	}
+	return ""
+}
+
+// The function returns the settings of a short domain, filling in the deployment defaults.
+func domainSettings(domain string) DomainConfig {
+	settings := config.Domains[domain]
+	if settings.DefaultMaxAge == 0 {
+		settings.DefaultMaxAge = config.LinkPolicy.DefaultMaxAge
+	}
+	switch settings.RedirectStatus {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		settings.RedirectStatus = http.StatusTemporaryRedirect
+	}
+	return settings
+}
+
+// The `resolveCreateDomain` function decides which short domain a new link is created on: the
+// domain the API key is bound to, the `domain` form parameter, or the domain the request was sent to.
+func resolveCreateDomain(c *gin.Context, apiKey *APIKey) (string, error) {
+	requested := strings.ToLower(c.PostForm("domain"))
+	if requested != "" {
+		if _, ok := config.Domains[requested]; !ok {
+			return "", newAPIError(http.StatusBadRequest, "Invalid domain parameter")
+		}
+	} else {
+		requested = requestDomain(c)
+	}
+
+	if apiKey != nil && apiKey.Domain != "" {
+		if c.PostForm("domain") != "" && requested != apiKey.Domain {
+			return "", newAPIError(http.StatusForbidden, "This API key can only create links on "+apiKey.Domain)
+		}
+		return apiKey.Domain, nil
+	}
+	return requested, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func performHostRequest(router *gin.Engine, method, host, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Host = host
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCustomDomains(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.Domains = map[string]DomainConfig{"go.acme.com": {DefaultMaxAge: 86400, RedirectStatus: http.StatusMovedPermanently}}
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	// Links are created on the domain the request is sent to
+	w := performHostRequest(router, "POST", "GO.acme.com:443", "/create", "long_url=https://example.com/acme", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "go.acme.com", created["domain"])
+
+	ttl := rdb.TTL(testCtx, linkKey("go.acme.com", created["token"])).Val()
+	assert.InDelta(t, 86400, ttl.Seconds(), 5)
+
+	w = performHostRequest(router, "GET", "go.acme.com", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://example.com/acme", w.Header().Get("Location"))
+
+	// The token doesn't exist on the default domain
+	w = performHostRequest(router, "GET", "localhost:8080", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performHostRequest(router, "POST", "localhost:8080", "/create", "long_url=https://example.com&domain=unknown.example", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDomainBoundAPIKey(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.Domains = map[string]DomainConfig{"go.acme.com": {}, "links.other.com": {}}
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=acme&domain=unknown.example", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var key struct {
+		Key    string `json:"key"`
+		Domain string `json:"domain"`
+	}
+	w = performRequest(router, "POST", "/api/admin/keys", "name=acme&domain=go.acme.com", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	assert.Equal(t, "go.acme.com", key.Domain)
+	acme := map[string]string{apiKeyHeader: key.Key}
+
+	// The key's domain wins over the host the request was sent to
+	w = performHostRequest(router, "POST", "localhost:8080", "/create", "long_url=https://example.com", acme)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "go.acme.com", created["domain"])
+
+	w = performHostRequest(router, "GET", "go.acme.com", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	// Let the background save of the access land before deleting
+	time.Sleep(50 * time.Millisecond)
+
+	w = performHostRequest(router, "POST", "localhost:8080", "/create", "long_url=https://example.com&domain=links.other.com", acme)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "DELETE", "/api/urls/"+created["token"]+"?domain=go.acme.com", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performHostRequest(router, "GET", "go.acme.com", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Emoji tokens such as "🐙🍉🚀🐢🌵" are an opt-in style for consumer-facing links. They are drawn from
+// emoji that are a single code point and shown as emoji without a variation selector, so they render
+// the same everywhere and survive copy and paste. In URLs they are percent-encoded UTF-8.
+const emojiChars = "🐀🐁🐂🐃🐄🐅🐆🐇🐈🐉🐊🐋🐌🐍🐎🐏🐐🐑🐒🐓🐔🐕🐖🐗🐘🐙🐚🐛🐜🐝🐞🐟" +
+	"🐠🐡🐢🐣🐤🐥🐦🐧🐨🐩🐪🐫🐬🐭🐮🐯🐰🐱🐲🐳🐴🐵🐶🐷🐸🐹🐺🐻🐼🐽🐾🍅" +
+	"🍇🍈🍉🍊🍋🍌🍍🍎🍏🍐🍒🍓🍔🍕🍖🍗🍘🍙🍚🍛🍜🍝🍞🍟🍠🍡🍢🍣🍤🍥🍦🍧" +
+	"🍨🍩🍪🍫🍬🍭🍮🍯🍰🍱🍲🍳🍴🍵🚀🌈🌙🌟🌲🌳🌴🌵🌷🌸🌹🌺🌻🌼🍀🍁🌊🌞"
+
+var emojiAlphabet = []rune(emojiChars)
+
+var emojiSet = func() map[rune]bool {
+	set := make(map[rune]bool, len(emojiAlphabet))
+	for _, r := range emojiAlphabet {
+		set[r] = true
+	}
+	return set
+}()
+
+// Number of emoji of an emoji token, about 35 bits of randomness
+const emojiTokenLength = 5
+
+// Variation selector-16, which some keyboards append to emoji
+const emojiVariationSelector = "\ufe0f"
+
+// The `emojiToken` function draws an emoji token with generator.
+func emojiToken(generator TokenGenerator) string {
+	var b strings.Builder
+	for i := 0; i < emojiTokenLength; i++ {
+		b.WriteRune(emojiAlphabet[randomIndex(generator, len(emojiAlphabet))])
+	}
+	return b.String()
+}
+
+// The function drops the variation selectors a keyboard or messenger may have added to the emoji of a
+// requested token, so it is looked up as it was generated.
+func normalizeToken(token string) string {
+	if isASCII(token) {
+		return token
+	}
+	return strings.ReplaceAll(token, emojiVariationSelector, "")
+}
+
+// The `malformedToken` function reports whether a requested token can't have been generated: tokens
+// are letters, digits and hyphens, or emoji of the emoji alphabet followed by an ASCII signature. Such
+// requests are rejected without looking them up. Links share the keyspace with the data kept next to
+// them, under keys with a colon such as "summary:<token>", and links of custom domains are stored as
+// "<domain>/<token>", so tokens with other characters must never be used as keys.
+func malformedToken(token string) bool {
+	if token == "" || !utf8.ValidString(token) {
+		return true
+	}
+	for _, r := range token {
+		switch {
+		case r >= utf8.RuneSelf:
+			if !emojiSet[r] {
+				return true
+			}
+		case (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-':
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
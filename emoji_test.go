@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmojiToken(t *testing.T) {
+	assert.Len(t, emojiSet, len(emojiAlphabet))
+	for _, generator := range []TokenGenerator{mathTokenGenerator{}, cryptoTokenGenerator{}} {
+		for i := 0; i < 100; i++ {
+			token := emojiToken(generator)
+			assert.Equal(t, emojiTokenLength, utf8.RuneCountInString(token))
+			assert.False(t, malformedToken(token), token)
+		}
+	}
+
+	assert.Equal(t, "🐙🍉", normalizeToken("🐙️🍉️"))
+	assert.Equal(t, "abc123", normalizeToken("abc123"))
+
+	assert.False(t, malformedToken("abc123"))
+	assert.False(t, malformedToken("🐙🍉🚀🐢🌵"))
+	assert.True(t, malformedToken("🐙🍉🚀🐢💀"))
+	assert.True(t, malformedToken("café"))
+	assert.True(t, malformedToken("abc\xff"))
+	assert.False(t, malformedToken("amber-otter-42"))
+	// Keys of the data kept next to links, and links of other domains, aren't tokens
+	for _, token := range []string{"summary:abc", "tombstone:abc", "example.com/abc", "abc_def", "abc.def", ""} {
+		assert.True(t, malformedToken(token), token)
+	}
+}
+
+func TestCreateWithEmojiToken(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/emoji&token_style=emoji", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, emojiTokenLength, utf8.RuneCountInString(created["token"]))
+
+	w = performRequest(router, "GET", "/"+url.PathEscape(created["token"]), "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/emoji", w.Header().Get("Location"))
+
+	// Variation selectors added to the emoji are ignored
+	selected := strings.Join(strings.Split(created["token"], ""), "️")
+	w = performRequest(router, "GET", "/"+url.PathEscape(selected), "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	w = performRequest(router, "GET", "/"+url.PathEscape("💀💀💀💀💀"), "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&token_style=emoji&one_time=true", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
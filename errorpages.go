@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Kinds of errors a visitor of a short link can run into, each with its own error page
+const (
+	pageNotFound    = "not_found"
+	pageExpired     = "expired"
+	pageRateLimited = "rate_limited"
+)
+
+var errorPageKinds = []string{pageNotFound, pageExpired, pageRateLimited}
+
+// The custom error page templates by kind, loaded from config.ErrorPagesDir at startup.
+var errorPages map[string]*template.Template
+
+// ErrorPageData is what the error page templates are rendered with. The link fields are filled in
+// when the link is known, e.g. {{.Title}} and {{.ExpiresAt}} of an exhausted link, or {{.ExpiredAt}}
+// and {{.Reason}} of one that is gone.
+type ErrorPageData struct {
+	Token   string
+	Status  int
+	Message string
+	// Title the owner gave the link
+	Title     string
+	CreatedAt string
+	ExpiresAt string
+	ExpiredAt string
+	Reason    string
+	// Operator settings, so pages can link somewhere useful
+	FallbackURL  string
+	ContactEmail string
+	// Branding of the link's workspace, nil if it has none
+	Branding *Branding
+	// API key that created the link, whose branding the page is rendered with
+	owner string
+}
+
+// The function returns the details of a link shown on error pages.
+func linkPageData(urlEntry URL) ErrorPageData {
+	return ErrorPageData{Title: urlEntry.Title, CreatedAt: urlEntry.CreatedAt, ExpiresAt: urlEntry.ExpiresAt, owner: urlEntry.CreatorAPIKey}
+}
+
+// The `loadErrorPages` function parses the error page templates of a directory, named after their
+// kind (e.g. "not_found.html"). Kinds without a file are left out.
+func loadErrorPages(dir string) (map[string]*template.Template, error) {
+	pages := make(map[string]*template.Template)
+	for _, kind := range errorPageKinds {
+		path := filepath.Join(dir, kind+".html")
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		page, err := template.ParseFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		pages[kind] = page
+	}
+	return pages, nil
+}
+
+// The `respondLinkError` function answers a visitor whose short link can't be followed. API clients
+// get the usual JSON message. Browsers (clients preferring HTML) get the custom error page of the kind,
+// or are redirected to the fallback URL if there is none, and get the JSON message if neither is
+// configured.
+func respondLinkError(c *gin.Context, status int, kind, message string) {
+	respondLinkErrorDetails(c, nil, status, kind, gin.H{"message": message}, ErrorPageData{})
+}
+
+// The function is respondLinkError for a link that is known, whose details the page can show.
+func respondLinkErrorFor(c *gin.Context, rdb *redis.Client, status int, kind, message string, urlEntry URL) {
+	respondLinkErrorDetails(c, rdb, status, kind, gin.H{"message": message}, linkPageData(urlEntry))
+}
+
+// The function is respondLinkError with a JSON body carrying more than the message, and the link
+// details the page is rendered with. The page gets the branding of the link's workspace, which is only
+// looked up when a page is rendered.
+func respondLinkErrorDetails(c *gin.Context, rdb *redis.Client, status int, kind string, body gin.H, data ErrorPageData) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		if page, ok := errorPages[kind]; ok {
+			data.Message, _ = body["message"].(string)
+			data.Token = requestToken(c)
+			data.Status = status
+			data.FallbackURL = config.FallbackURL
+			data.ContactEmail = config.ContactEmail
+			data.Branding = loadBranding(c.Request.Context(), rdb, data.owner)
+			c.Status(status)
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			if err := page.Execute(c.Writer, data); err != nil {
+				c.Error(err)
+			}
+			return
+		}
+		if config.FallbackURL != "" {
+			c.Redirect(http.StatusFound, config.FallbackURL)
+			return
+		}
+	}
+	c.JSON(status, body)
+}
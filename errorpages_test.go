@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestErrorPageFallbackURL(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	previous := config
+	defer func() { config = previous }()
+	config.FallbackURL = "https://company.example/"
+
+	// Browsers are sent to the fallback URL
+	w := performRequest(router, "GET", "/doesnotexist", "", map[string]string{"Accept": browserAccept})
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://company.example/", w.Header().Get("Location"))
+
+	// API clients still get JSON
+	for _, accept := range []string{"", "application/json"} {
+		w = performRequest(router, "GET", "/doesnotexist", "", map[string]string{"Accept": accept})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Error finding your short URL. It may have expired or never existed.", response["message"])
+	}
+}
+
+func TestCustomErrorPages(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "not_found.html"), []byte(`<h1>No link {{.Token}} here</h1>`), 0644)
+	os.WriteFile(filepath.Join(dir, "rate_limited.html"), []byte(`<h1>Slow down ({{.Status}}): {{.Message}}</h1>`), 0644)
+	pages, err := loadErrorPages(dir)
+	assert.NoError(t, err)
+	assert.Len(t, pages, 2)
+
+	previousPages := errorPages
+	defer func() { errorPages = previousPages }()
+	errorPages = pages
+	previous := config
+	defer func() { config = previous }()
+	config.FallbackURL = "https://company.example/"
+
+	browser := map[string]string{"Accept": browserAccept}
+	w := performRequest(router, "GET", "/doesnotexist", "", browser)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Equal(t, "<h1>No link doesnotexist here</h1>", w.Body.String())
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_per_hour=1", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	w = performRequest(router, "GET", "/"+token, "", browser)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	w = performRequest(router, "GET", "/"+token, "", browser)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "<h1>Slow down (429): Max access per hour reached</h1>", w.Body.String())
+
+	// Kinds without a page fall back to the fallback URL
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=1", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token = created["token"]
+	performRequest(router, "GET", "/"+token, "", nil)
+	time.Sleep(50 * time.Millisecond)
+	w = performRequest(router, "GET", "/"+token, "", browser)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://company.example/", w.Header().Get("Location"))
+}
+
+func TestLoadErrorPagesInvalidTemplate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "expired.html"), []byte(`{{.Token`), 0644)
+	_, err := loadErrorPages(dir)
+	assert.Error(t, err)
+}
+
+func TestErrorPageLinkDetails(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "expired.html"), []byte(`{{.Title}}|{{.Reason}}|{{if .ExpiredAt}}gone{{end}}|{{.ContactEmail}}|{{.FallbackURL}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "rate_limited.html"), []byte(`{{.Title}} is busy until the next hour, expires {{.ExpiresAt}}`), 0644)
+	pages, err := loadErrorPages(dir)
+	assert.NoError(t, err)
+
+	previousPages := errorPages
+	defer func() { errorPages = previousPages }()
+	errorPages = pages
+	previous := config
+	defer func() { config = previous }()
+	config.ContactEmail = "links@company.example"
+	config.FallbackURL = "https://company.example/"
+	browser := map[string]string{"Accept": browserAccept}
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&title=Spring+sale&max_per_hour=1&one_time=true", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&title=Price+list&max_per_hour=1", nil)
+	var limited map[string]string
+	json.Unmarshal(w.Body.Bytes(), &limited)
+	performRequest(router, "GET", "/"+limited["token"], "", nil)
+	w = performRequest(router, "GET", "/"+limited["token"], "", browser)
+	assert.Equal(t, "Price list is busy until the next hour, expires "+limited["expires_at"], w.Body.String())
+
+	// The tombstone of a consumed link still knows its title
+	performRequest(router, "GET", "/"+token, "", nil)
+	w = performRequest(router, "GET", "/"+token, "", browser)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "Spring sale|consumed|gone|links@company.example|https://company.example/", w.Body.String())
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&title="+strings.Repeat("x", 201), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkEvent is a change in the lifecycle of a link. Each event carries the link's record as it was
+// after the change, or before it for removals, so the link's state at any point in time is the record
+// of the last event before it.
+type LinkEvent struct {
+	// Position of the event in the link's event stream
+	ID string `json:"id"`
+	// "created", "imported", "updated", "frozen", "flagged", or one of the removals: "deleted", "max_access_reached",
+	// "consumed" (one-time links) and "rejected" (screening)
+	Type string `json:"type"`
+	At   string `json:"at"`
+	Link URL    `json:"link"`
+}
+
+// Events that remove a link, after which it doesn't exist anymore
+var removalEvents = map[string]bool{
+	"deleted":            true,
+	"max_access_reached": true,
+	"consumed":           true,
+	"rejected":           true,
+}
+
+// The events of a link are appended to a Redis stream that outlives the link by the retention period.
+func eventsKey(key string) string {
+	return "events:" + key
+}
+
+// The `recordEvent` function appends an event to the stream of a link when event sourcing is enabled.
+// Accesses aren't events, they are in the click log.
+func recordEvent(ctx context.Context, rdb redis.Cmdable, urlEntry URL, eventType string) {
+	if !config.EventSourcing {
+		return
+	}
+	data, _ := json.Marshal(urlEntry)
+	key := eventsKey(urlEntry.key())
+	rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		Values: map[string]interface{}{"type": eventType, "link": data},
+	})
+	rdb.Expire(ctx, key, max(urlEntry.ttl(), 0)+config.EventRetention)
+}
+
+// The function returns the time of an event from its ID, which starts with the Unix time in
+// milliseconds.
+func eventTime(id string) time.Time {
+	millis, _ := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return time.UnixMilli(millis)
+}
+
+func linkEventFrom(message redis.XMessage) LinkEvent {
+	event := LinkEvent{ID: message.ID, At: eventTime(message.ID).UTC().Format(time.RFC3339Nano)}
+	event.Type, _ = message.Values["type"].(string)
+	if data, ok := message.Values["link"].(string); ok {
+		json.Unmarshal([]byte(data), &event.Link)
+	}
+	return event
+}
+
+// The function reads the events of a link, oldest first.
+func linkEvents(ctx context.Context, rdb *redis.Client, key string) ([]LinkEvent, error) {
+	messages, err := rdb.XRange(ctx, eventsKey(key), "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]LinkEvent, 0, len(messages))
+	for _, message := range messages {
+		events = append(events, linkEventFrom(message))
+	}
+	return events, nil
+}
+
+// The `projectLink` function replays the events of a link up to a point in time. It returns the state
+// of the link at that time: "active", "expired", the removal event, or "not_created", along with its
+// record, which is nil before the link was created.
+func projectLink(events []LinkEvent, at time.Time) (string, *URL) {
+	for len(events) > 0 && eventTime(events[len(events)-1].ID).After(at) {
+		events = events[:len(events)-1]
+	}
+	if len(events) == 0 {
+		return "not_created", nil
+	}
+	last := events[len(events)-1]
+	switch {
+	case removalEvents[last.Type]:
+		return last.Type, &last.Link
+	case !at.Before(last.Link.expiry()):
+		return "expired", &last.Link
+	}
+	return "active", &last.Link
+}
+
+// The `linkHistoryHandler` function lists the events of a link, which outlive the link itself. With
+// `at` (RFC 3339), it returns the state of the link at that time instead, e.g. where it led on a
+// given day.
+func linkHistoryHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	if !config.EventSourcing {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Link history isn't recorded on this instance"})
+		return
+	}
+
+	var at time.Time
+	if value := c.Query("at"); value != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid at parameter, expected an RFC 3339 time"})
+			return
+		}
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	events, err := linkEvents(opCtx, rdb, key)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	if len(events) == 0 || !apiKey.owns(events[len(events)-1].Link.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	if at.IsZero() {
+		c.JSON(http.StatusOK, gin.H{"events": events})
+		return
+	}
+	state, link := projectLink(events, at)
+	c.JSON(http.StatusOK, gin.H{"at": at.Format(time.RFC3339), "state": state, "link": link})
+}
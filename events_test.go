@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectLink(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	id := func(at time.Time) string {
+		return strconv.FormatInt(at.UnixMilli(), 10) + "-0"
+	}
+	created := URL{Token: "abc", LongURL: "https://example.com/old", ExpiresAt: start.Add(10 * 24 * time.Hour).Format(time.RFC3339)}
+	frozen := created
+	frozen.Frozen = true
+	events := []LinkEvent{
+		{ID: id(start), Type: "created", Link: created},
+		{ID: id(start.Add(48 * time.Hour)), Type: "frozen", Link: frozen},
+	}
+
+	state, link := projectLink(events, start.Add(-time.Minute))
+	assert.Equal(t, "not_created", state)
+	assert.Nil(t, link)
+	state, link = projectLink(events, start.Add(24*time.Hour))
+	assert.Equal(t, "active", state)
+	assert.False(t, link.Frozen)
+	state, link = projectLink(events, start.Add(72*time.Hour))
+	assert.Equal(t, "active", state)
+	assert.True(t, link.Frozen)
+	state, _ = projectLink(events, start.Add(20*24*time.Hour))
+	assert.Equal(t, "expired", state)
+
+	events = append(events, LinkEvent{ID: id(start.Add(96 * time.Hour)), Type: "deleted", Link: frozen})
+	state, link = projectLink(events, start.Add(5*24*time.Hour))
+	assert.Equal(t, "deleted", state)
+	assert.Equal(t, "https://example.com/old", link.LongURL)
+}
+
+func TestLinkHistory(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.EventSourcing = true
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/history", admin)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+	performRequest(router, "POST", "/api/urls/"+token+"/freeze", "", admin)
+	w = performRequest(router, "DELETE", "/api/urls/"+token, "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The history outlives the link
+	var history struct {
+		Events []LinkEvent `json:"events"`
+	}
+	w = performRequest(router, "GET", "/api/v1/links/"+token+"/history", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	var types []string
+	for _, event := range history.Events {
+		types = append(types, event.Type)
+		assert.Equal(t, "https://example.com/history", event.Link.LongURL)
+	}
+	assert.Equal(t, []string{"created", "frozen", "deleted"}, types)
+	assert.True(t, history.Events[1].Link.Frozen)
+
+	var projection struct {
+		State string `json:"state"`
+		Link  *URL   `json:"link"`
+	}
+	w = performRequest(router, "GET", "/api/v1/links/"+token+"/history?at="+time.Now().Add(-time.Hour).Format(time.RFC3339), "", admin)
+	json.Unmarshal(w.Body.Bytes(), &projection)
+	assert.Equal(t, "not_created", projection.State)
+	assert.Nil(t, projection.Link)
+	w = performRequest(router, "GET", "/api/v1/links/"+token+"/history?at="+time.Now().Add(time.Hour).Format(time.RFC3339), "", admin)
+	json.Unmarshal(w.Body.Bytes(), &projection)
+	assert.Equal(t, "deleted", projection.State)
+	assert.Equal(t, token, projection.Link.Token)
+
+	w = performRequest(router, "GET", "/api/v1/links/"+token+"/history?at=yesterday", "", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var key map[string]string
+	w = performRequest(router, "POST", "/api/admin/keys", "name=other", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	w = performRequest(router, "GET", "/api/v1/links/"+token+"/history", "", map[string]string{apiKeyHeader: key["key"]})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.EventSourcing = false
+	w = performRequest(router, "GET", "/api/v1/links/"+token+"/history", "", admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Exemptions added through the admin API, in addition to the configured ones
+const (
+	exemptCIDRsKey   = "exemptions:cidrs"
+	exemptAPIKeysKey = "exemptions:keys"
+)
+
+// How long the exemption list is used before it is read from Redis again, so changes made through the
+// admin API reach every replica within this time
+const exemptionRefresh = 10 * time.Second
+
+// exemptionList holds the client networks and API key IDs that bypass bot filtering, e.g. internal
+// monitoring or partner integrations that check links with automated clients.
+type exemptionList struct {
+	mu       sync.Mutex
+	networks []*net.IPNet
+	keys     map[string]bool
+	loaded   time.Time
+}
+
+var exemptions = &exemptionList{}
+
+// The `parseCIDR` function accepts a network in CIDR notation or a single address.
+func parseCIDR(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "CIDR address", Text: value}
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// The function reloads the list if it is older than exemptionRefresh. While Redis can't be reached the
+// previous list stays in use.
+func (e *exemptionList) refresh(ctx context.Context, rdb *redis.Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Since(e.loaded) < exemptionRefresh {
+		return
+	}
+
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	var cidrs, keys *redis.StringSliceCmd
+	_, err := rdb.Pipelined(opCtx, func(pipe redis.Pipeliner) error {
+		cidrs = pipe.SMembers(opCtx, exemptCIDRsKey)
+		keys = pipe.SMembers(opCtx, exemptAPIKeysKey)
+		return nil
+	})
+	if err != nil && e.keys != nil {
+		return
+	}
+
+	e.networks, e.keys = nil, map[string]bool{}
+	for _, cidr := range append(config.ExemptCIDRs, cidrs.Val()...) {
+		if network, err := parseCIDR(cidr); err == nil {
+			e.networks = append(e.networks, network)
+		}
+	}
+	for _, id := range append(config.ExemptAPIKeys, keys.Val()...) {
+		e.keys[id] = true
+	}
+	e.loaded = time.Now()
+}
+
+// The function drops the cached list, so changes made through this process apply immediately.
+func (e *exemptionList) invalidate() {
+	e.mu.Lock()
+	e.loaded = time.Time{}
+	e.mu.Unlock()
+}
+
+func (e *exemptionList) covers(ip net.IP, keyID string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if keyID != "" && e.keys[keyID] {
+		return true
+	}
+	for _, network := range e.networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// The `exemptRequest` function reports whether a request comes from an exempt network or carries the
+// X-API-Key of an exempt key. An unknown key doesn't fail the request, it just isn't exempt.
+func exemptRequest(c *gin.Context, rdb *redis.Client) bool {
+	exemptions.refresh(c.Request.Context(), rdb)
+	ip := net.ParseIP(c.ClientIP())
+	if exemptions.covers(ip, "") {
+		return true
+	}
+
+	secret := c.GetHeader(apiKeyHeader)
+	if secret == "" {
+		return false
+	}
+	if isAdminKey(secret) {
+		return exemptions.covers(nil, adminAPIKey.ID)
+	}
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := rdb.Get(opCtx, apiKeyRedisKey(secret)).Result()
+	if err != nil {
+		return false
+	}
+	var key APIKey
+	if json.Unmarshal([]byte(val), &key) != nil {
+		return false
+	}
+	return exemptions.covers(nil, key.ID)
+}
+
+// The `listExemptionsHandler` function lists the exempt networks and API keys. Configured exemptions
+// are listed separately, they can only be changed in the configuration.
+func listExemptionsHandler(c *gin.Context, rdb *redis.Client) {
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	cidrs, err := rdb.SMembers(opCtx, exemptCIDRsKey).Result()
+	var keys []string
+	if err == nil {
+		keys, err = rdb.SMembers(opCtx, exemptAPIKeysKey).Result()
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	sort.Strings(cidrs)
+	sort.Strings(keys)
+
+	c.JSON(http.StatusOK, gin.H{
+		"cidrs":    cidrs,
+		"api_keys": keys,
+		"configured": gin.H{
+			"cidrs":    append([]string{}, config.ExemptCIDRs...),
+			"api_keys": append([]string{}, config.ExemptAPIKeys...),
+		},
+	})
+}
+
+// The function reads the exemption of an add or remove request: a `cidr` (or single address), or the
+// ID of an API key as `api_key`.
+func exemptionParams(cidr, apiKey string) (string, string, error) {
+	switch {
+	case cidr != "" && apiKey == "":
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			return "", "", newAPIError(http.StatusBadRequest, "Invalid cidr parameter")
+		}
+		return exemptCIDRsKey, network.String(), nil
+	case apiKey != "" && cidr == "":
+		if apiKey != adminAPIKey.ID && !strings.HasPrefix(apiKey, "key_") && !strings.HasPrefix(apiKey, jwtOwnerPrefix) {
+			return "", "", newAPIError(http.StatusBadRequest, "Invalid api_key parameter, expected the id of a key")
+		}
+		return exemptAPIKeysKey, apiKey, nil
+	}
+	return "", "", newAPIError(http.StatusBadRequest, "Either cidr or api_key is required")
+}
+
+// The `addExemptionHandler` function exempts a network or API key at runtime.
+func addExemptionHandler(c *gin.Context, rdb *redis.Client) {
+	setKey, member, err := exemptionParams(c.PostForm("cidr"), c.PostForm("api_key"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	if err := rdb.SAdd(opCtx, setKey, member).Err(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	exemptions.invalidate()
+	c.Set(auditTargetKey, member)
+	c.JSON(http.StatusOK, gin.H{"message": "Added", "exemption": member})
+}
+
+// The `removeExemptionHandler` function removes an exemption added through the admin API.
+func removeExemptionHandler(c *gin.Context, rdb *redis.Client) {
+	setKey, member, err := exemptionParams(c.Query("cidr"), c.Query("api_key"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	removed, err := rdb.SRem(opCtx, setKey, member).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No such exemption"})
+		return
+	}
+	exemptions.invalidate()
+	c.Set(auditTargetKey, member)
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted", "exemption": member})
+}
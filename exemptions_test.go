@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCIDR(t *testing.T) {
+	for value, expected := range map[string]string{
+		"10.0.0.0/8":  "10.0.0.0/8",
+		"10.1.2.3/8":  "10.0.0.0/8",
+		"192.0.2.7":   "192.0.2.7/32",
+		"2001:db8::1": "2001:db8::1/128",
+	} {
+		network, err := parseCIDR(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, network.String())
+	}
+	_, err := parseCIDR("example.com")
+	assert.Error(t, err)
+}
+
+func TestExemptions(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.BotMode = "preview"
+	previousExemptions := exemptions
+	exemptions = &exemptionList{}
+	defer func() { config, exemptions = previous, previousExemptions }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	// httptest requests come from 192.0.2.1
+	monitor := func(headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/"+created["token"], nil)
+		req.Header.Set("User-Agent", "curl/8.5.0")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w = monitor(nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "POST", "/api/admin/exemptions", "cidr=192.0.2.0/24", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = monitor(nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	w = performRequest(router, "DELETE", "/api/admin/exemptions?cidr=192.0.2.0/24", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = monitor(nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Clients can also be exempted by their API key
+	var key struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	w = performRequest(router, "POST", "/api/admin/keys", "name=monitoring", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	w = performRequest(router, "POST", "/api/admin/exemptions", "api_key="+key.ID, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = monitor(map[string]string{apiKeyHeader: key.Key})
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	w = monitor(map[string]string{apiKeyHeader: "unknown"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.ExemptCIDRs = []string{"10.0.0.0/8"}
+	var list struct {
+		CIDRs      []string            `json:"cidrs"`
+		APIKeys    []string            `json:"api_keys"`
+		Configured map[string][]string `json:"configured"`
+	}
+	w = performRequest(router, "GET", "/api/admin/exemptions", "", admin)
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Empty(t, list.CIDRs)
+	assert.Equal(t, []string{key.ID}, list.APIKeys)
+	assert.Equal(t, []string{"10.0.0.0/8"}, list.Configured["cidrs"])
+
+	for _, form := range []string{"cidr=nonsense", "api_key=secret-value", "", "cidr=10.0.0.1&api_key=" + key.ID} {
+		w = performRequest(router, "POST", "/api/admin/exemptions", form, admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code, form)
+	}
+	w = performRequest(router, "DELETE", "/api/admin/exemptions?cidr=10.9.9.9", "", admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performRequest(router, "GET", "/api/admin/exemptions", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
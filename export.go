@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Longest record accepted by an import
+const maxImportLine = 1 << 20
+
+// The `exportHandler` function streams every active link as newline-delimited JSON, one stored record
+// per line, including the links in cold storage. Links that expire during the export may or may not
+// be included.
+func exportHandler(c *gin.Context, rdb *redis.Client) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="links.ndjson"`)
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	iter := rdb.SScan(ctx, allURLsIndex, 0, "", 500).Iterator()
+	var batch []string
+	flush := func() error {
+		opCtx, cancel := readContext(ctx)
+		defer cancel()
+		values, err := rdb.MGet(opCtx, batch...).Result()
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			if data, ok := value.(string); ok {
+				c.Writer.WriteString(data + "\n")
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for iter.Next(ctx) {
+		if batch = append(batch, iter.Val()); len(batch) == 500 {
+			if err := flush(); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		c.Error(err)
+		return
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if coldStore != nil {
+		err := coldStore.ForEach(func(key string, record []byte, expiresAt time.Time) error {
+			_, err := c.Writer.Write(append(record, '\n'))
+			return err
+		})
+		if err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// ImportResult reports what an import did with the records it was sent.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	// Records of links that already exist, unless overwrite was requested
+	Skipped int `json:"skipped"`
+	// Records of links that expired since they were exported
+	Expired int           `json:"expired"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// ImportError is a record that couldn't be imported, by its line number.
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// The function stores an exported link record with its remaining lifetime, along with its index
+// entries, tombstone and quota entry. It reports whether the record was stored.
+func importLink(ctx context.Context, rdb *redis.Client, urlEntry URL, overwrite bool) (bool, error) {
+	// Links are imported into the region the request was routed to, unless another region has the token
+	urlEntry.Region = contextRegion(ctx)
+	claimed, err := claimToken(ctx, urlEntry)
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		region, err := tokenRegion(ctx, urlEntry.key())
+		if err != nil || !overwrite || region != urlEntry.Region {
+			return false, err
+		}
+	}
+
+	data, err := json.Marshal(urlEntry)
+	if err != nil {
+		return false, err
+	}
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	mode := "NX"
+	if overwrite {
+		mode = ""
+	}
+	stored, err := rdb.SetArgs(opCtx, urlEntry.key(), data, redis.SetArgs{Mode: mode, TTL: urlEntry.ttl()}).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil || stored != "OK" {
+		return false, err
+	}
+
+	_, err = rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		// Accesses are counted on from the imported record
+		pipe.Del(opCtx, accessCountsKey(urlEntry.key()))
+		armRemainingUses(opCtx, pipe, urlEntry)
+		armTombstone(opCtx, pipe, urlEntry)
+		trackExpiry(opCtx, pipe, urlEntry)
+		recordEvent(opCtx, pipe, urlEntry, "imported")
+		indexOwnedLink(opCtx, pipe, urlEntry)
+		for _, key := range indexKeys(urlEntry) {
+			pipe.SAdd(opCtx, key, urlEntry.key())
+		}
+		if urlEntry.CreatorAPIKey != "" {
+			pipe.ZAdd(opCtx, activeLinksKey(urlEntry.CreatorAPIKey), redis.Z{Score: float64(urlEntry.expiry().Unix()), Member: urlEntry.key()})
+		}
+		invalidateListings(opCtx, pipe)
+		return nil
+	})
+	linkCache.invalidate(urlEntry.key())
+	return true, err
+}
+
+// The `importHandler` function restores links from a newline-delimited JSON export, e.g. a backup or
+// the export of another deployment. Existing links are kept unless `overwrite=true`. Records are
+// imported one by one, so a failed import can be retried with the same file.
+func importHandler(c *gin.Context, rdb *redis.Client) {
+	overwrite := c.Query("overwrite") == "true"
+	result := ImportResult{Errors: []ImportError{}}
+
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var urlEntry URL
+		if err := json.Unmarshal([]byte(text), &urlEntry); err != nil {
+			result.Errors = append(result.Errors, ImportError{Line: line, Message: "Invalid JSON"})
+			continue
+		}
+		// Links are stored under their bare token, which must not reach into other key namespaces, and
+		// must be one redirects accept
+		if malformedToken(urlEntry.Token) || strings.ContainsAny(urlEntry.Domain, "/:") {
+			result.Errors = append(result.Errors, ImportError{Line: line, Message: "Invalid token"})
+			continue
+		}
+		if _, err := normalizeDestination(urlEntry.LongURL); err != nil {
+			result.Errors = append(result.Errors, ImportError{Line: line, Message: "Invalid long_url"})
+			continue
+		}
+		if urlEntry.ttl() < time.Second {
+			result.Expired++
+			continue
+		}
+
+		stored, err := importLink(c.Request.Context(), rdb, urlEntry, overwrite)
+		switch {
+		case err != nil:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later.", "result": result, "line": line})
+			return
+		case stored:
+			result.Imported++
+		default:
+			result.Skipped++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error reading the import after line " + strconv.Itoa(line), "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
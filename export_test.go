@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/exported&tags=backup", admin)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	w = performRequest(router, "GET", "/api/export", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	var exported string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var urlEntry URL
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &urlEntry))
+		if urlEntry.Token == token {
+			exported = scanner.Text()
+		}
+	}
+	assert.NotEmpty(t, exported)
+
+	// Restore the link after it is gone, with its remaining lifetime and index entries
+	w = performRequest(router, "DELETE", "/api/urls/"+token, "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	expired := `{"token":"expiredimport","long_url":"https://example.com","expires_at":"` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `"}`
+	body := strings.Join([]string{exported, "", "not json", `{"token":"apikey:secret","long_url":"https://example.com"}`, expired}, "\n")
+	var result ImportResult
+	w = performRequest(router, "POST", "/api/import", body, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	assert.Equal(t, ImportResult{Imported: 1, Expired: 1, Errors: []ImportError{{Line: 3, Message: "Invalid JSON"}, {Line: 4, Message: "Invalid token"}}}, result)
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/exported", w.Header().Get("Location"))
+	assert.True(t, rdb.SIsMember(testCtx, tagIndexKey("backup"), token).Val())
+	assert.Greater(t, rdb.TTL(testCtx, token).Val(), 50*time.Minute)
+
+	// Existing links are kept unless overwrite is asked for
+	w = performRequest(router, "POST", "/api/import", exported, admin)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	assert.Equal(t, 1, result.Skipped)
+	w = performRequest(router, "POST", "/api/import?overwrite=true", exported, admin)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	assert.Equal(t, 1, result.Imported)
+
+	w = performRequest(router, "GET", "/api/export", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
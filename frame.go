@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var frameTemplate = template.Must(template.New("frame").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>html, body, iframe { margin: 0; padding: 0; width: 100%; height: 100%; border: 0; overflow: hidden; }</style>
+</head>
+<body>
+<iframe src="{{.Destination}}" title="{{.Title}}" allow="fullscreen; clipboard-write" referrerpolicy="no-referrer-when-downgrade"></iframe>
+<noscript><p><a href="{{.Destination}}">Open {{.Title}}</a></p></noscript>
+</body>
+</html>
+`))
+
+// The `framingAllowed` function reads the headers of a destination for protections against being shown
+// in a frame on another site: X-Frame-Options, and the frame-ancestors directive of a
+// Content-Security-Policy, which only permits framing anywhere as "*" or by scheme.
+func framingAllowed(header http.Header) bool {
+	if header.Get("X-Frame-Options") != "" {
+		return false
+	}
+	for _, policy := range header.Values("Content-Security-Policy") {
+		for _, directive := range strings.Split(policy, ";") {
+			fields := strings.Fields(strings.ToLower(directive))
+			if len(fields) == 0 || fields[0] != "frame-ancestors" {
+				continue
+			}
+			allowed := false
+			for _, source := range fields[1:] {
+				if source == "*" || source == "https:" || source == "http:" {
+					allowed = true
+				}
+			}
+			if !allowed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The `probeFraming` function checks whether a destination lets itself be framed under the short
+// domain. Destinations that can't be reached are treated as refusing, so their links redirect. Like
+// other destination fetches it can't reach internal addresses, also not by redirect, since links are
+// probed on anonymous creation.
+func probeFraming(ctx context.Context, longURL string) bool {
+	resp, err := fetchDestination(ctx, http.MethodGet, longURL)
+	if err != nil {
+		log.Printf("frame probe %s: %v", longURL, err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400 && framingAllowed(resp.Header)
+}
+
+// The `serveDestination` function sends the visitor of a link to its destination: with a redirect, or
+// for links in frame mode, with a page showing the destination in a full-page frame, so the short URL
+// stays in the address bar. HEAD requests always get the redirect.
+func serveDestination(c *gin.Context, urlEntry URL, destination string) {
+	if !urlEntry.Frame || c.Request.Method != http.MethodGet {
+		c.Redirect(domainSettings(urlEntry.Domain).RedirectStatus, destination)
+		return
+	}
+	title := urlEntry.Title
+	if title == "" {
+		title = displayURL(destination)
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	frameTemplate.Execute(c.Writer, gin.H{"Title": title, "Destination": destination})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramingAllowed(t *testing.T) {
+	cases := []struct {
+		header  map[string]string
+		allowed bool
+	}{
+		{map[string]string{}, true},
+		{map[string]string{"X-Frame-Options": "DENY"}, false},
+		{map[string]string{"X-Frame-Options": "SAMEORIGIN"}, false},
+		{map[string]string{"Content-Security-Policy": "default-src 'self'; frame-ancestors 'self'"}, false},
+		{map[string]string{"Content-Security-Policy": "frame-ancestors 'none'"}, false},
+		{map[string]string{"Content-Security-Policy": "frame-ancestors *"}, true},
+		{map[string]string{"Content-Security-Policy": "script-src 'self'"}, true},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		for name, value := range tc.header {
+			header.Set(name, value)
+		}
+		assert.Equal(t, tc.allowed, framingAllowed(header), tc.header)
+	}
+}
+
+func TestFrameMode(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	frameable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer frameable.Close()
+	protected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+	}))
+	defer protected.Close()
+
+	previous := config
+	config.InterstitialMode = "off"
+	config.OutboundHostInterval = 0
+	config.OutboundAllowPrivate = true
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	var created map[string]any
+
+	w := performRequest(router, "POST", "/create", "long_url="+frameable.URL+"/page&frame=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, true, created["frame"])
+
+	w = performRequest(router, "GET", "/"+created["token"].(string), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<iframe src="`+frameable.URL+`/page"`)
+
+	// HEAD requests still get the redirect
+	w = performRequest(router, "HEAD", "/"+created["token"].(string), "", nil)
+	assert.Equal(t, frameable.URL+"/page", w.Header().Get("Location"))
+
+	// Destinations that can't be framed are redirected to
+	w = performRequest(router, "POST", "/create", "long_url="+protected.URL+"/page&frame=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, false, created["frame"])
+
+	w = performRequest(router, "GET", "/"+created["token"].(string), "", nil)
+	assert.Equal(t, protected.URL+"/page", w.Header().Get("Location"))
+}
+
+func TestProbeFramingRefusesPrivate(t *testing.T) {
+	requests := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer internal.Close()
+	// A public-looking destination redirecting to an internal one is refused at the redirect
+	redirected := 0
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected++
+		http.Redirect(w, r, internal.URL, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	previous := config
+	config.OutboundHostInterval = 0
+	config.OutboundAllowPrivate = false
+	defer func() { config = previous }()
+
+	assert.False(t, probeFraming(context.Background(), internal.URL))
+	assert.Equal(t, 0, requests)
+
+	// Only the redirecting server is let through here, to show the redirect target is checked on its own
+	transport := outboundClient.Transport
+	outboundClient.Transport = &http.Transport{DialContext: (&net.Dialer{Control: func(network, address string, c syscall.RawConn) error {
+		if address == redirecting.Listener.Addr().String() {
+			return nil
+		}
+		return guardOutboundDial(network, address, c)
+	}}).DialContext}
+	defer func() { outboundClient.Transport = transport }()
+	assert.False(t, probeFraming(context.Background(), redirecting.URL))
+	assert.Equal(t, 1, redirected)
+	assert.Equal(t, 0, requests)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkSummary is the final report of a frozen link. It is written once when the link is frozen and
+// kept after the link itself has expired or been deleted.
+type LinkSummary struct {
+	Token          string `json:"token"`
+	Domain         string `json:"domain,omitempty"`
+	LongURL        string `json:"long_url"`
+	Owner          string `json:"owner,omitempty"`
+	CampaignID     string `json:"campaign_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	FrozenAt       string `json:"frozen_at"`
+	Disabled       bool   `json:"disabled"`
+	TotalClicks    int    `json:"total_clicks"`
+	UniqueVisitors int    `json:"unique_visitors"`
+	LastAccessedAt string `json:"last_accessed_at,omitempty"`
+	// Breakdowns are computed from the click log and its rollups. The log only keeps the most recent
+	// events when a link had more clicks than it holds; LoggedClicks is the number of events covered.
+	LoggedClicks     int            `json:"logged_clicks"`
+	ClicksByDay      map[string]int `json:"clicks_by_day"`
+	ClicksByCountry  map[string]int `json:"clicks_by_country"`
+	ClicksByReferrer map[string]int `json:"clicks_by_referrer"`
+}
+
+func summaryKey(key string) string {
+	return "summary:" + key
+}
+
+// The function builds the summary of a link from its record, its click log and the rollups of older
+// click events.
+func summarizeLink(ctx context.Context, rdb *redis.Client, urlEntry URL) (LinkSummary, error) {
+	summaries, err := summarizeLinks(ctx, rdb, []URL{urlEntry})
+	if err != nil {
+		return LinkSummary{}, err
+	}
+	return summaries[0], nil
+}
+
+// The function builds the summaries of several links, reading their click logs, rollups and unique
+// visitors in one pipeline.
+func summarizeLinks(ctx context.Context, rdb *redis.Client, urlEntries []URL) ([]LinkSummary, error) {
+	rollups := make([]*redis.MapStringStringCmd, len(urlEntries))
+	logs := make([]*redis.XMessageSliceCmd, len(urlEntries))
+	uniques := make([]*redis.IntCmd, len(urlEntries))
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, urlEntry := range urlEntries {
+			rollups[i] = pipe.HGetAll(ctx, clickRollupKey(urlEntry.key()))
+			logs[i] = pipe.XRange(ctx, clickLogKey(urlEntry.key()), "-", "+")
+			uniques[i] = pipe.PFCount(ctx, uniquesKey(urlEntry.key()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]LinkSummary, len(urlEntries))
+	for i, urlEntry := range urlEntries {
+		summaries[i] = buildSummary(urlEntry, rollups[i].Val(), logs[i].Val(), uniques[i].Val())
+	}
+	return summaries, nil
+}
+
+func buildSummary(urlEntry URL, rollup map[string]string, messages []redis.XMessage, uniques int64) LinkSummary {
+	counts := map[string]int{}
+	for field, value := range rollup {
+		counts[field], _ = strconv.Atoi(value)
+	}
+	for _, message := range messages {
+		counts["total"]++
+		for _, field := range clickRollupFields(clickEventFrom(message)) {
+			counts[field]++
+		}
+	}
+
+	summary := LinkSummary{
+		Token:            urlEntry.Token,
+		Domain:           urlEntry.Domain,
+		LongURL:          urlEntry.LongURL,
+		Owner:            urlEntry.CreatorAPIKey,
+		CampaignID:       urlEntry.CampaignID,
+		CreatedAt:        urlEntry.CreatedAt,
+		TotalClicks:      urlEntry.CurrentAccessCount,
+		UniqueVisitors:   int(uniques),
+		LastAccessedAt:   urlEntry.LastAccessedAt,
+		LoggedClicks:     counts["total"],
+		ClicksByDay:      map[string]int{},
+		ClicksByCountry:  map[string]int{},
+		ClicksByReferrer: map[string]int{},
+	}
+	for field, count := range counts {
+		kind, value, _ := strings.Cut(field, ":")
+		switch kind {
+		case "day":
+			summary.ClicksByDay[value] += count
+		case "country":
+			summary.ClicksByCountry[value] += count
+		case "referrer":
+			summary.ClicksByReferrer[value] += count
+		}
+	}
+	return summary
+}
+
+// The `freezeURLHandler` function finalizes a link, e.g. at the end of a campaign: its statistics are
+// snapshotted into a summary that never changes afterwards, and accesses stop being counted. With
+// `disable=true` the link also stops redirecting.
+func freezeURLHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+	if urlEntry.Frozen {
+		c.JSON(http.StatusConflict, gin.H{"message": "The link is already frozen"})
+		return
+	}
+	loadAccessCount(opCtx, rdb, &urlEntry)
+
+	summary, err := summarizeLink(opCtx, rdb, urlEntry)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	summary.FrozenAt = time.Now().Format(time.RFC3339)
+	summary.Disabled = c.PostForm("disable") == "true"
+	if summary.Disabled {
+		c.Set(auditActionKey, "link.disable")
+	}
+
+	urlEntry.Frozen = true
+	urlEntry.Disabled = summary.Disabled
+	data, _ := json.Marshal(urlEntry)
+	summaryData, _ := json.Marshal(summary)
+	_, err = rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		pipe.Set(opCtx, summaryKey(key), summaryData, 0)
+		pipe.Set(opCtx, key, data, redis.KeepTTL)
+		recordEvent(opCtx, pipe, urlEntry, "frozen")
+		linkCache.invalidate(key)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// The `summaryHandler` function returns the summary recorded when a link was frozen.
+func summaryHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := rdb.Get(opCtx, summaryKey(key)).Result()
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var summary LinkSummary
+	if err == redis.Nil || json.Unmarshal([]byte(val), &summary) != nil || !apiKey.owns(summary.Owner) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No summary found, the link hasn't been frozen"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
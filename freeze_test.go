@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreezeURL(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=campaigns", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	owner := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", owner)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	for _, headers := range []map[string]string{
+		{"CF-IPCountry": "DE", "Referer": "https://news.example/a"},
+		{"CF-IPCountry": "DE"},
+		{"CF-IPCountry": "FR", "Referer": "https://News.example/b"},
+	} {
+		performRequest(router, "GET", "/"+token, "", headers)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	w = performRequest(router, "POST", "/api/urls/"+token+"/freeze", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "POST", "/api/urls/"+token+"/freeze", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var summary LinkSummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	assert.Equal(t, 3, summary.TotalClicks)
+	assert.Equal(t, 3, summary.LoggedClicks)
+	assert.Equal(t, map[string]int{"DE": 2, "FR": 1}, summary.ClicksByCountry)
+	assert.Equal(t, map[string]int{"news.example": 2, "direct": 1}, summary.ClicksByReferrer)
+	assert.False(t, summary.Disabled)
+
+	// The link keeps redirecting but no longer counts
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	assert.Equal(t, 3, urlEntry.CurrentAccessCount)
+
+	w = performRequest(router, "POST", "/api/urls/"+token+"/freeze", "", owner)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The summary outlives the link
+	performRequest(router, "DELETE", "/api/urls/"+token, "", admin)
+	w = performRequest(router, "GET", "/api/urls/"+token+"/summary", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stored LinkSummary
+	json.Unmarshal(w.Body.Bytes(), &stored)
+	assert.Equal(t, summary, stored)
+}
+
+func TestFreezeAndDisable(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = performRequest(router, "POST", "/api/urls/"+created["token"]+"/freeze", "disable=true", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestSummaryIsNotALink(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	// The final report of a frozen link shares the keyspace with links, but can't be requested as one
+	data, _ := json.Marshal(LinkSummary{TotalClicks: 3})
+	rdb.Set(testCtx, summaryKey("frozen1"), data, 0)
+	for _, path := range []string{"/" + summaryKey("frozen1"), "/" + summaryKey("frozen1") + "/preview", "/?t=" + summaryKey("frozen1")} {
+		w := performRequest(router, "GET", path, "", nil)
+		assert.NotEqual(t, http.StatusOK, w.Code, path)
+		assert.NotEqual(t, http.StatusTemporaryRedirect, w.Code, path)
+	}
+	assert.Equal(t, string(data), rdb.Get(testCtx, summaryKey("frozen1")).Val())
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, tombstoneKey(summaryKey("frozen1"))).Val())
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Overall states of a link in its health report
+const (
+	healthOK       = "healthy"
+	healthDegraded = "degraded"
+	healthFailing  = "unhealthy"
+)
+
+// DestinationHealth is the outcome of a request to a link's destination.
+type DestinationHealth struct {
+	Reachable  bool   `json:"reachable"`
+	StatusCode int    `json:"status_code,omitempty"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+	CheckedAt  string `json:"checked_at"`
+}
+
+// CertificateHealth describes the TLS certificate of an https destination.
+type CertificateHealth struct {
+	Valid         bool   `json:"valid"`
+	Issuer        string `json:"issuer,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	DaysRemaining int    `json:"days_remaining"`
+	Error         string `json:"error,omitempty"`
+}
+
+// WindowQuota is the use of an access limit in its current window.
+type WindowQuota struct {
+	Window    string `json:"window"`
+	Max       int    `json:"max"`
+	Remaining int    `json:"remaining"`
+	ResetsAt  string `json:"resets_at"`
+}
+
+// QuotaHealth holds the accesses a link has left, -1 when there is no limit.
+type QuotaHealth struct {
+	MaxAccess int           `json:"max_access"`
+	Remaining int           `json:"remaining"`
+	Windows   []WindowQuota `json:"windows,omitempty"`
+}
+
+// LinkHealth is the health report of a link, combining everything that can stop it from working.
+type LinkHealth struct {
+	Token  string `json:"token"`
+	Domain string `json:"domain,omitempty"`
+	// "healthy", "degraded" or "unhealthy", with the reasons in Issues
+	Status           string             `json:"status"`
+	Issues           []string           `json:"issues"`
+	Destination      DestinationHealth  `json:"destination"`
+	Certificate      *CertificateHealth `json:"certificate,omitempty"`
+	Quota            QuotaHealth        `json:"quota"`
+	ExpiresAt        string             `json:"expires_at"`
+	SecondsRemaining int64              `json:"seconds_remaining"`
+}
+
+// The result of the last destination check is kept for HEALTH_CHECK_TTL, so dashboards polling the
+// report don't turn into a stream of requests against the destination.
+type destinationCheck struct {
+	Destination DestinationHealth  `json:"destination"`
+	Certificate *CertificateHealth `json:"certificate,omitempty"`
+}
+
+func healthCheckKey(key string) string {
+	return "health:" + key
+}
+
+// The `checkDestination` function requests a destination the way a visitor would reach it and records
+// its status, latency and certificate. Servers that don't support HEAD are asked with GET.
+func checkDestination(ctx context.Context, destination string) destinationCheck {
+	var check destinationCheck
+	start := time.Now()
+	resp, err := fetchDestination(ctx, http.MethodHead, destination)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = fetchDestination(ctx, http.MethodGet, destination)
+	}
+	check.Destination.LatencyMS = time.Since(start).Milliseconds()
+	check.Destination.CheckedAt = time.Now().UTC().Format(time.RFC3339)
+
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		check.Certificate = &CertificateHealth{Error: certErr.Err.Error()}
+		if len(certErr.UnverifiedCertificates) > 0 {
+			cert := certErr.UnverifiedCertificates[0]
+			check.Certificate.Issuer = cert.Issuer.String()
+			check.Certificate.ExpiresAt = cert.NotAfter.UTC().Format(time.RFC3339)
+			check.Certificate.DaysRemaining = int(time.Until(cert.NotAfter).Hours() / 24)
+		}
+	}
+	if err != nil {
+		check.Destination.Error = err.Error()
+		return check
+	}
+	resp.Body.Close()
+
+	check.Destination.Reachable = true
+	check.Destination.StatusCode = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		check.Certificate = &CertificateHealth{
+			Valid:         true,
+			Issuer:        cert.Issuer.String(),
+			ExpiresAt:     cert.NotAfter.UTC().Format(time.RFC3339),
+			DaysRemaining: int(time.Until(cert.NotAfter).Hours() / 24),
+		}
+	}
+	return check
+}
+
+// The function returns the remaining accesses of a link, overall and in the current window of each
+// access limit.
+func linkQuota(ctx context.Context, rdb *redis.Client, urlEntry URL) (QuotaHealth, error) {
+	quota := QuotaHealth{MaxAccess: urlEntry.MaxAccess, Remaining: -1}
+	if urlEntry.MaxAccess != -1 {
+		quota.Remaining = max(urlEntry.MaxAccess-urlEntry.CurrentAccessCount, 0)
+	}
+	if urlEntry.OneTime {
+		quota.MaxAccess, quota.Remaining = 1, 1
+	}
+
+	limits := accessLimits(urlEntry)
+	if len(limits) == 0 {
+		return quota, nil
+	}
+	now := time.Now()
+	keys := make([]string, len(limits))
+	for i, limit := range limits {
+		keys[i] = limit.window.key(urlEntry.key(), now)
+	}
+	used, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return quota, err
+	}
+	for i, limit := range limits {
+		count := 0
+		if text, ok := used[i].(string); ok {
+			count, _ = strconv.Atoi(text)
+		}
+		quota.Windows = append(quota.Windows, WindowQuota{
+			Window:    limit.window.name,
+			Max:       limit.max,
+			Remaining: max(limit.max-count, 0),
+			ResetsAt:  limit.window.end(now).Format(time.RFC3339),
+		})
+	}
+	return quota, nil
+}
+
+// The `assessHealth` function sets the overall status of a report. A link is unhealthy when visitors
+// can't get through: the destination fails, its certificate is invalid or the link has no accesses
+// left. It is degraded when that is about to happen or the destination answers with a client error.
+func assessHealth(report *LinkHealth, urlEntry URL) {
+	failing := func(issue string) {
+		report.Issues = append(report.Issues, issue)
+		report.Status = healthFailing
+	}
+	degraded := func(issue string) {
+		report.Issues = append(report.Issues, issue)
+		if report.Status == healthOK {
+			report.Status = healthDegraded
+		}
+	}
+	report.Status, report.Issues = healthOK, []string{}
+
+	if urlEntry.Disabled {
+		failing("link_disabled")
+	}
+	switch destination := report.Destination; {
+	case !destination.Reachable:
+		failing("destination_unreachable")
+	case destination.StatusCode >= 500:
+		failing("destination_server_error")
+	case destination.StatusCode >= 400:
+		degraded("destination_client_error")
+	}
+	if cert := report.Certificate; cert != nil {
+		switch {
+		case !cert.Valid:
+			failing("certificate_invalid")
+		case time.Duration(cert.DaysRemaining)*24*time.Hour < config.HealthCertificateWarning:
+			degraded("certificate_expiring")
+		}
+	}
+	if report.Quota.Remaining == 0 {
+		failing("quota_exhausted")
+	}
+	for _, window := range report.Quota.Windows {
+		if window.Remaining == 0 {
+			degraded(window.Window + "_quota_exhausted")
+		}
+	}
+	if time.Duration(report.SecondsRemaining)*time.Second < config.HealthExpiryWarning {
+		degraded("expiring")
+	}
+}
+
+// The `linkHealthHandler` function returns the health report of a link owned by the requesting API
+// key, for external uptime dashboards. The status code is 200 whatever the link's health; monitors
+// should read the status field.
+func linkHealthHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	report := LinkHealth{
+		Token:            urlEntry.Token,
+		Domain:           urlEntry.Domain,
+		ExpiresAt:        urlEntry.ExpiresAt,
+		SecondsRemaining: max(int64(urlEntry.ttl().Seconds()), 0),
+	}
+	if report.Quota, err = linkQuota(opCtx, rdb, urlEntry); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	var check destinationCheck
+	cached, err := rdb.Get(opCtx, healthCheckKey(key)).Result()
+	if err != nil || json.Unmarshal([]byte(cached), &check) != nil {
+		check = checkDestination(c.Request.Context(), urlEntry.LongURL)
+		data, _ := json.Marshal(check)
+		writeCtx, cancel := writeContext(c.Request.Context())
+		rdb.Set(writeCtx, healthCheckKey(key), data, config.HealthCheckTTL)
+		cancel()
+	}
+	report.Destination, report.Certificate = check.Destination, check.Certificate
+
+	assessHealth(&report, urlEntry)
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkHealth(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	requests := 0
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer destination.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.OutboundRespectRobots = false
+	config.OutboundHostInterval = 0
+	config.OutboundAllowPrivate = true
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	create := func(form url.Values) string {
+		var created map[string]string
+		w := performRequest(router, "POST", "/create", form.Encode(), admin)
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+	health := func(token string) LinkHealth {
+		var report LinkHealth
+		w := performRequest(router, "GET", "/api/v1/links/"+token+"/health", "", admin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return report
+	}
+
+	token := create(url.Values{"long_url": {destination.URL + "/ok"}, "max_access": {"10"}, "max_per_hour": {"1"}, "max_age": {"172800"}})
+	report := health(token)
+	assert.Equal(t, healthOK, report.Status)
+	assert.Empty(t, report.Issues)
+	assert.True(t, report.Destination.Reachable)
+	assert.Equal(t, http.StatusOK, report.Destination.StatusCode)
+	assert.Nil(t, report.Certificate)
+	assert.Equal(t, 10, report.Quota.Remaining)
+	assert.Equal(t, []WindowQuota{{Window: "hour", Max: 1, Remaining: 1, ResetsAt: hourWindow.end(time.Now()).Format(time.RFC3339)}}, report.Quota.Windows)
+	assert.InDelta(t, 172800, report.SecondsRemaining, 5)
+
+	// The destination check is reused while the quota is read live
+	performRequest(router, "GET", "/"+token, "", nil)
+	time.Sleep(50 * time.Millisecond)
+	report = health(token)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 9, report.Quota.Remaining)
+	assert.Equal(t, healthDegraded, report.Status)
+	assert.Equal(t, []string{"hour_quota_exhausted"}, report.Issues)
+
+	token = create(url.Values{"long_url": {destination.URL + "/gone"}, "max_age": {"600"}})
+	report = health(token)
+	assert.Equal(t, healthFailing, report.Status)
+	assert.Equal(t, []string{"destination_server_error", "expiring"}, report.Issues)
+
+	w := performRequest(router, "GET", "/api/v1/links/"+token+"/health", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performRequest(router, "GET", "/api/v1/links/missing/health", "", admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCheckDestinationCertificate(t *testing.T) {
+	destination := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	previous := config
+	config.OutboundRespectRobots = false
+	config.OutboundHostInterval = 0
+	config.OutboundAllowPrivate = true
+	defer func() { config = previous }()
+
+	// The test server's certificate isn't trusted by the system
+	check := checkDestination(testCtx, destination.URL)
+	assert.False(t, check.Destination.Reachable)
+	assert.NotNil(t, check.Certificate)
+	assert.False(t, check.Certificate.Valid)
+	assert.NotEmpty(t, check.Certificate.ExpiresAt)
+
+	transport := outboundClient.Transport
+	outboundClient.Transport = destination.Client().Transport
+	defer func() { outboundClient.Transport = transport }()
+	check = checkDestination(testCtx, destination.URL)
+	assert.True(t, check.Destination.Reachable)
+	assert.True(t, check.Certificate.Valid)
+	assert.Greater(t, check.Certificate.DaysRemaining, 365)
+}
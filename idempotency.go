@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// IdempotentResponse is the stored outcome of a request sent with an Idempotency-Key. Until the
+// request completes only the fingerprint is set.
+type IdempotentResponse struct {
+	// SHA-256 of the method, path and body, so a key reused for another request is detected
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of the response body written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// The function returns the key an idempotent response is stored under. Keys are scoped to the API
+// key, or the client's address for anonymous requests, so clients can't see each other's responses.
+func idempotencyRedisKey(apiKey *APIKey, clientIP, key string) string {
+	scope := "ip:" + clientIP
+	if apiKey != nil {
+		scope = apiKey.ID
+	}
+	return "idempotency:" + scope + ":" + key
+}
+
+// The `idempotent` function runs handle at most once per Idempotency-Key. A retry with the same key
+// gets the stored response of the first request, marked with the Idempotent-Replayed header. A retry
+// while the first request is still running gets 409, and reusing a key for a different request 422.
+// Server errors aren't stored, so the request can be retried.
+func idempotent(c *gin.Context, rdb *redis.Client, apiKey *APIKey, handle func()) {
+	key := c.GetHeader(idempotencyHeader)
+	if key == "" {
+		handle()
+		return
+	}
+	if len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error reading the request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(append([]byte(c.Request.Method+"\n"+c.Request.URL.RequestURI()+"\n"), body...))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	redisKey := idempotencyRedisKey(apiKey, c.ClientIP(), key)
+	pending, _ := json.Marshal(IdempotentResponse{Fingerprint: fingerprint})
+	opCtx, cancel := writeContext(c.Request.Context())
+	reserved, err := rdb.SetNX(opCtx, redisKey, pending, config.IdempotencyTTL).Result()
+	var stored string
+	if err == nil && !reserved {
+		stored, err = rdb.Get(opCtx, redisKey).Result()
+	}
+	cancel()
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	if !reserved {
+		var previous IdempotentResponse
+		json.Unmarshal([]byte(stored), &previous)
+		switch {
+		case previous.Fingerprint != fingerprint:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Idempotency-Key was already used for a different request"})
+		case previous.Status == 0:
+			c.JSON(http.StatusConflict, gin.H{"message": "A request with this Idempotency-Key is still being processed"})
+		default:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(previous.Status, previous.ContentType, []byte(previous.Body))
+		}
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	handle()
+	c.Writer = recorder.ResponseWriter
+
+	opCtx, cancel = writeContext(c.Request.Context())
+	defer cancel()
+	if recorder.Status() >= 500 {
+		rdb.Del(opCtx, redisKey)
+		return
+	}
+	data, _ := json.Marshal(IdempotentResponse{
+		Fingerprint: fingerprint,
+		Status:      recorder.Status(),
+		ContentType: recorder.Header().Get("Content-Type"),
+		Body:        recorder.body.String(),
+	})
+	rdb.Set(opCtx, redisKey, data, config.IdempotencyTTL)
+}
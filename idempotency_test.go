@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	headers := map[string]string{idempotencyHeader: "retry-1"}
+
+	first := performRequest(router, "POST", "/create", "long_url=https://example.com/once", headers)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	// A retry gets the same link instead of a new one
+	retry := performRequest(router, "POST", "/create", "long_url=https://example.com/once", headers)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/other", headers)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Another key creates another link
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/once", map[string]string{idempotencyHeader: "retry-2"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotContains(t, first.Body.String(), response["token"])
+
+	// Client errors are replayed as well
+	headers = map[string]string{idempotencyHeader: "invalid"}
+	w = performRequest(router, "POST", "/create", "long_url=not-a-url", headers)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=not-a-url", headers)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotentCreateInProgress(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	// A reservation without a response is a request that is still being processed
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/slow", map[string]string{idempotencyHeader: "slow"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	key := idempotencyRedisKey(nil, "", "slow")
+	val, err := rdb.Get(testCtx, key).Result()
+	assert.NoError(t, err)
+	var stored IdempotentResponse
+	json.Unmarshal([]byte(val), &stored)
+	pending, _ := json.Marshal(IdempotentResponse{Fingerprint: stored.Fingerprint})
+	rdb.Set(testCtx, key, pending, 0)
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/slow", map[string]string{idempotencyHeader: "slow"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
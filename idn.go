@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+var errInvalidDestination = errors.New("long_url must be an absolute http or https URL")
+
+// Letters from these scripts are visually indistinguishable from Latin letters in most fonts. A label
+// written entirely in one of them can still impersonate a Latin domain (e.g. "аррӏе" in Cyrillic).
+var latinConfusables = map[rune]bool{
+	'а': true, 'в': true, 'е': true, 'к': true, 'м': true, 'н': true, 'о': true, 'р': true, 'с': true,
+	'т': true, 'у': true, 'х': true, 'ѕ': true, 'і': true, 'ј': true, 'ӏ': true, 'ԁ': true, 'ԛ': true,
+	'ԝ': true, 'ο': true, 'α': true, 'ν': true, 'ι': true, 'κ': true, 'ρ': true, 'τ': true, 'υ': true,
+	'χ': true, 'ε': true,
+}
+
+// Mixing any two of these scripts within one label is the classic homograph trick. Mixing Latin with
+// e.g. Han or Hangul is common in legitimate domains and isn't flagged.
+var confusableScripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Armenian}
+
+// The function parses and validates a destination URL and converts its host to the ASCII (punycode)
+// form, so the same domain is always stored and screened in a single canonical representation.
+func normalizeDestination(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "", errInvalidDestination
+	}
+
+	// IP literals have nothing to normalize and would be rejected by the IDNA lookup profile.
+	if net.ParseIP(u.Hostname()) != nil {
+		return u.String(), nil
+	}
+
+	host, err := idna.Lookup.ToASCII(u.Hostname())
+	if err != nil {
+		return "", errInvalidDestination
+	}
+
+	if port := u.Port(); port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// The function reports whether a URL can be sent in a Location header byte for byte: printable ASCII
+// only, as anything else would be escaped on the way out.
+func isRawSafe(raw string) bool {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] <= ' ' || raw[i] >= 0x7f {
+			return false
+		}
+	}
+	return raw != ""
+}
+
+// The function returns the human-readable form of a stored destination, with a punycode host converted
+// back to Unicode. If the host can't be decoded the URL is returned unchanged.
+func displayURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	host, err := idna.Display.ToUnicode(u.Hostname())
+	if err != nil || host == u.Hostname() {
+		return raw
+	}
+
+	if port := u.Port(); port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+	// url.URL.String would percent-encode the Unicode host again, so assemble the display form by hand.
+	display := u.Scheme + "://" + host + u.EscapedPath()
+	if u.RawQuery != "" {
+		display += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		display += "#" + u.EscapedFragment()
+	}
+	return display
+}
+
+// The `homographWarning` function inspects the Unicode form of a destination host and returns a
+// human-readable warning if any label mixes scripts or is made up solely of Latin look-alike
+// characters from another script. An empty string means no issue was detected.
+func homographWarning(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	host, err := idna.Display.ToUnicode(u.Hostname())
+	if err != nil {
+		return ""
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		seen := map[*unicode.RangeTable]bool{}
+		confusableOnly := true
+		nonLatin := false
+
+		for _, r := range label {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			for _, script := range confusableScripts {
+				if unicode.Is(script, r) {
+					seen[script] = true
+					break
+				}
+			}
+			if !unicode.Is(unicode.Latin, r) {
+				nonLatin = true
+				if !latinConfusables[r] {
+					confusableOnly = false
+				}
+			}
+		}
+
+		if len(seen) > 1 {
+			return "The domain \"" + host + "\" mixes characters from different alphabets and may be imitating another site."
+		}
+		if nonLatin && confusableOnly {
+			return "The domain \"" + host + "\" uses non-Latin characters that look like Latin letters and may be imitating another site."
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDestination(t *testing.T) {
+	normalized, err := normalizeDestination("https://bücher.example/path?q=1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://xn--bcher-kva.example/path?q=1", normalized)
+
+	normalized, err = normalizeDestination("HTTP://[::1]:8080/")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://[::1]:8080/", normalized)
+
+	for _, invalid := range []string{"example.com", "ftp://example.com", "javascript:alert(1)", "https://"} {
+		_, err = normalizeDestination(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDisplayURL(t *testing.T) {
+	assert.Equal(t, "https://bücher.example/path?q=1", displayURL("https://xn--bcher-kva.example/path?q=1"))
+	assert.Equal(t, "https://example.com/", displayURL("https://example.com/"))
+}
+
+func TestHomographWarning(t *testing.T) {
+	// "аpple" with a Cyrillic "а"
+	mixed, _ := normalizeDestination("https://аpple.com")
+	assert.NotEmpty(t, homographWarning(mixed))
+
+	// "аре" written entirely in Cyrillic look-alikes
+	confusable, _ := normalizeDestination("https://аре.com")
+	assert.NotEmpty(t, homographWarning(confusable))
+
+	legit, _ := normalizeDestination("https://bücher.example")
+	assert.Empty(t, homographWarning(legit))
+	assert.Empty(t, homographWarning("https://example.com"))
+}
+
+func TestPreserveRaw(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	signed := "https://CDN.Example.com/file?b=2&a=1&sig=AbC%2F%3D%3d"
+	var response map[string]string
+
+	w := performRequest(router, "POST", "/create", "long_url="+url.QueryEscape(signed), nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Equal(t, "https://cdn.example.com/file?b=2&a=1&sig=AbC%2F%3D%3d", w.Header().Get("Location"))
+
+	w = performRequest(router, "POST", "/create", "preserve_raw=true&long_url="+url.QueryEscape(signed), nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Equal(t, signed, w.Header().Get("Location"))
+
+	// Scheme and host are still validated
+	w = performRequest(router, "POST", "/create", "preserve_raw=true&long_url="+url.QueryEscape("javascript:alert(1)"), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/create", "preserve_raw=true&long_url="+url.QueryEscape("https://bücher.example/"), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Impersonation tokens are sent in place of an API key and read "imp.<key id>.<expiry>.<signature>".
+const impersonationPrefix = "imp."
+
+const (
+	defaultImpersonationTTL = 15 * time.Minute
+	maxImpersonationTTL     = time.Hour
+)
+
+// Audit records of issued impersonation tokens, newest first
+const impersonationsAuditKey = "audit:impersonations"
+
+// Impersonation is the audit record of an issued impersonation token.
+type Impersonation struct {
+	KeyID     string `json:"key_id"`
+	Reason    string `json:"reason"`
+	IssuedAt  string `json:"issued_at"`
+	ExpiresAt string `json:"expires_at"`
+	IssuedBy  string `json:"issued_by"`
+}
+
+func impersonationMessage(keyID string, expires int64) string {
+	return "impersonate:" + keyID + ":" + strconv.FormatInt(expires, 10)
+}
+
+// The function checks an impersonation token and returns the read-only API key it stands for.
+func parseImpersonationToken(token string) (*APIKey, bool) {
+	parts := strings.Split(strings.TrimPrefix(token, impersonationPrefix), ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, false
+	}
+	if !validSignature(impersonationMessage(parts[0], expires), parts[2]) {
+		return nil, false
+	}
+	return &APIKey{ID: parts[0], Name: "impersonated " + parts[0], Impersonated: true}, true
+}
+
+// The `authenticateImpersonation` function resolves an impersonation token sent as API key. The token
+// only grants read access, so any request that could change data is refused, and every use is logged.
+func authenticateImpersonation(c *gin.Context, token string) (*APIKey, bool) {
+	key, ok := parseImpersonationToken(token)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired impersonation token"})
+		return nil, false
+	}
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Impersonation tokens are read-only"})
+		return nil, false
+	}
+	log.Printf("impersonation: %s %s as %s", c.Request.Method, c.Request.URL.Path, key.ID)
+	return key, true
+}
+
+// The `impersonateHandler` function lets the admin mint a short-lived token to view an API key's links
+// and analytics read-only, e.g. while handling a support ticket, without knowing the key's secret.
+// Every token is recorded with the reason it was issued for.
+func impersonateHandler(c *gin.Context, rdb *redis.Client) {
+	keyID := c.PostForm("key_id")
+	reason := strings.TrimSpace(c.PostForm("reason"))
+	if !strings.HasPrefix(keyID, "key_") || strings.Contains(keyID, ".") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid key_id parameter"})
+		return
+	}
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing reason parameter, e.g. the support ticket"})
+		return
+	}
+	ttl := defaultImpersonationTTL
+	if value := c.PostForm("ttl"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxImpersonationTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ttl parameter, expected a duration of at most 1h"})
+			return
+		}
+		ttl = parsed
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl)
+	record := Impersonation{
+		KeyID:     keyID,
+		Reason:    reason,
+		IssuedAt:  now.Format(time.RFC3339),
+		ExpiresAt: expires.Format(time.RFC3339),
+		IssuedBy:  c.ClientIP(),
+	}
+	data, _ := json.Marshal(record)
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	if err := rdb.LPush(opCtx, impersonationsAuditKey, data).Err(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	token := impersonationPrefix + keyID + "." + strconv.FormatInt(expires.Unix(), 10) + "." + sign(impersonationMessage(keyID, expires.Unix()))
+	c.Set(auditTargetKey, keyID)
+	c.JSON(http.StatusOK, gin.H{"token": token, "key_id": keyID, "expires_at": record.ExpiresAt})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonation(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=customer", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	w = performRequest(router, "POST", "/api/campaigns", "name=Launch", map[string]string{apiKeyHeader: key.Key})
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+
+	w = performRequest(router, "POST", "/api/admin/impersonate", "key_id="+key.ID, admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/api/admin/impersonate", "key_id="+key.ID+"&reason=ticket-42&ttl=2h", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/api/admin/impersonate", "key_id="+key.ID+"&reason=ticket-42", map[string]string{apiKeyHeader: key.Key})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "POST", "/api/admin/impersonate", "key_id="+key.ID+"&reason=ticket-42", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var issued map[string]string
+	json.Unmarshal(w.Body.Bytes(), &issued)
+	support := map[string]string{apiKeyHeader: issued["token"]}
+
+	// The token sees the customer's data
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID, "", support)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// but can't change anything
+	w = performRequest(router, "POST", "/api/campaigns", "name=Sneaky", support)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", support)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Tampered and expired tokens are refused
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID, "", map[string]string{apiKeyHeader: issued["token"] + "x"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	expired := time.Now().Add(-time.Minute).Unix()
+	_, ok := parseImpersonationToken(impersonationPrefix + key.ID + "." + strconv.FormatInt(expired, 10) + "." + sign(impersonationMessage(key.ID, expired)))
+	assert.False(t, ok)
+
+	var audit Impersonation
+	json.Unmarshal([]byte(rdb.LIndex(testCtx, impersonationsAuditKey, 0).Val()), &audit)
+	assert.Equal(t, key.ID, audit.KeyID)
+	assert.Equal(t, "ticket-42", audit.Reason)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Secondary indexes are plain Redis sets of tokens. Links expire on their own through TTLs while set
+// members don't, so readers must expect tokens whose link is gone and clean them up as they go.
+const allURLsIndex = "index:all"
+
+const maxTagsPerLink = 10
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var errInvalidTags = errors.New("tags must be up to 10 comma-separated words of at most 32 characters (a-z, 0-9, _ and -)")
+
+func ownerIndexKey(owner string) string {
+	return "index:owner:" + owner
+}
+
+func tagIndexKey(tag string) string {
+	return "index:tag:" + tag
+}
+
+func ipIndexKey(ip string) string {
+	return "index:ip:" + ip
+}
+
+// Links by destination, keyed by a hash of the normalized long URL so keys stay short
+func destinationIndexKey(longURL string) string {
+	sum := sha256.Sum256([]byte(longURL))
+	return "index:url:" + hex.EncodeToString(sum[:])
+}
+
+// The function lists the index sets a link has to be added to when it is stored.
+func indexKeys(urlEntry URL) []string {
+	keys := []string{allURLsIndex}
+	if urlEntry.CreatorAPIKey != "" {
+		keys = append(keys, ownerIndexKey(urlEntry.CreatorAPIKey))
+	}
+	if urlEntry.CreatorIP != "" {
+		keys = append(keys, ipIndexKey(urlEntry.CreatorIP))
+	}
+	if urlEntry.CampaignID != "" {
+		keys = append(keys, campaignIndexKey(urlEntry.CampaignID))
+	}
+	for _, tag := range urlEntry.Tags {
+		keys = append(keys, tagIndexKey(tag))
+	}
+	if urlEntry.Category != "" {
+		keys = append(keys, categoryIndexKey(urlEntry.Category))
+	}
+	// Tokens of one-time links are secrets and can't be looked up by destination
+	if normalized, err := normalizeDestination(urlEntry.LongURL); err == nil && !urlEntry.OneTime {
+		keys = append(keys, destinationIndexKey(normalized))
+	}
+	return keys
+}
+
+// The `parseTags` function turns the comma-separated tags parameter into a normalized, de-duplicated
+// list of lowercase tags.
+func parseTags(raw string) ([]string, error) {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, errInvalidTags
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerLink {
+		return nil, errInvalidTags
+	}
+	return tags, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Name of the chat command shortening a URL, in Slack "/shorten <url>"
+const chatCommand = "shorten"
+
+// Answer to chat commands when Redis fails
+const storeUnavailable = "Error reaching the URL store, please try again later."
+
+// The function loads the API key chat integrations create links with, nil if none is configured.
+func integrationAPIKey(ctx context.Context, rdb *redis.Client) (*APIKey, error) {
+	if config.IntegrationAPIKeyID == "" {
+		return nil, nil
+	}
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	secret, err := rdb.Get(opCtx, apiKeyIDKey(config.IntegrationAPIKeyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	val, err := rdb.Get(opCtx, apiKeyRedisKey(secret)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var key APIKey
+	if err := json.Unmarshal([]byte(val), &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// The `shortenForChat` function shortens the URL sent with a chat command and returns the message to
+// answer with, and whether it's an error only the sender should see.
+func shortenForChat(c *gin.Context, rdb *redis.Client, text string) (string, bool) {
+	longURL := strings.Trim(strings.TrimSpace(text), "<>")
+	// Slack sends links as <url> or <url|label>
+	longURL, _, _ = strings.Cut(longURL, "|")
+	if longURL == "" {
+		return "Usage: /" + chatCommand + " <url>", true
+	}
+
+	apiKey, err := integrationAPIKey(c.Request.Context(), rdb)
+	if err != nil {
+		return storeUnavailable, true
+	}
+	// Links of a workspace pinned to a region are stored there
+	ctx := c.Request.Context()
+	if apiKey != nil && apiKey.Region != "" {
+		client, ok := regionClients[apiKey.Region]
+		if !ok {
+			return "The region of this workspace is not available.", true
+		}
+		ctx = withRegion(ctx, apiKey.Region)
+		rdb = client
+	}
+	domain, err := resolveCreateDomain(c, apiKey)
+	if err != nil {
+		return err.Error(), true
+	}
+	opts := defaultCreateOptions(domain, apiKey)
+	opts.LongURL = longURL
+	opts.APIKey = apiKey
+
+	urlEntry, err := createShortURL(ctx, rdb, opts)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Message, true
+	}
+	if err != nil {
+		return storeUnavailable, true
+	}
+	return shortURLFor(c, urlEntry), false
+}
+
+// The function checks that a chat platform signed the request recently, so captured requests can't be
+// replayed to mint links.
+func freshTimestamp(timestamp string) bool {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	return err == nil && time.Since(time.Unix(unix, 0)).Abs() <= config.RequestSignatureTolerance
+}
+
+// The `slackSignature` function computes the signature Slack sends with its requests: "v0=" and the
+// hex HMAC-SHA256, keyed with the app's signing secret, of "v0:<timestamp>:<body>".
+func slackSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// The `slackCommandHandler` function answers the /shorten slash command of a Slack app with the short
+// URL, posted to the channel. Errors are only shown to the user who sent the command.
+func slackCommandHandler(c *gin.Context, rdb *redis.Client) {
+	if config.SlackSigningSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "The Slack integration is not configured"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error reading the request body"})
+		return
+	}
+	timestamp := c.GetHeader("X-Slack-Request-Timestamp")
+	expected := slackSignature(config.SlackSigningSecret, timestamp, body)
+	if !freshTimestamp(timestamp) || !hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Slack-Signature"))) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid request signature"})
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	if form.Get("command") != "/"+chatCommand {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "Unknown command " + form.Get("command")})
+		return
+	}
+
+	message, failed := shortenForChat(c, rdb, form.Get("text"))
+	responseType := "in_channel"
+	if failed {
+		responseType = "ephemeral"
+	}
+	c.JSON(http.StatusOK, gin.H{"response_type": responseType, "text": message})
+}
+
+// Interaction and response types of the Discord API
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+	discordPong               = 1
+	discordChannelMessage     = 4
+	// Flag of messages only the user who sent the command sees
+	discordEphemeral = 64
+)
+
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// The `discordInteractionHandler` function is the interactions endpoint of a Discord application. It
+// answers Discord's pings and the /shorten command, whose `url` option is shortened.
+func discordInteractionHandler(c *gin.Context, rdb *redis.Client) {
+	publicKey, err := hex.DecodeString(config.DiscordPublicKey)
+	if config.DiscordPublicKey == "" || err != nil || len(publicKey) != ed25519.PublicKeySize {
+		c.JSON(http.StatusNotFound, gin.H{"message": "The Discord integration is not configured"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error reading the request body"})
+		return
+	}
+	timestamp := c.GetHeader("X-Signature-Timestamp")
+	signature, err := hex.DecodeString(c.GetHeader("X-Signature-Ed25519"))
+	if err != nil || !freshTimestamp(timestamp) || !ed25519.Verify(publicKey, append([]byte(timestamp), body...), signature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid request signature"})
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	switch {
+	case interaction.Type == discordPing:
+		c.JSON(http.StatusOK, gin.H{"type": discordPong})
+		return
+	case interaction.Type != discordApplicationCommand || interaction.Data.Name != chatCommand:
+		c.JSON(http.StatusOK, gin.H{"type": discordChannelMessage, "data": gin.H{"content": "Unknown command", "flags": discordEphemeral}})
+		return
+	}
+
+	text := ""
+	for _, option := range interaction.Data.Options {
+		if option.Name == "url" {
+			text = option.Value
+		}
+	}
+	message, failed := shortenForChat(c, rdb, text)
+	data := gin.H{"content": message}
+	if failed {
+		data["flags"] = discordEphemeral
+	}
+	c.JSON(http.StatusOK, gin.H{"type": discordChannelMessage, "data": data})
+}
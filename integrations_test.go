@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func slackRequestHeaders(secret, body string, at time.Time) map[string]string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return map[string]string{
+		"X-Slack-Request-Timestamp": timestamp,
+		"X-Slack-Signature":         slackSignature(secret, timestamp, []byte(body)),
+	}
+}
+
+func TestSlackSignatureVerification(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	body := url.Values{"command": {"/shorten"}, "text": {"https://example.com"}}.Encode()
+
+	// Disabled without a signing secret
+	w := performRequest(router, "POST", "/integrations/slack", body, slackRequestHeaders("", body, time.Now()))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.SlackSigningSecret = "slack-secret"
+	w = performRequest(router, "POST", "/integrations/slack", body, slackRequestHeaders("other-secret", body, time.Now()))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Replayed requests are too old
+	w = performRequest(router, "POST", "/integrations/slack", body, slackRequestHeaders("slack-secret", body, time.Now().Add(-time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	other := url.Values{"command": {"/weather"}}.Encode()
+	w = performRequest(router, "POST", "/integrations/slack", other, slackRequestHeaders("slack-secret", other, time.Now()))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"response_type":"ephemeral"`)
+}
+
+func TestSlackShortenCommand(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.SlackSigningSecret = "slack-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	// Slack wraps links in angle brackets
+	body := url.Values{"command": {"/shorten"}, "text": {"<https://example.com/article>"}}.Encode()
+	w := performRequest(router, "POST", "/integrations/slack", body, slackRequestHeaders("slack-secret", body, time.Now()))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "in_channel", response["response_type"])
+
+	token := response["text"][strings.LastIndex(response["text"], "/")+1:]
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, "https://example.com/article", w.Header().Get("Location"))
+
+	body = url.Values{"command": {"/shorten"}, "text": {"not a url"}}.Encode()
+	w = performRequest(router, "POST", "/integrations/slack", body, slackRequestHeaders("slack-secret", body, time.Now()))
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "ephemeral", response["response_type"])
+	assert.Equal(t, "Invalid long_url parameter", response["text"])
+}
+
+func TestDiscordInteractions(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	previous := config
+	config.DiscordPublicKey = hex.EncodeToString(publicKey)
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	signed := func(body string) map[string]string {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		return map[string]string{
+			"Content-Type":          "application/json",
+			"X-Signature-Timestamp": timestamp,
+			"X-Signature-Ed25519":   hex.EncodeToString(ed25519.Sign(privateKey, []byte(timestamp+body))),
+		}
+	}
+
+	ping := `{"type":1}`
+	headers := signed(ping)
+	w := performRequest(router, "POST", "/integrations/discord", `{"type":1,"data":{}}`, headers)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "POST", "/integrations/discord", ping, headers)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"type":1}`, w.Body.String())
+
+	command := `{"type":2,"data":{"name":"shorten","options":[{"name":"url","value":"https://example.com/discord"}]}}`
+	w = performRequest(router, "POST", "/integrations/discord", command, signed(command))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Type int `json:"type"`
+		Data struct {
+			Content string `json:"content"`
+			Flags   int    `json:"flags"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, discordChannelMessage, response.Type)
+	assert.Zero(t, response.Data.Flags)
+
+	token := response.Data.Content[strings.LastIndex(response.Data.Content, "/")+1:]
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, "https://example.com/discord", w.Header().Get("Location"))
+}
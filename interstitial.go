@@ -0,0 +1,92 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// How long the continue link of an interstitial page stays valid
+const continueLinkTTL = 10 * time.Minute
+
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(brandingPartials + `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>You are leaving via a short link</title>
+{{template "branding_style" .}}
+</head>
+<body>
+{{template "branding_header" .}}
+<main>
+<h1>You are leaving via a short link</h1>
+<p>This link leads to:</p>
+<p><strong>{{.DisplayURL}}</strong></p>
+{{if .Flagged}}<p role="alert">This link was flagged as potentially unsafe{{if .FlagReason}} ({{.FlagReason}}){{end}}. Only continue if you trust the destination.</p>{{end}}
+{{if .HomographWarning}}<p role="alert">{{.HomographWarning}}</p>{{end}}
+<p><a href="{{.ContinueURL}}">Continue to the destination</a></p>
+</main>
+{{template "branding_footer" .}}
+</body>
+</html>
+`))
+
+// The `needsInterstitial` function decides whether a visitor should see the warning page before being
+// redirected. Flagged links and links to a domain that looks like a homograph of another one always
+// get it (unless interstitials are off); in "untrusted" mode so do links created anonymously or with
+// an API key that isn't marked as trusted.
+func needsInterstitial(urlEntry URL) bool {
+	switch config.InterstitialMode {
+	case "off":
+		return false
+	case "untrusted":
+		if !urlEntry.CreatorTrusted {
+			return true
+		}
+	}
+	return urlEntry.Flagged || homographWarning(urlEntry.LongURL) != ""
+}
+
+func continueMessage(token string, issued int64) string {
+	return "continue:" + token + ":" + strconv.FormatInt(issued, 10)
+}
+
+// The function checks the value of the `continue` query parameter, which proves the visitor has seen
+// the interstitial for this token recently.
+func validContinue(token, value string) bool {
+	issuedText, signature, found := strings.Cut(value, ".")
+	if !found {
+		return false
+	}
+	issued, err := strconv.ParseInt(issuedText, 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > continueLinkTTL {
+		return false
+	}
+	return validSignature(continueMessage(token, issued), signature)
+}
+
+// The `serveInterstitial` function renders the warning page, in the branding of the link's workspace,
+// with a continue link back to the redirect route.
+func serveInterstitial(c *gin.Context, rdb *redis.Client, urlEntry URL) {
+	issued := time.Now().Unix()
+	continueValue := strconv.FormatInt(issued, 10) + "." + sign(continueMessage(urlEntry.Token, issued))
+
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	interstitialTemplate.Execute(c.Writer, gin.H{
+		"DisplayURL":       displayURL(urlEntry.LongURL),
+		"Flagged":          urlEntry.Flagged,
+		"FlagReason":       urlEntry.FlagReason,
+		"HomographWarning": homographWarning(urlEntry.LongURL),
+		"ContinueURL":      linkPathWith(c, "continue", continueValue),
+		"Branding":         loadBranding(c.Request.Context(), rdb, urlEntry.CreatorAPIKey),
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterstitial(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.ScreeningBlocklist = []string{"spam.example"}
+	config.ScreeningAction = "flag"
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var response map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://spam.example/win", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://spam.example/win")
+	assert.Contains(t, w.Body.String(), "flagged as potentially unsafe")
+
+	continueURL := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(w.Body.String())[1]
+	w = performRequest(router, "GET", continueURL, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	// A forged continue value doesn't skip the warning
+	w = performRequest(router, "GET", "/"+token+"?continue=1.forged", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// In "untrusted" mode anonymous links get the page too, links from trusted keys don't
+	config.InterstitialMode = "untrusted"
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w = performRequest(router, "POST", "/api/admin/keys", "name=partner&trusted=true", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &key)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", map[string]string{apiKeyHeader: key.Key})
+	json.Unmarshal(w.Body.Bytes(), &response)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+}
+
+func TestInterstitialForHomographs(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	// "аpple" with a Cyrillic "а" is warned about on the way out too, not only on the preview
+	var response map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://аpple.com/login", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "may be imitating another site")
+
+	continueURL := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(w.Body.String())[1]
+	w = performRequest(router, "GET", continueURL, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+}
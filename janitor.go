@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Counters of the keys and index entries the janitor reclaimed since the process started, published
+// at /debug/vars.
+var janitorStats = expvar.NewMap("janitor")
+
+// JanitorResult counts what a janitor run cleaned up.
+type JanitorResult struct {
+	ClickLogs    int
+	Rollups      int
+	IndexEntries int
+}
+
+// Deletes the auxiliary key KEYS[2] unless its link KEYS[1] exists (again), atomically so a link that
+// is created in the meantime keeps its data.
+var deleteOrphanScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+return redis.call('DEL', KEYS[2])
+`)
+
+// The function reports whether a link is stored, in Redis or in cold storage. Links waiting to be
+// archived count as stored, their clicks are summarized in the archive.
+func linkExists(ctx context.Context, rdb *redis.Client, key string) (bool, error) {
+	n, err := rdb.Exists(ctx, key, archiveSnapshotKey(key)).Result()
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+	if coldStore != nil {
+		if _, _, err := coldStore.Get(key); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// The function returns the link an analytics key belongs to, and whether it's a rollup. Unique
+// visitor counters, click series and access counts count as rollups.
+func analyticsParent(key string) (string, bool) {
+	if parent, ok := strings.CutPrefix(key, "clicks:rollup:"); ok {
+		return parent, true
+	}
+	if parent, ok := strings.CutPrefix(key, "clicks:uniques:"); ok {
+		return parent, true
+	}
+	if parent, ok := strings.CutPrefix(key, "clicks:series:"); ok {
+		return parent, true
+	}
+	if parent, ok := strings.CutPrefix(key, "clicks:accesses:"); ok {
+		return parent, true
+	}
+	return strings.TrimPrefix(key, "clicks:"), false
+}
+
+// The `cleanOrphanedKeys` function deletes the click logs and rollups of links that no longer exist,
+// e.g. links deleted once they reached their max_access, whose analytics would otherwise stay around
+// until their own TTL runs out.
+func cleanOrphanedKeys(ctx context.Context, rdb *redis.Client, result *JanitorResult) error {
+	iter := rdb.Scan(ctx, 0, "clicks:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		parent, rollup := analyticsParent(key)
+		exists, err := linkExists(ctx, rdb, parent)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		deleted, err := deleteOrphanScript.Run(ctx, rdb, []string{parent, key}).Int()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			continue
+		}
+		if rollup {
+			result.Rollups++
+		} else {
+			result.ClickLogs++
+		}
+	}
+	return iter.Err()
+}
+
+// The `cleanStaleIndexEntries` function removes the entries of links that no longer exist from the
+// secondary indexes. Readers clean up the entries they come across, this catches the ones nobody reads.
+func cleanStaleIndexEntries(ctx context.Context, rdb *redis.Client, result *JanitorResult) error {
+	iter := rdb.ScanType(ctx, 0, "index:*", 100, "set").Iterator()
+	for iter.Next(ctx) {
+		index := iter.Val()
+		// Campaign lists hold campaign IDs, not links
+		if strings.HasSuffix(index, ":campaigns") {
+			continue
+		}
+		removed, err := cleanIndex(ctx, rdb, index)
+		if err != nil {
+			return err
+		}
+		result.IndexEntries += removed
+	}
+	return iter.Err()
+}
+
+func cleanIndex(ctx context.Context, rdb *redis.Client, index string) (int, error) {
+	var stale []interface{}
+	members := rdb.SScan(ctx, index, 0, "", 100).Iterator()
+	for members.Next(ctx) {
+		exists, err := linkExists(ctx, rdb, members.Val())
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			stale = append(stale, members.Val())
+		}
+	}
+	if err := members.Err(); err != nil || len(stale) == 0 {
+		return 0, err
+	}
+	return len(stale), rdb.SRem(ctx, index, stale...).Err()
+}
+
+// The `runJanitor` function does one janitor run and adds its results to the published counters.
+func runJanitor(ctx context.Context, rdb *redis.Client) JanitorResult {
+	var result JanitorResult
+	if err := cleanOrphanedKeys(ctx, rdb, &result); err != nil {
+		log.Printf("janitor: %v", err)
+	}
+	if err := cleanStaleIndexEntries(ctx, rdb, &result); err != nil {
+		log.Printf("janitor: %v", err)
+	}
+
+	janitorStats.Add("runs", 1)
+	janitorStats.Add("click_logs_deleted", int64(result.ClickLogs))
+	janitorStats.Add("rollups_deleted", int64(result.Rollups))
+	janitorStats.Add("index_entries_removed", int64(result.IndexEntries))
+	if result.ClickLogs > 0 || result.Rollups > 0 || result.IndexEntries > 0 {
+		log.Printf("janitor: deleted %d click logs and %d rollups, removed %d index entries", result.ClickLogs, result.Rollups, result.IndexEntries)
+	}
+	return result
+}
+
+// The function runs the janitor at the configured interval for the lifetime of the process.
+func runJanitorJob(rdb *redis.Client) {
+	staggerStart(config.JanitorInterval)
+	ticker := time.NewTicker(config.JanitorInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		runJanitor(context.Background(), rdb)
+	}
+}
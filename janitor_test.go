@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJanitor(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/api/campaigns", "name=launch", admin)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		w := performRequest(router, "POST", "/create", "long_url=https://example.com&tags=docs&campaign_id="+campaign.ID, admin)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		tokens = append(tokens, created["token"])
+		performRequest(router, "GET", "/"+created["token"], "", nil)
+		time.Sleep(50 * time.Millisecond)
+	}
+	rdb.HSet(testCtx, clickRollupKey(tokens[0]), "total", 3)
+
+	// The first link disappears without its analytics
+	rdb.Del(testCtx, tokens[0])
+
+	result := runJanitor(testCtx, rdb)
+	assert.Equal(t, 1, result.ClickLogs)
+	assert.Equal(t, 1, result.Rollups)
+	// index:all, the tag, owner, campaign and destination indexes
+	assert.Equal(t, 5, result.IndexEntries)
+
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, clickLogKey(tokens[0]), clickRollupKey(tokens[0])).Val())
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, clickLogKey(tokens[1])).Val())
+	assert.Equal(t, []string{tokens[1]}, rdb.SMembers(testCtx, tagIndexKey("docs")).Val())
+	assert.Equal(t, []string{campaign.ID}, rdb.SMembers(testCtx, ownerCampaignsKey(adminAPIKey.ID)).Val())
+
+	// Nothing left to do
+	assert.Equal(t, JanitorResult{}, runJanitor(testCtx, rdb))
+
+	w = performRequest(router, "GET", "/debug/vars", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var vars map[string]json.RawMessage
+	json.Unmarshal(w.Body.Bytes(), &vars)
+	assert.Contains(t, string(vars["janitor"]), `"click_logs_deleted"`)
+	w = performRequest(router, "GET", "/debug/vars", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Links created in bulk with the same max_age would otherwise all expire in the same second, and their
+// analytics, tombstones and archive snapshots with them. Spreading out their expiry and the jobs
+// cleaning up after them keeps Redis from deleting everything at once.
+
+// The `ttlJitter` function returns the random extra lifetime of a new link, up to TTLJitter.
+func ttlJitter() time.Duration {
+	if config.TTLJitter <= 0 {
+		return 0
+	}
+	return rand.N(config.TTLJitter)
+}
+
+// The function waits a random part of a job's interval before its first run, so the jobs of several
+// instances started together don't run in lockstep.
+func staggerStart(interval time.Duration) {
+	if interval > 0 {
+		time.Sleep(rand.N(interval))
+	}
+}
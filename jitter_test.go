@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLJitter(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	config.TTLJitter = 0
+	assert.Zero(t, ttlJitter())
+
+	config.TTLJitter = time.Minute
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		jitter := ttlJitter()
+		assert.GreaterOrEqual(t, jitter, time.Duration(0))
+		assert.Less(t, jitter, time.Minute)
+		seen[jitter] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Link owners authenticated with a bearer token are recorded as "jwt:<subject>"
+const jwtOwnerPrefix = "jwt:"
+
+var (
+	errInvalidJWT = errors.New("invalid bearer token")
+	// The identity provider's key set couldn't be fetched, so the token couldn't be checked
+	errJWKSUnavailable = errors.New("identity provider unreachable")
+)
+
+// Requests for the key set don't go through outboundClient, the identity provider isn't a link destination
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// Signature algorithms accepted in tokens, with the hash they sign. Symmetric algorithms and "none"
+// are never accepted: the key set only holds public keys.
+var jwtAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// jwksCache keeps the public keys of the identity provider by key ID. The set is fetched again once
+// it is older than JWT_JWKS_REFRESH, or when a token names a key that isn't known yet, e.g. after the
+// provider rotated its keys, but at most every jwksMinRefetch. The set is fetched without holding the
+// lock, by one request at a time, so a slow provider only holds up requests that need a key it hasn't
+// sent yet.
+type jwksCache struct {
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+	// Closed when the fetch in progress ends, nil while there is none
+	refreshing chan struct{}
+	// Error of the last fetch
+	err error
+}
+
+const jwksMinRefetch = 30 * time.Second
+
+var jwks = &jwksCache{}
+
+// jsonWebKey is a key of a JWKS document; only the members of RSA and EC public keys are read.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// The function converts a JSON web key to a public key.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC key isn't on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// The function fetches the key set from config.JWTJWKSURL. Keys that can't be used for signatures are
+// skipped.
+func fetchJWKS(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.JWTJWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key set request returned %s", resp.Status)
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if publicKey, err := key.publicKey(); err == nil {
+			keys[key.Kid] = publicKey
+		}
+	}
+	return keys, nil
+}
+
+// The `key` function returns the public key with the given ID, fetching the key set if needed.
+func (j *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	publicKey, known := j.keys[kid]
+	stale := time.Since(j.fetched) > config.JWTJWKSRefresh
+	if known && !stale {
+		j.mu.Unlock()
+		return publicKey, nil
+	}
+	done, fetching := j.refreshing, false
+	if done == nil && time.Since(j.attempted) > jwksMinRefetch {
+		j.attempted = time.Now()
+		done, fetching = make(chan struct{}), true
+		j.refreshing = done
+	}
+	j.mu.Unlock()
+
+	switch {
+	case fetching:
+		// Other requests wait for the result, so it mustn't depend on this client staying connected
+		keys, err := fetchJWKS(context.WithoutCancel(ctx))
+		j.mu.Lock()
+		if err == nil {
+			j.keys, j.fetched = keys, time.Now()
+		}
+		j.err, j.refreshing = err, nil
+		j.mu.Unlock()
+		close(done)
+	case known:
+		// Keys that were known keep working while the set is fetched again
+		return publicKey, nil
+	case done == nil:
+		return nil, errInvalidJWT
+	default:
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, errJWKSUnavailable
+		}
+	}
+
+	// Keys that were known also keep working while the provider is unreachable
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if updated, ok := j.keys[kid]; ok {
+		return updated, nil
+	}
+	if j.err != nil {
+		if known {
+			return publicKey, nil
+		}
+		return nil, errJWKSUnavailable
+	}
+	return nil, errInvalidJWT
+}
+
+// jwtClaims holds the registered claims that are checked. The audience can be a string or a list.
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+func (c jwtClaims) hasAudience(audience string) bool {
+	var single string
+	if json.Unmarshal(c.Audience, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	json.Unmarshal(c.Audience, &list)
+	for _, entry := range list {
+		if entry == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// The function checks the signature of a token's signing input with an RSA or EC public key.
+func verifyJWTSignature(alg string, publicKey crypto.PublicKey, input string, signature []byte) bool {
+	hash := jwtAlgorithms[alg]
+	hasher := hash.New()
+	hasher.Write([]byte(input))
+	digest := hasher.Sum(nil)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// The `verifyJWT` function checks a bearer token against the identity provider's key set and the
+// configured issuer and audience, and returns its claims. Expiry is required; a small leeway allows
+// for clock skew between the provider and the service.
+func verifyJWT(ctx context.Context, token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errInvalidJWT
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return jwtClaims{}, errInvalidJWT
+	}
+	if _, ok := jwtAlgorithms[header.Alg]; !ok {
+		return jwtClaims{}, errInvalidJWT
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, errInvalidJWT
+	}
+
+	publicKey, err := jwks.key(ctx, header.Kid)
+	if err != nil {
+		return jwtClaims{}, err
+	}
+	if !verifyJWTSignature(header.Alg, publicKey, parts[0]+"."+parts[1], signature) {
+		return jwtClaims{}, errInvalidJWT
+	}
+
+	var claims jwtClaims
+	data, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return jwtClaims{}, errInvalidJWT
+	}
+	now := float64(time.Now().Unix())
+	leeway := config.JWTLeeway.Seconds()
+	switch {
+	case claims.ExpiresAt == nil || now > *claims.ExpiresAt+leeway,
+		claims.NotBefore != nil && now < *claims.NotBefore-leeway,
+		claims.Issuer != config.JWTIssuer,
+		config.JWTAudience != "" && !claims.hasAudience(config.JWTAudience),
+		claims.Subject == "" || len(claims.Subject) > 255:
+		return jwtClaims{}, errInvalidJWT
+	}
+	return claims, nil
+}
+
+// The function returns the bearer token of a request, if JWT authentication is enabled and one was sent.
+func bearerToken(c *gin.Context) (string, bool) {
+	if config.JWTJWKSURL == "" {
+		return "", false
+	}
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// The `authenticateBearer` function resolves the API key standing in for the subject of a bearer
+// token. Links created with it are owned by "jwt:<subject>", so each user of the identity provider
+// manages their own links, campaigns and account like the holder of an API key.
+func authenticateBearer(c *gin.Context, token string) (*APIKey, bool) {
+	claims, err := verifyJWT(c.Request.Context(), token)
+	if err == errJWKSUnavailable {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the identity provider, please try again later."})
+		return nil, false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired bearer token"})
+		return nil, false
+	}
+	return &APIKey{ID: jwtOwnerPrefix + claims.Subject, Name: claims.Subject}, true
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeSegment(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// The function signs test tokens with an RSA or P-256 key.
+func signTestJWT(key crypto.Signer, kid string, claims map[string]interface{}) string {
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	input := encodeSegment(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestBearerAuthentication(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fetches := 0
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa-1", "use": "sig",
+				"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec-1", "crv": "P-256",
+				"x": base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+		}})
+	}))
+	defer provider.Close()
+
+	previous := config
+	config.JWTJWKSURL = provider.URL
+	config.JWTIssuer = "https://sso.example"
+	config.JWTAudience = "shortener"
+	config.AdminAPIKey = "admin-secret"
+	previousJWKS := jwks
+	jwks = &jwksCache{}
+	defer func() { config, jwks = previous, previousJWKS }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss": "https://sso.example",
+			"sub": "alice",
+			"aud": []string{"shortener", "other"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for name, value := range changes {
+			claims[name] = value
+		}
+		return claims
+	}
+	bearer := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/rsa", bearer(signTestJWT(rsaKey, "rsa-1", claims(nil))))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/ec", bearer(signTestJWT(ecKey, "ec-1", claims(nil))))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, fetches)
+
+	// The subject owns the links
+	w = performRequest(router, "GET", "/api/urls?owner=jwt:alice", "", map[string]string{apiKeyHeader: "admin-secret"})
+	var page struct {
+		URLs []URL `json:"urls"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Len(t, page.URLs, 2)
+
+	for name, token := range map[string]string{
+		"expired":        signTestJWT(rsaKey, "rsa-1", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiry":      signTestJWT(rsaKey, "rsa-1", claims(map[string]interface{}{"exp": nil})),
+		"wrong issuer":   signTestJWT(rsaKey, "rsa-1", claims(map[string]interface{}{"iss": "https://evil.example"})),
+		"wrong audience": signTestJWT(rsaKey, "rsa-1", claims(map[string]interface{}{"aud": "other"})),
+		"no subject":     signTestJWT(rsaKey, "rsa-1", claims(map[string]interface{}{"sub": ""})),
+		"wrong key":      signTestJWT(ecKey, "rsa-1", claims(nil)),
+		"unsigned":       encodeSegment(map[string]string{"alg": "none"}) + "." + encodeSegment(claims(nil)) + ".",
+		"garbage":        "not-a-token",
+	} {
+		w = performRequest(router, "POST", "/create", "long_url=https://example.com", bearer(token))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+	}
+
+	// Unknown key IDs refetch the key set, but not on every request
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", bearer(signTestJWT(rsaKey, "rotated", claims(nil))))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 1, fetches)
+	jwks.attempted = time.Time{}
+	performRequest(router, "POST", "/create", "long_url=https://example.com", bearer(signTestJWT(rsaKey, "rotated", claims(nil))))
+	assert.Equal(t, 2, fetches)
+
+	// Bearer tokens are ignored when no identity provider is configured
+	config.JWTJWKSURL = ""
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", bearer("not-a-token"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBearerAuthenticationProviderDown(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer provider.Close()
+
+	previous := config
+	config.JWTJWKSURL = provider.URL
+	config.JWTIssuer = "https://sso.example"
+	previousJWKS := jwks
+	jwks = &jwksCache{}
+	defer func() { config, jwks = previous, previousJWKS }()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := signTestJWT(rsaKey, "rsa-1", map[string]interface{}{"iss": "https://sso.example", "sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", map[string]string{"Authorization": "Bearer " + token})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestJWKSFetchDoesNotBlockKnownKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "rotated",
+			"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		}}})
+	}))
+	defer provider.Close()
+
+	previous := config
+	config.JWTJWKSURL = provider.URL
+	config.JWTJWKSRefresh = time.Hour
+	previousJWKS := jwks
+	jwks = &jwksCache{keys: map[string]crypto.PublicKey{"known": &rsaKey.PublicKey}, fetched: time.Now()}
+	defer func() { config, jwks = previous, previousJWKS }()
+
+	// Two requests for a key that isn't known yet share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := jwks.key(context.Background(), "rotated")
+			assert.NoError(t, err)
+			assert.NotNil(t, key)
+		}()
+	}
+	assert.Eventually(t, func() bool { return fetches.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// While the provider is slow to answer, known keys are served without waiting
+	start := time.Now()
+	key, err := jwks.key(context.Background(), "known")
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), fetches.Load())
+}
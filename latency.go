@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redirects served from stale link records and with deferred limit checks, published at /debug/vars
+var latencyStats = expvar.NewMap("latency_budget")
+
+// latencyBudget bounds the time a redirect waits for Redis. Lookups still running when it is spent
+// finish in the background, and the redirect is served from what the process already knows.
+type latencyBudget struct {
+	deadline time.Time
+}
+
+// The function starts the budget of a redirect, which is unlimited when no budget is configured.
+func newLatencyBudget() latencyBudget {
+	if config.RedirectLatencyBudget <= 0 {
+		return latencyBudget{}
+	}
+	return latencyBudget{deadline: time.Now().Add(config.RedirectLatencyBudget)}
+}
+
+func (b latencyBudget) unlimited() bool {
+	return b.deadline.IsZero()
+}
+
+// The function runs op in the background and returns a channel that is closed once it is done.
+func runAsync(op func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		op()
+	}()
+	return done
+}
+
+// The function waits for done until the budget is spent, reporting whether it was closed in time.
+func (b latencyBudget) await(done <-chan struct{}) bool {
+	if b.unlimited() {
+		<-done
+		return true
+	}
+	timer := time.NewTimer(time.Until(b.deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// The `loadBudgetedLink` function is loadCachedLink bounded by the latency budget. If Redis doesn't
+// answer in time, an expired entry of the link cache is used, as long as the link itself hasn't
+// expired; the lookup then refreshes the cache in the background. Without such an entry the redirect
+// waits for Redis after all.
+func loadBudgetedLink(ctx context.Context, rdb *redis.Client, key string, budget latencyBudget) (string, error) {
+	if budget.unlimited() || linkCache == nil {
+		opCtx, cancel := readContext(ctx)
+		defer cancel()
+		val, err := loadCachedLink(opCtx, rdb, key)
+		return fallBackToCache(key, val, err)
+	}
+
+	var val string
+	var err error
+	opCtx, cancel := readContext(context.WithoutCancel(ctx))
+	done := runAsync(func() {
+		defer cancel()
+		val, err = loadCachedLink(opCtx, rdb, key)
+	})
+	if budget.await(done) {
+		return val, err
+	}
+	if stale, ok := linkCache.stale(key); ok && liveRecord(stale) {
+		latencyStats.Add("stale_links", 1)
+		return stale, nil
+	}
+	<-done
+	return fallBackToCache(key, val, err)
+}
+
+// The function reports whether a stored link record hasn't expired yet.
+func liveRecord(val string) bool {
+	var urlEntry URL
+	return json.Unmarshal([]byte(val), &urlEntry) == nil && urlEntry.ttl() > 0
+}
+
+// The `consumeBudgetedAccess` function is consumeAccess bounded by the latency budget, followed by the
+// shadow evaluation of the access. If the counters don't answer in time, the access is let through
+// without a limit check; it is still counted, and evaluated by the shadow engine, once Redis answers.
+// The keys of the windows the access was counted in are only returned if it was counted in time.
+func consumeBudgetedAccess(ctx context.Context, rdb *redis.Client, key string, limits []accessLimit, budget latencyBudget) (*accessWindow, []string, error) {
+	var exhausted *accessWindow
+	var counted []string
+	var err error
+	consumeCtx := ctx
+	if !budget.unlimited() {
+		consumeCtx = context.WithoutCancel(ctx)
+	}
+	opCtx, cancel := writeContext(consumeCtx)
+	engine := activeShadowEngine()
+	done := runAsync(func() {
+		defer cancel()
+		exhausted, counted, err = consumeAccess(opCtx, rdb, key, limits)
+		// The shadow engine decides on the same access in the background, without affecting the response
+		if err == nil && engine != nil {
+			go shadowEvaluate(context.WithoutCancel(ctx), rdb, engine, key, limits, exhausted)
+		}
+	})
+	if !budget.await(done) {
+		latencyStats.Add("deferred_limits", 1)
+		return nil, nil, nil
+	}
+	return exhausted, counted, err
+}
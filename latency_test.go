@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyBudgetAwait(t *testing.T) {
+	budget := latencyBudget{deadline: time.Now().Add(20 * time.Millisecond)}
+	assert.True(t, budget.await(runAsync(func() {})))
+
+	slow := runAsync(func() { time.Sleep(200 * time.Millisecond) })
+	started := time.Now()
+	assert.False(t, budget.await(slow))
+	assert.Less(t, time.Since(started), 150*time.Millisecond)
+
+	// Without a budget everything is waited for
+	assert.True(t, latencyBudget{}.await(runAsync(func() { time.Sleep(10 * time.Millisecond) })))
+}
+
+// The function returns a client of a Redis server that accepts connections but never answers.
+func stalledRedis(t *testing.T) *redis.Client {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	rdb := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), MaxRetries: -1, ContextTimeoutEnabled: true})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestLoadBudgetedLinkServesStaleRecords(t *testing.T) {
+	previous, previousCache := config, linkCache
+	config.RedisReadTimeout = 300 * time.Millisecond
+	linkCache = newLRUCache(10, time.Millisecond, linkCacheStats)
+	defer func() { config, linkCache = previous, previousCache }()
+
+	rdb := stalledRedis(t)
+	live, _ := json.Marshal(URL{Token: "live", LongURL: "https://example.com", MaxAccess: -1, ExpiresAt: time.Now().Add(time.Hour).Format(time.RFC3339)})
+	expired, _ := json.Marshal(URL{Token: "gone", LongURL: "https://example.com", MaxAccess: -1, ExpiresAt: time.Now().Add(-time.Hour).Format(time.RFC3339)})
+	linkCache.set("live", string(live))
+	linkCache.set("gone", string(expired))
+	time.Sleep(5 * time.Millisecond)
+
+	budget := latencyBudget{deadline: time.Now().Add(20 * time.Millisecond)}
+	started := time.Now()
+	val, err := loadBudgetedLink(context.Background(), rdb, "live", budget)
+	assert.NoError(t, err)
+	assert.Equal(t, string(live), val)
+	assert.Less(t, time.Since(started), 200*time.Millisecond)
+
+	// Records of expired links aren't served, the lookup is waited for and fails
+	_, err = loadBudgetedLink(context.Background(), rdb, "gone", budget)
+	assert.Error(t, err)
+}
+
+func TestConsumeBudgetedAccessDefersLimits(t *testing.T) {
+	previous := config
+	config.RedisWriteTimeout = 300 * time.Millisecond
+	defer func() { config = previous }()
+
+	rdb := stalledRedis(t)
+	budget := latencyBudget{deadline: time.Now().Add(20 * time.Millisecond)}
+	exhausted, counted, err := consumeBudgetedAccess(context.Background(), rdb, "link", []accessLimit{{hourWindow, 1}}, budget)
+	assert.NoError(t, err)
+	assert.Nil(t, exhausted)
+	// A deferred access may not be counted yet, so there is nothing to refund
+	assert.Empty(t, counted)
+
+	// Without a budget the failure is reported
+	_, _, err = consumeBudgetedAccess(context.Background(), rdb, "link", []accessLimit{{hourWindow, 1}}, latencyBudget{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Hits, misses, evictions and invalidations of the link cache, published at /debug/vars
+var linkCacheStats = expvar.NewMap("link_cache")
+
+// lruCache keeps values in process memory for a short time, evicting the least recently used ones. The
+// link cache keeps the records of recently followed links, so hot links don't cost a Redis round trip
+// on every redirect. Entries are dropped when the link is updated or deleted by this process; other
+// replicas see changes once their entries expire.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	stats   *expvar.Map
+}
+
+type cacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration, stats *expvar.Map) *lruCache {
+	return &lruCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}, stats: stats}
+}
+
+// The link cache of the process, nil when disabled
+var linkCache = newLinkCache()
+
+func newLinkCache() *lruCache {
+	if config.LinkCacheSize <= 0 || config.LinkCacheTTL <= 0 {
+		return nil
+	}
+	return newLRUCache(config.LinkCacheSize, config.LinkCacheTTL, linkCacheStats)
+}
+
+func (c *lruCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Add("misses", 1)
+		return "", false
+	}
+	// Expired entries are kept until they are replaced or evicted, as a fallback for slow lookups
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.stats.Add("misses", 1)
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	c.stats.Add("hits", 1)
+	return entry.value, true
+}
+
+// The function returns the entry of a key even if it has expired. Entries of links that were updated
+// or deleted by this process are gone, not stale.
+func (c *lruCache) stale(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.stats.Add("stale_hits", 1)
+	return element.Value.(*cacheEntry).value, true
+}
+
+func (c *lruCache) set(key, value string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cacheEntry{key: key, value: value, expires: expires}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Add("evictions", 1)
+	}
+}
+
+// The function refreshes the entry of a link that was saved, if it is cached.
+func (c *lruCache) update(key, value string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).value = value
+	}
+}
+
+// The function drops the entries of links that were updated or deleted.
+func (c *lruCache) invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.order.Remove(element)
+			delete(c.entries, key)
+			c.stats.Add("invalidations", 1)
+		}
+	}
+}
+
+// The function reports whether a link record may be served from the cache. Links whose every access
+// must see the latest count, one-time links and links with max_access, are always read from Redis.
+func cacheable(val string) bool {
+	var urlEntry URL
+	if json.Unmarshal([]byte(val), &urlEntry) != nil {
+		return false
+	}
+	return !urlEntry.OneTime && urlEntry.MaxAccess == -1
+}
+
+// The `loadCachedLink` function is loadReplicatedLink with the link cache in front of it.
+func loadCachedLink(ctx context.Context, rdb *redis.Client, key string) (string, error) {
+	if val, ok := linkCache.get(key); ok {
+		return val, nil
+	}
+	val, err := loadReplicatedLink(ctx, rdb, key)
+	if err == nil && cacheable(val) {
+		linkCache.set(key, val)
+	}
+	return val, err
+}
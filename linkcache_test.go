@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := newLRUCache(2, time.Minute, linkCacheStats)
+	cache.set("a", "1")
+	cache.set("b", "2")
+	cache.get("a")
+	// b is the least recently used entry
+	cache.set("c", "3")
+	_, ok := cache.get("b")
+	assert.False(t, ok)
+	value, ok := cache.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+
+	cache.update("a", "updated")
+	cache.update("b", "ignored")
+	value, _ = cache.get("a")
+	assert.Equal(t, "updated", value)
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+
+	cache.invalidate("a")
+	_, ok = cache.get("a")
+	assert.False(t, ok)
+
+	expiring := newLRUCache(2, time.Millisecond, linkCacheStats)
+	expiring.set("a", "1")
+	time.Sleep(5 * time.Millisecond)
+	_, ok = expiring.get("a")
+	assert.False(t, ok)
+}
+
+func TestCachedRedirects(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous, previousCache := config, linkCache
+	config.AdminAPIKey = "admin-secret"
+	linkCache = newLRUCache(100, time.Minute, linkCacheStats)
+	defer func() { config, linkCache = previous, previousCache }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+
+	hits := func() int64 {
+		if v := linkCacheStats.Get("hits"); v != nil {
+			return v.(interface{ Value() int64 }).Value()
+		}
+		return 0
+	}
+	before := hits()
+	for i := 0; i < 3; i++ {
+		w = performRequest(router, "GET", "/"+token, "", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, int64(2), hits()-before)
+
+	// Cached links still count every access
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	assert.Equal(t, 3, urlEntry.CurrentAccessCount)
+
+	// Deleting the link drops it from the cache
+	w = performRequest(router, "DELETE", "/api/urls/"+token, "", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Links with max_access are always read from Redis
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=5", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	performRequest(router, "GET", "/"+response["token"], "", nil)
+	_, ok := linkCache.get(response["token"])
+	assert.False(t, ok)
+}
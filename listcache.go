@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Hits, misses and evictions of the list cache, published at /debug/vars
+var listCacheStats = expvar.NewMap("list_cache")
+
+// listCache keeps the results of heavy list queries for a short time, so dashboards refreshing the
+// admin link listing or the destination report don't recompute them on every request. Nil when
+// disabled.
+var listCache = newListCache()
+
+func newListCache() *lruCache {
+	if config.ListCacheSize <= 0 || config.ListCacheTTL <= 0 {
+		return nil
+	}
+	return newLRUCache(config.ListCacheSize, config.ListCacheTTL, listCacheStats)
+}
+
+// Generation of the link listings. Cached listings belong to a generation, and changing the set of
+// links starts a new one, so every replica stops using its cached listings at once.
+const listGenerationKey = "listcache:generation"
+
+// The `invalidateListings` function is called when links are created or deleted.
+func invalidateListings(ctx context.Context, rdb redis.Cmdable) {
+	if listCache != nil {
+		rdb.Incr(ctx, listGenerationKey)
+	}
+}
+
+// The `listTokens` function returns the sorted tokens of the links in every one of the index sets.
+// Links that expired since the listing was cached are still in it, callers skip them like the stale
+// entries of the index sets themselves.
+func listTokens(ctx context.Context, rdb *redis.Client, indexes []string) ([]string, error) {
+	cacheKey := ""
+	if listCache != nil {
+		generation, err := rdb.Get(ctx, listGenerationKey).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		// Each data residency region has listings, and generations, of its own
+		cacheKey = "links:" + contextRegion(ctx) + ":" + generation + ":" + strings.Join(indexes, ",")
+		if val, ok := listCache.get(cacheKey); ok {
+			if val == "" {
+				return []string{}, nil
+			}
+			return strings.Split(val, "\n"), nil
+		}
+	}
+
+	tokens, err := rdb.SInter(ctx, indexes...).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tokens)
+	listCache.set(cacheKey, strings.Join(tokens, "\n"))
+	return tokens, nil
+}
+
+// The `destinationCounters` function returns the destination counters of an owner. The counters change
+// with every click, so cached ones are up to LIST_CACHE_TTL old.
+func destinationCounters(ctx context.Context, rdb *redis.Client, owner string) (map[string]string, error) {
+	cacheKey := "destinations:" + contextRegion(ctx) + ":" + owner
+	if val, ok := listCache.get(cacheKey); ok {
+		var fields map[string]string
+		if json.Unmarshal([]byte(val), &fields) == nil {
+			return fields, nil
+		}
+	}
+
+	fields, err := rdb.HGetAll(ctx, destinationStatsKey(owner)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if listCache != nil {
+		data, _ := json.Marshal(fields)
+		listCache.set(cacheKey, string(data))
+	}
+	return fields, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCache(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous, previousCache := config, listCache
+	config.AdminAPIKey = "admin-secret"
+	listCache = newLRUCache(10, time.Minute, listCacheStats)
+	defer func() { config, listCache = previous, previousCache }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+	tag := "listcache" + randomHex(4)
+	list := func() []string {
+		var response struct {
+			URLs []URL `json:"urls"`
+		}
+		w := performRequest(router, "GET", "/api/urls?tag="+tag, "", admin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &response)
+		var tokens []string
+		for _, urlEntry := range response.URLs {
+			tokens = append(tokens, urlEntry.Token)
+		}
+		return tokens
+	}
+	create := func() string {
+		var created map[string]string
+		w := performRequest(router, "POST", "/create", "long_url=https://example.com&tags="+tag, nil)
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+
+	first := create()
+	assert.Equal(t, []string{first}, list())
+
+	// Repeated listings are served from the cache, even if the index changed behind its back
+	rdb.SAdd(testCtx, tagIndexKey(tag), "unlisted")
+	assert.Equal(t, []string{first}, list())
+
+	// Creating and deleting links starts over
+	second := create()
+	assert.ElementsMatch(t, []string{first, second}, list())
+	w := performRequest(router, "DELETE", "/api/urls/"+first, "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{second}, list())
+
+	tokens, err := listTokens(testCtx, rdb, []string{tagIndexKey("no-such-tag-" + tag)})
+	assert.NoError(t, err)
+	assert.Empty(t, tokens)
+	tokens, _ = listTokens(testCtx, rdb, []string{tagIndexKey("no-such-tag-" + tag)})
+	assert.NotNil(t, tokens)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// A handler served on a listen address, over TLS when tlsConfig is set
+type listener struct {
+	handler   http.Handler
+	tlsConfig *tls.Config
+}
+
+// The `newServer` function returns the server of a listen address with the configured timeouts and
+// limits. TLS listeners negotiate HTTP/2 with clients, plain ones accept it without TLS (h2c) when
+// H2C is on, e.g. behind a load balancer speaking HTTP/2 to its backends.
+func newServer(addr string, l listener) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           l.handler,
+		TLSConfig:         l.tlsConfig,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+	server.SetKeepAlivesEnabled(config.KeepAlives)
+	h2 := &http2.Server{MaxConcurrentStreams: uint32(config.HTTP2MaxStreams), IdleTimeout: config.IdleTimeout}
+	if l.tlsConfig != nil {
+		if err := http2.ConfigureServer(server, h2); err != nil {
+			log.Printf("HTTP/2 on %s: %v", addr, err)
+		}
+	} else if config.H2C {
+		server.Handler = h2c.NewHandler(l.handler, h2)
+	}
+	return server
+}
+
+// The `serve` function serves each handler on its listen address, e.g. the public router on an IPv4
+// and an IPv6 address and the admin router on localhost. It returns when one of the listeners fails.
+func serve(listeners map[string]listener) error {
+	errs := make(chan error, len(listeners))
+	for addr, l := range listeners {
+		server := newServer(addr, l)
+		go func() {
+			if server.TLSConfig != nil {
+				log.Printf("listening on %s (TLS)", addr)
+				errs <- server.ListenAndServeTLS("", "")
+				return
+			}
+			log.Printf("listening on %s", addr)
+			errs <- server.ListenAndServe()
+		}()
+	}
+	return <-errs
+}
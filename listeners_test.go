@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+func TestAdminListener(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.AdminListenAddr = "localhost:9090"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	public := setupRouter(rdb)
+	admin := setupAdminRouter(rdb)
+	headers := map[string]string{apiKeyHeader: "admin-secret"}
+
+	// The admin API is only served by the admin router, the public one only lists the key's own links
+	w := performRequest(public, "GET", "/api/admin/audit", "", headers)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performRequest(public, "GET", "/api/urls?ip=127.0.0.1", "", headers)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(admin, "GET", "/api/urls", "", headers)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(admin, "GET", "/api/urls", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(public, "POST", "/create", "long_url=https://example.com", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(admin, "POST", "/create", "long_url=https://example.com", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServeFailingListener(t *testing.T) {
+	err := serve(map[string]listener{"localhost:-1": {handler: http.NotFoundHandler()}})
+	assert.Error(t, err)
+}
+
+func TestNewServer(t *testing.T) {
+	previous := config
+	config.ReadHeaderTimeout = 5 * time.Second
+	config.MaxHeaderBytes = 4096
+	config.H2C = true
+	defer func() { config = previous }()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server := newServer("localhost:0", listener{handler: handler})
+	assert.Equal(t, 5*time.Second, server.ReadHeaderTimeout)
+	assert.Equal(t, 4096, server.MaxHeaderBytes)
+
+	// HTTP/2 without TLS is accepted with H2C
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
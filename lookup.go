@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// LookupResult is a link found by the reverse lookup, with its statistics.
+type LookupResult struct {
+	Token              string   `json:"token"`
+	Domain             string   `json:"domain,omitempty"`
+	ShortURL           string   `json:"short_url"`
+	CreatedAt          string   `json:"created_at"`
+	LastAccessedAt     string   `json:"last_accessed_at"`
+	ExpiresAt          string   `json:"expires_at"`
+	CurrentAccessCount int      `json:"current_access_count"`
+	MaxAccess          int      `json:"max_access"`
+	Tags               []string `json:"tags,omitempty"`
+}
+
+// The `lookupHandler` function finds the links leading to the destination in the `url` parameter, so
+// clients can reuse an existing short link instead of creating another one. API keys only find their
+// own links, the admin key finds all of them.
+func lookupHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	longURL, err := normalizeDestination(c.Query("url"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid url parameter"})
+		return
+	}
+	index := destinationIndexKey(longURL)
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	keys, err := rdb.SMembers(opCtx, index).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	sort.Strings(keys)
+
+	links := []LookupResult{}
+	var stale []interface{}
+	if len(keys) > 0 {
+		values, err := rdb.MGet(opCtx, keys...).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				stale = append(stale, keys[i])
+				continue
+			}
+			var urlEntry URL
+			if json.Unmarshal([]byte(data), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+				continue
+			}
+			links = append(links, LookupResult{
+				Token:              urlEntry.Token,
+				Domain:             urlEntry.Domain,
+				ShortURL:           shortURLFor(c, urlEntry),
+				CreatedAt:          urlEntry.CreatedAt,
+				LastAccessedAt:     urlEntry.LastAccessedAt,
+				ExpiresAt:          urlEntry.ExpiresAt,
+				CurrentAccessCount: urlEntry.CurrentAccessCount,
+				MaxAccess:          urlEntry.MaxAccess,
+				Tags:               urlEntry.Tags,
+			})
+		}
+	}
+
+	// Drop index entries of links that have expired since they were indexed
+	if len(stale) > 0 {
+		cleanCtx, cleanCancel := writeContext(c.Request.Context())
+		defer cleanCancel()
+		rdb.SRem(cleanCtx, index, stale...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": longURL, "links": links})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseLookup(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key map[string]string
+	w := performRequest(router, "POST", "/api/admin/keys", "name=team", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	team := map[string]string{apiKeyHeader: key["key"]}
+
+	create := func(form string, headers map[string]string) string {
+		w := performRequest(router, "POST", "/create", form, headers)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+	own := create("long_url=https://example.com/page&tags=docs", team)
+	anonymous := create("long_url=https://example.com/page", nil)
+	create("long_url=https://example.com/page&one_time=true", team)
+	create("long_url=https://example.com/other", team)
+
+	lookup := func(longURL string, headers map[string]string) []LookupResult {
+		w := performRequest(router, "GET", "/api/lookup?url="+url.QueryEscape(longURL), "", headers)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Links []LookupResult `json:"links"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Links
+	}
+
+	// Keys only find their own links, one-time links are never found
+	links := lookup("https://example.com/page", team)
+	assert.Len(t, links, 1)
+	assert.Equal(t, own, links[0].Token)
+	assert.Equal(t, []string{"docs"}, links[0].Tags)
+	assert.True(t, strings.HasSuffix(links[0].ShortURL, "/"+own))
+
+	links = lookup("https://example.com/page", admin)
+	assert.Len(t, links, 2)
+
+	// Expired links are dropped from the index
+	rdb.Del(testCtx, anonymous)
+	assert.Len(t, lookup("https://example.com/page", admin), 1)
+	assert.Equal(t, int64(1), rdb.SCard(testCtx, destinationIndexKey("https://example.com/page")).Val())
+
+	assert.Empty(t, lookup("https://example.com/unknown", team))
+
+	w = performRequest(router, "GET", "/api/lookup?url=notaurl", "", team)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "GET", "/api/lookup?url=https://example.com/page", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -3,10 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"math/rand"
+	"errors"
+	"expvar"
+	"flag"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
@@ -17,117 +23,612 @@ const (
 	redisAddr     = "localhost:6379"
 	redisPassword = ""
 	redisDB       = 0
+
+	// Lifetime of a short URL in seconds: 1 hour unless DEFAULT_MAX_AGE says otherwise, between 1 second
+	// and 1 year
+	defaultMaxAge = 3600
+	minMaxAge     = 1
+	maxMaxAge     = 31536000
+
+	// Maximum length of the title of a link in characters
+	maxTitleLength = 200
 )
 
 type URL struct {
-	Token              string        `json:"token"`
-	LongURL            string        `json:"long_url"`
-	MaxAccess          int           `json:"max_access"`
-	CurrentAccessCount int           `json:"current_access_count"`
-	MaxPerHour         int           `json:"max_per_hour"`
-	HourlyAccessCount  int           `json:"hourly_access_count"`
-	CreatedAt          string        `json:"created_at"`
-	LastAccessedAt     string        `json:"last_accessed_at"`
-	LastHourlyResetAt  string        `json:"last_hourly_reset_at"`
-	AgeDuration        time.Duration `json:"age_duration"`
+	Token              string   `json:"token"`
+	LongURL            string   `json:"long_url"`
+	Title              string   `json:"title,omitempty"`
+	MaxAccess          int      `json:"max_access"`
+	CurrentAccessCount int      `json:"current_access_count"`
+	MaxPerHour         int      `json:"max_per_hour"`
+	MaxPerDay          int      `json:"max_per_day"`
+	MaxPerMonth        int      `json:"max_per_month"`
+	CreatedAt          string   `json:"created_at"`
+	LastAccessedAt     string   `json:"last_accessed_at"`
+	ExpiresAt          string   `json:"expires_at"`
+	CreatorIP          string   `json:"creator_ip,omitempty"`
+	CreatorAPIKey      string   `json:"creator_api_key,omitempty"`
+	Tags               []string `json:"tags,omitempty"`
+	Flagged            bool     `json:"flagged,omitempty"`
+	FlagReason         string   `json:"flag_reason,omitempty"`
+	CreatorTrusted     bool     `json:"creator_trusted,omitempty"`
+	CampaignID         string   `json:"campaign_id,omitempty"`
+	PreserveRaw        bool     `json:"preserve_raw,omitempty"`
+	Domain             string   `json:"domain,omitempty"`
+	Template           bool     `json:"template,omitempty"`
+	OneTime            bool     `json:"one_time,omitempty"`
+	// Seed the token was derived from, for links created with token_seed
+	TokenSeed string `json:"token_seed,omitempty"`
+	// The destination is shown in a frame under the short URL instead of redirecting to it
+	Frame bool `json:"frame,omitempty"`
+	// Category assigned by the classifier at creation: "social", "docs", "video", "commerce", ...
+	Category string `json:"category,omitempty"`
+	// No click log, creator IP or last access time is recorded for the link
+	NoTracking bool `json:"no_tracking,omitempty"`
+	// Domains the link may be followed from, any if empty
+	AllowedReferrers []string `json:"allowed_referrers,omitempty"`
+	// Visitors must pass a JavaScript challenge before they are redirected
+	Challenge bool `json:"challenge,omitempty"`
+	// Frozen links no longer count accesses, disabled ones no longer redirect
+	Frozen   bool `json:"frozen,omitempty"`
+	Disabled bool `json:"disabled,omitempty"`
+	// Data residency region the link is stored in, empty for the home region
+	Region string `json:"region,omitempty"`
+	// Number of edits made to the link, see its history
+	Version int `json:"version,omitempty"`
+}
+
+// The function decodes a stored link. Limits added after a link was created are missing from its
+// record and mean no limit rather than zero.
+func (u *URL) UnmarshalJSON(data []byte) error {
+	type stored URL
+	decoded := struct {
+		stored
+		AgeDuration time.Duration `json:"age_duration"`
+	}{stored: stored{MaxPerDay: -1, MaxPerMonth: -1}}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*u = URL(decoded.stored)
+
+	// Older records only have the lifetime, which every redirect restarted when it saved the record
+	if u.ExpiresAt == "" && decoded.AgeDuration > 0 {
+		saved, err := time.Parse(time.RFC3339, u.LastAccessedAt)
+		if err != nil {
+			saved = time.Now()
+		}
+		u.ExpiresAt = saved.Add(decoded.AgeDuration).Format(time.RFC3339)
+	}
+	return nil
+}
+
+// The function returns when the link expires.
+func (u URL) expiry() time.Time {
+	t, _ := time.Parse(time.RFC3339, u.ExpiresAt)
+	return t
+}
+
+// The function returns the remaining lifetime of the link, which is what it's stored with.
+func (u URL) ttl() time.Duration {
+	return time.Until(u.expiry())
+}
+
+// The `expiryTime` function returns the expiry time of a link living for maxAge from now, rounded up
+// to the second it is stored with.
+func expiryTime(maxAge time.Duration) time.Time {
+	t := time.Now().Add(maxAge)
+	if rounded := t.Truncate(time.Second); rounded.Before(t) {
+		return rounded.Add(time.Second)
+	}
+	return t
 }
 
-var ctx = context.Background()
+// The function tells clients when a link expires. Caches still have to ask again on every use, so
+// all accesses are counted.
+func setExpiryHeaders(c *gin.Context, urlEntry URL) {
+	c.Header("Expires", urlEntry.expiry().UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, no-cache")
+}
 
 // The function generates a random string of a specified length using characters from a given charset.
 func generateRandomString(length int) string {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(b)
+	return generateRandomToken(length, charset)
 }
 
-// The function generates a unique short URL of a specified length by checking if it already exists in
-// a Redis database.
-func generateUniqueShortURL(ctx context.Context, rdb *redis.Client, length int) string {
+// The function generates a random string of a specified length using characters from alphabet, with
+// the configured default generator.
+func generateRandomToken(length int, alphabet string) string {
+	return defaultTokenGenerator().Generate(length, alphabet)
+}
+
+// The function generates a unique short URL of a specified length by checking if it already exists on
+// the short domain in a Redis database. It gives up with an error if Redis can't answer, rather than
+// retrying forever.
+func generateUniqueShortURL(ctx context.Context, rdb *redis.Client, domain string, length int) (string, error) {
+	return generateUniqueToken(ctx, rdb, defaultTokenGenerator(), domain, length, charset)
+}
+
+// The function is generateUniqueShortURL with tokens drawn from alphabet by generator. Several
+// candidates are checked in one pipeline, so a collision doesn't cost another round trip. The token
+// is only free at the time of the check; createShortURL reserves it atomically.
+func generateUniqueToken(ctx context.Context, rdb *redis.Client, generator TokenGenerator, domain string, length int, alphabet string) (string, error) {
+	return drawUniqueToken(ctx, rdb, domain, func() string { return generator.Generate(length, alphabet) })
+}
+
+// The function checks the tokens draw returns for collisions like generateUniqueToken, for token
+// styles other than random characters.
+func drawUniqueToken(ctx context.Context, rdb *redis.Client, domain string, draw func() string) (string, error) {
 	for {
-		shortURL := generateRandomString(length)
-		_, err := rdb.Get(ctx, shortURL).Result()
-		if err == redis.Nil { // Key doesn't exist
-			return shortURL
+		candidates := make([]string, tokenCandidates)
+		for i := range candidates {
+			candidates[i] = draw()
+			if signingTokens() {
+				candidates[i] = signToken(domain, candidates[i])
+			}
+		}
+		opCtx, cancel := readContext(ctx)
+		cmds, err := rdb.Pipelined(opCtx, func(pipe redis.Pipeliner) error {
+			for _, candidate := range candidates {
+				pipe.Exists(opCtx, linkKey(domain, candidate))
+			}
+			return nil
+		})
+		cancel()
+		if err != nil {
+			return "", err
+		}
+		for i, cmd := range cmds {
+			if cmd.(*redis.IntCmd).Val() == 0 {
+				return candidates[i], nil
+			}
+		}
+	}
+}
+
+// The `reserveLink` function stores a new link unless its key is taken, reporting whether it was stored.
+func reserveLink(ctx context.Context, rdb *redis.Client, urlEntry URL) (bool, error) {
+	data, err := json.Marshal(urlEntry)
+	if err != nil {
+		return false, err
+	}
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	return rdb.SetNX(opCtx, urlEntry.key(), data, urlEntry.ttl()).Result()
+}
+
+// CreateOptions are the settings of a new short URL as requested by the client.
+type CreateOptions struct {
+	LongURL     string
+	MaxAccess   int
+	MaxPerHour  int
+	MaxPerDay   int
+	MaxPerMonth int
+	MaxAge      int
+	Tags        []string
+	CampaignID  string
+	// Title of the link, shown to visitors on error pages
+	Title string
+	// Store and redirect to LongURL exactly as given instead of its normalized form
+	PreserveRaw bool
+	// Substitute placeholders such as {click_id} in LongURL on every redirect
+	Template bool
+	// Delete the link on its first redirect
+	OneTime bool
+	// Don't record the creator IP, clicks or access times
+	NoTracking bool
+	// Only redirect visitors coming from these domains
+	AllowedReferrers []string
+	// Show a JavaScript challenge before redirecting
+	Challenge bool
+	// Show the destination in a frame under the short URL, if it allows framing
+	Frame bool
+	// Length of the token and name of the charset preset it is drawn from
+	TokenLength  int
+	TokenCharset string
+	// Derive the token from this seed, the owner and the destination instead of drawing it
+	TokenSeed string
+	// "random" characters, or "words" for a phrase token such as amber-otter-42
+	TokenStyle string
+	// Short domain to create the link on, empty for the default domain
+	Domain    string
+	APIKey    *APIKey
+	CreatorIP string
+}
+
+// The function returns the options used for everything the client doesn't specify on the domain.
+func defaultCreateOptions(domain string, apiKey *APIKey) CreateOptions {
+	maxAge, maxAccess := linkPolicy(domain, apiKey).defaults()
+	return CreateOptions{
+		MaxAccess: maxAccess, MaxPerHour: -1, MaxPerDay: -1, MaxPerMonth: -1,
+		MaxAge:       maxAge,
+		Domain:       domain,
+		TokenLength:  config.TokenLength,
+		TokenCharset: config.TokenCharset,
+		TokenStyle:   "random",
+	}
+}
+
+// apiError is an error that carries the HTTP status and message to respond with.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func newAPIError(status int, message string) *apiError {
+	return &apiError{Status: status, Message: message}
+}
+
+// The function responds with the status and message of an apiError, or a generic server error.
+func respondError(c *gin.Context, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		c.JSON(apiErr.Status, gin.H{"message": apiErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+}
+
+// The `createShortURL` function validates the options, generates a unique token and stores the URL
+// entry in Redis along with its index entries. It is shared by every endpoint that creates links.
+func createShortURL(ctx context.Context, rdb *redis.Client, opts CreateOptions) (URL, error) {
+	if opts.LongURL == "" {
+		return URL{}, newAPIError(http.StatusBadRequest, "Missing long_url parameter")
+	}
+
+	longURL, err := normalizeDestination(opts.LongURL)
+	if err != nil {
+		return URL{}, newAPIError(http.StatusBadRequest, "Invalid long_url parameter")
+	}
+	if err := checkDestinationPolicy(longURL); err != nil {
+		return URL{}, err
+	}
+
+	verdict := screenDestination(ctx, longURL)
+	if verdict.Malicious {
+		flaggedLinks.Add(1)
+	}
+	if verdict.Malicious && config.ScreeningAction == "reject" {
+		return URL{}, newAPIError(http.StatusBadRequest, "The destination was flagged as unsafe ("+verdict.Source+": "+verdict.Reason+")")
+	}
+
+	// Signed destination URLs break if a single byte changes, so on request the URL is stored exactly as
+	// given once its normalized form has passed validation and screening.
+	if opts.PreserveRaw {
+		if !isRawSafe(opts.LongURL) {
+			return URL{}, newAPIError(http.StatusBadRequest, "long_url must be percent-encoded ASCII without spaces when preserve_raw is set")
+		}
+		longURL = opts.LongURL
+	}
+
+	// Max age can't be less than 1 second and more than 1 year, or the cap of the creator's tier
+	policy := linkPolicy(opts.Domain, opts.APIKey)
+	if err := policy.checkMaxAge(opts.MaxAge); err != nil {
+		return URL{}, err
+	}
+	if err := policy.checkMaxAccess(opts.MaxAccess); err != nil {
+		return URL{}, err
+	}
+
+	if opts.CampaignID != "" {
+		if err := checkCampaign(ctx, rdb, opts.CampaignID, opts.APIKey); err != nil {
+			return URL{}, err
+		}
+	}
+
+	maxAgeDuration := time.Duration(opts.MaxAge)*time.Second + ttlJitter()
+	if err := validateTokenShape(opts.TokenLength, opts.TokenCharset); err != nil {
+		return URL{}, newAPIError(http.StatusBadRequest, "Invalid token parameters: "+err.Error())
+	}
+
+	if opts.TokenSeed != "" && opts.OneTime {
+		return URL{}, newAPIError(http.StatusBadRequest, "token_seed can't be used for one-time links")
+	}
+	if opts.TokenStyle != "random" && opts.TokenStyle != "words" && opts.TokenStyle != "emoji" {
+		return URL{}, newAPIError(http.StatusBadRequest, "Invalid token parameters: "+errInvalidTokenStyle.Error())
+	}
+	// Phrases and emoji are easier to guess than random characters, and seeded tokens are made of characters
+	if opts.TokenStyle != "random" && (opts.OneTime || opts.TokenSeed != "") {
+		return URL{}, newAPIError(http.StatusBadRequest, "token_style="+opts.TokenStyle+" can't be used for one-time links or with token_seed")
+	}
+	// Anonymous links share one namespace, where a seed would be all that keeps a caller from getting
+	// another's link, and its manage URL, back
+	if opts.TokenSeed != "" && opts.APIKey == nil {
+		return URL{}, newAPIError(http.StatusBadRequest, "token_seed requires an API key")
+	}
+
+	// Tokens of one-time links are secrets shared with a single recipient and must not be guessable
+	generator := defaultTokenGenerator()
+	if opts.OneTime {
+		generator = cryptoTokenGenerator{}
+	}
+	alphabet := tokenCharsets[opts.TokenCharset]
+
+	urlEntry := URL{
+		LongURL:            longURL,
+		Title:              opts.Title,
+		MaxAccess:          opts.MaxAccess,
+		CurrentAccessCount: 0,
+		MaxPerHour:         opts.MaxPerHour,
+		MaxPerDay:          opts.MaxPerDay,
+		MaxPerMonth:        opts.MaxPerMonth,
+		CreatedAt:          time.Now().Format(time.RFC3339),
+		LastAccessedAt:     time.Now().Format(time.RFC3339),
+		ExpiresAt:          expiryTime(maxAgeDuration).Format(time.RFC3339),
+		CreatorIP:          opts.CreatorIP,
+		Tags:               opts.Tags,
+		Category:           classifyDestination(ctx, longURL),
+		Flagged:            verdict.Malicious,
+		CampaignID:         opts.CampaignID,
+		PreserveRaw:        opts.PreserveRaw,
+		Template:           opts.Template,
+		OneTime:            opts.OneTime,
+		NoTracking:         opts.NoTracking,
+		AllowedReferrers:   opts.AllowedReferrers,
+		Challenge:          opts.Challenge,
+		Domain:             opts.Domain,
+		Region:             contextRegion(ctx),
+		TokenSeed:          opts.TokenSeed,
+	}
+	// Destinations refusing to be framed get a normal redirect
+	if opts.Frame {
+		urlEntry.Frame = probeFraming(ctx, longURL)
+	}
+	if opts.NoTracking {
+		urlEntry.CreatorIP = ""
+	}
+	if verdict.Malicious {
+		urlEntry.FlagReason = verdict.Source + ": " + verdict.Reason
+	}
+	if opts.APIKey != nil {
+		urlEntry.CreatorAPIKey = opts.APIKey.ID
+		urlEntry.CreatorTrusted = opts.APIKey.Trusted
+	}
+
+	// Free tokens are only a hint, another replica may take the same token in the meantime. The link is
+	// stored with SET NX, which reserves the token atomically, and a new token is drawn on conflict.
+	for attempt := 0; ; attempt++ {
+		if attempt == maxTokenAttempts {
+			return URL{}, newAPIError(http.StatusServiceUnavailable, "Error generating short URL")
+		}
+		if opts.TokenSeed != "" {
+			urlEntry.Token = seededToken(urlEntry, opts.TokenLength, alphabet)
+		} else if opts.TokenStyle == "words" {
+			urlEntry.Token, err = drawUniqueToken(ctx, rdb, opts.Domain, func() string {
+				return phraseToken(generator, tokenWords, config.TokenPhraseWords)
+			})
+		} else if opts.TokenStyle == "emoji" {
+			urlEntry.Token, err = drawUniqueToken(ctx, rdb, opts.Domain, func() string { return emojiToken(generator) })
+		} else if useSequentialTokens(alphabet, opts.OneTime) {
+			urlEntry.Token, err = generateSequentialToken(ctx, rdb, opts.Domain, opts.TokenLength, alphabet)
+		} else {
+			urlEntry.Token, err = generateUniqueToken(ctx, rdb, generator, opts.Domain, opts.TokenLength, alphabet)
+		}
+		if err != nil {
+			return URL{}, newAPIError(http.StatusServiceUnavailable, "Error generating short URL")
+		}
+
+		// With data residency regions, tokens are claimed in the directory first, so they are unique
+		// across regions
+		claimed, err := claimToken(ctx, urlEntry)
+		if err != nil {
+			return URL{}, newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+		}
+		if !claimed && opts.TokenSeed != "" {
+			return seededLink(ctx, rdb, urlEntry)
+		}
+		if !claimed {
+			continue
+		}
+		reserved, err := reserveLink(ctx, rdb, urlEntry)
+		if err != nil {
+			releaseToken(ctx, urlEntry)
+			return URL{}, newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+		}
+		if reserved {
+			break
+		}
+		releaseToken(ctx, urlEntry)
+		// Seeded tokens can't be drawn again, the link was created before
+		if opts.TokenSeed != "" {
+			return seededLink(ctx, rdb, urlEntry)
 		}
 	}
+
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	if err := consumeQuota(opCtx, rdb, urlEntry, opts.APIKey); err != nil {
+		rdb.Del(opCtx, urlEntry.key())
+		return URL{}, err
+	}
+
+	// Add the token to the owner/tag/IP indexes
+	_, err = rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		// A link taking over the token of a deleted one starts counting from zero
+		pipe.Del(opCtx, accessCountsKey(urlEntry.key()))
+		armRemainingUses(opCtx, pipe, urlEntry)
+		armTombstone(opCtx, pipe, urlEntry)
+		trackExpiry(opCtx, pipe, urlEntry)
+		recordEvent(opCtx, pipe, urlEntry, "created")
+		indexOwnedLink(opCtx, pipe, urlEntry)
+		invalidateListings(opCtx, pipe)
+		countDestination(opCtx, pipe, urlEntry, "links")
+		countCategory(opCtx, pipe, urlEntry, "links")
+		for _, key := range indexKeys(urlEntry) {
+			pipe.SAdd(opCtx, key, urlEntry.key())
+		}
+		return nil
+	})
+	if err != nil {
+		return URL{}, newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+	}
+
+	return urlEntry, nil
+}
+
+// Replaces a link record only if it is still the one given, with the remaining lifetime in milliseconds
+var replaceLinkScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// The `saveAccessedLink` function saves the record of a link after an access. The link keeps its
+// expiry time, so it is stored with its remaining lifetime rather than a fresh one. Only the record
+// the save was derived from, previous, is overwritten: a save racing with the link's expiry, deletion
+// or an edit must not undo it.
+func saveAccessedLink(ctx context.Context, rdb *redis.Client, key string, urlEntry URL, previous string, data []byte) bool {
+	ttl := urlEntry.ttl()
+	if ttl <= 0 {
+		return false
+	}
+	replaced, err := replaceLinkScript.Run(ctx, rdb, []string{key}, previous, data, ttl.Milliseconds()).Int()
+	return err == nil && replaced == 1
 }
 
 // The `createShortURLHandler` function generates a unique short URL for a given long URL and stores
 // the URL entry in Redis with specified parameters.
+// Requests carrying an Idempotency-Key are only processed once, and requests without an API key must
+// pass the CAPTCHA if one is configured.
 func createShortURLHandler(c *gin.Context, rdb *redis.Client) {
-	longURL := c.PostForm("long_url")
-	if longURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing long_url parameter"})
+	apiKey, ok := authenticate(c, rdb)
+	if !ok {
 		return
 	}
+	idempotent(c, rdb, apiKey, func() {
+		if requireCaptcha(c, apiKey) {
+			createShortURLForm(c, rdb, apiKey)
+		}
+	})
+}
 
-	maxAccessInt, err := strconv.Atoi(c.DefaultPostForm("max_access", "-1"))
+func createShortURLForm(c *gin.Context, rdb *redis.Client, apiKey *APIKey) {
+	domain, err := resolveCreateDomain(c, apiKey)
 	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	opts := defaultCreateOptions(domain, apiKey)
+	opts.LongURL = c.PostForm("long_url")
+	opts.CampaignID = c.PostForm("campaign_id")
+	opts.Title = strings.TrimSpace(c.PostForm("title"))
+	opts.PreserveRaw = c.PostForm("preserve_raw") == "true"
+	opts.Template = c.PostForm("template") == "true"
+	opts.OneTime = c.PostForm("one_time") == "true"
+	opts.NoTracking = c.PostForm("no_tracking") == "true"
+	opts.Challenge = c.PostForm("challenge") == "true"
+	opts.Frame = c.PostForm("frame") == "true"
+	opts.APIKey = apiKey
+	opts.CreatorIP = c.ClientIP()
+
+	if opts.MaxAccess, err = strconv.Atoi(c.DefaultPostForm("max_access", strconv.Itoa(opts.MaxAccess))); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_access parameter"})
 		return
 	}
 
-	maxPerHourInt, err := strconv.Atoi(c.DefaultPostForm("max_per_hour", "-1"))
-	if err != nil {
+	if opts.MaxPerHour, err = strconv.Atoi(c.DefaultPostForm("max_per_hour", "-1")); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_per_hour parameter"})
 		return
 	}
 
-	maxAgeInt, err := strconv.Atoi(c.DefaultPostForm("max_age", "3600"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_age parameter"})
+	if opts.MaxPerDay, err = strconv.Atoi(c.DefaultPostForm("max_per_day", "-1")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_per_day parameter"})
 		return
 	}
 
-	// Max age can't be less than 1 second and more than 1 year
-	if maxAgeInt < 1 || maxAgeInt > 31536000 {
+	if opts.MaxPerMonth, err = strconv.Atoi(c.DefaultPostForm("max_per_month", "-1")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_per_month parameter"})
+		return
+	}
+
+	if opts.TokenLength, err = strconv.Atoi(c.DefaultPostForm("token_length", strconv.Itoa(opts.TokenLength))); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid token_length parameter"})
+		return
+	}
+	opts.TokenCharset = c.DefaultPostForm("token_charset", opts.TokenCharset)
+	opts.TokenStyle = c.DefaultPostForm("token_style", opts.TokenStyle)
+	opts.TokenSeed = c.PostForm("token_seed")
+	if len(opts.TokenSeed) > maxTokenSeedLength {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid token_seed parameter: at most 200 characters"})
+		return
+	}
+
+	if opts.MaxAge, err = strconv.Atoi(c.DefaultPostForm("max_age", strconv.Itoa(opts.MaxAge))); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid max_age parameter"})
 		return
 	}
 
-	maxAgeDuration := time.Duration(maxAgeInt) * time.Second
-	Token := generateUniqueShortURL(ctx, rdb, 8)
+	if opts.Tags, err = parseTags(c.PostForm("tags")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid tags parameter: " + err.Error()})
+		return
+	}
 
-	urlEntry := URL{
-		Token:              Token,
-		LongURL:            longURL,
-		MaxAccess:          maxAccessInt,
-		CurrentAccessCount: 0,
-		MaxPerHour:         maxPerHourInt,
-		CreatedAt:          time.Now().Format(time.RFC3339),
-		LastAccessedAt:     time.Now().Format(time.RFC3339),
-		LastHourlyResetAt:  time.Now().Format(time.RFC3339),
-		AgeDuration:        maxAgeDuration,
+	if utf8.RuneCountInString(opts.Title) > maxTitleLength {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid title parameter: at most 200 characters"})
+		return
 	}
 
-	data, err := json.Marshal(urlEntry)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	if opts.AllowedReferrers, err = parseAllowedReferrers(c.PostForm("allowed_referrers")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid allowed_referrers parameter: " + err.Error()})
 		return
 	}
 
-	// Set the key-value pair in Redis
-	err = rdb.Set(ctx, Token, data, maxAgeDuration).Err()
+	urlEntry, err := createShortURL(c.Request.Context(), rdb, opts)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		respondError(c, err)
 		return
 	}
+	c.Set(auditTargetKey, urlEntry.key())
 
-	c.JSON(http.StatusOK, gin.H{"token": Token})
+	response := gin.H{"token": urlEntry.Token, "expires_at": urlEntry.ExpiresAt}
+	if urlEntry.Domain != "" {
+		response["domain"] = urlEntry.Domain
+	}
+	if opts.Frame {
+		response["frame"] = urlEntry.Frame
+	}
+	if apiKey == nil {
+		response["manage_url"] = manageURLFor(c, urlEntry)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // The `redirectHandler` function retrieves and processes a short URL entry from Redis, updating access
 // counts and redirecting to the corresponding long URL. It also checks if the maximum access count or
 // maximum access per hour has been reached.
 func redirectHandler(c *gin.Context, rdb *redis.Client) {
-	token := c.Param("token")
+	token := requestToken(c)
+	domain := requestDomain(c)
+	key := linkKey(domain, token)
+	if forgedToken(domain, token) || malformedToken(token) {
+		respondLinkError(c, http.StatusNotFound, pageNotFound, "Error finding your short URL. It may have expired or never existed.")
+		return
+	}
+
+	// Server-to-server integrations get the destination as JSON instead of a redirect
+	jsonClient := wantsResolution(c)
+	if jsonClient {
+		if _, ok := requireAPIKey(c, rdb); !ok {
+			return
+		}
+	}
 
-	val, err := rdb.Get(ctx, token).Result()
+	// The lookups a redirect waits for are bounded by the latency budget, so a slow Redis doesn't hold
+	// up visitors of links the process has seen recently
+	budget := newLatencyBudget()
+	val, err := loadBudgetedLink(c.Request.Context(), rdb, key, budget)
+	if err == redis.Nil {
+		respondMissingLink(c, rdb, key)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
 		return
 	}
 
@@ -138,40 +639,463 @@ func redirectHandler(c *gin.Context, rdb *redis.Client) {
 		return
 	}
 
-	lastHourlyResetAt, _ := time.Parse(time.RFC3339, urlEntry.LastHourlyResetAt)
+	if urlEntry.MaxAccess != -1 && urlEntry.CurrentAccessCount >= urlEntry.MaxAccess {
+		exhaustLink(c, rdb, key, urlEntry)
+		return
+	}
+
+	// Links restricted to some referring sites can't be followed from elsewhere, nor previewed. JSON
+	// clients are servers and send no Referer.
+	if !jsonClient && !referrerAllowed(c, urlEntry) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "This short URL can't be followed from here."})
+		return
+	}
 
-	if urlEntry.MaxAccess != -1 && urlEntry.CurrentAccessCount > urlEntry.MaxAccess {
-		rdb.Del(ctx, token)
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Max access reached"})
+	// Bots can get a preview page instead of the redirect, so unfurling a link doesn't count as an access.
+	// Exempt clients, such as the operator's monitoring, are treated like visitors.
+	bot := isBot(c) && !exemptRequest(c, rdb)
+	if bot && config.BotMode == "preview" && !jsonClient {
+		serveBotPreview(c, urlEntry)
 		return
 	}
 
-	if urlEntry.MaxPerHour != -1 {
-		if time.Since(lastHourlyResetAt) >= time.Hour {
-			urlEntry.HourlyAccessCount = 0
-			urlEntry.LastHourlyResetAt = time.Now().Format(time.RFC3339)
+	// Protected links first make sure the visitor runs JavaScript, so simple bots can't use up their
+	// accesses. JSON clients are authenticated already.
+	if urlEntry.Challenge && !jsonClient && !passedChallenge(c, key) && !exemptRequest(c, rdb) {
+		serveChallenge(c, rdb, urlEntry)
+		return
+	}
+
+	// Visitors of suspicious links get a warning page first. The access is only counted once they
+	// continue from it. JSON clients see the flag in the response instead.
+	if !jsonClient && needsInterstitial(urlEntry) && !validContinue(token, c.Query("continue")) {
+		serveInterstitial(c, rdb, urlEntry)
+		return
+	}
+
+	if urlEntry.Frozen && urlEntry.Disabled {
+		respondLinkErrorFor(c, rdb, http.StatusGone, pageExpired, "This short URL has been closed.", urlEntry)
+		return
+	}
+
+	// The statistics of frozen links are final, their accesses are no longer counted or logged. Neither
+	// are HEAD requests of link checkers and unfurlers, unless configured otherwise, nor requests of
+	// bots in "ignore" mode.
+	if urlEntry.Frozen || (c.Request.Method == http.MethodHead && !config.CountHeadRequests) || (bot && config.BotMode == "ignore") {
+		destination := urlEntry.LongURL
+		if urlEntry.Template {
+			destination = expandDestination(destination, templateVariables(c, token, randomHex(8)))
+		}
+		setExpiryHeaders(c, urlEntry)
+		if jsonClient {
+			c.JSON(http.StatusOK, newResolution(urlEntry, destination, ""))
+			return
+		}
+		serveDestination(c, urlEntry, destination)
+		return
+	}
+
+	// The windows the access was counted in, none if the count was deferred by the latency budget
+	var counted []string
+	if limits := accessLimits(urlEntry); len(limits) > 0 {
+		var exhausted *accessWindow
+		exhausted, counted, err = consumeBudgetedAccess(c.Request.Context(), rdb, key, limits, budget)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		if exhausted != nil {
+			respondWindowLimit(c, rdb, *exhausted, urlEntry)
+			return
+		}
+	}
+
+	// The count of the record lags behind concurrent redirects, the access is only let through if the
+	// counter of the accesses left has one. It isn't subject to the latency budget, so the limit holds.
+	if urlEntry.MaxAccess != -1 {
+		consumeCtx, cancel := writeContext(c.Request.Context())
+		defer cancel()
+		exhausted, err := consumeUse(consumeCtx, rdb, key, urlEntry)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
 		}
+		// The access never happened, so it doesn't count against the window limits either. A deferred
+		// count may not have happened yet, and is left in place.
+		if exhausted {
+			refundAccess(consumeCtx, rdb, counted)
+			exhaustLink(c, rdb, key, urlEntry)
+			return
+		}
+	}
 
-		if urlEntry.HourlyAccessCount >= urlEntry.MaxPerHour {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "Max access per hour reached"})
+	// A one-time link is consumed by deleting it. Only one of several concurrent requests can delete it,
+	// the others find the link gone, along with its tombstone.
+	if urlEntry.OneTime {
+		consumeCtx, cancel := writeContext(c.Request.Context())
+		defer cancel()
+		consumed, err := consumeLink(consumeCtx, rdb, key, urlEntry)
+		if err == nil && !consumed {
+			respondMissingLink(c, rdb, key)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
 			return
 		}
-		urlEntry.HourlyAccessCount++
 	}
 
+	// Links without tracking still count their accesses, which their limits need
 	urlEntry.CurrentAccessCount++
-	urlEntry.LastAccessedAt = time.Now().Format(time.RFC3339)
+	if urlEntry.OneTime {
+		go archiveLink(context.WithoutCancel(c.Request.Context()), rdb, urlEntry, "consumed")
+	}
+	if !urlEntry.NoTracking {
+		urlEntry.LastAccessedAt = time.Now().Format(time.RFC3339)
+	}
+
+	// Every counted click gets an identifier, which templated destinations can pass on to the
+	// destination's analytics.
+	clickID := randomHex(8)
+	c.Header("X-Click-ID", clickID)
+	vars := templateVariables(c, token, clickID)
+	destination := urlEntry.LongURL
+	if urlEntry.Template {
+		destination = expandDestination(destination, vars)
+	}
+	visitor := visitorID(c, urlEntry)
+	fingerprint := visitorFingerprint(c.ClientIP(), c.Request.UserAgent())
+	clickedAt := time.Now()
+	click := ClickEvent{
+		ClickID:   clickID,
+		Timestamp: clickedAt.Format(time.RFC3339),
+		Country:   vars["country"],
+		Referrer:  c.Request.Referer(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	// The access is counted and the click recorded after the response, by the write-behind workers. The
+	// updates must outlive the request, so they keep the request's values but not its cancellation.
+	enqueueClick(clickJob{
+		ctx:         context.WithoutCancel(c.Request.Context()),
+		rdb:         rdb,
+		key:         key,
+		urlEntry:    urlEntry,
+		visitor:     visitor,
+		fingerprint: fingerprint,
+		clickedAt:   clickedAt,
+		click:       click,
+	})
+
+	setExpiryHeaders(c, urlEntry)
+	if jsonClient {
+		c.JSON(http.StatusOK, newResolution(urlEntry, destination, clickID))
+		return
+	}
+	serveDestination(c, urlEntry, destination)
+}
+
+// The `previewHandler` function shows where a short URL leads without following it or counting it as
+// an access. Internationalized domains are rendered in their readable form along with a warning if
+// the domain looks like a homograph of another one.
+func previewHandler(c *gin.Context, rdb *redis.Client) {
+	token := requestToken(c)
+	domain := requestDomain(c)
+	key := linkKey(domain, token)
+	if forgedToken(domain, token) || malformedToken(token) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := loadCachedLink(opCtx, rdb, key)
+	if err == redis.Nil {
+		respondMissingLink(c, rdb, key)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	var urlEntry URL
+	err = json.Unmarshal([]byte(val), &urlEntry)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+
+	setExpiryHeaders(c, urlEntry)
+	c.JSON(http.StatusOK, gin.H{
+		"token":       urlEntry.Token,
+		"long_url":    urlEntry.LongURL,
+		"display_url": displayURL(urlEntry.LongURL),
+		"title":       urlEntry.Title,
+		"warning":     homographWarning(urlEntry.LongURL),
+		"expires_at":  urlEntry.ExpiresAt,
+	})
+}
+
+// The function returns the options of the Redis client from the configuration.
+func redisOptions() *redis.Options {
+	return &redis.Options{
+		Addr:            config.RedisAddr,
+		Password:        config.RedisPassword,
+		DB:              config.RedisDB,
+		PoolSize:        config.RedisPoolSize,
+		MinIdleConns:    config.RedisMinIdleConns,
+		PoolTimeout:     config.RedisPoolTimeout,
+		DialTimeout:     config.RedisDialTimeout,
+		MaxRetries:      config.RedisMaxRetries,
+		MinRetryBackoff: config.RedisMinRetryBackoff,
+		MaxRetryBackoff: config.RedisMaxRetryBackoff,
+		// Without this go-redis ignores the per-operation deadlines set by readContext/writeContext
+		ContextTimeoutEnabled: true,
+	}
+}
+
+// The `setupRouter` function registers all routes of the service on a new gin engine.
+func setupRouter(rdb *redis.Client) *gin.Engine {
+	r := gin.New()
+	// Handlers passing the gin context on see the request's span
+	r.ContextWithFallback = config.Tracing
+	// Invalid proxies are refused at startup
+	configureClientIP(r)
+	r.Use(middlewareChain(groupGlobal, rdb)...)
+	public := r.Group(basePath()+"/", middlewareChain(groupPublic, rdb)...)
+	api := r.Group(basePath()+"/", middlewareChain(groupAPI, rdb)...)
+
+	public.POST("/create", audit(rdb, "link.create"), func(c *gin.Context) {
+		createShortURLHandler(c, regionalClient(c, rdb))
+	})
+
+	slots := newRedirectSlots()
+	redirect := func(c *gin.Context) {
+		if !slots.acquire(c) {
+			return
+		}
+		defer slots.release()
+		redirectHandler(c, regionalClient(c, rdb))
+	}
+	preview := func(c *gin.Context) {
+		previewHandler(c, regionalClient(c, rdb))
+	}
+	public.GET("/:token", redirect)
+	public.HEAD("/:token", redirect)
+	public.POST("/:token/challenge", challengeFallbackHandler)
+	public.GET("/:token/preview", preview)
+	public.GET("/manage/:token", func(c *gin.Context) {
+		manageHandler(c, regionalClient(c, rdb))
+	})
+	public.POST("/manage/:token", audit(rdb, "link.update"), func(c *gin.Context) {
+		manageEditHandler(c, regionalClient(c, rdb))
+	})
+	public.POST("/manage/:token/delete", audit(rdb, "link.delete"), func(c *gin.Context) {
+		manageDeleteHandler(c, regionalClient(c, rdb))
+	})
+
+	// Aliases of the link routes for deployments under a sub-path of another site
+	for _, prefix := range tokenPathPrefixes() {
+		public.GET(prefix+"/:token", redirect)
+		public.HEAD(prefix+"/:token", redirect)
+		public.POST(prefix+"/:token/challenge", challengeFallbackHandler)
+		public.GET(prefix+"/:token/preview", preview)
+	}
+	if config.TokenQueryParam != "" {
+		public.GET("/", redirect)
+		public.HEAD("/", redirect)
+		public.POST("/", challengeFallbackHandler)
+	}
+
+	api.GET("/api/v1/schema/create", createFormSchemaHandler)
+
+	public.GET("/.well-known/share-target", shareTargetManifestHandler)
+	public.GET("/ui", dashboardHandler)
+	public.GET("/ui/*filepath", dashboardAssets.serve)
+
+	// Chat integrations pick the region of their API key themselves
+	public.POST("/integrations/slack", func(c *gin.Context) {
+		slackCommandHandler(c, homeClient(rdb))
+	})
+	public.POST("/integrations/discord", func(c *gin.Context) {
+		discordInteractionHandler(c, homeClient(rdb))
+	})
+
+	api.POST("/api/v1/resolve/batch", func(c *gin.Context) {
+		resolveBatchHandler(c, regionalClient(c, rdb))
+	})
+	api.POST("/api/resolve", func(c *gin.Context) {
+		resolveBatchHandler(c, regionalClient(c, rdb))
+	})
+	api.POST("/api/v1/share", audit(rdb, "link.create"), func(c *gin.Context) {
+		shareHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/quick", func(c *gin.Context) {
+		quickCreateHandler(c, regionalClient(c, rdb))
+	})
+
+	api.POST("/api/account/delete", audit(rdb, "account.delete_requested"), func(c *gin.Context) {
+		requestAccountDeletionHandler(c, regionalClient(c, rdb))
+	})
+	api.DELETE("/api/account", audit(rdb, "account.delete"), func(c *gin.Context) {
+		deleteAccountHandler(c, regionalClient(c, rdb))
+	})
+	api.POST("/api/campaigns", func(c *gin.Context) {
+		createCampaignHandler(c, regionalClient(c, rdb))
+	})
+
+	api.GET("/api/campaigns/:id", func(c *gin.Context) {
+		campaignStatsHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/campaigns/:id/funnel", func(c *gin.Context) {
+		campaignFunnelHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/campaigns/:id/conversions", func(c *gin.Context) {
+		campaignConversionsHandler(c, regionalClient(c, rdb))
+	})
+	api.POST("/api/conversions", func(c *gin.Context) {
+		conversionHandler(c, regionalClient(c, rdb))
+	})
+
+	api.GET("/api/branding", func(c *gin.Context) {
+		brandingHandler(c, regionalClient(c, rdb))
+	})
+	api.PUT("/api/branding", func(c *gin.Context) {
+		updateBrandingHandler(c, regionalClient(c, rdb))
+	})
+	api.DELETE("/api/branding", func(c *gin.Context) {
+		deleteBrandingHandler(c, regionalClient(c, rdb))
+	})
+
+	api.GET("/api/urls", func(c *gin.Context) {
+		listURLsHandler(c, regionalClient(c, rdb), config.AdminListenAddr == "")
+	})
+	api.GET("/api/my/urls", func(c *gin.Context) {
+		ownLinksHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/usage", func(c *gin.Context) {
+		usageHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/lookup", func(c *gin.Context) {
+		lookupHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/analytics/destinations", func(c *gin.Context) {
+		destinationReportHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/analytics/categories", func(c *gin.Context) {
+		categoryReportHandler(c, regionalClient(c, rdb))
+	})
+	api.POST("/api/bulk", audit(rdb, "links.bulk"), func(c *gin.Context) {
+		bulkHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/urls/:token/clicks", func(c *gin.Context) {
+		clickExportHandler(c, regionalClient(c, rdb))
+	})
+	api.POST("/api/urls/:token/freeze", audit(rdb, "link.freeze"), func(c *gin.Context) {
+		freezeURLHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/urls/:token/series", func(c *gin.Context) {
+		clickSeriesHandler(c, regionalClient(c, rdb))
+	})
+	api.PATCH("/api/urls/:token", audit(rdb, "link.update"), func(c *gin.Context) {
+		editLinkHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/urls/:token/history", func(c *gin.Context) {
+		linkVersionsHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/qr/sheet", func(c *gin.Context) {
+		qrSheetHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/urls/:token/qr", func(c *gin.Context) {
+		qrCodeHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/urls/:token/summary", func(c *gin.Context) {
+		summaryHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/v1/links/:token/health", func(c *gin.Context) {
+		linkHealthHandler(c, regionalClient(c, rdb))
+	})
+	api.GET("/api/v1/links/:token/history", func(c *gin.Context) {
+		linkHistoryHandler(c, regionalClient(c, rdb))
+	})
 
-	// Use a goroutine to update Redis asynchronously
-	go func() {
-		data, _ := json.Marshal(urlEntry)
-		rdb.Set(ctx, token, data, urlEntry.AgeDuration)
-	}()
+	// With a separate admin listener the admin API isn't reachable through the public one
+	if config.AdminListenAddr == "" {
+		registerAdminRoutes(r, rdb)
+	}
+	return r
+}
 
-	c.Redirect(http.StatusTemporaryRedirect, urlEntry.LongURL)
+// The `setupAdminRouter` function builds the router of the admin listener, which only serves the
+// admin API and by default doesn't compress its responses.
+func setupAdminRouter(rdb *redis.Client) *gin.Engine {
+	r := gin.New()
+	r.ContextWithFallback = config.Tracing
+	r.Use(middlewareChain(groupGlobal, rdb)...)
+	registerAdminRoutes(r, rdb)
+	return r
+}
+
+// The function registers the admin API, which requires the admin key on every route.
+func registerAdminRoutes(r gin.IRouter, rdb *redis.Client) {
+	admin := r.Group(basePath()+"/", middlewareChain(groupAdmin, rdb)...)
+	admin.POST("/api/admin/keys", adminOnly(), audit(rdb, "key.create"), func(c *gin.Context) {
+		createAPIKeyHandler(c, rdb)
+	})
+
+	admin.GET("/api/admin/exemptions", adminOnly(), func(c *gin.Context) {
+		listExemptionsHandler(c, rdb)
+	})
+	admin.POST("/api/admin/exemptions", adminOnly(), audit(rdb, "exemption.add"), func(c *gin.Context) {
+		addExemptionHandler(c, rdb)
+	})
+	admin.DELETE("/api/admin/exemptions", adminOnly(), audit(rdb, "exemption.remove"), func(c *gin.Context) {
+		removeExemptionHandler(c, rdb)
+	})
+
+	admin.POST("/api/admin/impersonate", adminOnly(), audit(rdb, "key.impersonate"), func(c *gin.Context) {
+		impersonateHandler(c, rdb)
+	})
+	admin.GET("/debug/vars", adminOnly(), gin.WrapH(expvar.Handler()))
+	admin.GET("/api/export", adminOnly(), func(c *gin.Context) {
+		exportHandler(c, regionalClient(c, rdb))
+	})
+	admin.POST("/api/import", adminOnly(), audit(rdb, "links.import"), func(c *gin.Context) {
+		importHandler(c, regionalClient(c, rdb))
+	})
+	// The public listener serves the listing to every API key, and to the admin key unless it has a listener of its own
+	if config.AdminListenAddr != "" {
+		admin.GET("/api/urls", adminOnly(), func(c *gin.Context) {
+			listURLsHandler(c, regionalClient(c, rdb), true)
+		})
+	}
+	admin.DELETE("/api/urls/:token", adminOnly(), audit(rdb, "link.delete"), func(c *gin.Context) {
+		deleteURLHandler(c, regionalClient(c, rdb))
+	})
+	admin.GET("/api/admin/audit", adminOnly(), func(c *gin.Context) {
+		auditLogHandler(c, rdb)
+	})
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "tui" {
+		if err := tuiMain(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := benchMain(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	sandbox := flag.Bool("sandbox", false, "seed an empty instance with generated links, clicks and analytics for development")
+	sandboxSeed := flag.Uint64("sandbox-seed", 1, "seed of the generated sandbox data")
+	flag.Parse()
+
 	// Uncomment the line below to run the application in release mode
 	gin.SetMode(gin.ReleaseMode)
 	// The following lines disable logging to stdout and stderr. In case of high traffic, it's recommended
@@ -179,21 +1103,157 @@ func main() {
 	// gin.DefaultWriter = io.Discard
 	// gin.DefaultErrorWriter = io.Discard
 
-	r := gin.Default()
+	if config.Tracing {
+		if err := setupTracing(context.Background()); err != nil {
+			log.Fatalf("tracing: %v", err)
+		}
+	}
+	rdb := redis.NewClient(redisOptions())
+	openRegions(rdb)
+	openReplicas(rdb)
+	traceRedis(rdb)
+	guardRedis(rdb)
+	startWriteBehind()
+	for _, client := range regionClients {
+		traceRedis(client)
+		guardRedis(client)
+	}
+	for _, replicas := range replicaClients {
+		for _, replica := range replicas {
+			traceRedis(replica)
+			guardRedis(replica)
+		}
+	}
+	if *sandbox {
+		secret, err := seedSandbox(context.Background(), rdb, *sandboxSeed)
+		if err != nil {
+			log.Fatalf("sandbox: %v", err)
+		}
+		log.Printf("sandbox: seeded with seed %d, API key %s", *sandboxSeed, secret)
+	}
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword,
-		DB:       redisDB,
-	})
+	// The maintenance jobs of links run in every region, cold storage and the archive only cover the
+	// home region
+	backends := []*redis.Client{rdb}
+	for _, client := range regionClients {
+		backends = append(backends, client)
+	}
+	for _, backend := range backends {
+		if config.ScreeningInterval > 0 {
+			go runScreeningJob(backend)
+		}
+		if config.CompactionInterval > 0 {
+			go runCompactionJob(backend)
+		}
+		if config.JanitorInterval > 0 {
+			go runJanitorJob(backend)
+		}
+	}
+	if config.ExpiryDigestInterval > 0 {
+		go runExpiryDigestJob(rdb)
+	}
+	if sinks := alertSinks(); len(sinks) > 0 && config.AlertInterval > 0 {
+		go runAlertJob(rdb, sinks)
+	}
+	if signingTokens() {
+		if len(config.TokenSigningKeys) == 0 {
+			log.Fatal("TOKEN_SIGNING_KEYS must be set to sign tokens")
+		}
+		if config.TokenSignatureLength < 4 || config.TokenSignatureLength > 16 {
+			log.Fatal("TOKEN_SIGNATURE_LENGTH must be between 4 and 16")
+		}
+	}
+	if err := validateMiddleware(); err != nil {
+		log.Fatal(err)
+	}
+	if err := configureClientIP(gin.New()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
+	for _, cidr := range config.ExemptCIDRs {
+		if _, err := parseCIDR(cidr); err != nil {
+			log.Fatalf("EXEMPT_CIDRS: %v", err)
+		}
+	}
+	if _, ok := captchaEndpoints[config.CaptchaProvider]; config.CaptchaProvider != "" && (!ok || config.CaptchaSecret == "") {
+		log.Fatal("CAPTCHA_PROVIDER must be hcaptcha or turnstile, with CAPTCHA_SECRET set")
+	}
+	if config.JWTJWKSURL != "" && config.JWTIssuer == "" {
+		log.Fatal("JWT_ISSUER must be set to accept bearer tokens")
+	}
+	if config.WindowLimitStatus != http.StatusTooManyRequests && config.WindowLimitStatus != http.StatusBadRequest {
+		log.Fatal("WINDOW_LIMIT_STATUS must be 429 or 400")
+	}
+	if err := validateLinkPolicies(); err != nil {
+		log.Fatal(err)
+	}
+	if config.TokenPhraseWords < minPhraseWords || config.TokenPhraseWords > maxPhraseWords {
+		log.Fatal("TOKEN_PHRASE_WORDS must be between 1 and 6")
+	}
+	if config.TokenWordlist != "" {
+		words, err := loadWordlist(config.TokenWordlist)
+		if err != nil {
+			log.Fatalf("TOKEN_WORDLIST: %v", err)
+		}
+		tokenWords = words
+	}
+	secretKey()
+	if config.TokenGenerator == "hashids" && config.HashidsSalt == "" {
+		log.Println("HASHIDS_SALT is not set, sequential tokens can be decoded by anyone")
+	}
+	if config.ErrorPagesDir != "" {
+		pages, err := loadErrorPages(config.ErrorPagesDir)
+		if err != nil {
+			log.Fatalf("error pages: %v", err)
+		}
+		errorPages = pages
+	}
+	if config.ColdStorePath != "" {
+		store, err := openBoltColdStore(config.ColdStorePath)
+		if err != nil {
+			log.Fatalf("cold storage: %v", err)
+		}
+		defer store.Close()
+		coldStore = store
+		if config.TieringInterval > 0 {
+			go runTieringJob(rdb, store)
+		}
+	}
 
-	r.POST("/create", func(c *gin.Context) {
-		createShortURLHandler(c, rdb)
-	})
+	if config.ArchivePath != "" {
+		archive, err := openFileArchive(config.ArchivePath)
+		if err != nil {
+			log.Fatalf("archive: %v", err)
+		}
+		defer archive.Close()
+		linkArchive = archive
+		if config.ArchiveInterval > 0 {
+			go runArchiveJob(rdb)
+		}
+	}
 
-	r.GET("/:token", func(c *gin.Context) {
-		redirectHandler(c, rdb)
-	})
+	if config.AuditLogPath != "" {
+		file, err := openAuditFile(config.AuditLogPath)
+		if err != nil {
+			log.Fatalf("audit: %v", err)
+		}
+		defer file.Close()
+		auditLog = file
+	}
 
-	r.Run("localhost:8080")
+	tlsConfig, redirect, err := setupTLS()
+	if err != nil {
+		log.Fatalf("TLS: %v", err)
+	}
+	listeners := map[string]listener{}
+	public := setupRouter(rdb)
+	for _, addr := range config.ListenAddrs {
+		listeners[addr] = listener{handler: public, tlsConfig: tlsConfig}
+	}
+	if config.AdminListenAddr != "" {
+		listeners[config.AdminListenAddr] = listener{handler: setupAdminRouter(rdb)}
+	}
+	if config.HTTPRedirectAddr != "" {
+		listeners[config.HTTPRedirectAddr] = listener{handler: redirect}
+	}
+	log.Fatal(serve(listeners))
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -26,6 +27,20 @@ func setupTestRedis() *redis.Client {
 	return rdb
 }
 
+// The function sends a request through the router; a non-empty body is sent as a url-encoded form.
+func performRequest(router *gin.Engine, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
 func TestGenerateRandomString(t *testing.T) {
 	length := 8
 	randomString := generateRandomString(length)
@@ -37,7 +52,8 @@ func TestGenerateUniqueShortURL(t *testing.T) {
 	defer rdb.Close()
 
 	length := 8
-	shortURL := generateUniqueShortURL(testCtx, rdb, length)
+	shortURL, err := generateUniqueShortURL(testCtx, rdb, "", length)
+	assert.NoError(t, err)
 	assert.Equal(t, length, len(shortURL))
 }
 
@@ -99,6 +115,13 @@ func TestMaxAccess(t *testing.T) {
 		router.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
 	}
+
+	// The 11th access is one too many
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/"+token, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Max access reached")
 }
 
 func TestMaxPerHour(t *testing.T) {
@@ -176,5 +199,170 @@ func TestMaxAge(t *testing.T) {
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("GET", "/"+token, nil)
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGone, w.Code)
+	var gone map[string]string
+	json.Unmarshal(w.Body.Bytes(), &gone)
+	assert.Equal(t, "expired", gone["reason"])
+	assert.NotEmpty(t, gone["expired_at"])
+}
+
+func TestRedisTimeout(t *testing.T) {
+	// A server that accepts connections but never answers, like a Redis stuck under load
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:                  listener.Addr().String(),
+		MaxRetries:            -1,
+		ContextTimeoutEnabled: true,
+	})
+	defer rdb.Close()
+
+	previous := config
+	config.RedisReadTimeout = 100 * time.Millisecond
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/:token", func(c *gin.Context) {
+		redirectHandler(c, rdb)
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sometoken", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestHeadRequest(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=1", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Link checkers don't use up the link
+	for i := 0; i < 3; i++ {
+		w = performRequest(router, "HEAD", "/"+token, "", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+	}
+	time.Sleep(50 * time.Millisecond)
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	assert.Equal(t, 0, urlEntry.CurrentAccessCount)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, clickLogKey(token)).Val())
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	w = performRequest(router, "HEAD", "/missing1", "", nil)
 	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Unless they are configured to count
+	previous := config
+	config.CountHeadRequests = true
+	defer func() { config = previous }()
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	performRequest(router, "HEAD", "/"+created["token"], "", nil)
+	time.Sleep(50 * time.Millisecond)
+	json.Unmarshal([]byte(rdb.Get(testCtx, created["token"]).Val()), &urlEntry)
+	assert.Equal(t, 1, urlEntry.CurrentAccessCount)
+}
+
+func TestExpiresAt(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_age=3600", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	expiresAt, err := time.Parse(time.RFC3339, created["expires_at"])
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, 2*time.Second)
+
+	// Accesses keep the expiry time, the link is saved with its remaining lifetime
+	rdb.Expire(testCtx, created["token"], 10*time.Minute)
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, expiresAt.UTC().Format(http.TimeFormat), w.Header().Get("Expires"))
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	time.Sleep(50 * time.Millisecond)
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, created["token"]).Val()), &urlEntry)
+	assert.Equal(t, created["expires_at"], urlEntry.ExpiresAt)
+	assert.InDelta(t, time.Hour.Seconds(), rdb.TTL(testCtx, created["token"]).Val().Seconds(), 2)
+
+	w = performRequest(router, "GET", "/"+created["token"]+"/preview", "", nil)
+	var preview map[string]string
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	assert.Equal(t, created["expires_at"], preview["expires_at"])
+
+	// Records from before expires_at expire their age_duration after they were last saved
+	legacy := `{"token":"legacy02","long_url":"https://example.com","max_access":-1,"max_per_hour":-1,"last_accessed_at":"2026-01-02T10:00:00Z","age_duration":3600000000000}`
+	assert.NoError(t, json.Unmarshal([]byte(legacy), &urlEntry))
+	assert.Equal(t, "2026-01-02T11:00:00Z", urlEntry.ExpiresAt)
+}
+
+func TestSaveAccessedLinkKeepsLifetime(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	urlEntry := URL{Token: "keepttl1", LongURL: "https://example.com", MaxAccess: -1, ExpiresAt: time.Now().Add(10 * time.Minute).Format(time.RFC3339)}
+	data, _ := json.Marshal(urlEntry)
+
+	// A save never extends the stored lifetime
+	rdb.Set(testCtx, urlEntry.Token, data, time.Hour)
+	urlEntry.CurrentAccessCount = 1
+	accessed, _ := json.Marshal(urlEntry)
+	assert.True(t, saveAccessedLink(testCtx, rdb, urlEntry.Token, urlEntry, string(data), accessed))
+	assert.Equal(t, string(accessed), rdb.Get(testCtx, urlEntry.Token).Val())
+	assert.InDelta(t, (10 * time.Minute).Seconds(), rdb.TTL(testCtx, urlEntry.Token).Val().Seconds(), 2)
+
+	// A record that was changed since it was read isn't overwritten
+	assert.False(t, saveAccessedLink(testCtx, rdb, urlEntry.Token, urlEntry, string(data), accessed))
+
+	// A link that expired or was deleted while it was being accessed stays gone
+	rdb.Del(testCtx, urlEntry.Token)
+	assert.False(t, saveAccessedLink(testCtx, rdb, urlEntry.Token, urlEntry, string(data), accessed))
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, urlEntry.Token).Val())
+
+	urlEntry.ExpiresAt = time.Now().Add(-time.Second).Format(time.RFC3339)
+	rdb.Set(testCtx, urlEntry.Token, data, time.Minute)
+	assert.False(t, saveAccessedLink(testCtx, rdb, urlEntry.Token, urlEntry, string(data), accessed))
+}
+
+func TestRedisOptions(t *testing.T) {
+	previous := config
+	config.RedisPoolSize = 50
+	config.RedisMinIdleConns = 5
+	config.RedisMaxRetries = -1
+	defer func() { config = previous }()
+
+	options := redisOptions()
+	assert.Equal(t, 50, options.PoolSize)
+	assert.Equal(t, 5, options.MinIdleConns)
+	assert.Equal(t, -1, options.MaxRetries)
+	assert.True(t, options.ContextTimeoutEnabled)
 }
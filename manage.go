@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Links created without an API key come with the address of a manage page, where their creator can
+// see the link's statistics, edit or delete it without an account. The address carries a secret signed
+// for the link, so it is valid as long as the link exists and SECRET_KEY doesn't change. Links created
+// with an API key are managed with the key and have no manage page.
+
+var manageTemplate = template.Must(template.New("manage").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<meta name="referrer" content="no-referrer">
+<title>Manage {{.ShortURL}}</title>
+<style>body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 2rem auto; padding: 0 1rem; } label, input { display: block; width: 100%; box-sizing: border-box; } input { margin-bottom: 1rem; } dt { font-weight: bold; }</style>
+</head>
+<body>
+<main>
+{{if .Deleted}}
+<h1>Link deleted</h1>
+<p>{{.ShortURL}} no longer leads anywhere.</p>
+{{else}}
+<h1>Manage your short link</h1>
+<p><a href="{{.ShortURL}}">{{.ShortURL}}</a> leads to <strong>{{.Link.LongURL}}</strong></p>
+<p>Keep the address of this page private: anyone who has it can change or delete the link.</p>
+{{if .Message}}<p role="alert">{{.Message}}</p>{{end}}
+{{if .Saved}}<p role="status">Your changes were saved.</p>{{end}}
+<h2>Statistics</h2>
+<dl>
+<dt>Clicks</dt><dd>{{.Summary.TotalClicks}}{{if ge .Link.MaxAccess 0}} of {{.Link.MaxAccess}} allowed{{end}}</dd>
+<dt>Unique visitors</dt><dd>{{.Summary.UniqueVisitors}}</dd>
+<dt>Last click</dt><dd>{{or .Link.LastAccessedAt "Never"}}</dd>
+<dt>Created</dt><dd>{{.Link.CreatedAt}}</dd>
+<dt>Expires</dt><dd>{{.Link.ExpiresAt}}</dd>
+</dl>
+{{with .Summary.ClicksByCountry}}<h3>Countries</h3>
+<ul>{{range $country, $count := .}}<li>{{$country}}: {{$count}}</li>{{end}}</ul>{{end}}
+{{with .Summary.ClicksByReferrer}}<h3>Referrers</h3>
+<ul>{{range $referrer, $count := .}}<li>{{$referrer}}: {{$count}}</li>{{end}}</ul>{{end}}
+<h2>Edit</h2>
+{{if .Link.Frozen}}<p>The link was frozen and can no longer be edited.</p>{{else}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="secret" value="{{.Secret}}">
+<label for="long_url">Destination</label>
+<input id="long_url" name="long_url" type="url" value="{{.Link.LongURL}}" required>
+<label for="title">Title</label>
+<input id="title" name="title" value="{{.Link.Title}}" maxlength="200">
+<label for="max_access">Maximum number of clicks, -1 for no limit</label>
+<input id="max_access" name="max_access" type="number" min="-1" value="{{.Link.MaxAccess}}">
+<button type="submit">Save changes</button>
+</form>{{end}}
+<h2>Delete</h2>
+<form method="post" action="{{.Action}}/delete">
+<input type="hidden" name="secret" value="{{.Secret}}">
+<button type="submit">Delete this link</button>
+</form>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+// ManagePage is what the manage page of a link is rendered with.
+type ManagePage struct {
+	Link     URL
+	Summary  LinkSummary
+	ShortURL string
+	// Address the edit and delete forms are posted to
+	Action  string
+	Secret  string
+	Message string
+	Saved   bool
+	Deleted bool
+}
+
+func manageMessage(urlEntry URL) string {
+	return "manage:" + urlEntry.key() + ":" + urlEntry.CreatedAt
+}
+
+// The function checks the secret of a manage page request. Signing the creation time with the key
+// keeps the secret of a deleted link from working for a later link with the same token.
+func validManageSecret(urlEntry URL, secret string) bool {
+	return urlEntry.CreatorAPIKey == "" && secret != "" && validSignature(manageMessage(urlEntry), secret)
+}
+
+// The `manageURLFor` function returns the address of the manage page of a link created without an API key.
+func manageURLFor(c *gin.Context, urlEntry URL) string {
+	return publicBaseURL(c, urlEntry) + "/manage/" + url.PathEscape(urlEntry.Token) + "?secret=" + sign(manageMessage(urlEntry))
+}
+
+// The function loads the link a manage page request is for. Links that don't exist and requests with
+// a wrong secret get the same error.
+func loadManagedLink(ctx context.Context, c *gin.Context, rdb *redis.Client, secret string) (URL, error) {
+	var urlEntry URL
+	if malformedToken(requestToken(c)) {
+		return urlEntry, newAPIError(http.StatusNotFound, "Error finding your short URL. It may have expired or never existed.")
+	}
+	val, err := loadLink(ctx, rdb, linkKey(requestDomain(c), requestToken(c)))
+	if err != nil && err != redis.Nil {
+		return urlEntry, newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+	}
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !validManageSecret(urlEntry, secret) {
+		return urlEntry, newAPIError(http.StatusNotFound, "Error finding your short URL. It may have expired or never existed.")
+	}
+	loadAccessCount(ctx, rdb, &urlEntry)
+	return urlEntry, nil
+}
+
+// The function answers a manage page request that failed before a page could be rendered.
+func respondManageError(c *gin.Context, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		respondLinkError(c, http.StatusNotFound, pageNotFound, apiErr.Message)
+		return
+	}
+	respondError(c, err)
+}
+
+// The function renders the manage page of a link with its statistics.
+func renderManagePage(c *gin.Context, rdb *redis.Client, status int, page ManagePage) {
+	if !page.Deleted {
+		summary, err := summarizeLink(c.Request.Context(), rdb, page.Link)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		page.Summary = summary
+	}
+	page.ShortURL = shortURLFor(c, page.Link)
+	page.Action = basePath() + "/manage/" + url.PathEscape(page.Link.Token)
+
+	// The secret is in the page's address, which must not leak to the destination or caches
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := manageTemplate.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
+
+// The `manageHandler` function shows the manage page of a link, given the `secret` of its manage URL.
+func manageHandler(c *gin.Context, rdb *redis.Client) {
+	secret := c.Query("secret")
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	urlEntry, err := loadManagedLink(opCtx, c, rdb, secret)
+	if err != nil {
+		respondManageError(c, err)
+		return
+	}
+	renderManagePage(c, rdb, http.StatusOK, ManagePage{Link: urlEntry, Secret: secret, Saved: c.Query("saved") == "true"})
+}
+
+// The `manageEditHandler` function applies the edit form of a manage page. The edit is recorded in the
+// link's history with the actor "manage", and the browser is sent back to the page.
+func manageEditHandler(c *gin.Context, rdb *redis.Client) {
+	secret := c.PostForm("secret")
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	urlEntry, err := loadManagedLink(opCtx, c, rdb, secret)
+	if err != nil {
+		respondManageError(c, err)
+		return
+	}
+	c.Set(auditTargetKey, urlEntry.key())
+
+	allowed := func(current URL) bool { return validManageSecret(current, secret) }
+	if _, _, err := editLinkWithRetries(opCtx, c, rdb, "manage", allowed, urlEntry.key()); err != nil {
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) || apiErr.Status == http.StatusNotFound {
+			respondManageError(c, err)
+			return
+		}
+		renderManagePage(c, rdb, apiErr.Status, ManagePage{Link: urlEntry, Secret: secret, Message: apiErr.Message})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, basePath()+"/manage/"+url.PathEscape(urlEntry.Token)+"?"+url.Values{"secret": {secret}, "saved": {"true"}}.Encode())
+}
+
+// The `manageDeleteHandler` function deletes a link from its manage page.
+func manageDeleteHandler(c *gin.Context, rdb *redis.Client) {
+	secret := c.PostForm("secret")
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	urlEntry, err := loadManagedLink(opCtx, c, rdb, secret)
+	if err != nil {
+		respondManageError(c, err)
+		return
+	}
+	c.Set(auditTargetKey, urlEntry.key())
+
+	if err := deleteLink(opCtx, rdb, urlEntry); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	renderManagePage(c, rdb, http.StatusOK, ManagePage{Link: urlEntry, Deleted: true})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidManageSecret(t *testing.T) {
+	urlEntry := URL{Token: "abc", CreatedAt: "2024-05-01T12:00:00Z"}
+	secret := sign(manageMessage(urlEntry))
+	assert.True(t, validManageSecret(urlEntry, secret))
+	assert.False(t, validManageSecret(urlEntry, ""))
+	assert.False(t, validManageSecret(urlEntry, secret+"x"))
+
+	// A later link with the same token doesn't accept the secret
+	recreated := urlEntry
+	recreated.CreatedAt = "2024-05-02T12:00:00Z"
+	assert.False(t, validManageSecret(recreated, secret))
+
+	owned := urlEntry
+	owned.CreatorAPIKey = "key1"
+	assert.False(t, validManageSecret(owned, secret))
+}
+
+func TestManageLink(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/old", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	manageURL, err := url.Parse(created["manage_url"])
+	assert.NoError(t, err)
+	assert.Equal(t, "/manage/"+created["token"], manageURL.Path)
+	secret := manageURL.Query().Get("secret")
+	path := manageURL.Path
+
+	w = performRequest(router, "GET", path+"?secret="+secret, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/old")
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+
+	w = performRequest(router, "GET", path+"?secret=wrong", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performRequest(router, "POST", path, "secret="+secret+"&long_url=https://example.com/new&title=Launch", nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, "https://example.com/new", w.Header().Get("Location"))
+
+	// Invalid edits are shown on the page
+	w = performRequest(router, "POST", path, "secret="+secret+"&long_url=https://example.com/new&title=Launch", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Nothing to change")
+
+	w = performRequest(router, "POST", path, "secret=wrong&long_url=https://example.com/other", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var history struct {
+		Versions []LinkVersion `json:"versions"`
+	}
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/history", "", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if assert.Len(t, history.Versions, 1) {
+		assert.Equal(t, "manage", history.Versions[0].Actor)
+	}
+
+	w = performRequest(router, "POST", path+"/delete", "secret="+secret, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Link deleted")
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performRequest(router, "GET", path+"?secret="+secret, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestManageURLOnlyForAnonymousLinks(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.NotContains(t, created, "manage_url")
+}
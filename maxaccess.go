@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// The accesses a link with max_access has left are counted down in a key of their own, set when the
+// link is created and expiring with it. Redirects take an access from it with a script that checks and
+// decrements in one step, so concurrent redirects on any number of replicas can't exceed the limit the
+// way checking the lagging count of the record would.
+func remainingUsesKey(key string) string {
+	return "remaining:" + key
+}
+
+// Takes an access if there is one left and returns the accesses left after it, or -1 if there were
+// none. Links stored before the counter existed get it on their first access, from their record.
+var consumeUseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('SET', KEYS[1], ARGV[1])
+	redis.call('EXPIREAT', KEYS[1], ARGV[2])
+end
+if tonumber(redis.call('GET', KEYS[1])) <= 0 then
+	return -1
+end
+return redis.call('DECR', KEYS[1])
+`)
+
+// Moves the accesses left by the change of a link's max_access. Without the counter there is nothing
+// to move, it is set from the record on the next access.
+var adjustUsesScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('INCRBY', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// The function returns the accesses a link has left according to its record.
+func usesLeft(urlEntry URL) int {
+	return max(urlEntry.MaxAccess-urlEntry.CurrentAccessCount, 0)
+}
+
+// The `consumeUse` function takes one of the accesses a link with max_access has left, reporting
+// whether none was left.
+func consumeUse(ctx context.Context, rdb *redis.Client, key string, urlEntry URL) (bool, error) {
+	left, err := consumeUseScript.Run(ctx, rdb, []string{remainingUsesKey(key)}, usesLeft(urlEntry), strconv.FormatInt(urlEntry.expiry().Unix(), 10)).Int()
+	if err != nil {
+		return false, err
+	}
+	return left < 0, nil
+}
+
+// The `armRemainingUses` function sets the counter of a link that is stored, with the accesses its
+// record has left. A link without max_access drops the counter of a former link with its token.
+func armRemainingUses(ctx context.Context, pipe redis.Cmdable, urlEntry URL) {
+	key := remainingUsesKey(urlEntry.key())
+	if urlEntry.MaxAccess == -1 {
+		pipe.Del(ctx, key)
+		return
+	}
+	pipe.Set(ctx, key, usesLeft(urlEntry), 0)
+	pipe.ExpireAt(ctx, key, urlEntry.expiry())
+}
+
+// The function updates the counter of an edited link whose max_access was previousMax.
+func adjustRemainingUses(ctx context.Context, pipe redis.Cmdable, urlEntry URL, previousMax int) {
+	switch {
+	case urlEntry.MaxAccess == -1 || previousMax == -1:
+		armRemainingUses(ctx, pipe, urlEntry)
+	default:
+		adjustUsesScript.Eval(ctx, pipe, []string{remainingUsesKey(urlEntry.key())}, urlEntry.MaxAccess-previousMax)
+	}
+}
+
+// The `exhaustLink` function removes a link that has used up its max_access, leaving a tombstone, and
+// answers the redirect that found it so. The record is deleted in the same transaction the tombstone
+// is written in, so concurrent redirects find either of them. Of several refused redirects, only the
+// one that deleted the record records the removal. The counter of the accesses left stays at zero until
+// it expires, so redirects that read the record before it was deleted can't restart it.
+func exhaustLink(c *gin.Context, rdb *redis.Client, key string, urlEntry URL) {
+	delCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	var deleted *redis.IntCmd
+	_, err := rdb.TxPipelined(delCtx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(delCtx, key)
+		buryLink(delCtx, pipe, urlEntry, "max_access_reached")
+		return nil
+	})
+	if err == nil && deleted.Val() > 0 {
+		recordEvent(delCtx, rdb, urlEntry, "max_access_reached")
+		releaseQuota(delCtx, rdb, urlEntry)
+		go archiveLink(context.WithoutCancel(c.Request.Context()), rdb, urlEntry, "max_access_reached")
+	}
+	respondLinkErrorFor(c, rdb, http.StatusBadRequest, pageExpired, "Max access reached", urlEntry)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxAccessConcurrent(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=3", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+	assert.Equal(t, "3", rdb.Get(testCtx, remainingUsesKey(token)).Val())
+
+	// Concurrent redirects used to read the same count from the link record and get one access too many
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// The refused ones find the link exhausted, or already gone
+	redirected, refused := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := performRequest(router, "GET", "/"+token, "", nil)
+			mu.Lock()
+			defer mu.Unlock()
+			if w.Code == http.StatusTemporaryRedirect {
+				redirected++
+			} else {
+				refused++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, redirected)
+	assert.Equal(t, 7, refused)
+
+	time.Sleep(50 * time.Millisecond)
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "0", rdb.Get(testCtx, remainingUsesKey(token)).Val())
+}
+
+func TestMaxAccessRefundsWindows(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=1&max_per_hour=5", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Only the access that happened counts against the hour
+	assert.Equal(t, "1", rdb.Get(testCtx, hourWindow.key(token, time.Now())).Val())
+}
+
+func TestMaxAccessZero(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=0", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMaxAccessWithoutCounter(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=2", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Links stored before the counter existed get it from their record
+	rdb.Del(testCtx, remainingUsesKey(token))
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, token).Val()), &urlEntry)
+	urlEntry.CurrentAccessCount = 1
+	data, _ := json.Marshal(urlEntry)
+	rdb.Set(testCtx, token, data, time.Hour)
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	ttl := rdb.TTL(testCtx, remainingUsesKey(token)).Val()
+	assert.True(t, ttl > 0 && ttl <= time.Hour, ttl)
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEditMaxAccess(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=2", admin)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+	path := "/api/urls/" + token
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+
+	// Raising the limit adds to the accesses left
+	w = performRequest(router, "PATCH", path, "max_access=4", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", rdb.Get(testCtx, remainingUsesKey(token)).Val())
+
+	// Lifting it drops the counter, setting it again starts from the accesses counted so far
+	performRequest(router, "PATCH", path, "max_access=-1", admin)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, remainingUsesKey(token)).Val())
+	performRequest(router, "PATCH", path, "max_access=2", admin)
+	assert.Equal(t, "1", rdb.Get(testCtx, remainingUsesKey(token)).Val())
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
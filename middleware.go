@@ -0,0 +1,213 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Route groups middleware is applied to. Global middleware runs for every request, including ones that
+// don't match a route, such as CORS preflight requests.
+const (
+	groupGlobal = "global"
+	groupPublic = "public"
+	groupAPI    = "api"
+	groupAdmin  = "admin"
+)
+
+// A middlewareFactory builds a middleware for a route group.
+type middlewareFactory func(group string, rdb *redis.Client) gin.HandlerFunc
+
+// Middleware that can be enabled per route group by name. Admin routes always require the admin key,
+// whatever their group's chain.
+var middlewareRegistry = map[string]middlewareFactory{
+	"logger": func(string, *redis.Client) gin.HandlerFunc {
+		return gin.Logger()
+	},
+	"recovery": func(string, *redis.Client) gin.HandlerFunc {
+		return gin.Recovery()
+	},
+	"compression": func(string, *redis.Client) gin.HandlerFunc {
+		return compressResponses()
+	},
+	"cors": func(string, *redis.Client) gin.HandlerFunc {
+		return allowCORS()
+	},
+	"metrics": func(group string, _ *redis.Client) gin.HandlerFunc {
+		return countRequests(group)
+	},
+	"auth": func(_ string, rdb *redis.Client) gin.HandlerFunc {
+		return requireAuth(rdb)
+	},
+	"ratelimit": func(_ string, rdb *redis.Client) gin.HandlerFunc {
+		return limitRate(rdb)
+	},
+	"residency": func(_ string, rdb *redis.Client) gin.HandlerFunc {
+		return routeResidency(rdb)
+	},
+	"tracing": func(string, *redis.Client) gin.HandlerFunc {
+		return traceRequests()
+	},
+}
+
+// The function returns the names of the middleware configured for a group. Groups that aren't
+// configured keep the chain the service had before the registry existed, led by residency routing
+// when regions are configured; "none" empties a chain.
+func groupMiddleware(group string) []string {
+	names := map[string][]string{
+		groupGlobal: config.MiddlewareGlobal,
+		groupPublic: config.MiddlewarePublic,
+		groupAPI:    config.MiddlewareAPI,
+		groupAdmin:  config.MiddlewareAdmin,
+	}[group]
+	switch {
+	case slices.Equal(names, []string{"none"}):
+		return nil
+	case names != nil:
+		return names
+	case group == groupGlobal && config.Tracing:
+		return []string{"tracing", "logger", "recovery"}
+	case group == groupGlobal:
+		return []string{"logger", "recovery"}
+	}
+	var defaults []string
+	if len(config.Regions) > 0 {
+		defaults = append(defaults, "residency")
+	}
+	// The admin listener didn't compress its responses
+	if config.Compression && !(group == groupAdmin && config.AdminListenAddr != "") {
+		defaults = append(defaults, "compression")
+	}
+	return defaults
+}
+
+// The `validateMiddleware` function checks that every configured middleware name is registered.
+func validateMiddleware() error {
+	for _, group := range []string{groupGlobal, groupPublic, groupAPI, groupAdmin} {
+		for _, name := range groupMiddleware(group) {
+			if _, ok := middlewareRegistry[name]; !ok {
+				return fmt.Errorf("unknown middleware %q for the %s group", name, group)
+			}
+		}
+		// Without routing, requests of pinned workspaces would be served from the home region
+		if len(config.Regions) > 0 && group != groupGlobal && !slices.Contains(groupMiddleware(group), "residency") {
+			return fmt.Errorf("the %s group needs the residency middleware when regions are configured", group)
+		}
+	}
+	return nil
+}
+
+// The `middlewareChain` function builds the configured middleware of a group, in order. Unknown names
+// are skipped, the configuration is validated at startup.
+func middlewareChain(group string, rdb *redis.Client) []gin.HandlerFunc {
+	var chain []gin.HandlerFunc
+	for _, name := range groupMiddleware(group) {
+		if factory, ok := middlewareRegistry[name]; ok {
+			chain = append(chain, factory(group, rdb))
+		}
+	}
+	return chain
+}
+
+// Headers browsers may send with cross-origin API requests
+var corsHeaders = strings.Join([]string{
+	"Content-Type", apiKeyHeader, "Authorization", idempotencyHeader,
+	keyIDHeader, timestampHeader, nonceHeader, signatureHeader,
+}, ", ")
+
+// The `allowCORS` middleware lets browsers on the origins in CORS_ALLOWED_ORIGINS call the service, and
+// answers their preflight requests.
+func allowCORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		c.Writer.Header().Add("Vary", "Origin")
+		if origin == "" || !slices.ContainsFunc(config.CORSAllowedOrigins, func(allowed string) bool {
+			return allowed == "*" || strings.EqualFold(allowed, origin)
+		}) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE")
+			c.Header("Access-Control-Allow-Headers", corsHeaders)
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Header("Access-Control-Expose-Headers", "Retry-After, Idempotent-Replayed")
+		c.Next()
+	}
+}
+
+// Requests per route group by status class, and the time spent handling them
+var httpStats = expvar.NewMap("http")
+
+// The `countRequests` middleware records the requests of a group in the `http` metrics, e.g.
+// `api_requests`, `api_4xx` and `api_latency_ms`.
+func countRequests(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		httpStats.Add(group+"_requests", 1)
+		httpStats.Add(group+"_"+strconv.Itoa(c.Writer.Status()/100)+"xx", 1)
+		httpStats.Add(group+"_latency_ms", time.Since(start).Milliseconds())
+	}
+}
+
+// Where requireAuth keeps the API key it authenticated, for the handlers
+const apiKeyContextKey = "api_key"
+
+// The `requireAuth` middleware rejects requests without a valid API key or bearer token. Handlers reuse
+// the key it authenticated, so signed requests aren't checked twice.
+func requireAuth(rdb *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := requireAPIKey(c, rdb)
+		if !ok {
+			return
+		}
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// Requests of a client IP counted in fixed one-minute windows
+func rateLimitKey(ip string, now time.Time) string {
+	return "ratelimit:" + ip + ":" + strconv.FormatInt(now.Unix()/60, 10)
+}
+
+// The `limitRate` middleware limits clients to RATE_LIMIT_PER_MINUTE requests per minute by IP.
+// Exempt clients aren't limited, and requests go through when Redis can't be reached.
+func limitRate(rdb *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.RateLimitPerMinute <= 0 || exemptRequest(c, rdb) {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		key := rateLimitKey(c.ClientIP(), now)
+		opCtx, cancel := writeContext(c.Request.Context())
+		var count *redis.IntCmd
+		_, err := rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+			count = pipe.Incr(opCtx, key)
+			pipe.Expire(opCtx, key, time.Minute)
+			return nil
+		})
+		cancel()
+		if err == nil && count.Val() > int64(config.RateLimitPerMinute) {
+			c.Header("Retry-After", strconv.FormatInt(60-now.Unix()%60, 10))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests, please try again later."})
+			return
+		}
+		c.Next()
+	}
+}
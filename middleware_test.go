@@ -0,0 +1,95 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupMiddleware(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	config.Compression = true
+	assert.Equal(t, []string{"logger", "recovery"}, groupMiddleware(groupGlobal))
+	assert.Equal(t, []string{"compression"}, groupMiddleware(groupPublic))
+	assert.Equal(t, []string{"compression"}, groupMiddleware(groupAdmin))
+	config.AdminListenAddr = "127.0.0.1:8081"
+	assert.Nil(t, groupMiddleware(groupAdmin))
+
+	config.MiddlewareAPI = []string{"none"}
+	config.MiddlewarePublic = []string{"metrics", "ratelimit"}
+	assert.Nil(t, groupMiddleware(groupAPI))
+	assert.Equal(t, []string{"metrics", "ratelimit"}, groupMiddleware(groupPublic))
+	assert.NoError(t, validateMiddleware())
+
+	config.MiddlewareAdmin = []string{"metrics", "gzip"}
+	assert.EqualError(t, validateMiddleware(), `unknown middleware "gzip" for the admin group`)
+}
+
+func TestMiddlewareChains(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.MiddlewareGlobal = []string{"recovery", "cors"}
+	config.MiddlewareAPI = []string{"metrics", "auth"}
+	config.MiddlewarePublic = []string{"ratelimit"}
+	config.CORSAllowedOrigins = []string{"https://app.example.com"}
+	config.RateLimitPerMinute = 3
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	request := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Preflight requests are answered for allowed origins only
+	w := request("OPTIONS", "/api/usage", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), apiKeyHeader)
+	w = request("OPTIONS", "/api/usage", map[string]string{"Origin": "https://evil.example", "Access-Control-Request-Method": "GET"})
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// The api group requires a key, routes that read the key reuse it
+	apiRequests := func() int64 {
+		if value, ok := httpStats.Get("api_requests").(*expvar.Int); ok {
+			return value.Value()
+		}
+		return 0
+	}
+	requests := apiRequests()
+	w = request("GET", "/api/lookup?url=https://example.com", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = request("GET", "/api/usage", map[string]string{apiKeyHeader: "admin-secret", "Origin": "https://app.example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, requests+2, apiRequests())
+
+	// The public group is rate limited per client IP
+	rdb.Del(testCtx, rateLimitKey("192.0.2.1", time.Now()))
+	for i := 0; i < 3; i++ {
+		w = request("GET", "/missing-token", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+	w = request("GET", "/missing-token", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	// The api group isn't
+	w = request("GET", "/api/usage", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOneTimeLink(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/secret&one_time=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Previews don't consume the link
+	w = performRequest(router, "GET", "/"+token+"/preview", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := performRequest(router, "GET", "/"+token, "", nil)
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, map[int]int{http.StatusTemporaryRedirect: 1, http.StatusGone: 9}, codes)
+
+	// The background save doesn't bring the link back
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, token).Val())
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	var gone map[string]string
+	json.Unmarshal(w.Body.Bytes(), &gone)
+	assert.Equal(t, "consumed", gone["reason"])
+}
+
+func TestOneTimeLinkRecordsOneConsumption(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.EventSourcing = true
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/secret&one_time=true", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			performRequest(router, "GET", "/"+token, "", nil)
+		}()
+	}
+	wg.Wait()
+
+	// Only the request that consumed the link records it, the others found it gone
+	consumed := 0
+	for _, event := range rdb.XRange(testCtx, eventsKey(token), "-", "+").Val() {
+		if event.Values["type"] == "consumed" {
+			consumed++
+		}
+	}
+	assert.Equal(t, 1, consumed)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	errDisallowedByRobots = errors.New("destination disallows fetching by robots.txt")
+	errPrivateDestination = errors.New("destination resolves to a loopback, private or link-local address")
+)
+
+// Shared address space of carrier-grade NAT, internal to providers like private ranges
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// The `guardOutboundDial` function refuses connections to addresses that aren't on the public internet:
+// loopback, private and link-local ranges (among them cloud metadata endpoints), so links can't make
+// the shortener reach internal services. As a dialer hook it sees the address after DNS resolution,
+// for every connection including those of redirects. OUTBOUND_ALLOW_PRIVATE turns it off.
+func guardOutboundDial(network, address string, _ syscall.RawConn) error {
+	if config.OutboundAllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return errPrivateDestination
+	}
+	return nil
+}
+
+// All requests the shortener makes to link destinations (verification, title lookups, health checks,
+// frame probes) go through this client so they share the same identification and politeness rules,
+// and the guard against reaching internal addresses. It connects directly: through a proxy, the guard
+// would only see the proxy's address.
+var outboundClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: guardOutboundDial}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return http.ErrUseLastResponse
+		}
+		req.Header.Set("User-Agent", config.OutboundUserAgent)
+		return nil
+	},
+}
+
+// hostThrottle spaces out requests to the same host so a burst of links pointing at one site doesn't
+// turn into a burst of requests against it.
+type hostThrottle struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+var outboundThrottle = &hostThrottle{next: map[string]time.Time{}}
+
+// The function reserves the next free slot for the host and waits for it, or returns early if the
+// context is cancelled first.
+func (t *hostThrottle) wait(ctx context.Context, host string, interval time.Duration) error {
+	if interval <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	slot := t.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next[host] = slot.Add(interval)
+	// Forget hosts that have been quiet for a while so the map doesn't grow forever
+	if len(t.next) > 10000 {
+		for h, next := range t.next {
+			if next.Before(now) {
+				delete(t.next, h)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+type robotsEntry struct {
+	rules     []robotsRule
+	fetchedAt time.Time
+}
+
+var robotsCache = struct {
+	sync.Mutex
+	entries map[string]robotsEntry
+}{entries: map[string]robotsEntry{}}
+
+// The `parseRobots` function extracts the Allow/Disallow rules that apply to the given user agent
+// product token from a robots.txt body. Rules from a group naming the agent take precedence over the
+// "*" group.
+func parseRobots(body io.Reader, agent string) []robotsRule {
+	agent = strings.ToLower(agent)
+	var specific, wildcard []robotsRule
+	var groupAgents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", path: value}
+			for _, groupAgent := range groupAgents {
+				if groupAgent == "*" {
+					wildcard = append(wildcard, rule)
+				} else if strings.Contains(agent, groupAgent) {
+					specific = append(specific, rule)
+				}
+			}
+		}
+	}
+
+	if specific != nil {
+		return specific
+	}
+	return wildcard
+}
+
+// The function applies robots.txt rules to a path: the longest matching rule wins and Allow wins
+// ties. Only simple prefixes and a trailing "*" or "$" are understood.
+func robotsAllowed(rules []robotsRule, path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range rules {
+		pattern := strings.TrimSuffix(rule.path, "*")
+		matched := false
+		if strings.HasSuffix(pattern, "$") {
+			matched = path == strings.TrimSuffix(pattern, "$")
+		} else {
+			matched = strings.HasPrefix(path, pattern)
+		}
+		if !matched {
+			continue
+		}
+		if len(rule.path) > longest || (len(rule.path) == longest && rule.allow) {
+			longest = len(rule.path)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// The function fetches and caches the robots.txt rules for the destination's origin. A missing
+// robots.txt allows everything, while an unreachable one disallows everything until the next attempt.
+func robotsRulesFor(ctx context.Context, u *url.URL) []robotsRule {
+	origin := u.Scheme + "://" + u.Host
+
+	robotsCache.Lock()
+	entry, ok := robotsCache.entries[origin]
+	robotsCache.Unlock()
+	if ok && time.Since(entry.fetchedAt) < config.OutboundRobotsCacheTTL {
+		return entry.rules
+	}
+
+	disallowAll := []robotsRule{{allow: false, path: "/"}}
+	entry = robotsEntry{rules: disallowAll, fetchedAt: time.Now()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err == nil {
+		req.Header.Set("User-Agent", config.OutboundUserAgent)
+		if err = outboundThrottle.wait(ctx, u.Host, config.OutboundHostInterval); err == nil {
+			var resp *http.Response
+			if resp, err = outboundClient.Do(req); err == nil {
+				switch {
+				case resp.StatusCode >= 200 && resp.StatusCode < 300:
+					entry.rules = parseRobots(io.LimitReader(resp.Body, 512*1024), robotsProductToken())
+				case resp.StatusCode >= 400 && resp.StatusCode < 500:
+					entry.rules = nil
+				}
+				resp.Body.Close()
+			}
+		}
+	}
+
+	robotsCache.Lock()
+	robotsCache.entries[origin] = entry
+	robotsCache.Unlock()
+	return entry.rules
+}
+
+// The product token is the part of the User-Agent that robots.txt groups refer to, e.g.
+// "golang-url-shortener" for "golang-url-shortener/1.0 (+https://...)".
+func robotsProductToken() string {
+	token, _, _ := strings.Cut(config.OutboundUserAgent, "/")
+	return strings.TrimSpace(token)
+}
+
+// The `fetchDestination` function performs a request to a link destination on behalf of the shortener.
+// It identifies itself with the configured User-Agent, optionally honours the destination's
+// robots.txt, and paces requests per destination host. The caller must close the response body.
+func fetchDestination(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.OutboundRespectRobots && !robotsAllowed(robotsRulesFor(ctx, u), u.EscapedPath()) {
+		return nil, errDisallowedByRobots
+	}
+
+	if err := outboundThrottle.wait(ctx, u.Host, config.OutboundHostInterval); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.OutboundUserAgent)
+	return outboundClient.Do(req)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRobots(t *testing.T) {
+	body := `
+User-agent: *
+Disallow: /private
+
+User-agent: golang-url-shortener
+Disallow: /
+Allow: /public # comment
+`
+	rules := parseRobots(strings.NewReader(body), "golang-url-shortener")
+	assert.False(t, robotsAllowed(rules, "/anything"))
+	assert.True(t, robotsAllowed(rules, "/public/page"))
+
+	rules = parseRobots(strings.NewReader(body), "otherbot")
+	assert.True(t, robotsAllowed(rules, "/anything"))
+	assert.False(t, robotsAllowed(rules, "/private/page"))
+}
+
+func TestFetchDestination(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /blocked\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	previous := config
+	config.OutboundRespectRobots = true
+	config.OutboundHostInterval = 100 * time.Millisecond
+	config.OutboundAllowPrivate = true
+	defer func() { config = previous }()
+
+	start := time.Now()
+	resp, err := fetchDestination(context.Background(), http.MethodHead, server.URL+"/page")
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = fetchDestination(context.Background(), http.MethodHead, server.URL+"/blocked")
+	assert.ErrorIs(t, err, errDisallowedByRobots)
+
+	// robots.txt and the page request were spaced out by the per-host interval
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	for _, userAgent := range userAgents {
+		assert.Equal(t, config.OutboundUserAgent, userAgent)
+	}
+}
+
+func TestGuardOutboundDial(t *testing.T) {
+	previous := config
+	config.OutboundAllowPrivate = false
+	defer func() { config = previous }()
+
+	for _, address := range []string{"127.0.0.1:80", "[::1]:443", "10.0.0.5:80", "192.168.1.1:80", "172.16.0.1:80", "169.254.169.254:80", "100.64.0.1:80", "0.0.0.0:80", "[fe80::1]:80", "[fd00::1]:80", "[::ffff:127.0.0.1]:80"} {
+		assert.ErrorIs(t, guardOutboundDial("tcp", address, nil), errPrivateDestination, address)
+	}
+	for _, address := range []string{"93.184.216.34:443", "[2606:2800:220:1:248:1893:25c8:1946]:443"} {
+		assert.NoError(t, guardOutboundDial("tcp", address, nil), address)
+	}
+
+	config.OutboundAllowPrivate = true
+	assert.NoError(t, guardOutboundDial("tcp", "127.0.0.1:80", nil))
+}
+
+func TestFetchDestinationRefusesPrivate(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	previous := config
+	config.OutboundAllowPrivate = false
+	config.OutboundRespectRobots = false
+	config.OutboundHostInterval = 0
+	defer func() { config = previous }()
+
+	// Hostnames are checked once they are resolved
+	_, err := fetchDestination(context.Background(), http.MethodGet, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	assert.ErrorIs(t, err, errPrivateDestination)
+	assert.Equal(t, 0, requests)
+}
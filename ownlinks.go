@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// The links of an API key sorted by creation time and by access count, so they can be paged through
+// in either order. Like the other indexes, they keep links that are gone until a reader cleans them up.
+func ownerCreatedIndexKey(owner string) string {
+	return "index:owner:" + owner + ":created"
+}
+
+func ownerClicksIndexKey(owner string) string {
+	return "index:owner:" + owner + ":clicks"
+}
+
+// The `indexOwnedLink` function adds a new link to the sorted indexes of its owner.
+func indexOwnedLink(ctx context.Context, rdb redis.Cmdable, urlEntry URL) {
+	if urlEntry.CreatorAPIKey == "" {
+		return
+	}
+	created, _ := time.Parse(time.RFC3339, urlEntry.CreatedAt)
+	rdb.ZAdd(ctx, ownerCreatedIndexKey(urlEntry.CreatorAPIKey), redis.Z{Score: float64(created.Unix()), Member: urlEntry.key()})
+	rdb.ZAdd(ctx, ownerClicksIndexKey(urlEntry.CreatorAPIKey), redis.Z{Score: float64(urlEntry.CurrentAccessCount), Member: urlEntry.key()})
+}
+
+// The function updates the access count of a link in its owner's index after an access was saved.
+func rankOwnedLink(ctx context.Context, rdb redis.Cmdable, urlEntry URL) {
+	if urlEntry.CreatorAPIKey != "" {
+		rdb.ZAddXX(ctx, ownerClicksIndexKey(urlEntry.CreatorAPIKey), redis.Z{Score: float64(urlEntry.CurrentAccessCount), Member: urlEntry.key()})
+	}
+}
+
+// The function removes a link from the sorted indexes of its owner.
+func unindexOwnedLink(ctx context.Context, rdb redis.Cmdable, urlEntry URL) {
+	if urlEntry.CreatorAPIKey != "" {
+		rdb.ZRem(ctx, ownerCreatedIndexKey(urlEntry.CreatorAPIKey), urlEntry.key())
+		rdb.ZRem(ctx, ownerClicksIndexKey(urlEntry.CreatorAPIKey), urlEntry.key())
+	}
+}
+
+// The function fills the sorted indexes of an API key from its plain owner index, for keys whose links
+// were created before the sorted indexes existed.
+func backfillOwnedLinks(ctx context.Context, rdb *redis.Client, owner string) error {
+	n, err := rdb.Exists(ctx, ownerCreatedIndexKey(owner)).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	keys, err := rdb.SMembers(ctx, ownerIndexKey(owner)).Result()
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	for len(keys) > 0 {
+		batch := keys[:min(100, len(keys))]
+		keys = keys[len(batch):]
+		values, err := rdb.MGet(ctx, batch...).Result()
+		if err != nil {
+			return err
+		}
+		pipe := rdb.Pipeline()
+		for _, value := range values {
+			var urlEntry URL
+			if data, ok := value.(string); ok && json.Unmarshal([]byte(data), &urlEntry) == nil {
+				indexOwnedLink(ctx, pipe, urlEntry)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OwnLink is an entry of the own links listing: the record of an active link, or the tombstone of a
+// link that expired or was used up recently.
+type OwnLink struct {
+	Token     string     `json:"token"`
+	Domain    string     `json:"domain,omitempty"`
+	Status    string     `json:"status"`
+	Link      *URL       `json:"link,omitempty"`
+	Tombstone *Tombstone `json:"tombstone,omitempty"`
+}
+
+// A position in a sorted index: the score of the last link examined and how many links with that
+// score were examined, so links with the same score are neither repeated nor skipped.
+type indexCursor struct {
+	score float64
+	seen  int64
+}
+
+func parseIndexCursor(value string) (indexCursor, bool) {
+	score, seen, ok := strings.Cut(value, ":")
+	if !ok {
+		return indexCursor{}, false
+	}
+	var cursor indexCursor
+	var err1, err2 error
+	cursor.score, err1 = strconv.ParseFloat(score, 64)
+	cursor.seen, err2 = strconv.ParseInt(seen, 10, 64)
+	return cursor, err1 == nil && err2 == nil && cursor.seen >= 0
+}
+
+func (c indexCursor) String() string {
+	return formatScore(c.score) + ":" + strconv.FormatInt(c.seen, 10)
+}
+
+// The function formats a score as a range bound, with Redis's spelling of infinity.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// The function moves the cursor past a link with the given score.
+func (c *indexCursor) advance(score float64) {
+	if score != c.score {
+		c.score, c.seen = score, 0
+	}
+	c.seen++
+}
+
+// The `ownLinksHandler` function lists the links of the requesting API key, newest first by default.
+// `sort` is `created` or `clicks`, `order` is `desc` or `asc`, `status` is `active` (default),
+// `expired` or `all`, and `domain` and `category` restrict the listing to one short domain or
+// category. Pages hold up to `limit` links, the `next_cursor` of a page continues the listing. Links
+// with a tag are listed by `GET /api/urls?tag=`, from the tag's index.
+func ownLinksHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	index := ownerCreatedIndexKey(apiKey.ID)
+	switch c.DefaultQuery("sort", "created") {
+	case "created":
+	case "clicks":
+		index = ownerClicksIndexKey(apiKey.ID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid sort parameter, expected created or clicks"})
+		return
+	}
+	order := c.DefaultQuery("order", "desc")
+	status := c.DefaultQuery("status", "active")
+	if (order != "desc" && order != "asc") || (status != "active" && status != "expired" && status != "all") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid order or status parameter"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit parameter"})
+		return
+	}
+	domain := strings.ToLower(c.Query("domain"))
+	category := c.Query("category")
+
+	cursor := indexCursor{score: math.Inf(1)}
+	if order == "asc" {
+		cursor.score = math.Inf(-1)
+	}
+	if value := c.Query("cursor"); value != "" {
+		if cursor, ok = parseIndexCursor(value); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor parameter"})
+			return
+		}
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	if err := backfillOwnedLinks(opCtx, rdb, apiKey.ID); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	links := []OwnLink{}
+	exhausted := false
+	for len(links) < limit && !exhausted {
+		args := redis.ZRangeArgs{Key: index, ByScore: true, Offset: cursor.seen, Count: int64(limit)}
+		bound := formatScore(cursor.score)
+		// For reverse ranges, the client sends Stop as the maximum
+		if order == "desc" {
+			args.Start, args.Stop, args.Rev = "-inf", bound, true
+		} else {
+			args.Start, args.Stop = bound, "+inf"
+		}
+		entries, err := rdb.ZRangeArgsWithScores(opCtx, args).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		exhausted = len(entries) < limit
+		if len(entries) == 0 {
+			break
+		}
+
+		keys := make([]string, 0, 2*len(entries))
+		for _, entry := range entries {
+			keys = append(keys, entry.Member.(string))
+		}
+		for _, entry := range entries {
+			keys = append(keys, tombstoneKey(entry.Member.(string)))
+		}
+		values, err := rdb.MGet(opCtx, keys...).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+
+		var stale []URL
+		for i, entry := range entries {
+			if len(links) == limit {
+				exhausted = false
+				break
+			}
+			key := entry.Member.(string)
+			link := OwnLink{Status: "active"}
+			link.Domain, link.Token, ok = strings.Cut(key, "/")
+			if !ok {
+				link.Domain, link.Token = "", key
+			}
+
+			data, ok := values[i].(string)
+			if !ok && coldStore != nil {
+				if record, _, err := coldStore.Get(key); err == nil {
+					data, ok = string(record), true
+				}
+			}
+			if ok {
+				link.Link = &URL{}
+				json.Unmarshal([]byte(data), link.Link)
+			} else if data, ok := values[len(entries)+i].(string); ok {
+				link.Status = "expired"
+				link.Tombstone = parseTombstone(data)
+			}
+			// Entries of links that are gone for good are dropped, so the cursor doesn't count them
+			if link.Link == nil && link.Tombstone == nil {
+				stale = append(stale, URL{Token: link.Token, Domain: link.Domain, CreatorAPIKey: apiKey.ID})
+				continue
+			}
+			cursor.advance(entry.Score)
+			matches := (domain == "" || link.Domain == domain) && (status == "all" || status == link.Status)
+			// Tombstones don't keep the category, so expired links can't be filtered by it
+			if category != "" {
+				matches = matches && link.Link != nil && link.Link.Category == category
+			}
+			if matches {
+				links = append(links, link)
+			}
+		}
+
+		if len(stale) > 0 {
+			cleanCtx, cleanCancel := writeContext(c.Request.Context())
+			pipe := rdb.Pipeline()
+			for _, urlEntry := range stale {
+				unindexOwnedLink(cleanCtx, pipe, urlEntry)
+			}
+			_, err := pipe.Exec(cleanCtx)
+			cleanCancel()
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+				return
+			}
+		}
+	}
+
+	nextCursor := ""
+	if !exhausted {
+		nextCursor = cursor.String()
+	}
+	c.JSON(http.StatusOK, gin.H{"urls": links, "next_cursor": nextCursor})
+}
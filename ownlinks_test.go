@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnLinks(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var key map[string]string
+	w := performRequest(router, "POST", "/api/admin/keys", "name=owner", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &key)
+	owner := map[string]string{apiKeyHeader: key["key"]}
+
+	var tokens []string
+	for _, form := range []string{"long_url=https://example.com/1", "long_url=https://example.com/2&max_access=1", "long_url=https://example.com/3"} {
+		var created map[string]string
+		w = performRequest(router, "POST", "/create", form, owner)
+		json.Unmarshal(w.Body.Bytes(), &created)
+		tokens = append(tokens, created["token"])
+	}
+	performRequest(router, "POST", "/create", "long_url=https://example.com/anonymous", nil)
+
+	type page struct {
+		URLs       []OwnLink `json:"urls"`
+		NextCursor string    `json:"next_cursor"`
+	}
+	list := func(query string) page {
+		var result page
+		w := performRequest(router, "GET", "/api/my/urls?"+query, "", owner)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+	listed := func(p page) []string {
+		var listed []string
+		for _, link := range p.URLs {
+			listed = append(listed, link.Token)
+		}
+		return listed
+	}
+
+	// Links created within the same second are paged through without repeats
+	first := list("limit=2")
+	assert.Len(t, first.URLs, 2)
+	assert.NotEmpty(t, first.NextCursor)
+	second := list("limit=2&cursor=" + first.NextCursor)
+	assert.Len(t, second.URLs, 1)
+	assert.Empty(t, second.NextCursor)
+	assert.ElementsMatch(t, tokens, append(listed(first), listed(second)...))
+
+	performRequest(router, "GET", "/"+tokens[2], "", nil)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, tokens[2], list("sort=clicks").URLs[0].Token)
+	assert.Equal(t, tokens[2], list("sort=clicks&order=asc").URLs[2].Token)
+
+	// Used up links are listed as expired while their tombstone lasts
+	for i := 0; i < 3; i++ {
+		performRequest(router, "GET", "/"+tokens[1], "", nil)
+		time.Sleep(50 * time.Millisecond)
+	}
+	expired := list("status=expired")
+	assert.Equal(t, []string{tokens[1]}, listed(expired))
+	assert.Equal(t, "max_access_reached", expired.URLs[0].Tombstone.Reason)
+	assert.Len(t, list("status=active").URLs, 2)
+	assert.Len(t, list("status=all").URLs, 3)
+	assert.Empty(t, list("domain=other.example").URLs)
+
+	// Entries of links that are gone for good are dropped
+	rdb.Del(testCtx, tokens[0], tombstoneKey(tokens[0]))
+	assert.Len(t, list("status=all").URLs, 2)
+	assert.Equal(t, int64(2), rdb.ZCard(testCtx, ownerCreatedIndexKey(key["id"])).Val())
+
+	for _, query := range []string{"sort=title", "order=up", "status=gone", "cursor=abc", "limit=0"} {
+		w = performRequest(router, "GET", "/api/my/urls?"+query, "", owner)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	w = performRequest(router, "GET", "/api/my/urls", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBackfillOwnedLinks(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	owner := "key_backfill" + randomHex(4)
+	urlEntry := URL{Token: "backfill" + randomHex(4), LongURL: "https://example.com", CreatorAPIKey: owner, CreatedAt: time.Now().Format(time.RFC3339), CurrentAccessCount: 7, ExpiresAt: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	data, _ := json.Marshal(urlEntry)
+	rdb.Set(testCtx, urlEntry.key(), data, time.Hour)
+	rdb.SAdd(testCtx, ownerIndexKey(owner), urlEntry.key())
+
+	assert.NoError(t, backfillOwnedLinks(testCtx, rdb, owner))
+	assert.Equal(t, float64(7), rdb.ZScore(testCtx, ownerClicksIndexKey(owner), urlEntry.key()).Val())
+	assert.Equal(t, int64(1), rdb.ZCard(testCtx, ownerCreatedIndexKey(owner)).Val())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pdfDocument is a minimal PDF writer for the printable pages of the service: pages of filled
+// rectangles and single-line text in Helvetica, one of the fonts every PDF reader has built in, so
+// nothing needs to be embedded.
+type pdfDocument struct {
+	width, height float64
+	pages         []*pdfPage
+}
+
+// pdfPage is the content stream of a page, in points from the bottom left corner.
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+func newPDFDocument(width, height float64) *pdfDocument {
+	return &pdfDocument{width: width, height: height}
+}
+
+func (d *pdfDocument) addPage() *pdfPage {
+	page := &pdfPage{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// The method fills a black rectangle.
+func (p *pdfPage) rect(x, y, width, height float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f %.2f re f\n", x, y, width, height)
+}
+
+// The method writes a line of text centered on x, with its baseline at y.
+func (p *pdfPage) centeredText(x, y, size float64, text string) {
+	encoded := winAnsi(text)
+	x -= helveticaWidth(encoded, size) / 2
+	fmt.Fprintf(&p.content, "BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET\n", size, x, y, escapePDFString(encoded))
+}
+
+// The method writes the document. Objects are numbered in the order they are written: the catalog,
+// the page tree and the font, then each page followed by its content stream.
+func (d *pdfDocument) write(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", d.width, d.height, 5+2*i))
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(page.content.Bytes())
+		zw.Close()
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// The function converts text to the WinAnsi encoding of the built-in fonts. Characters it doesn't
+// have are replaced by question marks.
+func winAnsi(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= ' ' && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func escapePDFString(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(text)
+}
+
+// Widths of the printable ASCII characters in Helvetica, in thousandths of the font size
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// The function returns the width of WinAnsi encoded text in Helvetica. Characters beyond ASCII are
+// counted with the width of a digit, which is close enough to center captions.
+func helveticaWidth(encoded string, size float64) float64 {
+	total := 0
+	for i := 0; i < len(encoded); i++ {
+		if c := encoded[i]; c >= ' ' && c < 0x7f {
+			total += helveticaWidths[c-' ']
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// The function shortens text to fit into width at the given font size, ending it with an ellipsis.
+func fitText(text string, size, width float64) string {
+	if helveticaWidth(winAnsi(text), size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && helveticaWidth(winAnsi(string(runes))+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
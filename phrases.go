@@ -0,0 +1,106 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Phrase tokens such as "amber-otter-42" are made of words and a two-digit number joined by hyphens,
+// so links shared verbally can be spelled without reading out random characters.
+
+//go:embed wordlists/words.txt
+var defaultWordlist string
+
+// The words phrase tokens are made of, the built-in list unless TOKEN_WORDLIST names another one
+var tokenWords = mustParseWordlist(defaultWordlist)
+
+// Words of a word list are lowercase letters only, so phrases can be typed without guessing
+var wordPattern = regexp.MustCompile(`^[a-z]{2,12}$`)
+
+// A word list needs this many words for phrases to be hard to guess and rarely collide
+const minWordlistSize = 64
+
+// Bounds of the number of words in a phrase token
+const (
+	minPhraseWords = 1
+	maxPhraseWords = 6
+)
+
+var errInvalidTokenStyle = errors.New("token_style must be random, words or emoji")
+
+// The `parseWordlist` function reads a word list with one word per line. Empty lines and lines
+// starting with # are skipped, duplicates are dropped.
+func parseWordlist(data string) ([]string, error) {
+	var words []string
+	seen := map[string]bool{}
+	for n, line := range strings.Split(data, "\n") {
+		word := strings.ToLower(strings.TrimSpace(line))
+		if word == "" || strings.HasPrefix(word, "#") || seen[word] {
+			continue
+		}
+		if !wordPattern.MatchString(word) {
+			return nil, fmt.Errorf("line %d: %q is not a word of 2 to 12 letters a-z", n+1, word)
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if len(words) < minWordlistSize {
+		return nil, fmt.Errorf("%d words, at least %d are needed", len(words), minWordlistSize)
+	}
+	return words, nil
+}
+
+func mustParseWordlist(data string) []string {
+	words, err := parseWordlist(data)
+	if err != nil {
+		panic("built-in word list: " + err.Error())
+	}
+	return words
+}
+
+// The function loads the word list configured with TOKEN_WORDLIST.
+func loadWordlist(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseWordlist(string(data))
+}
+
+// All 256 byte values, the alphabet random indexes are drawn from
+var byteAlphabet = func() string {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return string(b)
+}()
+
+// The function draws a number below n from generator, so phrase tokens use the same randomness as
+// other tokens. Draws that would favour the lower numbers are rejected.
+func randomIndex(generator TokenGenerator, n int) int {
+	limit := uint64(1<<32) - uint64(1<<32)%uint64(n)
+	for {
+		value := uint64(binary.BigEndian.Uint32([]byte(generator.Generate(4, byteAlphabet))))
+		if value < limit {
+			return int(value % uint64(n))
+		}
+	}
+}
+
+// The `phraseToken` function draws a phrase token of the given number of words followed by a number
+// from 10 to 99.
+func phraseToken(generator TokenGenerator, words []string, count int) string {
+	parts := make([]string, 0, count+1)
+	for i := 0; i < count; i++ {
+		parts = append(parts, words[randomIndex(generator, len(words))])
+	}
+	parts = append(parts, strconv.Itoa(10+randomIndex(generator, 90)))
+	return strings.Join(parts, "-")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWordlist(t *testing.T) {
+	assert.GreaterOrEqual(t, len(tokenWords), minWordlistSize)
+
+	var list strings.Builder
+	list.WriteString("# colors\n\nRed\nred\n")
+	for _, word := range tokenWords[:minWordlistSize] {
+		list.WriteString(word + "\n")
+	}
+	words, err := parseWordlist(list.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "red", words[0])
+	assert.Len(t, words, minWordlistSize+1)
+
+	_, err = parseWordlist("red\ngreen\nblue\n")
+	assert.Error(t, err)
+	_, err = parseWordlist(list.String() + "sky-blue\n")
+	assert.ErrorContains(t, err, "sky-blue")
+}
+
+func TestPhraseToken(t *testing.T) {
+	pattern := regexp.MustCompile(`^[a-z]+-[a-z]+-[1-9][0-9]$`)
+	for _, generator := range []TokenGenerator{mathTokenGenerator{}, cryptoTokenGenerator{}} {
+		for i := 0; i < 100; i++ {
+			assert.Regexp(t, pattern, phraseToken(generator, tokenWords, 2))
+		}
+	}
+	assert.Regexp(t, `^[a-z]+-[1-9][0-9]$`, phraseToken(mathTokenGenerator{}, tokenWords, 1))
+
+	// Every index is drawn, also for sizes dividing the range of the draws
+	for _, n := range []int{1, 3, 64, 90} {
+		seen := map[int]bool{}
+		for i := 0; i < 50*n; i++ {
+			index := randomIndex(mathTokenGenerator{}, n)
+			assert.True(t, index >= 0 && index < n)
+			seen[index] = true
+		}
+		assert.Len(t, seen, n)
+	}
+}
+
+func TestCreateWithPhraseToken(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&token_style=words", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Regexp(t, `^[a-z]+-[a-z]+-[1-9][0-9]$`, created["token"])
+
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	for _, form := range []string{"token_style=fancy", "token_style=words&one_time=true", "token_style=words&token_seed=abc"} {
+		w = performRequest(router, "POST", "/create", "long_url=https://example.com&"+form, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, form)
+	}
+}
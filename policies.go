@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// LinkPolicy holds the defaults of new links and the caps on what clients may ask for. In the tiers
+// of LINK_POLICIES, zero fields keep the deployment's setting.
+type LinkPolicy struct {
+	// max_age and max_access of links whose creator doesn't send them
+	DefaultMaxAge    int `json:"default_max_age"`
+	DefaultMaxAccess int `json:"default_max_access"`
+	// Longest lifetime in seconds and most accesses a client may give a link, 0 for no cap beyond the
+	// built-in year of lifetime
+	MaxAgeLimit    int `json:"max_age_limit"`
+	MaxAccessLimit int `json:"max_access_limit"`
+}
+
+// The tier of LINK_POLICIES that applies to links created without an API key
+const anonymousTier = "anonymous"
+
+// The function reads the JSON object of link policies by tier.
+func envLinkPolicies(key string) map[string]LinkPolicy {
+	policies := map[string]LinkPolicy{}
+	if value := os.Getenv(key); value != "" {
+		if err := json.Unmarshal([]byte(value), &policies); err != nil {
+			log.Fatalf("%s: %v", key, err)
+		}
+	}
+	return policies
+}
+
+// The `linkPolicy` function returns the policy of links created on domain with key: the deployment's,
+// with the default lifetime of the domain, overridden by the settings of the key's tier, or of the
+// "anonymous" tier without a key. Keys without a tier, like the admin key, get the deployment's policy.
+func linkPolicy(domain string, key *APIKey) LinkPolicy {
+	policy := config.LinkPolicy
+	if settings := config.Domains[domain]; settings.DefaultMaxAge != 0 {
+		policy.DefaultMaxAge = settings.DefaultMaxAge
+	}
+	tier := anonymousTier
+	if key != nil {
+		tier = key.Tier
+	}
+	if override, ok := config.LinkPolicies[tier]; ok && tier != "" {
+		if override.DefaultMaxAge != 0 {
+			policy.DefaultMaxAge = override.DefaultMaxAge
+		}
+		if override.DefaultMaxAccess != 0 {
+			policy.DefaultMaxAccess = override.DefaultMaxAccess
+		}
+		if override.MaxAgeLimit != 0 {
+			policy.MaxAgeLimit = override.MaxAgeLimit
+		}
+		if override.MaxAccessLimit != 0 {
+			policy.MaxAccessLimit = override.MaxAccessLimit
+		}
+	}
+	return policy
+}
+
+// The function returns the longest lifetime a link may be given in seconds.
+func (p LinkPolicy) maxAge() int {
+	if p.MaxAgeLimit > 0 {
+		return min(p.MaxAgeLimit, maxMaxAge)
+	}
+	return maxMaxAge
+}
+
+// The function returns the max_age and max_access of a link whose creator doesn't send them. Defaults
+// above a cap, e.g. the lifetime of a domain for a tier with a shorter limit, are lowered to it.
+func (p LinkPolicy) defaults() (maxAge, maxAccess int) {
+	maxAge, maxAccess = min(p.DefaultMaxAge, p.maxAge()), p.DefaultMaxAccess
+	if p.MaxAccessLimit > 0 && (maxAccess < 0 || maxAccess > p.MaxAccessLimit) {
+		maxAccess = p.MaxAccessLimit
+	}
+	return maxAge, maxAccess
+}
+
+// The `checkMaxAge` method rejects lifetimes outside of the policy with 400.
+func (p LinkPolicy) checkMaxAge(maxAge int) error {
+	if maxAge < minMaxAge || maxAge > p.maxAge() {
+		return newAPIError(http.StatusBadRequest, "Invalid max_age parameter, expected "+strconv.Itoa(minMaxAge)+" to "+strconv.Itoa(p.maxAge())+" seconds")
+	}
+	return nil
+}
+
+// The `checkMaxAccess` method rejects access limits above the cap of the policy with 400. Under a cap,
+// links can't be unlimited.
+func (p LinkPolicy) checkMaxAccess(maxAccess int) error {
+	if p.MaxAccessLimit > 0 && (maxAccess < 0 || maxAccess > p.MaxAccessLimit) {
+		return newAPIError(http.StatusBadRequest, "Invalid max_access parameter, expected at most "+strconv.Itoa(p.MaxAccessLimit))
+	}
+	return nil
+}
+
+// The `validateLinkPolicies` function checks the deployment's link policy and its tiers at startup.
+func validateLinkPolicies() error {
+	p := config.LinkPolicy
+	switch {
+	case p.DefaultMaxAge < minMaxAge || p.DefaultMaxAge > maxMaxAge:
+		return fmt.Errorf("DEFAULT_MAX_AGE must be between %d and %d seconds", minMaxAge, maxMaxAge)
+	case p.DefaultMaxAccess < -1:
+		return errors.New("DEFAULT_MAX_ACCESS must be -1 (no limit) or more")
+	case p.MaxAgeLimit < 0 || p.MaxAgeLimit > maxMaxAge:
+		return fmt.Errorf("MAX_AGE_LIMIT must be between 0 (no cap) and %d seconds", maxMaxAge)
+	case p.MaxAccessLimit < 0:
+		return errors.New("MAX_ACCESS_LIMIT can't be negative")
+	}
+	for tier, p := range config.LinkPolicies {
+		if tier == "" || p.DefaultMaxAge < 0 || p.DefaultMaxAge > maxMaxAge || p.DefaultMaxAccess < -1 || p.MaxAgeLimit < 0 || p.MaxAgeLimit > maxMaxAge || p.MaxAccessLimit < 0 {
+			return fmt.Errorf("LINK_POLICIES: invalid settings of tier %q", tier)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkPolicy(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+	config.LinkPolicy = LinkPolicy{DefaultMaxAge: 3600, DefaultMaxAccess: -1}
+	config.Domains = map[string]DomainConfig{"go.acme.com": {DefaultMaxAge: 30 * 86400}}
+	config.LinkPolicies = map[string]LinkPolicy{
+		anonymousTier: {MaxAgeLimit: 7 * 86400, MaxAccessLimit: 100},
+		"pro":         {DefaultMaxAge: 86400},
+	}
+
+	maxAge, maxAccess := linkPolicy("", nil).defaults()
+	assert.Equal(t, 3600, maxAge)
+	assert.Equal(t, 100, maxAccess)
+	// The domain's default is lowered to the cap of the tier
+	maxAge, _ = linkPolicy("go.acme.com", nil).defaults()
+	assert.Equal(t, 7*86400, maxAge)
+
+	pro := &APIKey{ID: "key1", Tier: "pro"}
+	maxAge, maxAccess = linkPolicy("go.acme.com", pro).defaults()
+	assert.Equal(t, 86400, maxAge)
+	assert.Equal(t, -1, maxAccess)
+	assert.NoError(t, linkPolicy("", pro).checkMaxAge(maxMaxAge))
+	assert.Error(t, linkPolicy("", pro).checkMaxAge(maxMaxAge+1))
+	assert.NoError(t, linkPolicy("", pro).checkMaxAccess(-1))
+
+	// Keys without a tier get the deployment's policy
+	assert.Equal(t, config.LinkPolicy, linkPolicy("", &adminAPIKey))
+
+	anonymous := linkPolicy("", nil)
+	assert.NoError(t, anonymous.checkMaxAge(7*86400))
+	assert.Error(t, anonymous.checkMaxAge(7*86400+1))
+	assert.NoError(t, anonymous.checkMaxAccess(100))
+	assert.Error(t, anonymous.checkMaxAccess(101))
+	assert.Error(t, anonymous.checkMaxAccess(-1))
+}
+
+func TestValidateLinkPolicies(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+	config.LinkPolicy = LinkPolicy{DefaultMaxAge: 3600, DefaultMaxAccess: -1}
+	config.LinkPolicies = map[string]LinkPolicy{anonymousTier: {MaxAgeLimit: 86400}}
+	assert.NoError(t, validateLinkPolicies())
+
+	config.LinkPolicies = map[string]LinkPolicy{anonymousTier: {MaxAgeLimit: maxMaxAge + 1}}
+	assert.Error(t, validateLinkPolicies())
+
+	config.LinkPolicies = nil
+	config.LinkPolicy.DefaultMaxAge = 0
+	assert.Error(t, validateLinkPolicies())
+}
+
+func TestCreateWithLinkPolicy(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.LinkPolicies = map[string]LinkPolicy{
+		anonymousTier: {MaxAgeLimit: 90 * 86400, DefaultMaxAccess: 50, MaxAccessLimit: 100},
+		"pro":         {DefaultMaxAge: 86400},
+	}
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_age=7776001", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=-1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_age=7776000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	var link URL
+	val, _ := rdb.Get(testCtx, created["token"]).Result()
+	json.Unmarshal([]byte(val), &link)
+	assert.Equal(t, 50, link.MaxAccess)
+
+	var apiKey struct {
+		Key  string `json:"key"`
+		Tier string `json:"tier"`
+	}
+	w = performRequest(router, "POST", "/api/admin/keys", "name=pro&tier=pro", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &apiKey)
+	assert.Equal(t, "pro", apiKey.Tier)
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=-1", map[string]string{apiKeyHeader: apiKey.Key})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	expiresAt, _ := time.Parse(time.RFC3339, created["expires_at"])
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), expiresAt, time.Minute)
+
+	for _, tier := range []string{"gold", anonymousTier} {
+		w = performRequest(router, "POST", "/api/admin/keys", "name=other&tier="+tier, map[string]string{apiKeyHeader: "admin-secret"})
+		assert.Equal(t, http.StatusBadRequest, w.Code, tier)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Sizes of QR code images in pixels
+const (
+	defaultQRSize = 256
+	maxQRSize     = 1024
+)
+
+// The `qrCodeHandler` function renders the QR code of a link's short URL as a PNG image of `size`
+// pixels. Only the link's owner and the admin can get it. The code uses the medium error correction
+// level, so it still scans when it is printed small or gets smudged.
+func qrCodeHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(defaultQRSize)))
+	if err != nil || size < 64 || size > maxQRSize {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid size parameter, expected 64 to " + strconv.Itoa(maxQRSize) + " pixels"})
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	png, err := qrcode.Encode(shortURLFor(c, urlEntry), qrcode.Medium, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error rendering the QR code"})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// Most links a QR sheet can hold, a few dozen pages
+const maxQRSheetLinks = 500
+
+// Paper sizes of QR sheets in points
+var paperSizes = map[string][2]float64{
+	"a4":     {595.28, 841.89},
+	"letter": {612, 792},
+}
+
+// qrLabel is a QR code on a sheet with its caption, the link's title, and its short URL.
+type qrLabel struct {
+	caption string
+	url     string
+}
+
+// The `qrSheetHandler` function renders the QR codes of a campaign's links (`campaign_id`) or of a list
+// of tokens (`tokens`, comma-separated, with `domain` for links of a custom domain) as a printable PDF,
+// e.g. for table cards at an event. `per_page` codes (default 6, at most 24) are laid out on each page
+// of `paper` size (`a4` or `letter`), each captioned with the link's title and its short URL. Listed
+// tokens must all be links of the requesting API key, the admin key may print any.
+func qrSheetHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", "6"))
+	if err != nil || perPage < 1 || perPage > 24 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid per_page parameter, expected 1 to 24"})
+		return
+	}
+	paper, ok := paperSizes[c.DefaultQuery("paper", "a4")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid paper parameter, expected a4 or letter"})
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	campaignID, tokenList := c.Query("campaign_id"), c.Query("tokens")
+	// Keys of the links to print and the tokens they were listed as
+	var keys, tokens, missing []string
+	switch {
+	case campaignID != "" && tokenList == "":
+		campaign, err := loadCampaign(c.Request.Context(), rdb, campaignID)
+		if err == redis.Nil || (err == nil && !apiKey.owns(campaign.Owner)) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Campaign not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		if keys, err = rdb.SMembers(opCtx, campaignIndexKey(campaign.ID)).Result(); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		sort.Strings(keys)
+		tokens = keys
+	case tokenList != "" && campaignID == "":
+		domain := strings.ToLower(c.Query("domain"))
+		for _, token := range strings.Split(tokenList, ",") {
+			switch token = strings.TrimSpace(token); {
+			case token == "":
+			case malformedToken(token):
+				missing = append(missing, token)
+			default:
+				keys = append(keys, linkKey(domain, token))
+				tokens = append(tokens, token)
+			}
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Pass either campaign_id or tokens"})
+		return
+	}
+	if len(keys) > maxQRSheetLinks {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A QR sheet holds at most " + strconv.Itoa(maxQRSheetLinks) + " links"})
+		return
+	}
+
+	var labels []qrLabel
+	if len(keys) > 0 {
+		values, err := rdb.MGet(opCtx, keys...).Result()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		for i, value := range values {
+			var urlEntry URL
+			data, found := value.(string)
+			// Links of the campaign that have expired since are left out, listed tokens must all be printed
+			if !found || json.Unmarshal([]byte(data), &urlEntry) != nil || (campaignID == "" && !apiKey.owns(urlEntry.CreatorAPIKey)) {
+				missing = append(missing, tokens[i])
+				continue
+			}
+			labels = append(labels, qrLabel{caption: urlEntry.Title, url: shortURLFor(c, urlEntry)})
+		}
+	}
+	if campaignID == "" && len(missing) > 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URLs. They may have expired or never existed.", "missing": missing})
+		return
+	}
+	if len(labels) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "The campaign has no active links"})
+		return
+	}
+
+	sheet, err := renderQRSheet(labels, perPage, paper[0], paper[1])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error rendering the QR codes"})
+		return
+	}
+	var out bytes.Buffer
+	sheet.write(&out)
+	c.Header("Content-Disposition", `attachment; filename="qr-sheet.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", out.Bytes())
+}
+
+// The function lays out QR codes in a grid of perPage cells per page, with as many columns as fit
+// the page's proportions. Each code is centered in its cell above its captions.
+func renderQRSheet(labels []qrLabel, perPage int, width, height float64) (*pdfDocument, error) {
+	const margin, padding, titleSize, urlSize = 36.0, 12.0, 11.0, 8.0
+	columns := max(int(math.Round(math.Sqrt(float64(perPage)*width/height))), 1)
+	rows := (perPage + columns - 1) / columns
+	cellWidth := (width - 2*margin) / float64(columns)
+	cellHeight := (height - 2*margin) / float64(rows)
+	captionHeight := titleSize + urlSize + 10
+	side := min(cellWidth, cellHeight-captionHeight) - 2*padding
+
+	doc := newPDFDocument(width, height)
+	var page *pdfPage
+	for i, label := range labels {
+		if i%perPage == 0 {
+			page = doc.addPage()
+		}
+		code, err := qrcode.New(label.url, qrcode.Medium)
+		if err != nil {
+			return nil, err
+		}
+		cell := i % perPage
+		left := margin + float64(cell%columns)*cellWidth
+		top := height - margin - float64(cell/columns)*cellHeight
+		center := left + cellWidth/2
+
+		// The bitmap includes the quiet zone around the code, which scanners need
+		bitmap := code.Bitmap()
+		module := side / float64(len(bitmap))
+		x0, y0 := center-side/2, top-padding
+		for y, row := range bitmap {
+			// Dark modules next to each other are drawn as one rectangle
+			for x := 0; x < len(row); x++ {
+				if !row[x] {
+					continue
+				}
+				start := x
+				for x < len(row) && row[x] {
+					x++
+				}
+				page.rect(x0+float64(start)*module, y0-float64(y+1)*module, float64(x-start)*module, module)
+			}
+		}
+
+		baseline := top - padding - side - titleSize
+		if label.caption != "" {
+			page.centeredText(center, baseline, titleSize, fitText(label.caption, titleSize, cellWidth-padding))
+			baseline -= urlSize + 4
+		}
+		page.centeredText(center, baseline, urlSize, fitText(label.url, urlSize, cellWidth-padding))
+	}
+	return doc, nil
+}
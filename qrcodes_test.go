@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQRCode(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.PublicURL = "https://sho.rt"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", admin)
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/qr?size=128", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	img, err := png.Decode(w.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 128, img.Bounds().Dx())
+	}
+
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/qr?size=4096", "", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/qr", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performRequest(router, "GET", "/api/urls/missing/qr", "", admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRenderQRSheet(t *testing.T) {
+	labels := make([]qrLabel, 7)
+	for i := range labels {
+		labels[i] = qrLabel{caption: "Table " + strconv.Itoa(i+1), url: "https://sho.rt/tbl" + strconv.Itoa(i)}
+	}
+	labels[0].caption = "A title (much) too long to fit under its code, so it is shortened"
+
+	sheet, err := renderQRSheet(labels, 6, 595.28, 841.89)
+	assert.NoError(t, err)
+	assert.Len(t, sheet.pages, 2)
+	var out bytes.Buffer
+	assert.NoError(t, sheet.write(&out))
+	pdf := out.String()
+	assert.True(t, strings.HasPrefix(pdf, "%PDF-1.4"))
+	assert.Contains(t, pdf, "/Count 2")
+
+	// Every object is where the cross-reference table says
+	xref := regexp.MustCompile(`(?m)^(\d{10}) 00000 n $`).FindAllStringSubmatch(pdf, -1)
+	assert.Len(t, xref, 7)
+	for i, entry := range xref {
+		offset, _ := strconv.Atoi(entry[1])
+		assert.True(t, strings.HasPrefix(pdf[offset:], strconv.Itoa(i+1)+" 0 obj"), i+1)
+	}
+
+	content := sheet.pages[0].content.String()
+	assert.Contains(t, content, "(Table 2) Tj")
+	assert.Contains(t, content, `(A title \(much\) too long to fit under its`)
+	assert.Contains(t, content, "...) Tj")
+	assert.Contains(t, sheet.pages[1].content.String(), "(https://sho.rt/tbl6) Tj")
+}
+
+func TestWinAnsi(t *testing.T) {
+	assert.Equal(t, "Caf\xe9 ?", winAnsi("Café 🎉"))
+	assert.Equal(t, helveticaWidth("ii", 10), helveticaWidth("l", 10)*2)
+}
+
+func TestQRSheet(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/api/campaigns", "name=Gala", admin)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		w = performRequest(router, "POST", "/create", "long_url=https://example.com/menu&title=Table+"+strconv.Itoa(i+1)+"&campaign_id="+campaign.ID, admin)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		tokens = append(tokens, created["token"])
+	}
+
+	w = performRequest(router, "GET", "/api/qr/sheet?campaign_id="+campaign.ID+"&per_page=2", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "/Count 2")
+
+	w = performRequest(router, "GET", "/api/qr/sheet?tokens="+strings.Join(tokens, ","), "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/Count 1")
+
+	// Listed tokens must all be printed
+	w = performRequest(router, "GET", "/api/qr/sheet?tokens="+tokens[0]+",missing,summary:x", "", admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var response struct {
+		Missing []string `json:"missing"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.ElementsMatch(t, []string{"missing", "summary:x"}, response.Missing)
+
+	for _, query := range []string{"", "?campaign_id=" + campaign.ID + "&tokens=" + tokens[0], "?tokens=" + tokens[0] + "&per_page=0", "?tokens=" + tokens[0] + "&paper=a3"} {
+		w = performRequest(router, "GET", "/api/qr/sheet"+query, "", admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	w = performRequest(router, "GET", "/api/qr/sheet?campaign_id="+campaign.ID, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
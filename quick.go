@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Quick links created by an API key, counted in fixed one-minute windows
+func quickRateKey(keyID string, now time.Time) string {
+	return "ratelimit:quick:" + keyID + ":" + strconv.FormatInt(now.Unix()/60, 10)
+}
+
+// The function responds to a quick create request with a line of plain text, so errors don't end up
+// where a shell or bookmarklet expects the short URL without anyone noticing.
+func quickError(c *gin.Context, status int, message string) {
+	c.String(status, message+"\n")
+}
+
+// The function is respondError for quick create requests.
+func quickAPIError(c *gin.Context, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		quickError(c, apiErr.Status, apiErr.Message)
+		return
+	}
+	quickError(c, http.StatusInternalServerError, err.Error())
+}
+
+// The `quickCreateHandler` function shortens the `url` query parameter and responds with nothing but
+// the short URL, for bookmarklets and shell one-liners such as `curl -H "X-API-Key: ..." .../api/quick?url=...`.
+// Creating links with GET is easy to trigger by accident or from another site, so the endpoint always
+// needs an API key, refuses read-only impersonation tokens, and is limited to QUICK_CREATE_PER_MINUTE
+// links per key.
+func quickCreateHandler(c *gin.Context, rdb *redis.Client) {
+	c.Header("Cache-Control", "no-store")
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+	if apiKey.Impersonated {
+		quickError(c, http.StatusForbidden, "Impersonation tokens are read-only")
+		return
+	}
+
+	if config.QuickCreatePerMinute > 0 && !exemptRequest(c, rdb) {
+		now := time.Now()
+		key := quickRateKey(apiKey.ID, now)
+		opCtx, cancel := writeContext(c.Request.Context())
+		var count *redis.IntCmd
+		_, err := rdb.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+			count = pipe.Incr(opCtx, key)
+			pipe.Expire(opCtx, key, time.Minute)
+			return nil
+		})
+		cancel()
+		if err != nil {
+			quickError(c, http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+			return
+		}
+		if count.Val() > int64(config.QuickCreatePerMinute) {
+			c.Header("Retry-After", strconv.FormatInt(60-now.Unix()%60, 10))
+			quickError(c, http.StatusTooManyRequests, "Too many requests, please try again later.")
+			return
+		}
+	}
+
+	domain, err := resolveCreateDomain(c, apiKey)
+	if err != nil {
+		quickAPIError(c, err)
+		return
+	}
+	opts := defaultCreateOptions(domain, apiKey)
+	opts.LongURL = strings.TrimSpace(c.Query("url"))
+	opts.APIKey = apiKey
+	opts.CreatorIP = c.ClientIP()
+	if value := c.Query("max_age"); value != "" {
+		if opts.MaxAge, err = strconv.Atoi(value); err != nil {
+			quickError(c, http.StatusBadRequest, "Invalid max_age parameter")
+			return
+		}
+	}
+	if opts.LongURL == "" {
+		quickError(c, http.StatusBadRequest, "Missing url parameter")
+		return
+	}
+
+	urlEntry, err := createShortURL(c.Request.Context(), rdb, opts)
+	if err != nil {
+		quickAPIError(c, err)
+		return
+	}
+	c.String(http.StatusOK, shortURLFor(c, urlEntry)+"\n")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuickCreate(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.QuickCreatePerMinute = 2
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=shell", map[string]string{apiKeyHeader: "admin-secret"})
+	var key map[string]any
+	json.Unmarshal(w.Body.Bytes(), &key)
+	secret := key["key"].(string)
+
+	// An API key is required
+	w = performRequest(router, "GET", "/api/quick?url=https://example.com", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "GET", "/api/quick?url=https://example.com/article", "", map[string]string{apiKeyHeader: secret})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	shortURL := strings.TrimSuffix(w.Body.String(), "\n")
+	assert.True(t, strings.HasPrefix(shortURL, "http://"))
+
+	token := shortURL[strings.LastIndex(shortURL, "/")+1:]
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, "https://example.com/article", w.Header().Get("Location"))
+
+	// Errors are plain text too
+	w = performRequest(router, "GET", "/api/quick?url=ftp://example.com", "", map[string]string{apiKeyHeader: secret})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid long_url parameter\n", w.Body.String())
+
+	w = performRequest(router, "GET", "/api/quick?url=https://example.com/third", "", map[string]string{apiKeyHeader: secret})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
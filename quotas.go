@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Links an API key created on a UTC day, counted in a key that expires after the day
+func dailyUsageKey(owner string, now time.Time) string {
+	return "usage:" + owner + ":" + now.UTC().Format("20060102")
+}
+
+// Links of an API key that haven't expired yet, scored by their expiry time, so the links that expired
+// on their own can be dropped from the count without a lookup
+func activeLinksKey(owner string) string {
+	return "usage:" + owner + ":active"
+}
+
+// The function returns the number of links an API key may create per day and keep active at once, 0
+// for no limit. Limits set on the key take precedence over the deployment's defaults, -1 lifts them.
+func keyQuotas(key *APIKey) (perDay, active int) {
+	if key == nil || key.ID == adminAPIKey.ID {
+		return 0, 0
+	}
+	perDay, active = config.QuotaLinksPerDay, config.QuotaActiveLinks
+	if key.MaxLinksPerDay != 0 {
+		perDay = max(key.MaxLinksPerDay, 0)
+	}
+	if key.MaxActiveLinks != 0 {
+		active = max(key.MaxActiveLinks, 0)
+	}
+	return perDay, active
+}
+
+// Checks both quotas and only then counts the new link against them, so concurrent creates can't
+// exceed a quota. Returns 1 if the daily quota is used up, 2 if the active one is, 0 otherwise.
+var consumeQuotaScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[3])
+if tonumber(ARGV[1]) > 0 and tonumber(redis.call('GET', KEYS[1]) or '0') >= tonumber(ARGV[1]) then
+	return 1
+end
+if tonumber(ARGV[2]) > 0 and redis.call('ZCARD', KEYS[2]) >= tonumber(ARGV[2]) then
+	return 2
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIREAT', KEYS[1], ARGV[4])
+redis.call('ZADD', KEYS[2], ARGV[5], ARGV[6])
+return 0
+`)
+
+// The `consumeQuota` function counts a new link against the quotas of the API key it was created with.
+// If a quota is used up, nothing is counted and a 429 error is returned.
+func consumeQuota(ctx context.Context, rdb *redis.Client, urlEntry URL, key *APIKey) error {
+	if key == nil {
+		return nil
+	}
+	perDay, active := keyQuotas(key)
+	now := time.Now()
+	exceeded, err := consumeQuotaScript.Run(ctx, rdb,
+		[]string{dailyUsageKey(key.ID, now), activeLinksKey(key.ID)},
+		perDay, active, now.Unix(), dayWindow.end(now).Add(24*time.Hour).Unix(), urlEntry.expiry().Unix(), urlEntry.key(),
+	).Int()
+	if err != nil {
+		return newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+	}
+	switch exceeded {
+	case 1:
+		return newAPIError(http.StatusTooManyRequests, "Daily quota of "+strconv.Itoa(perDay)+" new links reached")
+	case 2:
+		return newAPIError(http.StatusTooManyRequests, "Quota of "+strconv.Itoa(active)+" active links reached")
+	}
+	return nil
+}
+
+// The function stops counting a link that was removed before its expiry against its owner's quota.
+func releaseQuota(ctx context.Context, rdb redis.Cmdable, urlEntry URL) {
+	if urlEntry.CreatorAPIKey != "" {
+		rdb.ZRem(ctx, activeLinksKey(urlEntry.CreatorAPIKey), urlEntry.key())
+	}
+}
+
+// Usage is the quota report of an API key. Limits of 0 mean no limit.
+type Usage struct {
+	KeyID             string `json:"key_id"`
+	LinksCreatedToday int64  `json:"links_created_today"`
+	LinksPerDay       int    `json:"links_per_day"`
+	ActiveLinks       int64  `json:"active_links"`
+	MaxActiveLinks    int    `json:"max_active_links"`
+	// When the daily count starts over
+	ResetsAt string `json:"resets_at"`
+}
+
+// The `usageHandler` function reports the usage and quotas of the requesting API key. The admin key can
+// ask for the usage of any key with `key_id`, e.g. for billing.
+func usageHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	key := apiKey
+	if keyID := c.Query("key_id"); keyID != "" && apiKey.ID == adminAPIKey.ID {
+		key = &APIKey{ID: keyID}
+		secret, err := rdb.Get(opCtx, apiKeyIDKey(keyID)).Result()
+		var val string
+		if err == nil {
+			val, err = rdb.Get(opCtx, apiKeyRedisKey(secret)).Result()
+		}
+		if err != nil && err != redis.Nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return
+		}
+		// Owners without a key record, such as bearer token subjects, have the default quotas
+		json.Unmarshal([]byte(val), key)
+	}
+
+	now := time.Now()
+	var created *redis.StringCmd
+	var active *redis.IntCmd
+	_, err := rdb.Pipelined(opCtx, func(pipe redis.Pipeliner) error {
+		created = pipe.Get(opCtx, dailyUsageKey(key.ID, now))
+		active = pipe.ZCount(opCtx, activeLinksKey(key.ID), "("+strconv.FormatInt(now.Unix(), 10), "+inf")
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	usage := Usage{KeyID: key.ID, ActiveLinks: active.Val(), ResetsAt: dayWindow.end(now).Format(time.RFC3339)}
+	usage.LinksCreatedToday, _ = created.Int64()
+	usage.LinksPerDay, usage.MaxActiveLinks = keyQuotas(key)
+	c.JSON(http.StatusOK, usage)
+}
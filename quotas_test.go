@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotas(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.QuotaLinksPerDay = 3
+	config.QuotaActiveLinks = 2
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=tenant", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	tenant := map[string]string{apiKeyHeader: key.Key}
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/1", tenant)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/2&max_access=1", tenant)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/3", tenant)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "2 active links")
+
+	// A link that is used up no longer counts as active, but still counts for the day
+	for i := 0; i < 3; i++ {
+		performRequest(router, "GET", "/"+created["token"], "", nil)
+		time.Sleep(50 * time.Millisecond)
+	}
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/3", tenant)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	w = performRequest(router, "DELETE", "/api/urls/"+created["token"], "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/4", tenant)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "3 new links")
+
+	var usage Usage
+	w = performRequest(router, "GET", "/api/usage", "", tenant)
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	assert.Equal(t, Usage{KeyID: key.ID, LinksCreatedToday: 3, LinksPerDay: 3, ActiveLinks: 1, MaxActiveLinks: 2, ResetsAt: usage.ResetsAt}, usage)
+
+	w = performRequest(router, "GET", "/api/usage?key_id="+key.ID, "", admin)
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	assert.Equal(t, key.ID, usage.KeyID)
+	assert.Equal(t, int64(3), usage.LinksCreatedToday)
+
+	// Only the admin key can look at other keys
+	w = performRequest(router, "GET", "/api/usage?key_id=admin", "", tenant)
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	assert.Equal(t, key.ID, usage.KeyID)
+
+	// Quotas set on a key override the defaults, anonymous links aren't limited
+	w = performRequest(router, "POST", "/api/admin/keys", "name=unlimited&max_links_per_day=-1&max_active_links=-1", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	for i := 0; i < 4; i++ {
+		w = performRequest(router, "POST", "/create", "long_url=https://example.com", map[string]string{apiKeyHeader: key.Key})
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w = performRequest(router, "POST", "/api/admin/keys", "name=broken&max_active_links=-5", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
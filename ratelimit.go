@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// accessWindow is a calendar period (in UTC) access limits can be set for.
+type accessWindow struct {
+	name   string
+	layout string
+	next   func(start time.Time) time.Time
+}
+
+var (
+	hourWindow  = accessWindow{"hour", "2006010215", func(t time.Time) time.Time { return t.Add(time.Hour) }}
+	dayWindow   = accessWindow{"day", "20060102", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }}
+	monthWindow = accessWindow{"month", "200601", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }}
+)
+
+// Access limits per window are counted in Redis keys of their own, one per link and window, rather
+// than in the link record. The keys are updated atomically, so concurrent redirects can't lose counts,
+// and they expire on their own once their window is over.
+func (w accessWindow) key(key string, now time.Time) string {
+	return "rate:" + key + ":" + now.UTC().Format(w.layout)
+}
+
+// The function returns the time the window containing now ends.
+func (w accessWindow) end(now time.Time) time.Time {
+	start, _ := time.Parse(w.layout, now.UTC().Format(w.layout))
+	return w.next(start)
+}
+
+// accessLimit is the maximum number of accesses of a link within a window.
+type accessLimit struct {
+	window accessWindow
+	max    int
+}
+
+// The function lists the window limits set on a link.
+func accessLimits(urlEntry URL) []accessLimit {
+	var limits []accessLimit
+	for _, limit := range []accessLimit{
+		{hourWindow, urlEntry.MaxPerHour},
+		{dayWindow, urlEntry.MaxPerDay},
+		{monthWindow, urlEntry.MaxPerMonth},
+	} {
+		if limit.max != -1 {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+// Checks every counter first and only then increments them all, so an access refused by one window
+// doesn't use up the allowance of the others. Returns the 1-based index of the exhausted counter, or 0.
+var consumeAccessScript = redis.NewScript(`
+for i, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') >= tonumber(ARGV[i]) then
+		return i
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call('INCR', key)
+	redis.call('EXPIREAT', key, ARGV[#KEYS + i])
+end
+return 0
+`)
+
+// The `consumeAccess` function counts an access against the window limits of a link and returns the
+// keys of the windows it was counted in. If a limit is reached, nothing is counted and the window of
+// that limit is returned.
+func consumeAccess(ctx context.Context, rdb *redis.Client, key string, limits []accessLimit) (*accessWindow, []string, error) {
+	if len(limits) == 0 {
+		return nil, nil, nil
+	}
+
+	now := time.Now()
+	keys := make([]string, len(limits))
+	args := make([]interface{}, 2*len(limits))
+	for i, limit := range limits {
+		keys[i] = limit.window.key(key, now)
+		args[i] = limit.max
+		// Kept a minute past the window so clock skew between instances can't reset it early
+		args[len(limits)+i] = strconv.FormatInt(limit.window.end(now).Add(time.Minute).Unix(), 10)
+	}
+
+	exhausted, err := consumeAccessScript.Run(ctx, rdb, keys, args...).Int()
+	if err != nil {
+		return nil, nil, err
+	}
+	if exhausted == 0 {
+		return nil, keys, nil
+	}
+	return &limits[exhausted-1].window, nil, nil
+}
+
+// Takes back an access counted in windows that haven't expired since.
+var refundAccessScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
+
+// The `refundAccess` function takes back an access counted against the window limits of a link, for
+// a redirect that was refused afterwards. counted are the keys consumeAccess returned, so the access
+// is taken back from the windows it was counted in even if one of them has ended since.
+func refundAccess(ctx context.Context, rdb *redis.Client, counted []string) error {
+	if len(counted) == 0 {
+		return nil
+	}
+	return refundAccessScript.Run(ctx, rdb, counted).Err()
+}
+
+// The `respondWindowLimit` function answers a redirect refused by a window limit of a link. With the
+// default WINDOW_LIMIT_STATUS of 429, Retry-After tells clients when the window ends; the body has
+// the time as `resets_at`.
+func respondWindowLimit(c *gin.Context, rdb *redis.Client, window accessWindow, urlEntry URL) {
+	now := time.Now()
+	resetsAt := window.end(now)
+	if config.WindowLimitStatus == http.StatusTooManyRequests {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(resetsAt.Sub(now).Seconds())), 10))
+	}
+	body := gin.H{"message": "Max access per " + window.name + " reached", "resets_at": resetsAt.Format(time.RFC3339)}
+	respondLinkErrorDetails(c, rdb, config.WindowLimitStatus, pageRateLimited, body, linkPageData(urlEntry))
+}
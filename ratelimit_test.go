@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessWindows(t *testing.T) {
+	at := time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)
+	assert.Equal(t, "rate:abc:2024123123", hourWindow.key("abc", at))
+	assert.Equal(t, "rate:abc:2025010100", hourWindow.key("abc", at.Add(time.Second)))
+	assert.Equal(t, "rate:abc:20241231", dayWindow.key("abc", at))
+	assert.Equal(t, "rate:abc:202412", monthWindow.key("abc", at))
+	assert.Equal(t, "rate:go.acme.com/abc:2024123123", hourWindow.key(linkKey("go.acme.com", "abc"), at))
+
+	newYear := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, newYear, hourWindow.end(at))
+	assert.Equal(t, newYear, dayWindow.end(at))
+	assert.Equal(t, newYear, monthWindow.end(at))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), monthWindow.end(time.Date(2024, 2, 10, 8, 0, 0, 0, time.UTC)))
+}
+
+func TestRespondWindowLimit(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+	gin.SetMode(gin.TestMode)
+
+	respond := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/abc", nil)
+		respondWindowLimit(c, nil, dayWindow, URL{Token: "abc"})
+		return w
+	}
+
+	w := respond()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.True(t, retryAfter > 0 && retryAfter <= 86400, retryAfter)
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "Max access per day reached", body["message"])
+	assert.Equal(t, dayWindow.end(time.Now()).Format(time.RFC3339), body["resets_at"])
+
+	// Clients expecting the status of older versions
+	config.WindowLimitStatus = http.StatusBadRequest
+	w = respond()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
+
+func TestMaxPerHourConcurrent(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_per_hour=3", nil)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+
+	// Concurrent redirects used to read the same count from the link record and all get through
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	redirected := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := performRequest(router, "GET", "/"+token, "", nil)
+			if w.Code == http.StatusTemporaryRedirect {
+				mu.Lock()
+				redirected++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, redirected)
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, hourWindow.end(time.Now()), time.Now().Add(time.Duration(retryAfter)*time.Second), time.Second)
+
+	ttl := rdb.TTL(testCtx, hourWindow.key(token, time.Now())).Val()
+	assert.True(t, ttl > 0 && ttl <= time.Hour+time.Minute, ttl)
+}
+
+func TestMaxPerDayAndMonth(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_per_hour=3&max_per_day=2&max_per_month=10", nil)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+
+	for i := 0; i < 2; i++ {
+		w = performRequest(router, "GET", "/"+token, "", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "Max access per day reached")
+	assert.Contains(t, w.Body.String(), dayWindow.end(time.Now()).Format(time.RFC3339))
+
+	// Refused accesses don't count against the other windows
+	now := time.Now()
+	assert.Equal(t, "2", rdb.Get(testCtx, hourWindow.key(token, now)).Val())
+	assert.Equal(t, "2", rdb.Get(testCtx, monthWindow.key(token, now)).Val())
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_per_month=1", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	performRequest(router, "GET", "/"+response["token"], "", nil)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Contains(t, w.Body.String(), "Max access per month reached")
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_per_day=abc", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Links stored before the daily and monthly limits existed have no such limits
+	legacy := `{"token":"legacy01","long_url":"https://example.com","max_access":-1,"max_per_hour":-1,"age_duration":60000000000}`
+	rdb.Set(testCtx, "legacy01", legacy, time.Minute)
+	w = performRequest(router, "GET", "/legacy01", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+}
@@ -0,0 +1,40 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// Platforms whose edge sets a header with the client IP, by the name TRUSTED_PLATFORM takes
+var trustedPlatforms = map[string]string{
+	"cloudflare": gin.PlatformCloudflare,
+	"appengine":  gin.PlatformGoogleAppEngine,
+	"flyio":      gin.PlatformFlyIO,
+}
+
+// The `configureClientIP` function sets up how the engine determines the client IP of a request,
+// which rate limits, exemptions, creator IPs and analytics all use. Forwarding headers are only
+// believed when the request comes from a trusted proxy, and then read right to left up to the first
+// address that isn't a trusted proxy itself, so clients can't spoof their IP by sending the headers.
+// Without trusted proxies, the address of the connection is used. A trusted platform's header is
+// believed on every request, so it must only be configured when the service can't be reached around
+// the platform.
+func configureClientIP(r *gin.Engine) error {
+	r.ForwardedByClientIP = len(config.TrustedProxies) > 0
+	r.RemoteIPHeaders = config.RealIPHeaders
+	if header, ok := trustedPlatforms[config.TrustedPlatform]; ok {
+		r.TrustedPlatform = header
+	} else {
+		r.TrustedPlatform = config.TrustedPlatform
+	}
+
+	proxies := make([]string, 0, len(config.TrustedProxies))
+	for _, proxy := range config.TrustedProxies {
+		network, err := parseCIDR(proxy)
+		if err != nil {
+			return err
+		}
+		proxies = append(proxies, network.String())
+	}
+	if len(proxies) == 0 {
+		return r.SetTrustedProxies(nil)
+	}
+	return r.SetTrustedProxies(proxies)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+	gin.SetMode(gin.TestMode)
+
+	clientIP := func(remoteAddr string, headers map[string]string) string {
+		router := gin.New()
+		assert.NoError(t, configureClientIP(router))
+		router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		req, _ := http.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	forwarded := map[string]string{"X-Forwarded-For": "198.51.100.9, 10.0.0.2"}
+
+	// Without trusted proxies the headers are ignored, clients could spoof them
+	config.TrustedProxies = nil
+	assert.Equal(t, "203.0.113.5", clientIP("203.0.113.5:4000", forwarded))
+
+	config.TrustedProxies = []string{"10.0.0.0/8"}
+	assert.Equal(t, "198.51.100.9", clientIP("10.0.0.1:4000", forwarded))
+	assert.Equal(t, "203.0.113.5", clientIP("203.0.113.5:4000", forwarded))
+	assert.Equal(t, "198.51.100.7", clientIP("10.0.0.1:4000", map[string]string{"X-Real-IP": "198.51.100.7"}))
+
+	config.TrustedProxies = nil
+	config.TrustedPlatform = "cloudflare"
+	assert.Equal(t, "198.51.100.3", clientIP("203.0.113.5:4000", map[string]string{"CF-Connecting-IP": "198.51.100.3"}))
+
+	config.TrustedProxies = []string{"not an address"}
+	assert.Error(t, configureClientIP(gin.New()))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// At most this many domains can be allowed to refer to a link
+const maxAllowedReferrers = 20
+
+var referrerDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+var errInvalidReferrers = errors.New("allowed_referrers must be up to 20 comma-separated domains")
+
+// The `parseAllowedReferrers` function parses the comma-separated domains a link may be followed
+// from. A leading "www." is dropped, as every subdomain of an allowed domain is allowed too.
+func parseAllowedReferrers(raw string) ([]string, error) {
+	var domains []string
+	seen := map[string]bool{}
+	for _, domain := range strings.Split(raw, ",") {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		if domain == "" || seen[domain] {
+			continue
+		}
+		if !referrerDomainPattern.MatchString(domain) {
+			return nil, errInvalidReferrers
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	if len(domains) > maxAllowedReferrers {
+		return nil, errInvalidReferrers
+	}
+	return domains, nil
+}
+
+// The `referrerAllowed` function reports whether a request may follow a link restricted to some
+// referring domains: its Referer must be on one of them or their subdomains. Requests without a
+// Referer are refused, as the restriction would be trivial to bypass otherwise.
+func referrerAllowed(c *gin.Context, urlEntry URL) bool {
+	if len(urlEntry.AllowedReferrers) == 0 {
+		return true
+	}
+	referrer, err := url.Parse(c.Request.Referer())
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(referrer.Hostname())
+	for _, domain := range urlEntry.AllowedReferrers {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
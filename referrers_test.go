@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAllowedReferrers(t *testing.T) {
+	domains, err := parseAllowedReferrers(" Example.com, www.blog.example.org,example.com,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "blog.example.org"}, domains)
+
+	domains, err = parseAllowedReferrers("")
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+
+	_, err = parseAllowedReferrers("https://example.com/")
+	assert.Error(t, err)
+}
+
+func TestReferrerRestriction(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/download&allowed_referrers=example.com", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+
+	for referrer, status := range map[string]int{
+		"https://example.com/downloads":     http.StatusTemporaryRedirect,
+		"https://www.example.com/":          http.StatusTemporaryRedirect,
+		"https://scraper.example.net/":      http.StatusForbidden,
+		"https://notexample.com/":           http.StatusForbidden,
+		"https://example.com.evil.example/": http.StatusForbidden,
+		"":                                  http.StatusForbidden,
+	} {
+		headers := map[string]string{}
+		if referrer != "" {
+			headers["Referer"] = referrer
+		}
+		w = performRequest(router, "GET", "/"+token, "", headers)
+		assert.Equal(t, status, w.Code, referrer)
+	}
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&allowed_referrers=not+a+domain", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Reads served by replicas, and reads that went to the primary because a replica failed or didn't
+// have the key (yet), published at /debug/vars
+var replicaStats = expvar.NewMap("replicas")
+
+// Read replicas by the client of their primary, the home Redis and those of the regions. Replicas
+// only serve link lookups; everything else, counters included, goes to the primary.
+var (
+	replicaClients map[*redis.Client][]*redis.Client
+	replicaTurn    atomic.Uint64
+)
+
+// The function connects to the read replicas of the home Redis and of every region. Replicas share the
+// password, database and pool settings of their primary.
+func openReplicas(home *redis.Client) {
+	replicaClients = map[*redis.Client][]*redis.Client{}
+	connect := func(primary *redis.Client, addrs []string) {
+		for _, addr := range addrs {
+			options := *primary.Options()
+			options.Addr = addr
+			replicaClients[primary] = append(replicaClients[primary], redis.NewClient(&options))
+		}
+	}
+	connect(home, config.RedisReplicaAddrs)
+	for name, region := range config.Regions {
+		connect(regionClients[name], region.ReplicaAddrs)
+	}
+}
+
+// The function returns the replica the next read of a primary goes to, taking turns, or nil when the
+// primary has no replicas.
+func replicaFor(rdb *redis.Client) *redis.Client {
+	replicas := replicaClients[rdb]
+	if len(replicas) == 0 {
+		return nil
+	}
+	return replicas[replicaTurn.Add(1)%uint64(len(replicas))]
+}
+
+// The `loadReplicatedLink` function is loadLink reading from a replica. A link the replica doesn't
+// have is looked up on the primary: it may have been created a moment ago and not be replicated yet,
+// or be in cold storage, which only the primary can move it back from.
+func loadReplicatedLink(ctx context.Context, rdb *redis.Client, key string) (string, error) {
+	replica := replicaFor(rdb)
+	if replica == nil {
+		return loadLink(ctx, rdb, key)
+	}
+	val, err := replica.Get(ctx, key).Result()
+	if err != nil {
+		replicaStats.Add("primary_reads", 1)
+		return loadLink(ctx, rdb, key)
+	}
+	replicaStats.Add("replica_reads", 1)
+	return val, nil
+}
+
+// The `mgetReplicated` function is MGET reading from a replica, with the keys the replica doesn't have
+// read from the primary.
+func mgetReplicated(ctx context.Context, rdb *redis.Client, keys []string) ([]interface{}, error) {
+	replica := replicaFor(rdb)
+	if replica == nil {
+		return rdb.MGet(ctx, keys...).Result()
+	}
+	values, err := replica.MGet(ctx, keys...).Result()
+	if err != nil {
+		replicaStats.Add("primary_reads", 1)
+		return rdb.MGet(ctx, keys...).Result()
+	}
+	replicaStats.Add("replica_reads", 1)
+
+	var missing []string
+	var positions []int
+	for i, value := range values {
+		if value == nil {
+			missing = append(missing, keys[i])
+			positions = append(positions, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	replicaStats.Add("primary_reads", 1)
+	found, err := rdb.MGet(ctx, missing...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range positions {
+		values[i] = found[j]
+	}
+	return values, nil
+}
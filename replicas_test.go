@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaFor(t *testing.T) {
+	previous := replicaClients
+	defer func() { replicaClients = previous }()
+
+	primary := redis.NewClient(&redis.Options{Addr: "primary:6379"})
+	first := redis.NewClient(&redis.Options{Addr: "replica-1:6379"})
+	second := redis.NewClient(&redis.Options{Addr: "replica-2:6379"})
+	replicaClients = map[*redis.Client][]*redis.Client{primary: {first, second}}
+
+	seen := map[*redis.Client]bool{replicaFor(primary): true, replicaFor(primary): true}
+	assert.Equal(t, map[*redis.Client]bool{first: true, second: true}, seen)
+	assert.Nil(t, replicaFor(first))
+}
+
+func TestReplicatedReads(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+	// Another database of the test server stands in for the replica
+	replica := redis.NewClient(&redis.Options{Addr: redisAddr, Password: redisPassword, DB: redisDB + 1})
+	defer replica.Close()
+	replica.FlushDB(testCtx)
+
+	previous := replicaClients
+	replicaClients = map[*redis.Client][]*redis.Client{rdb: {replica}}
+	defer func() { replicaClients = previous }()
+
+	replica.Set(testCtx, "replicated", "from replica", time.Minute)
+	rdb.Set(testCtx, "replicated", "from primary", time.Minute)
+	rdb.Set(testCtx, "fresh", "not replicated yet", time.Minute)
+
+	val, err := loadReplicatedLink(testCtx, rdb, "replicated")
+	assert.NoError(t, err)
+	assert.Equal(t, "from replica", val)
+	val, err = loadReplicatedLink(testCtx, rdb, "fresh")
+	assert.NoError(t, err)
+	assert.Equal(t, "not replicated yet", val)
+	_, err = loadReplicatedLink(testCtx, rdb, "unknown")
+	assert.Equal(t, redis.Nil, err)
+
+	values, err := mgetReplicated(testCtx, rdb, []string{"replicated", "fresh", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"from replica", "not replicated yet", nil}, values)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Headers of signed requests. The secret itself is never sent, so an intercepted request neither
+// reveals it nor can be changed or sent again.
+const (
+	keyIDHeader     = "X-API-Key-ID"
+	timestampHeader = "X-Timestamp"
+	nonceHeader     = "X-Nonce"
+	signatureHeader = "X-Signature"
+)
+
+// The function returns the key of the index from an API key's public ID to its secret, which signed
+// requests are verified with.
+func apiKeyIDKey(id string) string {
+	return "apikey:id:" + id
+}
+
+func nonceKey(keyID, nonce string) string {
+	return "nonce:" + keyID + ":" + nonce
+}
+
+// The `requestSignature` function computes the signature of a request: the hex HMAC-SHA256, keyed with
+// the API key secret, of the timestamp, nonce, method, path and body, separated by newlines.
+func requestSignature(secret, timestamp, nonce, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// The `authenticateSigned` function resolves the API key of a signed request. The timestamp must be
+// within the tolerance of the server's clock and every nonce is only accepted once within it, so a
+// captured request can't be replayed to mint more links.
+func authenticateSigned(c *gin.Context, rdb *redis.Client) (*APIKey, bool) {
+	keyID := c.GetHeader(keyIDHeader)
+	timestamp := c.GetHeader(timestampHeader)
+	nonce := c.GetHeader(nonceHeader)
+	if timestamp == "" || nonce == "" || len(nonce) > 64 || c.GetHeader(signatureHeader) == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Signed requests need the " + timestampHeader + ", " + nonceHeader + " and " + signatureHeader + " headers"})
+		return nil, false
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)).Abs() > config.RequestSignatureTolerance {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Request timestamp is missing or too far from the server's clock"})
+		return nil, false
+	}
+
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	secret, err := rdb.Get(opCtx, apiKeyIDKey(keyID)).Result()
+	var val string
+	if err == nil {
+		val, err = rdb.Get(opCtx, apiKeyRedisKey(secret)).Result()
+	}
+	if err == redis.Nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid API key"})
+		return nil, false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return nil, false
+	}
+
+	// The body is read for the signature and put back for the handler
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Error reading the request body"})
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	expected := requestSignature(secret, timestamp, nonce, c.Request.Method, c.Request.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(c.GetHeader(signatureHeader))) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid request signature"})
+		return nil, false
+	}
+
+	// The nonce is remembered for as long as its timestamp is accepted, on either side of the clock
+	fresh, err := rdb.SetNX(opCtx, nonceKey(keyID, nonce), 1, 2*config.RequestSignatureTolerance).Result()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return nil, false
+	}
+	if !fresh {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Replayed request"})
+		return nil, false
+	}
+
+	var key APIKey
+	if err := json.Unmarshal([]byte(val), &key); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Error parsing JSON"})
+		return nil, false
+	}
+	key.secret = secret
+	return &key, true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedRequests(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.RequestSignatureTolerance = 5 * time.Minute
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var key struct {
+		ID         string `json:"id"`
+		Key        string `json:"key"`
+		SignedOnly bool   `json:"signed_only"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=extension&signed_only=true", admin)
+	json.Unmarshal(w.Body.Bytes(), &key)
+	assert.True(t, key.SignedOnly)
+
+	signed := func(body, nonce string, at time.Time) map[string]string {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		return map[string]string{
+			keyIDHeader:     key.ID,
+			timestampHeader: timestamp,
+			nonceHeader:     nonce,
+			signatureHeader: requestSignature(key.Key, timestamp, nonce, "POST", "/create", []byte(body)),
+		}
+	}
+
+	body := "long_url=https://example.com"
+	headers := signed(body, "n1", time.Now())
+	w = performRequest(router, "POST", "/create", body, headers)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Sending the same request again is refused
+	w = performRequest(router, "POST", "/create", body, headers)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Replayed")
+
+	// So is a request whose body was changed, or that is too old
+	tampered := signed(body, "n2", time.Now())
+	w = performRequest(router, "POST", "/create", "long_url=https://evil.example", tampered)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performRequest(router, "POST", "/create", body, signed(body, "n3", time.Now().Add(-10*time.Minute)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The key of a semi-trusted client can't be used directly
+	w = performRequest(router, "POST", "/create", body, map[string]string{apiKeyHeader: key.Key})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
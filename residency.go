@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// RegionConfig holds the Redis backend of a data residency region.
+type RegionConfig struct {
+	RedisAddr     string `json:"redis_addr"`
+	RedisPassword string `json:"redis_password"`
+	RedisDB       int    `json:"redis_db"`
+	// Read replicas of the region's Redis, e.g. ["redis-replica.eu.internal:6379"]
+	ReplicaAddrs []string `json:"replica_addrs"`
+}
+
+// Workspaces can be pinned to a region, so their links, analytics, campaigns and branding are only
+// stored in that region's Redis. The home Redis keeps the API keys and a directory mapping every link
+// to its region, which the residency middleware consults to route requests. Both are nil/empty when no
+// regions are configured.
+var (
+	regionClients map[string]*redis.Client
+	residencyHome *redis.Client
+)
+
+// The function connects to the Redis of every configured region. Region clients share the pool and
+// timeout settings of the home client.
+func openRegions(home *redis.Client) {
+	if len(config.Regions) == 0 {
+		return
+	}
+	regionClients = map[string]*redis.Client{}
+	for name, region := range config.Regions {
+		options := redisOptions()
+		options.Addr = region.RedisAddr
+		options.Password = region.RedisPassword
+		options.DB = region.RedisDB
+		regionClients[name] = redis.NewClient(options)
+	}
+	residencyHome = home
+}
+
+type regionContextKey struct{}
+
+// The functions store and retrieve the region a request was routed to. Requests of workspaces that
+// aren't pinned to a region have none.
+func withRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionContextKey{}, region)
+}
+
+func contextRegion(ctx context.Context) string {
+	region, _ := ctx.Value(regionContextKey{}).(string)
+	return region
+}
+
+// The `regionalClient` function returns the Redis a request was routed to, rdb unless the request
+// belongs to a region.
+func regionalClient(c *gin.Context, rdb *redis.Client) *redis.Client {
+	if client, ok := regionClients[contextRegion(c.Request.Context())]; ok {
+		return client
+	}
+	return rdb
+}
+
+// The function returns the home Redis, which is rdb when no regions are configured.
+func homeClient(rdb *redis.Client) *redis.Client {
+	if residencyHome != nil {
+		return residencyHome
+	}
+	return rdb
+}
+
+// Region of the link stored under a key, "" for the home region
+func residencyKey(key string) string {
+	return "residency:" + key
+}
+
+// The `claimToken` function records the region of a new link in the directory unless its key is
+// taken in any region, reporting whether it was claimed. The entry outlives the link by the tombstone
+// TTL, so requests for an expired link still reach its region.
+func claimToken(ctx context.Context, urlEntry URL) (bool, error) {
+	if residencyHome == nil {
+		return true, nil
+	}
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	return residencyHome.SetNX(opCtx, residencyKey(urlEntry.key()), urlEntry.Region, urlEntry.ttl()+config.TombstoneTTL).Result()
+}
+
+// The function returns the region of the link stored under a key from the directory.
+func tokenRegion(ctx context.Context, key string) (string, error) {
+	if residencyHome == nil {
+		return "", nil
+	}
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	return residencyHome.Get(opCtx, residencyKey(key)).Result()
+}
+
+// The function releases a claim of claimToken when the link couldn't be stored after all.
+func releaseToken(ctx context.Context, urlEntry URL) {
+	if residencyHome == nil {
+		return
+	}
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	residencyHome.Del(opCtx, residencyKey(urlEntry.key()))
+}
+
+// The `routeResidency` middleware decides which region a request is served from: the region of the
+// link for routes with a token, the region of the API key's workspace otherwise. The admin key may pick
+// a region with the `region` query parameter. Requests of workspaces without a region stay home.
+func routeResidency(rdb *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(regionClients) == 0 {
+			c.Next()
+			return
+		}
+		region, ok := requestRegion(c, rdb)
+		if !ok {
+			return
+		}
+		if _, known := regionClients[region]; region != "" && !known {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "The region of this workspace is not available."})
+			return
+		}
+		c.Request = c.Request.WithContext(withRegion(c.Request.Context(), region))
+		c.Next()
+	}
+}
+
+func requestRegion(c *gin.Context, rdb *redis.Client) (string, bool) {
+	if token := requestToken(c); token != "" {
+		opCtx, cancel := readContext(c.Request.Context())
+		region, err := rdb.Get(opCtx, residencyKey(linkKey(requestDomain(c), token))).Result()
+		cancel()
+		if err == nil {
+			return region, true
+		}
+		if err != redis.Nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+			return "", false
+		}
+	}
+
+	if isAdminKey(c.GetHeader(apiKeyHeader)) {
+		region := c.Query("region")
+		if _, ok := regionClients[region]; region != "" && !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid region parameter"})
+			return "", false
+		}
+		return region, true
+	}
+
+	// API keys live in the home Redis. The key is kept for the handlers, which can't look it up in the
+	// region they are served from.
+	key, ok := authenticate(c, rdb)
+	if !ok || key == nil {
+		return "", ok
+	}
+	c.Set(apiKeyContextKey, key)
+	return key.Region, true
+}
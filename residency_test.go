@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupMiddlewareWithRegions(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	config.Compression = true
+	config.Regions = map[string]RegionConfig{"eu": {RedisAddr: "redis.eu.internal:6379"}}
+	assert.Equal(t, []string{"logger", "recovery"}, groupMiddleware(groupGlobal))
+	assert.Equal(t, []string{"residency", "compression"}, groupMiddleware(groupPublic))
+	assert.NoError(t, validateMiddleware())
+
+	config.MiddlewareAPI = []string{"metrics"}
+	assert.EqualError(t, validateMiddleware(), "the api group needs the residency middleware when regions are configured")
+}
+
+func TestDataResidency(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+	eu := redis.NewClient(&redis.Options{Addr: redisAddr, Password: redisPassword, DB: 1})
+	eu.FlushDB(testCtx)
+	defer eu.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.Regions = map[string]RegionConfig{"eu": {RedisAddr: redisAddr, RedisDB: 1}}
+	regionClients, residencyHome = map[string]*redis.Client{"eu": eu}, rdb
+	defer func() {
+		config = previous
+		regionClients, residencyHome = nil, nil
+	}()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/api/admin/keys", "name=acme-eu&region=eu", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var key map[string]any
+	json.Unmarshal(w.Body.Bytes(), &key)
+	assert.Equal(t, "eu", key["region"])
+	secret := key["key"].(string)
+
+	w = performRequest(router, "POST", "/api/admin/keys", "name=acme&region=mars", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Links of the pinned workspace are only stored in its region, the home Redis knows where they are
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/eu", map[string]string{apiKeyHeader: secret})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, token).Val())
+	assert.Equal(t, int64(1), eu.Exists(testCtx, token).Val())
+	assert.Equal(t, "eu", rdb.Get(testCtx, residencyKey(token)).Val())
+
+	// Anonymous visitors are routed to the link's region
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/eu", w.Header().Get("Location"))
+
+	// The workspace's own listing is served from its region
+	w = performRequest(router, "GET", "/api/my/urls", "", map[string]string{apiKeyHeader: secret})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), token)
+
+	// Anonymous links stay home
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/home", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, created["token"]).Val())
+	assert.Equal(t, "", rdb.Get(testCtx, residencyKey(created["token"])).Val())
+
+	// The admin picks the region of listings
+	w = performRequest(router, "GET", "/api/urls?region=eu", "", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), token)
+	w = performRequest(router, "GET", "/api/urls?region=mars", "", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ResolveResult is the state of one link in a batch resolve answer.
+type ResolveResult struct {
+	Token string `json:"token"`
+	// "active", "not_found", "expired", "max_access_reached" or "closed"
+	Status     string `json:"status"`
+	LongURL    string `json:"long_url,omitempty"`
+	DisplayURL string `json:"display_url,omitempty"`
+	Flagged    bool   `json:"flagged,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	// When a link that is gone expired, see Tombstone
+	ExpiredAt string `json:"expired_at,omitempty"`
+}
+
+// Resolution is the answer of the redirect route to API clients asking for JSON: where the visitor
+// would have been redirected, with the link's metadata.
+type Resolution struct {
+	Token          string   `json:"token"`
+	Domain         string   `json:"domain,omitempty"`
+	Destination    string   `json:"destination"`
+	DisplayURL     string   `json:"display_url"`
+	RedirectStatus int      `json:"redirect_status"`
+	ClickID        string   `json:"click_id,omitempty"`
+	AccessCount    int      `json:"current_access_count"`
+	MaxAccess      int      `json:"max_access"`
+	CreatedAt      string   `json:"created_at"`
+	Tags           []string `json:"tags,omitempty"`
+	Flagged        bool     `json:"flagged,omitempty"`
+	FlagReason     string   `json:"flag_reason,omitempty"`
+	Frozen         bool     `json:"frozen,omitempty"`
+	ExpiresAt      string   `json:"expires_at"`
+}
+
+// The function reports whether the client of the redirect route asked for JSON (explicitly, browsers
+// and clients without an Accept header get the redirect) with an API key.
+func wantsResolution(c *gin.Context) bool {
+	return c.GetHeader(apiKeyHeader) != "" && c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+func newResolution(urlEntry URL, destination, clickID string) Resolution {
+	return Resolution{
+		Token:          urlEntry.Token,
+		Domain:         urlEntry.Domain,
+		Destination:    destination,
+		DisplayURL:     displayURL(destination),
+		RedirectStatus: domainSettings(urlEntry.Domain).RedirectStatus,
+		ClickID:        clickID,
+		AccessCount:    urlEntry.CurrentAccessCount,
+		MaxAccess:      urlEntry.MaxAccess,
+		CreatedAt:      urlEntry.CreatedAt,
+		Tags:           urlEntry.Tags,
+		Flagged:        urlEntry.Flagged,
+		FlagReason:     urlEntry.FlagReason,
+		Frozen:         urlEntry.Frozen,
+		ExpiresAt:      urlEntry.ExpiresAt,
+	}
+}
+
+// The function describes the state of a stored link, nil when it doesn't exist.
+func resolveResult(token string, urlEntry *URL) ResolveResult {
+	if urlEntry == nil {
+		return ResolveResult{Token: token, Status: "not_found"}
+	}
+	result := ResolveResult{
+		Token:      token,
+		Status:     "active",
+		LongURL:    urlEntry.LongURL,
+		DisplayURL: displayURL(urlEntry.LongURL),
+		Flagged:    urlEntry.Flagged,
+		ExpiresAt:  urlEntry.ExpiresAt,
+	}
+	switch {
+	case urlEntry.Disabled:
+		result.Status = "closed"
+	case urlEntry.MaxAccess != -1 && urlEntry.CurrentAccessCount >= urlEntry.MaxAccess:
+		result.Status = "max_access_reached"
+	}
+	return result
+}
+
+// The `resolveLinks` function looks up many links with a single MGET, on a replica if there are any.
+// Links missing from Redis are
+// looked up in cold storage, without moving them back, since resolving them isn't an access.
+func resolveLinks(ctx context.Context, rdb *redis.Client, domain string, tokens []string) ([]ResolveResult, error) {
+	// Malformed tokens aren't looked up, they could name other data than links
+	keys := make([]string, len(tokens))
+	for i, token := range tokens {
+		if !malformedToken(token) {
+			keys[i] = linkKey(domain, token)
+		}
+	}
+	values, err := mgetReplicated(ctx, rdb, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ResolveResult, len(tokens))
+	var missing []int
+	for i, value := range values {
+		if keys[i] == "" {
+			results[i] = resolveResult(tokens[i], nil)
+			continue
+		}
+		data, ok := value.(string)
+		if !ok && coldStore != nil {
+			if record, _, err := coldStore.Get(keys[i]); err == nil {
+				data, ok = string(record), true
+			}
+		}
+		var urlEntry URL
+		if !ok || json.Unmarshal([]byte(data), &urlEntry) != nil {
+			results[i] = resolveResult(tokens[i], nil)
+			missing = append(missing, i)
+			continue
+		}
+		results[i] = resolveResult(tokens[i], &urlEntry)
+	}
+
+	// Links that are gone may have left a tombstone telling that they expired
+	if len(missing) > 0 {
+		graves := make([]string, len(missing))
+		for j, i := range missing {
+			graves[j] = tombstoneKey(keys[i])
+		}
+		values, err := rdb.MGet(ctx, graves...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for j, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if tombstone := parseTombstone(data); tombstone != nil {
+				results[missing[j]].Status = "expired"
+				results[missing[j]].ExpiredAt = tombstone.ExpiredAt
+			}
+		}
+	}
+	return results, nil
+}
+
+// The `resolveBatchHandler` function returns the destination and status of many short URLs at once,
+// for tools validating lots of links. Resolving a link doesn't count as an access.
+func resolveBatchHandler(c *gin.Context, rdb *redis.Client) {
+	var request struct {
+		Tokens []string `json:"tokens"`
+		Domain string   `json:"domain"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Tokens) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": `Expected a JSON body like {"tokens": ["abc", "def"]}`})
+		return
+	}
+	if len(request.Tokens) > config.ResolveBatchMax {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("At most %d tokens can be resolved at once", config.ResolveBatchMax)})
+		return
+	}
+
+	domain := requestDomain(c)
+	if request.Domain != "" {
+		domain = strings.ToLower(request.Domain)
+		if _, ok := config.Domains[domain]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid domain parameter"})
+			return
+		}
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	results, err := resolveLinks(opCtx, rdb, domain, request.Tokens)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveBatch(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.ResolveBatchMax = 3
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var tokens []string
+	for _, form := range []string{"long_url=https://example.com/a", "long_url=https://example.com/b&max_access=1"} {
+		w := performRequest(router, "POST", "/create", form, nil)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		tokens = append(tokens, created["token"])
+	}
+	// Exhaust the second link
+	performRequest(router, "GET", "/"+tokens[1], "", nil)
+	time.Sleep(50 * time.Millisecond)
+
+	body := `{"tokens": ["` + tokens[0] + `", "missing1", "` + tokens[1] + `"]}`
+	w := performRequest(router, "POST", "/api/v1/resolve/batch", body, map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []ResolveResult `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	// Stored links report when they expire
+	for i := range response.Results {
+		if response.Results[i].Status != "not_found" {
+			assert.NotEmpty(t, response.Results[i].ExpiresAt)
+			response.Results[i].ExpiresAt = ""
+		}
+	}
+	assert.Equal(t, []ResolveResult{
+		{Token: tokens[0], Status: "active", LongURL: "https://example.com/a", DisplayURL: "https://example.com/a"},
+		{Token: "missing1", Status: "not_found"},
+		{Token: tokens[1], Status: "max_access_reached", LongURL: "https://example.com/b", DisplayURL: "https://example.com/b"},
+	}, response.Results)
+
+	// Resolving isn't an access
+	var urlEntry URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, tokens[0]).Val()), &urlEntry)
+	assert.Equal(t, 0, urlEntry.CurrentAccessCount)
+
+	tooMany := `{"tokens": ["a", "b", "c", "d"]}`
+	w = performRequest(router, "POST", "/api/v1/resolve/batch", tooMany, map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/resolve/batch", strings.Repeat("{", 3), map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRedirectResolutionForAPIClients(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/page&tags=docs", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Without an API key or an explicit Accept header clients are redirected
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+
+	apiClient := map[string]string{apiKeyHeader: "admin-secret", "Accept": "application/json"}
+	w = performRequest(router, "GET", "/"+token, "", apiClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resolution Resolution
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resolution))
+	assert.Equal(t, token, resolution.Token)
+	assert.Equal(t, "https://example.com/page", resolution.Destination)
+	assert.Equal(t, http.StatusTemporaryRedirect, resolution.RedirectStatus)
+	assert.Equal(t, 3, resolution.AccessCount)
+	assert.Equal(t, []string{"docs"}, resolution.Tags)
+	assert.Equal(t, w.Header().Get("X-Click-ID"), resolution.ClickID)
+
+	w = performRequest(router, "GET", "/"+token, "", map[string]string{apiKeyHeader: "wrong", "Accept": "application/json"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Errors stay JSON
+	w = performRequest(router, "GET", "/missing1", "", apiClient)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestResolveAlias(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=1", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// Exhaust the link, so it's deleted and leaves a tombstone
+	performRequest(router, "GET", "/"+token, "", nil)
+	time.Sleep(50 * time.Millisecond)
+	performRequest(router, "GET", "/"+token, "", nil)
+
+	body := `{"tokens": ["` + token + `", "missing1"]}`
+	w = performRequest(router, "POST", "/api/resolve", body, map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []ResolveResult `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response.Results, 2)
+	assert.Equal(t, "expired", response.Results[0].Status)
+	assert.NotEmpty(t, response.Results[0].ExpiredAt)
+	assert.Equal(t, ResolveResult{Token: "missing1", Status: "not_found"}, response.Results[1])
+}
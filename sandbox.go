@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Marks an instance seeded by the sandbox, with the seed it was seeded with
+const sandboxSeedKey = "sandbox:seed"
+
+// Fake data the sandbox draws from
+var (
+	sandboxDestinations = []string{
+		"https://example.com/blog/launch-announcement",
+		"https://shop.example.com/products/espresso-machine",
+		"https://docs.example.org/getting-started",
+		"https://www.example.net/pricing",
+		"https://news.example.com/2024/10/quarterly-results",
+		"https://example.com/careers/backend-engineer",
+		"https://events.example.org/conference/schedule",
+		"https://support.example.com/articles/reset-password",
+	}
+	sandboxTitles     = []string{"Launch post", "Spring sale", "Docs", "Pricing", "Results", "Hiring", "Conference", "Support", ""}
+	sandboxTags       = []string{"marketing", "launch", "social", "newsletter", "docs", "sale"}
+	sandboxCountries  = []string{"US", "US", "US", "DE", "GB", "FR", "IN", "BR", "JP", "CA", ""}
+	sandboxReferrers  = []string{"", "", "https://t.co/", "https://www.linkedin.com/", "https://news.ycombinator.com/", "https://mail.google.com/", "https://www.reddit.com/"}
+	sandboxUserAgents = []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0 Safari/537.36",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Safari/605.1.15",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+	}
+)
+
+// The sandbox API key owning the generated links, and the number of links it gets
+const (
+	sandboxKeyID = "key_sandbox"
+	sandboxLinks = 60
+)
+
+func pick[T any](rng *rand.Rand, items []T) T {
+	return items[rng.IntN(len(items))]
+}
+
+// The `seedSandbox` function fills an empty instance with generated links, campaigns, clicks and
+// analytics for frontend and SDK development. The same seed always generates the same API key,
+// tokens, destinations and clicks; only timestamps are relative to now. It returns the secret of the
+// sandbox API key. Instances with data of their own are refused, and an instance is seeded only once.
+func seedSandbox(ctx context.Context, rdb *redis.Client, seed uint64) (string, error) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	secretBytes := make([]byte, 24)
+	for i := range secretBytes {
+		secretBytes[i] = byte(rng.UintN(256))
+	}
+	secret := "sandbox_" + hex.EncodeToString(secretBytes)
+
+	seeded, err := rdb.Get(ctx, sandboxSeedKey).Result()
+	if err == nil {
+		if seeded != strconv.FormatUint(seed, 10) {
+			return "", fmt.Errorf("the instance was seeded with seed %s", seeded)
+		}
+		return secret, nil
+	}
+	if err != redis.Nil {
+		return "", err
+	}
+	size, err := rdb.DBSize(ctx).Result()
+	if err != nil {
+		return "", err
+	}
+	if size > 0 {
+		return "", errors.New("the Redis database isn't empty, the sandbox only seeds empty instances")
+	}
+
+	now := time.Now()
+	key := APIKey{ID: sandboxKeyID, Name: "sandbox", CreatedAt: now.AddDate(0, 0, -60).Format(time.RFC3339), Trusted: true}
+	keyData, _ := json.Marshal(key)
+	campaigns := []Campaign{
+		{ID: "cmp_sandbox_spring", Name: "Spring launch", Owner: sandboxKeyID, CreatedAt: now.AddDate(0, 0, -45).Format(time.RFC3339)},
+		{ID: "cmp_sandbox_newsletter", Name: "Newsletter", Owner: sandboxKeyID, CreatedAt: now.AddDate(0, 0, -30).Format(time.RFC3339)},
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sandboxSeedKey, strconv.FormatUint(seed, 10), 0)
+		pipe.Set(ctx, apiKeyRedisKey(secret), keyData, 0)
+		pipe.Set(ctx, apiKeyIDKey(key.ID), secret, 0)
+		for _, campaign := range campaigns {
+			data, _ := json.Marshal(campaign)
+			pipe.Set(ctx, campaignKey(campaign.ID), data, 0)
+			pipe.SAdd(ctx, ownerCampaignsKey(sandboxKeyID), campaign.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < sandboxLinks; i++ {
+		urlEntry := sandboxLink(rng, now)
+		// Some links are anonymous, the others belong to the sandbox key and some of its campaigns
+		if i%5 != 0 {
+			urlEntry.CreatorAPIKey = sandboxKeyID
+			urlEntry.CreatorTrusted = true
+			if rng.IntN(3) == 0 {
+				urlEntry.CampaignID = pick(rng, campaigns).ID
+			}
+		}
+		clicks := sandboxClicks(rng, urlEntry, now)
+		urlEntry.CurrentAccessCount = len(clicks)
+		if len(clicks) > 0 {
+			urlEntry.LastAccessedAt = clicks[len(clicks)-1].Timestamp
+		}
+
+		if _, err := importLink(ctx, rdb, urlEntry, false); err != nil {
+			return "", err
+		}
+		_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			countDestination(ctx, pipe, urlEntry, "links")
+			for _, click := range clicks {
+				countDestination(ctx, pipe, urlEntry, "clicks")
+				if urlEntry.CampaignID != "" {
+					pipe.Incr(ctx, campaignClicksKey(urlEntry.CampaignID))
+				}
+				if config.ClickLogMaxLen > 0 {
+					pipe.XAdd(ctx, &redis.XAddArgs{
+						Stream: clickLogKey(urlEntry.key()),
+						ID:     click.ID,
+						Values: map[string]interface{}{
+							"click_id":   click.ClickID,
+							"timestamp":  click.Timestamp,
+							"country":    click.Country,
+							"referrer":   click.Referrer,
+							"user_agent": click.UserAgent,
+						},
+					})
+				}
+			}
+			pipe.ExpireAt(ctx, clickLogKey(urlEntry.key()), urlEntry.expiry())
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return secret, nil
+}
+
+// The function generates the record of a link created within the last 30 days that is still active.
+func sandboxLink(rng *rand.Rand, now time.Time) URL {
+	token := make([]byte, 8)
+	for i := range token {
+		token[i] = charset[rng.IntN(len(charset))]
+	}
+	created := now.Add(-time.Duration(rng.Int64N(int64(30 * 24 * time.Hour)))).Truncate(time.Second)
+	expires := now.Add(time.Hour + time.Duration(rng.Int64N(int64(90*24*time.Hour)))).Truncate(time.Second)
+
+	urlEntry := URL{
+		Token:          string(token),
+		LongURL:        pick(rng, sandboxDestinations),
+		Title:          pick(rng, sandboxTitles),
+		MaxAccess:      -1,
+		MaxPerHour:     -1,
+		MaxPerDay:      -1,
+		MaxPerMonth:    -1,
+		CreatedAt:      created.Format(time.RFC3339),
+		LastAccessedAt: created.Format(time.RFC3339),
+		ExpiresAt:      expires.Format(time.RFC3339),
+		CreatorIP:      "203.0.113." + strconv.Itoa(1+rng.IntN(254)),
+	}
+	if rng.IntN(4) == 0 {
+		urlEntry.MaxAccess = 500 + rng.IntN(1000)
+	}
+	for _, tag := range sandboxTags {
+		if rng.IntN(4) == 0 {
+			urlEntry.Tags = append(urlEntry.Tags, tag)
+		}
+	}
+	return urlEntry
+}
+
+// The function generates the clicks of a link since its creation, oldest first. A few links are hot,
+// most get a handful of clicks.
+func sandboxClicks(rng *rand.Rand, urlEntry URL, now time.Time) []ClickEvent {
+	count := rng.IntN(20)
+	if rng.IntN(6) == 0 {
+		count = 100 + rng.IntN(300)
+	}
+	if urlEntry.MaxAccess != -1 {
+		count = min(count, urlEntry.MaxAccess)
+	}
+	created, _ := time.Parse(time.RFC3339, urlEntry.CreatedAt)
+	span := now.Sub(created)
+
+	times := make([]time.Time, count)
+	for i := range times {
+		times[i] = created.Add(time.Duration(rng.Int64N(int64(span) + 1)))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	clicks := make([]ClickEvent, count)
+	for i, t := range times {
+		clickID := make([]byte, 8)
+		for j := range clickID {
+			clickID[j] = byte(rng.UintN(256))
+		}
+		clicks[i] = ClickEvent{
+			// Stream IDs must grow, clicks in the same millisecond get a sequence number
+			ID:        strconv.FormatInt(t.UnixMilli(), 10) + "-" + strconv.Itoa(i),
+			ClickID:   hex.EncodeToString(clickID),
+			Timestamp: t.Format(time.RFC3339),
+			Country:   pick(rng, sandboxCountries),
+			Referrer:  pick(rng, sandboxReferrers),
+			UserAgent: pick(rng, sandboxUserAgents),
+		}
+	}
+	return clicks
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxDataIsDeterministic(t *testing.T) {
+	now := time.Now()
+	generate := func(seed uint64) (URL, []ClickEvent) {
+		rng := rand.New(rand.NewPCG(seed, seed))
+		urlEntry := sandboxLink(rng, now)
+		return urlEntry, sandboxClicks(rng, urlEntry, now)
+	}
+	first, firstClicks := generate(7)
+	second, secondClicks := generate(7)
+	assert.Equal(t, first, second)
+	assert.Equal(t, firstClicks, secondClicks)
+
+	other, _ := generate(8)
+	assert.NotEqual(t, first.Token, other.Token)
+
+	assert.True(t, first.ttl() > 0)
+	for i := 1; i < len(firstClicks); i++ {
+		assert.LessOrEqual(t, firstClicks[i-1].Timestamp, firstClicks[i].Timestamp)
+	}
+}
+
+func TestSeedSandbox(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	secret, err := seedSandbox(testCtx, rdb, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(sandboxLinks), rdb.SCard(testCtx, allURLsIndex).Val())
+
+	// Seeding again with the same seed is a no-op, another seed is refused
+	again, err := seedSandbox(testCtx, rdb, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, again)
+	assert.Equal(t, int64(sandboxLinks), rdb.SCard(testCtx, allURLsIndex).Val())
+	_, err = seedSandbox(testCtx, rdb, 2)
+	assert.Error(t, err)
+
+	// The generated links can be listed with the sandbox key
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	w := performRequest(router, "GET", "/api/my/urls?limit=100", "", map[string]string{apiKeyHeader: secret})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var listing struct {
+		URLs []OwnLink `json:"urls"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	assert.NotEmpty(t, listing.URLs)
+
+	// Instances with data of their own aren't seeded
+	rdb.FlushDB(testCtx)
+	rdb.Set(testCtx, "some-token", "{}", 0)
+	_, err = seedSandbox(testCtx, rdb, 1)
+	assert.Error(t, err)
+}
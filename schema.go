@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FormField describes one input of an API form: its type, constraints and the texts needed to render
+// an accessible label and hint for it.
+type FormField struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Label       string      `json:"label"`
+	Description string      `json:"description"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Minimum     *int        `json:"minimum,omitempty"`
+	Maximum     *int        `json:"maximum,omitempty"`
+	// A value with a special meaning that falls outside minimum/maximum, e.g. -1 for "unlimited"
+	UnlimitedValue *int     `json:"unlimited_value,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	MaxLength      int      `json:"max_length,omitempty"`
+	MaxItems       int      `json:"max_items,omitempty"`
+	Schemes        []string `json:"schemes,omitempty"`
+	Enum           []string `json:"enum,omitempty"`
+	Location       string   `json:"in"`
+}
+
+// FormSchema describes how to call an endpoint that takes a form, so alternative frontends can render
+// it without hardcoding the server's policy.
+type FormSchema struct {
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	ContentType string      `json:"content_type"`
+	Fields      []FormField `json:"fields"`
+	// The CAPTCHA requests without an API key must pass, if any
+	Captcha *CaptchaInfo `json:"captcha,omitempty"`
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+// The function describes the create form from the same limits createShortURLHandler enforces, with
+// the deployment's link policy. Tiers of API keys may have other defaults and caps.
+func createFormSchema() FormSchema {
+	policy := config.LinkPolicy
+	defaultMaxAge, defaultMaxAccess := policy.defaults()
+	// Under a cap of max_access, links can't be unlimited
+	maxAccessLimit, unlimitedAccess := (*int)(nil), intPtr(-1)
+	if policy.MaxAccessLimit > 0 {
+		maxAccessLimit, unlimitedAccess = intPtr(policy.MaxAccessLimit), nil
+	}
+	return FormSchema{
+		Method:      http.MethodPost,
+		Path:        "/create",
+		ContentType: "application/x-www-form-urlencoded",
+		Captcha:     captchaInfo(),
+		Fields: []FormField{
+			{
+				Name: "long_url", Type: "url", Label: "Long URL", Location: "form", Required: true,
+				Description: "The address the short URL redirects to.",
+				Schemes:     []string{"http", "https"},
+			},
+			{
+				Name: "max_access", Type: "integer", Label: "Maximum uses", Location: "form",
+				Description: "How many times the short URL can be used in total. Leave empty for the default.",
+				Default:     defaultMaxAccess, Maximum: maxAccessLimit, UnlimitedValue: unlimitedAccess,
+			},
+			{
+				Name: "max_per_hour", Type: "integer", Label: "Maximum uses per hour", Location: "form",
+				Description: "How many times the short URL can be used within an hour. Leave empty for no limit.",
+				Default:     -1, UnlimitedValue: intPtr(-1),
+			},
+			{
+				Name: "max_per_day", Type: "integer", Label: "Maximum uses per day", Location: "form",
+				Description: "How many times the short URL can be used within a day (UTC). Leave empty for no limit.",
+				Default:     -1, UnlimitedValue: intPtr(-1),
+			},
+			{
+				Name: "max_per_month", Type: "integer", Label: "Maximum uses per month", Location: "form",
+				Description: "How many times the short URL can be used within a calendar month (UTC). Leave empty for no limit.",
+				Default:     -1, UnlimitedValue: intPtr(-1),
+			},
+			{
+				Name: "max_age", Type: "integer", Label: "Lifetime in seconds", Location: "form",
+				Description: "How long the short URL stays valid.",
+				Default:     defaultMaxAge, Minimum: intPtr(minMaxAge), Maximum: intPtr(policy.maxAge()),
+			},
+			{
+				Name: "title", Type: "string", Label: "Title", Location: "form",
+				Description: "Title of the link, shown to visitors on custom error pages.",
+				MaxLength:   maxTitleLength,
+			},
+			{
+				Name: "tags", Type: "list", Label: "Tags", Location: "form",
+				Description: "Comma-separated labels to organize links.",
+				Pattern:     tagPattern.String(), MaxItems: maxTagsPerLink,
+			},
+			{
+				Name: "preserve_raw", Type: "boolean", Label: "Keep the URL exactly as entered", Location: "form",
+				Description: "Redirect to the URL byte for byte instead of its normalized form, e.g. for signed URLs. The URL must be percent-encoded ASCII.",
+				Default:     false,
+			},
+			{
+				Name: "template", Type: "boolean", Label: "Templated destination", Location: "form",
+				Description: "Substitute {click_id}, {country}, {ts} and {token} in the path and query of long_url on every redirect.",
+				Default:     false,
+			},
+			{
+				Name: "token_length", Type: "integer", Label: "Token length", Location: "form",
+				Description: "Number of characters of the generated token.",
+				Default:     config.TokenLength, Minimum: intPtr(minTokenLength), Maximum: intPtr(maxTokenLength),
+			},
+			{
+				Name: "token_charset", Type: "string", Label: "Token characters", Location: "form",
+				Description: "Characters the token is made of. \"unambiguous\" avoids look-alikes such as 0/O and 1/l for links that are read aloud or printed.",
+				Default:     config.TokenCharset, Enum: tokenCharsetNames(),
+			},
+			{
+				Name: "token_style", Type: "string", Label: "Token style", Location: "form",
+				Description: "\"words\" makes a token of words and a number, such as amber-otter-42, for links shared verbally, \"emoji\" a token of five emoji. Not available for one-time links.",
+				Default:     "random", Enum: []string{"random", "words", "emoji"},
+			},
+			{
+				Name: "token_seed", Type: "string", Label: "Token seed", Location: "form",
+				Description: "Namespace to derive the token from instead of drawing it: the same seed, API key and long_url always get the same token, and creating the link again returns it unchanged.",
+			},
+			{
+				Name: "one_time", Type: "boolean", Label: "Burn after reading", Location: "form",
+				Description: "Delete the short URL on its first use. Exactly one visitor is redirected, even under concurrent requests.",
+				Default:     false,
+			},
+			{
+				Name: "no_tracking", Type: "boolean", Label: "Don't track", Location: "form",
+				Description: "Don't record the creator's IP address, a click log or access times for the link. Accesses are still counted for the limits.",
+				Default:     false,
+			},
+			{
+				Name: "challenge", Type: "boolean", Label: "Browser check", Location: "form",
+				Description: "Show a short JavaScript check before redirecting, so simple bots can't use up the link's accesses. Visitors without JavaScript can confirm with a button.",
+				Default:     false,
+			},
+			{
+				Name: "frame", Type: "boolean", Label: "Keep the short URL in the address bar", Location: "form",
+				Description: "Show the destination in a full-page frame under the short URL instead of redirecting. Destinations that refuse to be framed are redirected to as usual.",
+				Default:     false,
+			},
+			{
+				Name: "allowed_referrers", Type: "list", Label: "Allowed referrers", Location: "form",
+				Description: "Comma-separated domains the link may be followed from, including their subdomains. Visitors coming from elsewhere or without a Referer get 403 Forbidden.",
+			},
+			{
+				Name: "campaign_id", Type: "string", Label: "Campaign", Location: "form",
+				Description: "ID of a campaign of the API key to add the link to.",
+			},
+			{
+				Name: "domain", Type: "string", Label: "Short domain", Location: "form",
+				Description: "Short domain to create the link on. Defaults to the domain the request is sent to; API keys bound to a domain always use it.",
+			},
+			{
+				Name: apiKeyHeader, Type: "string", Label: "API key", Location: "header",
+				Description: "Optional API key the link is recorded as owned by.",
+			},
+		},
+	}
+}
+
+// The `createFormSchemaHandler` function serves the create form schema.
+func createFormSchemaHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, createFormSchema())
+}
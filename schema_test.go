@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateFormSchema(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "GET", "/api/v1/schema/create", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var schema FormSchema
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schema))
+	assert.Equal(t, "/create", schema.Path)
+
+	fields := map[string]FormField{}
+	for _, field := range schema.Fields {
+		fields[field.Name] = field
+	}
+	assert.True(t, fields["long_url"].Required)
+	assert.Equal(t, minMaxAge, *fields["max_age"].Minimum)
+	assert.Equal(t, maxMaxAge, *fields["max_age"].Maximum)
+
+	// Values just outside the advertised bounds are rejected by the create endpoint
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&max_age=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScreeningVerdict is the outcome of checking a destination against the configured screeners.
+type ScreeningVerdict struct {
+	Malicious bool
+	Source    string
+	Reason    string
+}
+
+// Screener checks a destination URL against a source of known phishing and malware URLs.
+type Screener interface {
+	Screen(ctx context.Context, rawURL string) (ScreeningVerdict, error)
+}
+
+var screeningClient = &http.Client{Timeout: 5 * time.Second}
+
+// Endpoints of the remote screening services, variables so tests can point them at a fake server.
+var (
+	safeBrowsingEndpoint = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+	urlhausEndpoint      = "https://urlhaus-api.abuse.ch/v1/url/"
+)
+
+// The function reports whether host is domain itself or one of its subdomains.
+func hostMatchesDomain(host, domain string) bool {
+	host = strings.ToLower(host)
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func destinationHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// safeBrowsingScreener looks destinations up with the Google Safe Browsing v4 Lookup API.
+type safeBrowsingScreener struct {
+	apiKey string
+}
+
+func (s safeBrowsingScreener) Screen(ctx context.Context, rawURL string) (ScreeningVerdict, error) {
+	payload := map[string]interface{}{
+		"client": map[string]string{"clientId": "golang-url-shortener", "clientVersion": "1.0"},
+		"threatInfo": map[string]interface{}{
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    []map[string]string{{"url": rawURL}},
+		},
+	}
+	body, _ := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, safeBrowsingEndpoint+"?key="+url.QueryEscape(s.apiKey), bytes.NewReader(body))
+	if err != nil {
+		return ScreeningVerdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := screeningClient.Do(req)
+	if err != nil {
+		return ScreeningVerdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ScreeningVerdict{}, fmt.Errorf("safe browsing returned %s", resp.Status)
+	}
+
+	var result struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ScreeningVerdict{}, err
+	}
+	if len(result.Matches) == 0 {
+		return ScreeningVerdict{}, nil
+	}
+	return ScreeningVerdict{Malicious: true, Source: "safe_browsing", Reason: strings.ToLower(result.Matches[0].ThreatType)}, nil
+}
+
+// urlhausScreener looks destinations up in the abuse.ch URLhaus database of malware distribution URLs.
+type urlhausScreener struct {
+	authKey string
+}
+
+func (s urlhausScreener) Screen(ctx context.Context, rawURL string) (ScreeningVerdict, error) {
+	form := url.Values{"url": {rawURL}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlhausEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return ScreeningVerdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Auth-Key", s.authKey)
+
+	resp, err := screeningClient.Do(req)
+	if err != nil {
+		return ScreeningVerdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ScreeningVerdict{}, fmt.Errorf("urlhaus returned %s", resp.Status)
+	}
+
+	var result struct {
+		QueryStatus string `json:"query_status"`
+		Threat      string `json:"threat"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ScreeningVerdict{}, err
+	}
+	if result.QueryStatus != "ok" {
+		return ScreeningVerdict{}, nil
+	}
+	return ScreeningVerdict{Malicious: true, Source: "urlhaus", Reason: result.Threat}, nil
+}
+
+// The function lists the remote screeners enabled by the configuration.
+func remoteScreeners() []Screener {
+	var screeners []Screener
+	if config.SafeBrowsingAPIKey != "" {
+		screeners = append(screeners, safeBrowsingScreener{apiKey: config.SafeBrowsingAPIKey})
+	}
+	if config.URLhausAuthKey != "" {
+		screeners = append(screeners, urlhausScreener{authKey: config.URLhausAuthKey})
+	}
+	return screeners
+}
+
+// The `screenDestination` function checks a destination against the operator's domain lists and then
+// the remote screening services. Allowlisted domains are trusted without asking the remote services.
+// A service that can't be reached is logged and skipped, so an outage doesn't block link creation.
+func screenDestination(ctx context.Context, rawURL string) ScreeningVerdict {
+	host := destinationHost(rawURL)
+	for _, domain := range config.ScreeningAllowlist {
+		if hostMatchesDomain(host, domain) {
+			return ScreeningVerdict{}
+		}
+	}
+	for _, domain := range config.ScreeningBlocklist {
+		if hostMatchesDomain(host, domain) {
+			return ScreeningVerdict{Malicious: true, Source: "blocklist", Reason: "domain " + domain + " is blocked"}
+		}
+	}
+
+	for _, screener := range remoteScreeners() {
+		verdict, err := screener.Screen(ctx, rawURL)
+		if err != nil {
+			log.Printf("screening %s: %v", rawURL, err)
+			continue
+		}
+		if verdict.Malicious {
+			return verdict
+		}
+	}
+	return ScreeningVerdict{}
+}
+
+// The `rescreenLinks` function screens every stored link again, since destinations can turn malicious
+// after a link was created. Depending on the configured action, links found to be malicious are
+// either deleted or flagged.
+func rescreenLinks(ctx context.Context, rdb *redis.Client) {
+	iter := rdb.SScan(ctx, allURLsIndex, 0, "", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+
+		val, err := rdb.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+		var urlEntry URL
+		if json.Unmarshal([]byte(val), &urlEntry) != nil || urlEntry.Flagged {
+			continue
+		}
+
+		verdict := screenDestination(ctx, urlEntry.LongURL)
+		if !verdict.Malicious {
+			continue
+		}
+		flaggedLinks.Add(1)
+
+		if config.ScreeningAction == "reject" {
+			archiveLink(ctx, rdb, urlEntry, "rejected")
+			rdb.Del(ctx, key, tombstoneKey(key))
+			releaseQuota(ctx, rdb, urlEntry)
+			recordEvent(ctx, rdb, urlEntry, "rejected")
+			invalidateListings(ctx, rdb)
+			linkCache.invalidate(key)
+			log.Printf("screening: deleted %s (%s: %s)", key, verdict.Source, verdict.Reason)
+			continue
+		}
+
+		urlEntry.Flagged = true
+		urlEntry.FlagReason = verdict.Source + ": " + verdict.Reason
+		data, _ := json.Marshal(urlEntry)
+		rdb.Set(ctx, key, data, redis.KeepTTL)
+		recordEvent(ctx, rdb, urlEntry, "flagged")
+		linkCache.invalidate(key)
+		log.Printf("screening: flagged %s (%s)", key, urlEntry.FlagReason)
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("screening: %v", err)
+	}
+}
+
+// The function runs rescreenLinks at the configured interval for the lifetime of the process.
+func runScreeningJob(rdb *redis.Client) {
+	ticker := time.NewTicker(config.ScreeningInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rescreenLinks(context.Background(), rdb)
+	}
+}
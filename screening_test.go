@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScreenDestination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "" {
+			w.Write([]byte(`{"matches": [{"threatType": "SOCIAL_ENGINEERING"}]}`))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("url") == "https://malware.example/payload.exe" {
+			w.Write([]byte(`{"query_status": "ok", "threat": "malware_download"}`))
+			return
+		}
+		w.Write([]byte(`{"query_status": "no_results"}`))
+	}))
+	defer server.Close()
+
+	previous, previousSafeBrowsing, previousURLhaus := config, safeBrowsingEndpoint, urlhausEndpoint
+	safeBrowsingEndpoint, urlhausEndpoint = server.URL, server.URL
+	defer func() {
+		config, safeBrowsingEndpoint, urlhausEndpoint = previous, previousSafeBrowsing, previousURLhaus
+	}()
+
+	config.ScreeningBlocklist = []string{"spam.example"}
+	config.ScreeningAllowlist = []string{"trusted.example"}
+	config.URLhausAuthKey = "auth"
+
+	verdict := screenDestination(testCtx, "https://www.spam.example/")
+	assert.True(t, verdict.Malicious)
+	assert.Equal(t, "blocklist", verdict.Source)
+
+	verdict = screenDestination(testCtx, "https://malware.example/payload.exe")
+	assert.Equal(t, ScreeningVerdict{Malicious: true, Source: "urlhaus", Reason: "malware_download"}, verdict)
+	assert.False(t, screenDestination(testCtx, "https://example.com/").Malicious)
+
+	config.SafeBrowsingAPIKey = "key"
+	assert.Equal(t, "safe_browsing", screenDestination(testCtx, "https://example.com/").Source)
+	assert.False(t, screenDestination(testCtx, "https://trusted.example/").Malicious)
+}
+
+func TestScreeningOnCreate(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.ScreeningBlocklist = []string{"spam.example"}
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://spam.example/win", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	config.ScreeningAction = "flag"
+	w = performRequest(router, "POST", "/create", "long_url=https://spam.example/win", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	val, _ := rdb.Get(testCtx, response["token"]).Result()
+	var urlEntry URL
+	json.Unmarshal([]byte(val), &urlEntry)
+	assert.True(t, urlEntry.Flagged)
+	assert.Equal(t, "blocklist: domain spam.example is blocked", urlEntry.FlagReason)
+
+	// Links that turn malicious after creation are caught by the periodic check
+	config.ScreeningBlocklist = nil
+	w = performRequest(router, "POST", "/create", "long_url=https://later.example/", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	config.ScreeningBlocklist = []string{"later.example"}
+	rescreenLinks(testCtx, rdb)
+
+	val, _ = rdb.Get(testCtx, response["token"]).Result()
+	json.Unmarshal([]byte(val), &urlEntry)
+	assert.True(t, urlEntry.Flagged)
+}
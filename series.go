@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Clicks are also counted per hour and per day in a hash next to the link, with fields
+// "hour:2006-01-02T15" and "day:2006-01-02" in UTC, so activity can be charted without reading the
+// click log. The hash expires with the link, the compaction job drops the periods no chart shows.
+func clickSeriesKey(key string) string {
+	return "clicks:series:" + key
+}
+
+// How far back the series go, in days and in hours
+const (
+	seriesDays  = 30
+	seriesHours = 7 * 24
+)
+
+const (
+	seriesHourLayout = "2006-01-02T15"
+	seriesDayLayout  = "2006-01-02"
+)
+
+// SeriesPoint is the number of clicks in the hour or day starting at Time.
+type SeriesPoint struct {
+	Time   string `json:"time"`
+	Clicks int    `json:"clicks"`
+}
+
+// The function counts a click in the hour and the day it was made.
+func countClickSeries(ctx context.Context, rdb *redis.Client, urlEntry URL, clickedAt time.Time) {
+	key := clickSeriesKey(urlEntry.key())
+	clickedAt = clickedAt.UTC()
+	rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, "hour:"+clickedAt.Format(seriesHourLayout), 1)
+		pipe.HIncrBy(ctx, key, "day:"+clickedAt.Format(seriesDayLayout), 1)
+		pipe.ExpireAt(ctx, key, urlEntry.expiry())
+		return nil
+	})
+}
+
+// The function returns the periods of a series ending with the one now is in, oldest first.
+func seriesPeriods(interval string, now time.Time) []time.Time {
+	now = now.UTC()
+	var periods []time.Time
+	if interval == "hour" {
+		last := now.Truncate(time.Hour)
+		for i := seriesHours - 1; i >= 0; i-- {
+			periods = append(periods, last.Add(-time.Duration(i)*time.Hour))
+		}
+		return periods
+	}
+	last := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for i := seriesDays - 1; i >= 0; i-- {
+		periods = append(periods, last.AddDate(0, 0, -i))
+	}
+	return periods
+}
+
+// The function returns the hash field counting the clicks of a period.
+func seriesField(interval string, period time.Time) string {
+	if interval == "hour" {
+		return "hour:" + period.Format(seriesHourLayout)
+	}
+	return "day:" + period.Format(seriesDayLayout)
+}
+
+// The `pruneClickSeries` function deletes the counters of periods that are no longer charted.
+func pruneClickSeries(ctx context.Context, rdb *redis.Client, key string, now time.Time) error {
+	seriesKey := clickSeriesKey(key)
+	fields, err := rdb.HKeys(ctx, seriesKey).Result()
+	if err != nil {
+		return err
+	}
+	oldestHour := seriesField("hour", seriesPeriods("hour", now)[0])
+	oldestDay := seriesField("day", seriesPeriods("day", now)[0])
+	var stale []string
+	for _, field := range fields {
+		// The fixed-width layouts sort chronologically
+		if (strings.HasPrefix(field, "hour:") && field < oldestHour) || (strings.HasPrefix(field, "day:") && field < oldestDay) {
+			stale = append(stale, field)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return rdb.HDel(ctx, seriesKey, stale...).Err()
+}
+
+// The `clickSeriesHandler` function returns the clicks of a link per day over the last 30 days, or
+// with `interval=hour` per hour over the last 7 days, oldest first and including periods without
+// clicks, e.g. for a sparkline. Only the link's owner and the admin can read it.
+func clickSeriesHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "day")
+	if interval != "day" && interval != "hour" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid interval parameter, expected day or hour"})
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	periods := seriesPeriods(interval, time.Now())
+	fields := make([]string, len(periods))
+	for i, period := range periods {
+		fields[i] = seriesField(interval, period)
+	}
+	values, err := rdb.HMGet(opCtx, clickSeriesKey(key), fields...).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	points := make([]SeriesPoint, len(periods))
+	total := 0
+	for i, period := range periods {
+		points[i].Time = period.Format(time.RFC3339)
+		if value, ok := values[i].(string); ok {
+			points[i].Clicks, _ = strconv.Atoi(value)
+		}
+		total += points[i].Clicks
+	}
+	c.JSON(http.StatusOK, gin.H{"token": urlEntry.Token, "interval": interval, "total": total, "points": points})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesPeriods(t *testing.T) {
+	now := time.Date(2024, 5, 31, 14, 25, 0, 0, time.UTC)
+
+	days := seriesPeriods("day", now)
+	if assert.Len(t, days, seriesDays) {
+		assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), days[0])
+		assert.Equal(t, time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC), days[seriesDays-1])
+	}
+
+	hours := seriesPeriods("hour", now)
+	if assert.Len(t, hours, seriesHours) {
+		assert.Equal(t, time.Date(2024, 5, 24, 15, 0, 0, 0, time.UTC), hours[0])
+		assert.Equal(t, time.Date(2024, 5, 31, 14, 0, 0, 0, time.UTC), hours[seriesHours-1])
+	}
+	assert.Equal(t, "hour:2024-05-31T14", seriesField("hour", hours[seriesHours-1]))
+	assert.Equal(t, "day:2024-05-31", seriesField("day", days[seriesDays-1]))
+}
+
+func TestClickSeries(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var apiKey struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=series", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &apiKey)
+	owner := map[string]string{apiKeyHeader: apiKey.Key}
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/series", owner)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	for i := 0; i < 3; i++ {
+		performRequest(router, "GET", "/"+created["token"], "", nil)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// A period that has left the charted range
+	ctx := context.Background()
+	key := linkKey("", created["token"])
+	rdb.HSet(ctx, clickSeriesKey(key), "day:2000-01-01", 5)
+
+	var series struct {
+		Interval string        `json:"interval"`
+		Total    int           `json:"total"`
+		Points   []SeriesPoint `json:"points"`
+	}
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/series", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &series)
+	assert.Equal(t, "day", series.Interval)
+	assert.Equal(t, 3, series.Total)
+	if assert.Len(t, series.Points, seriesDays) {
+		assert.Equal(t, 3, series.Points[seriesDays-1].Clicks)
+		assert.Equal(t, 0, series.Points[0].Clicks)
+	}
+
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/series?interval=hour", "", owner)
+	json.Unmarshal(w.Body.Bytes(), &series)
+	assert.Equal(t, 3, series.Total)
+	assert.Len(t, series.Points, seriesHours)
+
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/series?interval=week", "", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "GET", "/api/urls/"+created["token"]+"/series", "", nil)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+
+	assert.NoError(t, pruneClickSeries(ctx, rdb, key, time.Now()))
+	exists, _ := rdb.HExists(ctx, clickSeriesKey(key), "day:2000-01-01").Result()
+	assert.False(t, exists)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ShadowEngine is an alternative implementation of the access limits. The engine named by
+// SHADOW_ENGINE is evaluated on live traffic next to the one in use, and where their decisions
+// diverge it is logged, so a rewrite can be checked against real traffic before it's switched on.
+// Shadow decisions never affect responses.
+type ShadowEngine interface {
+	// Decide returns the window the engine would refuse the access for, or "" to allow it. Engines keep
+	// state of their own and must not touch the keys of the engine in use.
+	Decide(ctx context.Context, rdb *redis.Client, key string, limits []accessLimit, now time.Time) (string, error)
+}
+
+var shadowEngines = map[string]ShadowEngine{
+	"sliding-window": slidingWindowEngine{},
+}
+
+// Counters of the shadow evaluation, published at /debug/vars
+var shadowStats = expvar.NewMap("shadow")
+
+// The function returns the configured shadow engine, nil when shadow evaluation is off.
+func activeShadowEngine() ShadowEngine {
+	return shadowEngines[config.ShadowEngine]
+}
+
+// The `shadowEvaluate` function lets the shadow engine decide on an access the engine in use decided
+// on (refused is the exhausted window or nil) and records whether they agree.
+func shadowEvaluate(ctx context.Context, rdb *redis.Client, engine ShadowEngine, key string, limits []accessLimit, refused *accessWindow) {
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	decision, err := engine.Decide(opCtx, rdb, key, limits, time.Now())
+	if err != nil {
+		shadowStats.Add("errors", 1)
+		log.Printf("shadow: %s: %v", key, err)
+		return
+	}
+
+	primary := ""
+	if refused != nil {
+		primary = refused.name
+	}
+	shadowStats.Add("evaluations", 1)
+	if decision != primary {
+		shadowStats.Add("divergences", 1)
+		log.Printf("shadow: %s: %s engine refused for %q, engine in use for %q", key, config.ShadowEngine, decision, primary)
+	}
+}
+
+// slidingWindowEngine approximates a sliding window: the count of the previous window is weighted by
+// how much of it still overlaps the sliding window ending now. It smooths out the bursts fixed
+// windows allow at their boundaries.
+type slidingWindowEngine struct{}
+
+func (slidingWindowEngine) counterKey(key string, window accessWindow, start time.Time) string {
+	return "shadow:sliding:" + key + ":" + start.Format(window.layout)
+}
+
+func (e slidingWindowEngine) Decide(ctx context.Context, rdb *redis.Client, key string, limits []accessLimit, now time.Time) (string, error) {
+	current := make([]string, len(limits))
+	previous := make([]string, len(limits))
+	overlap := make([]float64, len(limits))
+	ends := make([]time.Time, len(limits))
+	for i, limit := range limits {
+		end := limit.window.end(now)
+		start, _ := time.Parse(limit.window.layout, now.UTC().Format(limit.window.layout))
+		before, _ := time.Parse(limit.window.layout, start.Add(-time.Nanosecond).Format(limit.window.layout))
+		current[i] = e.counterKey(key, limit.window, start)
+		previous[i] = e.counterKey(key, limit.window, before)
+		overlap[i] = 1 - float64(now.Sub(start))/float64(end.Sub(start))
+		ends[i] = end
+	}
+
+	values, err := rdb.MGet(ctx, append(current, previous...)...).Result()
+	if err != nil {
+		return "", err
+	}
+	count := func(value interface{}) float64 {
+		text, _ := value.(string)
+		n, _ := strconv.ParseFloat(text, 64)
+		return n
+	}
+	for i, limit := range limits {
+		if count(values[len(limits)+i])*overlap[i]+count(values[i]) >= float64(limit.max) {
+			return limit.window.name, nil
+		}
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, limit := range limits {
+			pipe.Incr(ctx, current[i])
+			// The counter is needed until the end of the following window
+			pipe.ExpireAt(ctx, current[i], limit.window.next(ends[i]).Add(time.Minute))
+		}
+		return nil
+	})
+	return "", err
+}
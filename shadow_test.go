@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func shadowCount(name string) int64 {
+	if value, ok := shadowStats.Get(name).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
+
+func TestSlidingWindowEngine(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	engine := slidingWindowEngine{}
+	limits := []accessLimit{{hourWindow, 2}, {dayWindow, 5}}
+	// Counters expire at the end of the following window, so the clock has to be close to the real one
+	now := time.Now().UTC().Truncate(time.Hour).Add(45 * time.Minute)
+
+	for i := 0; i < 2; i++ {
+		decision, err := engine.Decide(testCtx, rdb, "abc", limits, now)
+		assert.NoError(t, err)
+		assert.Equal(t, "", decision)
+	}
+	decision, _ := engine.Decide(testCtx, rdb, "abc", limits, now)
+	assert.Equal(t, "hour", decision)
+
+	// At a quarter past, three quarters of the previous hour overlap the sliding window: 2 * 0.75 + 0 < 2,
+	// but 2 * 0.75 + 1 >= 2
+	next := now.Add(30 * time.Minute)
+	decision, _ = engine.Decide(testCtx, rdb, "abc", limits, next)
+	assert.Equal(t, "", decision)
+	decision, _ = engine.Decide(testCtx, rdb, "abc", limits, next)
+	assert.Equal(t, "hour", decision)
+
+	// The engine doesn't touch the counters of the engine in use
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, hourWindow.key("abc", now)).Val())
+}
+
+func TestShadowEvaluation(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.ShadowEngine = "sliding-window"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_per_hour=2", nil)
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	// A burst at the end of the previous hour makes the sliding window refuse what the fixed one allows
+	now := time.Now().UTC()
+	start := now.Truncate(time.Hour)
+	rdb.Set(testCtx, slidingWindowEngine{}.counterKey(token, hourWindow, start.Add(-time.Hour)), 1000000000, time.Hour)
+
+	evaluations, divergences := shadowCount("evaluations"), shadowCount("divergences")
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, evaluations+1, shadowCount("evaluations"))
+	assert.Equal(t, divergences+1, shadowCount("divergences"))
+
+	// Shadow evaluation is off by default
+	config.ShadowEngine = ""
+	performRequest(router, "GET", "/"+token, "", nil)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, evaluations+1, shadowCount("evaluations"))
+}
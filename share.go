@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+var urlInText = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// The function builds the public short URL of a link, on its custom short domain, the configured public
+// URL or, failing that, the address the request was sent to.
+func shortURLFor(c *gin.Context, urlEntry URL) string {
+	return publicBaseURL(c, urlEntry) + "/" + url.PathEscape(urlEntry.Token)
+}
+
+// The function returns the address the service is reached at for a link, without a trailing slash.
+func publicBaseURL(c *gin.Context, urlEntry URL) string {
+	base := config.PublicURL
+	if urlEntry.Domain != "" {
+		base = "https://" + urlEntry.Domain + basePath()
+	} else if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + c.Request.Host + basePath()
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// The `shareTargetManifestHandler` function serves a web app manifest registering the service as a
+// share target, so an installed instance shows up in the operating system's share sheet. Shared
+// pages are posted to /api/v1/share.
+func shareTargetManifestHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/manifest+json")
+	c.JSON(http.StatusOK, gin.H{
+		"name":       "URL Shortener",
+		"short_name": "Shorten",
+		"start_url":  basePath() + "/",
+		"display":    "standalone",
+		"share_target": gin.H{
+			"action":  basePath() + "/api/v1/share",
+			"method":  "POST",
+			"enctype": "application/x-www-form-urlencoded",
+			"params":  gin.H{"title": "title", "text": "text", "url": "url"},
+		},
+	})
+}
+
+// The `shareHandler` function shortens a page sent by a share sheet. Share sheets send the page as
+// `url`, though some platforms only put it into `text`, so the first URL found there is used as a
+// fallback. API clients asking for JSON get the details, everyone else just the short URL as text.
+func shareHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := authenticate(c, rdb)
+	if !ok || !requireCaptcha(c, apiKey) {
+		return
+	}
+
+	domain, err := resolveCreateDomain(c, apiKey)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	opts := defaultCreateOptions(domain, apiKey)
+	opts.LongURL = strings.TrimSpace(c.PostForm("url"))
+	if opts.LongURL == "" {
+		opts.LongURL = urlInText.FindString(c.PostForm("text"))
+	}
+	opts.APIKey = apiKey
+	opts.CreatorIP = c.ClientIP()
+
+	urlEntry, err := createShortURL(c.Request.Context(), rdb, opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Set(auditTargetKey, urlEntry.key())
+
+	shortURL := shortURLFor(c, urlEntry)
+	if c.NegotiateFormat(gin.MIMEPlain, gin.MIMEJSON) == gin.MIMEJSON {
+		response := gin.H{"token": urlEntry.Token, "short_url": shortURL, "title": c.PostForm("title"), "expires_at": urlEntry.ExpiresAt}
+		if apiKey == nil {
+			response["manage_url"] = manageURLFor(c, urlEntry)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	c.String(http.StatusOK, shortURL)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShare(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	w := performRequest(router, "GET", "/.well-known/share-target", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"action":"/api/v1/share"`)
+
+	w = performRequest(router, "POST", "/api/v1/share", "title=Example&url=https://example.com/article", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "http://"))
+
+	token := w.Body.String()[strings.LastIndex(w.Body.String(), "/")+1:]
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, "https://example.com/article", w.Header().Get("Location"))
+
+	// The URL is taken from the text when the share sheet doesn't send it separately
+	w = performRequest(router, "POST", "/api/v1/share", "title=Example&text=Look+at+this+https://example.org/x", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Example", response["title"])
+	assert.True(t, strings.HasSuffix(response["short_url"], "/"+response["token"]))
+
+	w = performRequest(router, "POST", "/api/v1/share", "title=Nothing", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// Characters of the signature segment of signed tokens. There are 32 of them, so every character
+// carries exactly five bits of the HMAC, and look-alikes such as 0/O and 1/l are left out.
+const signatureAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+
+// The function reports whether new tokens get a signature segment.
+func signingTokens() bool {
+	return config.TokenSigning == "sign" || config.TokenSigning == "enforce"
+}
+
+// The `tokenSignature` function computes the signature segment of a token with one signing key. The
+// domain is part of the message, so a token can't be reused on another short domain.
+func tokenSignature(secret, domain, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(linkKey(domain, payload)))
+	sum := mac.Sum(nil)
+
+	signature := make([]byte, config.TokenSignatureLength)
+	for i := range signature {
+		// Five bits per character, read across byte boundaries
+		bit := i * 5
+		chunk := uint16(sum[bit/8])<<8 | uint16(sum[bit/8+1])
+		signature[i] = signatureAlphabet[chunk>>(11-bit%8)&31]
+	}
+	return string(signature)
+}
+
+// The function appends the signature segment to a generated token, signed with the current key.
+func signToken(domain, payload string) string {
+	return payload + tokenSignature(config.TokenSigningKeys[0], domain, payload)
+}
+
+// The `validTokenSignature` function checks the signature segment of a token against every configured
+// signing key, so links signed with a key that has been rotated out of first place keep working until
+// the key is removed.
+func validTokenSignature(domain, token string) bool {
+	if len(token) <= config.TokenSignatureLength {
+		return false
+	}
+	payload, signature := token[:len(token)-config.TokenSignatureLength], token[len(token)-config.TokenSignatureLength:]
+	valid := false
+	for _, secret := range config.TokenSigningKeys {
+		if hmac.Equal([]byte(tokenSignature(secret, domain, payload)), []byte(signature)) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// The `forgedToken` function reports whether a requested token must be rejected without looking it up,
+// because signatures are enforced and its signature is invalid. Guessed tokens then never reach Redis.
+func forgedToken(domain, token string) bool {
+	return config.TokenSigning == "enforce" && !validTokenSignature(domain, token)
+}
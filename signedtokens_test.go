@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenSignature(t *testing.T) {
+	previous := config
+	config.TokenSigningKeys = []string{"new-key", "old-key"}
+	config.TokenSignatureLength = 6
+	defer func() { config = previous }()
+
+	token := signToken("", "abc123")
+	assert.Len(t, token, 12)
+	assert.True(t, validTokenSignature("", token))
+	// Signatures are bound to the short domain
+	assert.False(t, validTokenSignature("go.example", token))
+	assert.False(t, validTokenSignature("", "abc124"+token[6:]))
+	assert.False(t, validTokenSignature("", "abc"))
+
+	// Tokens signed with a rotated key stay valid while the key is configured
+	config.TokenSigningKeys = []string{"old-key"}
+	old := signToken("", "abc123")
+	config.TokenSigningKeys = []string{"new-key", "old-key"}
+	assert.True(t, validTokenSignature("", old))
+	config.TokenSigningKeys = []string{"new-key"}
+	assert.False(t, validTokenSignature("", old))
+}
+
+func TestEnforcedTokenSignatures(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	// A link from before tokens were signed
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	legacy := response["token"]
+
+	config.TokenSigning = "enforce"
+	config.TokenSigningKeys = []string{"signing-key"}
+	config.TokenSignatureLength = 6
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&token_length=8", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token := response["token"]
+	assert.Len(t, token, 14)
+
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	// Unsigned tokens are refused without a lookup, unless signatures are only added to new tokens
+	w = performRequest(router, "GET", "/"+legacy, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performRequest(router, "GET", "/"+legacy+"/preview", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.TokenSigning = "sign"
+	w = performRequest(router, "GET", "/"+legacy, "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+}
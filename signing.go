@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"sync"
+)
+
+// The key values are signed with, set once from SECRET_KEY and only read after signingKeyOnce
+var (
+	signingKey     []byte
+	signingKeyOnce sync.Once
+)
+
+// The function returns the key used to sign values handed to clients. Without a configured SECRET_KEY
+// a random one is generated, which works for a single instance but invalidates signed values on
+// restart and doesn't work across replicas. main calls it at startup, so the key is settled before
+// requests are served.
+func secretKey() []byte {
+	signingKeyOnce.Do(func() {
+		key := config.SecretKey
+		if key == "" {
+			log.Println("SECRET_KEY is not set, using a random key for this process: manage URLs and other signed values stop working on restart and on other replicas")
+			key = randomHex(32)
+		}
+		signingKey = []byte(key)
+	})
+	return signingKey
+}
+
+// The `sign` function computes a URL-safe HMAC-SHA256 signature of message with the service's secret key.
+func sign(message string) string {
+	mac := hmac.New(sha256.New, secretKey())
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// The function checks a signature produced by sign in constant time.
+func validSignature(message, signature string) bool {
+	return hmac.Equal([]byte(sign(message)), []byte(signature))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignConcurrently(t *testing.T) {
+	// The key is settled on first use, concurrent callers must all sign with the same one
+	signatures := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range signatures {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			signatures[i] = sign("message")
+		}()
+	}
+	wg.Wait()
+	for _, signature := range signatures {
+		assert.Equal(t, signatures[0], signature)
+		assert.True(t, validSignature("message", signature))
+	}
+	assert.NotEmpty(t, secretKey())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hashedAssets serves a tree of static files under content-hashed names (e.g. "app.3f2a1b9c.js"). A
+// hashed name changes whenever the file does, so those responses can be cached by browsers forever
+// and no CDN or manual cache busting is needed.
+type hashedAssets struct {
+	files  map[string][]byte // original path -> content
+	hashed map[string]string // original path -> hashed path
+	byHash map[string]string // hashed path -> original path
+}
+
+// The function reads every file of the tree and computes its hashed name.
+func newHashedAssets(fsys fs.FS) (*hashedAssets, error) {
+	assets := &hashedAssets{files: map[string][]byte{}, hashed: map[string]string{}, byHash: map[string]string{}}
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+
+		assets.files[name] = content
+		assets.hashed[name] = hashedName
+		assets.byHash[hashedName] = name
+		return nil
+	})
+	return assets, err
+}
+
+// The `Path` method returns the hashed name to reference an asset by, e.g. from an HTML template.
+// Unknown names are returned unchanged.
+func (a *hashedAssets) Path(name string) string {
+	if hashedName, ok := a.hashed[name]; ok {
+		return hashedName
+	}
+	return name
+}
+
+// The `serve` method answers requests for an asset whose path is in the `filepath` route parameter.
+// Hashed names are marked immutable for a year, while original names stay available but must be
+// revalidated on every use.
+func (a *hashedAssets) serve(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	if original, ok := a.byHash[name]; ok {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(a.files[original]))
+		return
+	}
+
+	if _, ok := a.files[name]; ok {
+		c.Header("Cache-Control", "no-cache")
+		c.Header("ETag", `"`+a.hashed[name]+`"`)
+		http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(a.files[name]))
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"message": "Asset not found"})
+}
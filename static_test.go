@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashedAssets(t *testing.T) {
+	assets, err := newHashedAssets(fstest.MapFS{
+		"app.js": {Data: []byte("console.log('hi')")},
+	})
+	assert.NoError(t, err)
+
+	hashedName := assets.Path("app.js")
+	assert.Regexp(t, `^app\.[0-9a-f]{8}\.js$`, hashedName)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/static/*filepath", assets.serve)
+
+	w := performRequest(router, "GET", "/static/"+hashedName, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	assert.Equal(t, "console.log('hi')", w.Body.String())
+
+	w = performRequest(router, "GET", "/static/app.js", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = performRequest(router, "GET", "/static/app.js", "", map[string]string{"If-None-Match": w.Header().Get("ETag")})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = performRequest(router, "GET", "/static/missing.js", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
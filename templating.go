@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Placeholders in templated destinations. They may be stored percent-encoded, since normalizing the
+// destination escapes braces in the path.
+var placeholderPattern = regexp.MustCompile(`(?i)(?:\{|%7B)(click_id|country|ts|token)(?:\}|%7D)`)
+
+var countryPattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// The function collects the values a templated destination can refer to for one click.
+func templateVariables(c *gin.Context, token, clickID string) map[string]string {
+	country := c.GetHeader(config.CountryHeader)
+	if !countryPattern.MatchString(country) {
+		country = ""
+	}
+	return map[string]string{
+		"click_id": clickID,
+		"country":  strings.ToUpper(country),
+		"ts":       strconv.FormatInt(time.Now().Unix(), 10),
+		"token":    token,
+	}
+}
+
+// The `expandDestination` function substitutes the placeholders of a templated destination. Only the
+// part after the host is expanded, so a visitor-controlled value can never change where the redirect
+// goes, and every value is escaped.
+func expandDestination(destination string, vars map[string]string) string {
+	start := strings.Index(destination, "://")
+	if start == -1 {
+		return destination
+	}
+	start += len("://")
+	if end := strings.IndexAny(destination[start:], "/?#"); end != -1 {
+		start += end
+	} else {
+		return destination
+	}
+
+	expanded := placeholderPattern.ReplaceAllStringFunc(destination[start:], func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return url.QueryEscape(vars[strings.ToLower(name)])
+	})
+	return destination[:start] + expanded
+}
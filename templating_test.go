@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandDestination(t *testing.T) {
+	vars := map[string]string{"click_id": "abc123", "country": "DE", "ts": "1700000000", "token": "tok"}
+
+	assert.Equal(t, "https://shop.example/DE/tok?cid=abc123&ts=1700000000",
+		expandDestination("https://shop.example/%7Bcountry%7D/{token}?cid={click_id}&ts={ts}", vars))
+
+	// The host is never expanded and values are escaped
+	assert.Equal(t, "https://{country}.example/", expandDestination("https://{country}.example/", vars))
+	assert.Equal(t, "https://shop.example/?c=a%26b%3Dc", expandDestination("https://shop.example/?c={country}", map[string]string{"country": "a&b=c"}))
+
+	// Unknown placeholders are left alone
+	assert.Equal(t, "https://shop.example/?q={other}", expandDestination("https://shop.example/?q={other}", vars))
+}
+
+func TestTemplatedRedirect(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	destination := "https://shop.example/landing/{country}?cid={click_id}&ts={ts}"
+	w := performRequest(router, "POST", "/create", "template=true&long_url="+url.QueryEscape(destination), nil)
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	w = performRequest(router, "GET", "/"+response["token"], "", map[string]string{"CF-IPCountry": "fr"})
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/landing/FR", location.Path)
+	assert.Equal(t, w.Header().Get("X-Click-ID"), location.Query().Get("cid"))
+	assert.NotEmpty(t, location.Query().Get("cid"))
+	assert.Regexp(t, `^\d+$`, location.Query().Get("ts"))
+
+	// Without the flag placeholders are part of the destination
+	w = performRequest(router, "POST", "/create", "long_url="+url.QueryEscape(destination), nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	w = performRequest(router, "GET", "/"+response["token"], "", nil)
+	assert.Contains(t, w.Header().Get("Location"), "click_id")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// The `setupTLS` function returns the TLS configuration of the public listeners, from the configured
+// certificate files or with certificates Let's Encrypt issues for the short domains, and the handler
+// of HTTPRedirectAddr, which answers ACME challenges and redirects everything else to HTTPS. Without
+// TLS, it returns nil for both and the listeners serve plain HTTP, e.g. behind a reverse proxy.
+func setupTLS() (*tls.Config, http.Handler, error) {
+	files := config.TLSCertFile != "" || config.TLSKeyFile != ""
+	var tlsConfig *tls.Config
+	redirect := http.HandlerFunc(redirectToHTTPS)
+	var handler http.Handler = redirect
+	switch {
+	case files && config.Autocert:
+		return nil, nil, errors.New("TLS_CERT_FILE and AUTOCERT can't be used together")
+	case files:
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case config.Autocert:
+		hosts := autocertHosts()
+		if len(hosts) == 0 {
+			return nil, nil, errors.New("AUTOCERT needs the short domain in PUBLIC_URL or DOMAINS")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(config.AutocertCacheDir),
+			HostPolicy: autocert.HostWhitelist(hosts...),
+			Email:      config.AutocertEmail,
+		}
+		tlsConfig = manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		handler = manager.HTTPHandler(redirect)
+	default:
+		if config.HTTPRedirectAddr != "" {
+			return nil, nil, errors.New("HTTP_REDIRECT_ADDR needs TLS_CERT_FILE or AUTOCERT")
+		}
+		return nil, nil, nil
+	}
+	return tlsConfig, handler, nil
+}
+
+// The function returns the host names certificates are requested for: the host of the public URL and
+// the additional short domains. Other hosts are refused, so nobody can make the service request
+// certificates for names pointed at it.
+func autocertHosts() []string {
+	var hosts []string
+	if publicURL, err := url.Parse(config.PublicURL); err == nil && publicURL.Hostname() != "" {
+		hosts = append(hosts, publicURL.Hostname())
+	}
+	for domain := range config.Domains {
+		hosts = append(hosts, domain)
+	}
+	return hosts
+}
+
+// The `redirectToHTTPS` function redirects plain HTTP requests to the same address over HTTPS.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+}
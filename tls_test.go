@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupTLS(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	// Plain HTTP by default
+	tlsConfig, redirect, err := setupTLS()
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+	assert.Nil(t, redirect)
+
+	config.HTTPRedirectAddr = ":80"
+	_, _, err = setupTLS()
+	assert.Error(t, err)
+
+	// A self-signed certificate
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sho.rt"},
+		DNSNames:     []string{"sho.rt"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	dir := t.TempDir()
+	config.TLSCertFile = filepath.Join(dir, "cert.pem")
+	config.TLSKeyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(config.TLSCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(config.TLSKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	tlsConfig, redirect, err = setupTLS()
+	assert.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	req, _ := http.NewRequest("GET", "http://sho.rt:80/abc?x=1", nil)
+	w := httptest.NewRecorder()
+	redirect.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://sho.rt/abc?x=1", w.Header().Get("Location"))
+
+	config.Autocert = true
+	_, _, err = setupTLS()
+	assert.Error(t, err)
+
+	// Autocert needs to know the short domains
+	config.TLSCertFile, config.TLSKeyFile = "", ""
+	config.PublicURL = ""
+	config.Domains = nil
+	_, _, err = setupTLS()
+	assert.Error(t, err)
+
+	config.PublicURL = "https://sho.rt/s"
+	config.Domains = map[string]DomainConfig{"go.acme.com": {}}
+	config.AutocertCacheDir = t.TempDir()
+	assert.ElementsMatch(t, []string{"sho.rt", "go.acme.com"}, autocertHosts())
+	tlsConfig, _, err = setupTLS()
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig.GetCertificate)
+	assert.Contains(t, tlsConfig.NextProtos, "acme-tls/1")
+}
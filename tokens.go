@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/speps/go-hashids/v2"
+)
+
+// TokenGenerator draws random tokens from an alphabet. All randomness used for tokens goes through it.
+type TokenGenerator interface {
+	Generate(length int, alphabet string) string
+}
+
+// mathTokenGenerator uses the fast, automatically seeded math/rand source. Its output is predictable
+// to someone who observes enough tokens, which is fine for public links.
+type mathTokenGenerator struct{}
+
+func (mathTokenGenerator) Generate(length int, alphabet string) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = alphabet[mathrand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// cryptoTokenGenerator uses crypto/rand, for tokens that act as secrets. Random bytes that would
+// favour the first characters of the alphabet are rejected, so every character is equally likely.
+type cryptoTokenGenerator struct{}
+
+func (cryptoTokenGenerator) Generate(length int, alphabet string) string {
+	limit := 256 - 256%len(alphabet)
+	b := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(b) < length {
+		if _, err := rand.Read(buf); err != nil {
+			panic("crypto/rand: " + err.Error())
+		}
+		for _, r := range buf {
+			if int(r) < limit && len(b) < length {
+				b = append(b, alphabet[int(r)%len(alphabet)])
+			}
+		}
+	}
+	return string(b)
+}
+
+var tokenGenerators = map[string]TokenGenerator{
+	"math":   mathTokenGenerator{},
+	"crypto": cryptoTokenGenerator{},
+}
+
+// The function returns the generator configured for tokens that don't need to be secret.
+func defaultTokenGenerator() TokenGenerator {
+	if generator, ok := tokenGenerators[config.TokenGenerator]; ok {
+		return generator
+	}
+	return mathTokenGenerator{}
+}
+
+// Number of random tokens checked for collisions at once
+const tokenCandidates = 4
+
+// Number of times creating a link draws a new token after losing it to a concurrent create
+const maxTokenAttempts = 10
+
+// Counter the sequential token mode numbers links with
+const tokenCounterKey = "counter:tokens"
+
+// Hashids needs at least this many distinct characters in its alphabet
+const minHashidsAlphabet = 16
+
+// The function reports whether a token from alphabet is generated in the sequential mode: tokens are
+// then the Hashids encoding of a counter instead of random, which needs an alphabet of at least 16
+// characters. One-time links always get random tokens.
+func useSequentialTokens(alphabet string, oneTime bool) bool {
+	return config.TokenGenerator == "hashids" && !oneTime && len(alphabet) >= minHashidsAlphabet
+}
+
+// The `generateSequentialToken` function numbers a new link with the token counter and encodes the
+// number with Hashids, salted with the instance salt, so tokens are neither guessable nor sequential.
+// Tokens are padded to length and only grow once the counter outgrows it. Tokens that are already
+// taken (e.g. by random tokens from before the mode was switched on) are skipped.
+func generateSequentialToken(ctx context.Context, rdb *redis.Client, domain string, length int, alphabet string) (string, error) {
+	data := hashids.NewData()
+	data.Salt = config.HashidsSalt
+	data.MinLength = length
+	data.Alphabet = alphabet
+	encoder, err := hashids.NewWithData(data)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		opCtx, cancel := writeContext(ctx)
+		id, err := rdb.Incr(opCtx, tokenCounterKey).Result()
+		cancel()
+		if err != nil {
+			return "", err
+		}
+		token, err := encoder.EncodeInt64([]int64{id})
+		if err != nil {
+			return "", err
+		}
+		if signingTokens() {
+			token = signToken(domain, token)
+		}
+
+		opCtx, cancel = readContext(ctx)
+		_, err = rdb.Get(opCtx, linkKey(domain, token)).Result()
+		cancel()
+		if err == redis.Nil {
+			return token, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Bounds of the token length clients may ask for
+const (
+	minTokenLength = 4
+	maxTokenLength = 32
+)
+
+// Alphabets tokens can be drawn from. "unambiguous" leaves out characters that are easily confused
+// when a link is read aloud or printed (0/O/o, 1/l/I).
+var tokenCharsets = map[string]string{
+	"alphanumeric": charset,
+	"unambiguous":  "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789",
+	"lowercase":    "abcdefghijklmnopqrstuvwxyz0123456789",
+	"numeric":      "0123456789",
+}
+
+var (
+	errInvalidTokenLength  = errors.New("token_length must be between 4 and 32")
+	errInvalidTokenCharset = errors.New("unknown token_charset")
+)
+
+// The function lists the names of the charset presets in a stable order.
+func tokenCharsetNames() []string {
+	names := make([]string, 0, len(tokenCharsets))
+	for name := range tokenCharsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The function checks the requested token shape against the allowed bounds and presets.
+func validateTokenShape(length int, charsetName string) error {
+	if length < minTokenLength || length > maxTokenLength {
+		return errInvalidTokenLength
+	}
+	if _, ok := tokenCharsets[charsetName]; !ok {
+		return errInvalidTokenCharset
+	}
+	return nil
+}
+
+// The function reads the configured default charset preset, falling back to "alphanumeric" for
+// unknown names.
+func envTokenCharset(key string) string {
+	name := envString(key, "alphanumeric")
+	if _, ok := tokenCharsets[name]; !ok {
+		log.Printf("%s: unknown charset %q, using alphanumeric", key, name)
+		return "alphanumeric"
+	}
+	return name
+}
+
+// Longest token seed accepted from clients
+const maxTokenSeedLength = 200
+
+// The `seededToken` function derives the token of a link created with a token seed from the seed, the
+// owner and the destination, so automation creating the same link again gets the same token without
+// keeping state of its own. The hash is mapped onto the alphabet with the rejection sampling of
+// cryptoTokenGenerator, hashing further blocks until the token is complete.
+func seededToken(urlEntry URL, length int, alphabet string) string {
+	limit := 256 - 256%len(alphabet)
+	b := make([]byte, 0, length)
+	for block := 0; len(b) < length; block++ {
+		sum := sha256.Sum256([]byte(strconv.Itoa(block) + "\x00" + urlEntry.CreatorAPIKey + "\x00" + urlEntry.TokenSeed + "\x00" + urlEntry.LongURL))
+		for _, r := range sum {
+			if int(r) < limit && len(b) < length {
+				b = append(b, alphabet[int(r)%len(alphabet)])
+			}
+		}
+	}
+	token := string(b)
+	if signingTokens() {
+		token = signToken(urlEntry.Domain, token)
+	}
+	return token
+}
+
+// The `seededLink` function returns the link already stored under a seeded token, when it was created
+// from the same seed, owner and destination. Its settings are returned as stored, the settings of the
+// repeated request are ignored. A token taken by a different link is a conflict.
+func seededLink(ctx context.Context, rdb *redis.Client, urlEntry URL) (URL, error) {
+	opCtx, cancel := readContext(ctx)
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, urlEntry.key())
+	if err != nil && err != redis.Nil {
+		return URL{}, newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+	}
+	var existing URL
+	if err == nil && json.Unmarshal([]byte(val), &existing) == nil && existing.TokenSeed == urlEntry.TokenSeed &&
+		existing.CreatorAPIKey == urlEntry.CreatorAPIKey && existing.LongURL == urlEntry.LongURL {
+		return existing, nil
+	}
+	return URL{}, newAPIError(http.StatusConflict, "The token derived from token_seed is taken by another link")
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/speps/go-hashids/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenShape(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.TokenLength = 6
+	config.TokenCharset = "lowercase"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	var created map[string]string
+
+	// Deployment defaults
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Regexp(t, `^[a-z0-9]{6}$`, created["token"])
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com&token_length=12&token_charset=unambiguous", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Len(t, created["token"], 12)
+	assert.False(t, strings.ContainsAny(created["token"], "0Oo1lI"), created["token"])
+
+	for _, form := range []string{"token_length=3", "token_length=33", "token_length=abc", "token_charset=emoji"} {
+		w = performRequest(router, "POST", "/create", "long_url=https://example.com&"+form, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, form)
+	}
+}
+
+func TestTokenGenerators(t *testing.T) {
+	for name, generator := range tokenGenerators {
+		for _, alphabet := range tokenCharsets {
+			token := generator.Generate(16, alphabet)
+			assert.Len(t, token, 16, name)
+			for _, r := range token {
+				assert.Contains(t, alphabet, string(r), name)
+			}
+		}
+	}
+
+	// Rejection sampling keeps crypto tokens unbiased even when 256 isn't a multiple of the alphabet size
+	counts := map[rune]int{}
+	for _, r := range (cryptoTokenGenerator{}).Generate(60000, tokenCharsets["alphanumeric"]) {
+		counts[r]++
+	}
+	assert.Len(t, counts, 62)
+	for r, count := range counts {
+		assert.InDelta(t, 60000/62, count, 250, string(r))
+	}
+}
+
+func TestSequentialTokens(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.TokenGenerator = "hashids"
+	config.HashidsSalt = "instance salt"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	var created map[string]string
+
+	data := hashids.NewData()
+	data.Salt = config.HashidsSalt
+	data.MinLength = config.TokenLength
+	data.Alphabet = charset
+	decoder, err := hashids.NewWithData(data)
+	assert.NoError(t, err)
+
+	var last int64
+	for i := 0; i < 5; i++ {
+		w := performRequest(router, "POST", "/create", "long_url=https://example.com", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &created)
+		assert.Regexp(t, `^[a-zA-Z0-9]{8}$`, created["token"])
+
+		// Tokens encode the increasing counter
+		numbers, err := decoder.DecodeInt64WithError(created["token"])
+		assert.NoError(t, err)
+		assert.Len(t, numbers, 1)
+		assert.Greater(t, numbers[0], last)
+		last = numbers[0]
+	}
+
+	// The encoding depends on the salt
+	data.Salt = "another salt"
+	other, _ := hashids.NewWithData(data)
+	encoded, _ := other.EncodeInt64([]int64{last})
+	assert.NotEqual(t, created["token"], encoded)
+
+	// Charsets too small for Hashids still get random tokens
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com&token_charset=numeric", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Regexp(t, `^[0-9]{8}$`, created["token"])
+	assert.False(t, useSequentialTokens(tokenCharsets["numeric"], false))
+	assert.False(t, useSequentialTokens(charset, true))
+}
+
+// sequenceGenerator hands out fixed tokens, to provoke collisions.
+type sequenceGenerator struct {
+	tokens []string
+}
+
+func (g *sequenceGenerator) Generate(length int, alphabet string) string {
+	token := g.tokens[0]
+	g.tokens = g.tokens[1:]
+	return token
+}
+
+func TestUniqueTokenSkipsTakenCandidates(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	rdb.Set(testCtx, "taken1", "{}", 0)
+	rdb.Set(testCtx, "taken2", "{}", 0)
+	rdb.Set(testCtx, "taken3", "{}", 0)
+	rdb.Set(testCtx, "taken4", "{}", 0)
+	generator := &sequenceGenerator{tokens: []string{"taken1", "taken2", "taken3", "taken4", "taken1", "free01", "free02", "free03"}}
+
+	token, err := generateUniqueToken(testCtx, rdb, generator, "", 6, charset)
+	assert.NoError(t, err)
+	assert.Equal(t, "free01", token)
+	assert.Empty(t, generator.tokens)
+}
+
+func TestReserveLink(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	first := URL{Token: "race01", LongURL: "https://example.com/first", MaxAccess: -1, ExpiresAt: expiryTime(time.Hour).Format(time.RFC3339)}
+	reserved, err := reserveLink(testCtx, rdb, first)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+
+	// A replica that drew the same token loses and must not overwrite the link
+	second := first
+	second.LongURL = "https://example.com/second"
+	reserved, err = reserveLink(testCtx, rdb, second)
+	assert.NoError(t, err)
+	assert.False(t, reserved)
+
+	var stored URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, "race01").Val()), &stored)
+	assert.Equal(t, "https://example.com/first", stored.LongURL)
+	assert.Greater(t, rdb.TTL(testCtx, "race01").Val(), time.Duration(0))
+}
+
+func TestSeededToken(t *testing.T) {
+	link := URL{LongURL: "https://example.com/", TokenSeed: "terraform/prod", CreatorAPIKey: "key_a"}
+	token := seededToken(link, 8, charset)
+	assert.Regexp(t, `^[a-zA-Z0-9]{8}$`, token)
+	assert.Equal(t, token, seededToken(link, 8, charset))
+	assert.Len(t, seededToken(link, 32, tokenCharsets["numeric"]), 32)
+
+	other := link
+	other.TokenSeed = "terraform/staging"
+	assert.NotEqual(t, token, seededToken(other, 8, charset))
+	other = link
+	other.CreatorAPIKey = "key_b"
+	assert.NotEqual(t, token, seededToken(other, 8, charset))
+}
+
+func TestSeededLinks(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	var first, second map[string]string
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/seeded&token_seed=infra", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &first)
+
+	// Creating the link again returns it as it is
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/seeded&token_seed=infra&max_access=3", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &second)
+	assert.Equal(t, first, second)
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/other&token_seed=infra", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &second)
+	assert.NotEqual(t, first["token"], second["token"])
+
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/seeded&token_seed=infra&one_time=true", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Without an API key, a repeated seed would hand out another caller's link
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/seeded&token_seed=infra", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
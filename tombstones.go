@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Tombstone records why a link is gone, so clients get 410 Gone with details instead of a 404.
+type Tombstone struct {
+	Token string `json:"token"`
+	// "expired", "max_access_reached" or "consumed" (one-time links)
+	Reason    string `json:"reason"`
+	ExpiredAt string `json:"expired_at"`
+	CreatedAt string `json:"created_at"`
+	Title     string `json:"title,omitempty"`
+	// API key that created the link, so its error page can be branded
+	Owner string `json:"owner,omitempty"`
+}
+
+// The function returns the key of the tombstone of a link.
+func tombstoneKey(key string) string {
+	return "tombstone:" + key
+}
+
+func setTombstone(ctx context.Context, rdb redis.Cmdable, urlEntry URL, reason string, expiredAt time.Time, ttl time.Duration) {
+	rdb.Set(ctx, tombstoneKey(urlEntry.key()), tombstoneData(urlEntry, reason, expiredAt), ttl)
+}
+
+// The function encodes the tombstone of a link.
+func tombstoneData(urlEntry URL, reason string, expiredAt time.Time) []byte {
+	data, _ := json.Marshal(Tombstone{
+		Token:     urlEntry.Token,
+		Reason:    reason,
+		ExpiredAt: expiredAt.UTC().Format(time.RFC3339),
+		CreatedAt: urlEntry.CreatedAt,
+		Title:     urlEntry.Title,
+		Owner:     urlEntry.CreatorAPIKey,
+	})
+	return data
+}
+
+// The `armTombstone` function is called when a link is created. Redis expires links silently, so the
+// tombstone is written ahead of time: it outlives the link by the tombstone period and only counts
+// once the link's expiry time has passed.
+func armTombstone(ctx context.Context, rdb redis.Cmdable, urlEntry URL) {
+	if config.TombstoneTTL <= 0 {
+		return
+	}
+	setTombstone(ctx, rdb, urlEntry, "expired", urlEntry.expiry(), urlEntry.ttl()+config.TombstoneTTL)
+}
+
+// The function records that a link was removed before its expiry time.
+func buryLink(ctx context.Context, rdb redis.Cmdable, urlEntry URL, reason string) {
+	if config.TombstoneTTL <= 0 {
+		return
+	}
+	setTombstone(ctx, rdb, urlEntry, reason, time.Now(), config.TombstoneTTL)
+}
+
+// Deletes a link and, if it was still there, writes its tombstone, unless the tombstone period is 0.
+// Returns whether the link was deleted.
+var consumeLinkScript = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 0 then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+// The `consumeLink` function removes a one-time link that is accessed, leaving a tombstone, and reports
+// whether this access removed it. Of concurrent accesses only one removes the link; the others find it
+// gone, along with its tombstone, and the removal is only recorded by the one that made it.
+func consumeLink(ctx context.Context, rdb *redis.Client, key string, urlEntry URL) (bool, error) {
+	data := tombstoneData(urlEntry, "consumed", time.Now())
+	deleted, err := consumeLinkScript.Run(ctx, rdb, []string{key, tombstoneKey(key)}, data, config.TombstoneTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		recordEvent(ctx, pipe, urlEntry, "consumed")
+		releaseQuota(ctx, pipe, urlEntry)
+		return nil
+	})
+	return true, err
+}
+
+// The `findTombstone` function returns the tombstone of a link that isn't stored (anymore), or nil if
+// the link never existed, was deleted, or its tombstone period is over.
+func findTombstone(ctx context.Context, rdb *redis.Client, key string) (*Tombstone, error) {
+	val, err := rdb.Get(ctx, tombstoneKey(key)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseTombstone(val), nil
+}
+
+// The function decodes a stored tombstone, nil if it doesn't count (yet).
+func parseTombstone(val string) *Tombstone {
+	var tombstone Tombstone
+	if json.Unmarshal([]byte(val), &tombstone) != nil {
+		return nil
+	}
+	// A link that is missing before its expiry time was deleted, e.g. by an admin
+	expiredAt, err := time.Parse(time.RFC3339, tombstone.ExpiredAt)
+	if err != nil || expiredAt.After(time.Now()) {
+		return nil
+	}
+	return &tombstone
+}
+
+// The `respondMissingLink` function answers a request for a link that isn't stored: 410 Gone with the
+// details of its tombstone if it expired recently, 404 otherwise.
+func respondMissingLink(c *gin.Context, rdb *redis.Client, key string) {
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	tombstone, err := findTombstone(opCtx, rdb, key)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	if tombstone == nil {
+		respondLinkError(c, http.StatusNotFound, pageNotFound, "Error finding your short URL. It may have expired or never existed.")
+		return
+	}
+	respondLinkErrorDetails(c, rdb, http.StatusGone, pageExpired, gin.H{
+		"message":    "This short URL is no longer available.",
+		"reason":     tombstone.Reason,
+		"expired_at": tombstone.ExpiredAt,
+		"created_at": tombstone.CreatedAt,
+	}, ErrorPageData{Title: tombstone.Title, CreatedAt: tombstone.CreatedAt, ExpiredAt: tombstone.ExpiredAt, Reason: tombstone.Reason, owner: tombstone.Owner})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTombstones(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	create := func() string {
+		w := performRequest(router, "POST", "/create", "long_url=https://example.com&max_access=1", nil)
+		var created map[string]string
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created["token"]
+	}
+
+	// Exhausted links are gone, not unknown
+	token := create()
+	performRequest(router, "GET", "/"+token, "", nil)
+	time.Sleep(50 * time.Millisecond)
+	w := performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	for _, path := range []string{"/" + token, "/" + token + "/preview"} {
+		w = performRequest(router, "GET", path, "", nil)
+		assert.Equal(t, http.StatusGone, w.Code)
+		var gone map[string]string
+		json.Unmarshal(w.Body.Bytes(), &gone)
+		assert.Equal(t, "max_access_reached", gone["reason"])
+		assert.NotEmpty(t, gone["expired_at"])
+		assert.NotEmpty(t, gone["created_at"])
+	}
+
+	// Links that never existed or were deleted before their expiry are unknown
+	w = performRequest(router, "GET", "/neverexisted", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	token = create()
+	assert.Equal(t, int64(1), rdb.Exists(testCtx, tombstoneKey(token)).Val())
+	w = performRequest(router, "DELETE", "/api/urls/"+token, "", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, tombstoneKey(token)).Val())
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The tombstone of a live link only counts after the link's expiry time
+	token = create()
+	rdb.Del(testCtx, token)
+	w = performRequest(router, "GET", "/"+token, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.TombstoneTTL = 0
+	token = create()
+	assert.Equal(t, int64(0), rdb.Exists(testCtx, tombstoneKey(token)).Val())
+}
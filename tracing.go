@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// The `setupTracing` function exports the spans of requests and Redis commands with OTLP over HTTP.
+// The exporter and sampler are configured with the standard OTEL_* variables, e.g.
+// OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_TRACES_SAMPLER. Trace context sent by callers in the
+// traceparent header is continued, so redirects show up in the traces of the services sending them.
+func setupTracing(ctx context.Context) error {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(config.TracingServiceName)))
+	if err != nil {
+		return err
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// The function records a span for every command sent to a Redis server, as a child of the span of
+// the request sending it.
+func traceRedis(rdb *redis.Client) {
+	if !config.Tracing {
+		return
+	}
+	if err := redisotel.InstrumentTracing(rdb); err != nil {
+		log.Printf("tracing: %v", err)
+	}
+}
+
+// The `traceRequests` middleware starts a span for every request, named after its route.
+func traceRequests() gin.HandlerFunc {
+	return otelgin.Middleware(config.TracingServiceName)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous, previousProvider, previousPropagator := config, otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	config.Tracing = true
+	defer func() {
+		config = previous
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	traceRedis(rdb)
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	w := performRequest(router, "GET", "/ui", "", map[string]string{"traceparent": traceparent})
+	assert.Equal(t, http.StatusOK, w.Code)
+	performRequest(router, "GET", "/missing-token", "", nil)
+
+	spans := recorder.Ended()
+	names := map[string]bool{}
+	for _, span := range spans {
+		names[span.Name()] = true
+	}
+	assert.True(t, names["GET /ui"], names)
+	assert.True(t, names["GET /:token"], names)
+
+	// The caller's trace is continued, and Redis commands are children of the request's span
+	for _, span := range spans {
+		if span.Name() == "GET /ui" {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		}
+	}
+	var request sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "GET /:token" {
+			request = span
+		}
+	}
+	children := 0
+	for _, span := range spans {
+		if span.Parent().SpanID() == request.SpanContext().SpanID() {
+			children++
+		}
+	}
+	assert.Greater(t, children, 0)
+}
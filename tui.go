@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tuiClient talks to a running instance through its HTTP API using the admin key.
+type tuiClient struct {
+	server string
+	key    string
+	http   *http.Client
+}
+
+// The function sends a request to the instance and decodes the JSON answer into result, turning
+// error responses into errors carrying the server's message.
+func (t *tuiClient) do(method, path string, form url.Values, result interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(t.server, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set(apiKeyHeader, t.key)
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		if failure.Message == "" {
+			failure.Message = resp.Status
+		}
+		return errors.New(failure.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (t *tuiClient) list(filters url.Values, cursor string) ([]URL, string, error) {
+	query := url.Values{}
+	for key, values := range filters {
+		query[key] = values
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	var page struct {
+		URLs       []URL  `json:"urls"`
+		NextCursor string `json:"next_cursor"`
+	}
+	err := t.do(http.MethodGet, "/api/urls?"+query.Encode(), nil, &page)
+	return page.URLs, page.NextCursor, err
+}
+
+func (t *tuiClient) create(form url.Values) (string, error) {
+	var created struct {
+		Token string `json:"token"`
+	}
+	err := t.do(http.MethodPost, "/create", form, &created)
+	return created.Token, err
+}
+
+// The function deletes a link given as a token, or as domain/token for links of a custom short domain.
+func (t *tuiClient) delete(link string) error {
+	path := "/api/urls/" + url.PathEscape(link)
+	if domain, token, found := strings.Cut(link, "/"); found {
+		path = "/api/urls/" + url.PathEscape(token) + "?domain=" + url.QueryEscape(domain)
+	}
+	return t.do(http.MethodDelete, path, nil, nil)
+}
+
+// The function replaces the branding of the key's workspace.
+func (t *tuiClient) setBranding(branding Branding) error {
+	form := url.Values{
+		"logo_url":         {branding.LogoURL},
+		"primary_color":    {branding.PrimaryColor},
+		"background_color": {branding.BackgroundColor},
+		"footer_text":      {branding.FooterText},
+	}
+	return t.do(http.MethodPut, "/api/branding", form, nil)
+}
+
+const tuiHelp = `Commands:
+  ls                       list links
+  n                        next page of the last listing
+  search <term>...         search links; terms tag:<tag>, owner:<key id> and ip:<ip> filter on
+                           the server, other terms match the token or destination
+  create <url> [max_age]   create a link
+  rm <token>               delete a link, domain/token for custom domains (asks for confirmation)
+  branding                 show the branding of the workspace's pages
+  branding <setting> [value]
+                           change logo_url, primary_color, background_color or footer_text,
+                           clearing it without a value
+  help                     show this help
+  q                        quit
+`
+
+// tuiSession holds the state of an interactive session: where input comes from, where the screen is
+// drawn, and what the last listing was so it can be continued.
+type tuiSession struct {
+	client  *tuiClient
+	input   *bufio.Scanner
+	out     io.Writer
+	filters url.Values
+	terms   []string
+	cursor  string
+}
+
+func (s *tuiSession) prompt(text string) (string, bool) {
+	fmt.Fprint(s.out, text)
+	if !s.input.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(s.input.Text()), true
+}
+
+// The function draws one page of links as a table. Pages are fetched until a full screen of links
+// matching the local search terms has been collected or the listing is exhausted.
+func (s *tuiSession) showPage() {
+	const pageSize = 20
+	var shown []URL
+	for len(shown) < pageSize {
+		urls, next, err := s.client.list(s.filters, s.cursor)
+		if err != nil {
+			fmt.Fprintln(s.out, "error:", err)
+			return
+		}
+		for _, urlEntry := range urls {
+			if matchesTerms(urlEntry, s.terms) {
+				shown = append(shown, urlEntry)
+			}
+		}
+		s.cursor = next
+		if next == "" {
+			break
+		}
+	}
+
+	table := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TOKEN\tUSES\tCREATED\tTAGS\tDESTINATION")
+	for _, urlEntry := range shown {
+		uses := fmt.Sprint(urlEntry.CurrentAccessCount)
+		if urlEntry.MaxAccess != -1 {
+			uses += fmt.Sprintf("/%d", urlEntry.MaxAccess)
+		}
+		created := urlEntry.CreatedAt
+		if parsed, err := time.Parse(time.RFC3339, created); err == nil {
+			created = parsed.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", urlEntry.key(), uses, created, strings.Join(urlEntry.Tags, ","), displayURL(urlEntry.LongURL))
+	}
+	table.Flush()
+
+	if len(shown) == 0 {
+		fmt.Fprintln(s.out, "No links found.")
+	}
+	if s.cursor != "" {
+		fmt.Fprintln(s.out, "More links available, type n for the next page.")
+	}
+}
+
+func matchesTerms(urlEntry URL, terms []string) bool {
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		if !strings.Contains(strings.ToLower(urlEntry.Token), term) && !strings.Contains(strings.ToLower(displayURL(urlEntry.LongURL)), term) {
+			return false
+		}
+	}
+	return true
+}
+
+// The `runTUI` function runs the interactive management session until the user quits or the input
+// ends.
+func runTUI(client *tuiClient, in io.Reader, out io.Writer) error {
+	s := &tuiSession{client: client, input: bufio.NewScanner(in), out: out}
+	fmt.Fprintf(out, "Connected to %s. Type help for the list of commands.\n", client.server)
+
+	for {
+		line, ok := s.prompt("> ")
+		if !ok {
+			return s.input.Err()
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "ls", "list":
+			s.filters, s.terms, s.cursor = nil, nil, ""
+			s.showPage()
+		case "n", "next":
+			if s.cursor == "" {
+				fmt.Fprintln(out, "No more links.")
+				continue
+			}
+			s.showPage()
+		case "search":
+			s.filters, s.terms, s.cursor = url.Values{}, nil, ""
+			for _, term := range fields[1:] {
+				key, value, found := strings.Cut(term, ":")
+				if found && (key == "tag" || key == "owner" || key == "ip") {
+					s.filters.Set(key, value)
+				} else {
+					s.terms = append(s.terms, term)
+				}
+			}
+			s.showPage()
+		case "create":
+			if len(fields) < 2 {
+				fmt.Fprintln(out, "usage: create <url> [max_age]")
+				continue
+			}
+			form := url.Values{"long_url": {fields[1]}}
+			if len(fields) > 2 {
+				form.Set("max_age", fields[2])
+			}
+			token, err := client.create(form)
+			if err != nil {
+				fmt.Fprintln(out, "error:", err)
+				continue
+			}
+			fmt.Fprintf(out, "Created %s/%s\n", strings.TrimSuffix(client.server, "/"), token)
+		case "rm", "delete":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: rm <token>")
+				continue
+			}
+			answer, ok := s.prompt("Delete " + fields[1] + "? [y/N] ")
+			if !ok {
+				return s.input.Err()
+			}
+			if answer != "y" && answer != "yes" {
+				continue
+			}
+			if err := client.delete(fields[1]); err != nil {
+				fmt.Fprintln(out, "error:", err)
+				continue
+			}
+			fmt.Fprintln(out, "Deleted", fields[1])
+		case "branding":
+			var branding Branding
+			if err := client.do(http.MethodGet, "/api/branding", nil, &branding); err != nil {
+				fmt.Fprintln(out, "error:", err)
+				continue
+			}
+			if len(fields) == 1 {
+				table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+				fmt.Fprintf(table, "logo_url\t%s\nprimary_color\t%s\nbackground_color\t%s\nfooter_text\t%s\n",
+					branding.LogoURL, branding.PrimaryColor, branding.BackgroundColor, branding.FooterText)
+				table.Flush()
+				continue
+			}
+			value := strings.Join(fields[2:], " ")
+			switch fields[1] {
+			case "logo_url":
+				branding.LogoURL = value
+			case "primary_color":
+				branding.PrimaryColor = value
+			case "background_color":
+				branding.BackgroundColor = value
+			case "footer_text":
+				branding.FooterText = value
+			default:
+				fmt.Fprintln(out, "usage: branding <logo_url|primary_color|background_color|footer_text> [value]")
+				continue
+			}
+			if err := client.setBranding(branding); err != nil {
+				fmt.Fprintln(out, "error:", err)
+				continue
+			}
+			fmt.Fprintln(out, "Updated", fields[1])
+		case "help", "?":
+			fmt.Fprint(out, tuiHelp)
+		case "q", "quit", "exit":
+			return nil
+		default:
+			fmt.Fprintf(out, "Unknown command %q. Type help for the list of commands.\n", fields[0])
+		}
+	}
+}
+
+// The `tuiMain` function is the entry point of `urlshortener tui`.
+func tuiMain(args []string) error {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	server := flags.String("server", "http://localhost:8080", "address of the running instance")
+	key := flags.String("key", os.Getenv("ADMIN_API_KEY"), "admin API key (defaults to $ADMIN_API_KEY)")
+	flags.Parse(args)
+
+	if *key == "" {
+		return errors.New("an admin API key is required, pass -key or set ADMIN_API_KEY")
+	}
+
+	client := &tuiClient{server: *server, key: *key, http: &http.Client{Timeout: 10 * time.Second}}
+	return runTUI(client, os.Stdin, os.Stdout)
+}
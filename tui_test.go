@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTUI(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(setupRouter(rdb))
+	defer server.Close()
+
+	client := &tuiClient{server: server.URL, key: "admin-secret", http: http.DefaultClient}
+	var out bytes.Buffer
+	err := runTUI(client, strings.NewReader("create https://example.com/docs\ncreate https://example.org\nsearch docs\nq\n"), &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Created "+server.URL+"/")
+	assert.Contains(t, out.String(), "https://example.com/docs")
+	assert.NotContains(t, out.String(), "https://example.org")
+
+	urls, _, err := client.list(nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	out.Reset()
+	err = runTUI(client, strings.NewReader("rm "+urls[0].Token+"\ny\nls\n"), &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Deleted "+urls[0].Token)
+	assert.NotContains(t, out.String(), urls[0].LongURL)
+	assert.Contains(t, out.String(), urls[1].LongURL)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Unique visitors are counted in HyperLogLogs of visitor fingerprints, per link and per campaign.
+// Counts are estimates with a standard error below 1%, in 12 KB per counter however many visitors
+// there are. Raw clicks overstate reach when one person opens a link repeatedly.
+
+// The counter of a link expires with the link; the janitor deletes the ones of links removed earlier.
+func uniquesKey(key string) string {
+	return "clicks:uniques:" + key
+}
+
+// Campaign counters survive the expiry of individual links, like their click totals
+func campaignUniquesKey(id string) string {
+	return "campaign:" + id + ":uniques"
+}
+
+// The `visitorFingerprint` function identifies a visitor by client IP and user agent. It's keyed with
+// the secret key, so the stored fingerprints can't be matched with IP addresses by trying them all.
+func visitorFingerprint(ip, userAgent string) string {
+	return sign(ip + "\n" + userAgent)
+}
+
+// The function adds a visitor to the unique visitors of a link and its campaign.
+func countVisitor(ctx context.Context, rdb *redis.Client, urlEntry URL, fingerprint string) {
+	rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		key := uniquesKey(urlEntry.key())
+		pipe.PFAdd(ctx, key, fingerprint)
+		pipe.ExpireAt(ctx, key, urlEntry.expiry())
+		if urlEntry.CampaignID != "" {
+			pipe.PFAdd(ctx, campaignUniquesKey(urlEntry.CampaignID), fingerprint)
+		}
+		return nil
+	})
+}
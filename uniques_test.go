@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVisitorFingerprint(t *testing.T) {
+	previous := config
+	config.SecretKey = "secret"
+	defer func() { config = previous }()
+
+	fingerprint := visitorFingerprint("203.0.113.7", "Firefox")
+	assert.Equal(t, fingerprint, visitorFingerprint("203.0.113.7", "Firefox"))
+	assert.NotEqual(t, fingerprint, visitorFingerprint("203.0.113.7", "Chrome"))
+	assert.NotEqual(t, fingerprint, visitorFingerprint("203.0.113.8", "Firefox"))
+	assert.NotContains(t, fingerprint, "203.0.113.7")
+}
+
+func TestUniqueVisitors(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=uniques", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &key)
+	owner := map[string]string{apiKeyHeader: key.Key}
+
+	w = performRequest(router, "POST", "/api/campaigns", "name=Reach", owner)
+	var campaign Campaign
+	json.Unmarshal(w.Body.Bytes(), &campaign)
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/reach&campaign_id="+campaign.ID, owner)
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	// One visitor refreshing three times and a second one
+	for _, userAgent := range []string{"Firefox", "Firefox", "Firefox", "Chrome"} {
+		performRequest(router, "GET", "/"+created["token"], "", map[string]string{"User-Agent": userAgent})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	w = performRequest(router, "GET", "/api/campaigns/"+campaign.ID, "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats struct {
+		TotalClicks    int `json:"total_clicks"`
+		UniqueVisitors int `json:"unique_visitors"`
+		Links          []struct {
+			UniqueVisitors int `json:"unique_visitors"`
+		} `json:"links"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	assert.Equal(t, 4, stats.TotalClicks)
+	assert.Equal(t, 2, stats.UniqueVisitors)
+	if assert.Len(t, stats.Links, 1) {
+		assert.Equal(t, 2, stats.Links[0].UniqueVisitors)
+	}
+
+	w = performRequest(router, "POST", "/api/urls/"+created["token"]+"/freeze", "", owner)
+	var summary LinkSummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	assert.Equal(t, 4, summary.TotalClicks)
+	assert.Equal(t, 2, summary.UniqueVisitors)
+}
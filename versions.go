@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkVersion is an edit of a link: who changed which settings when, and the version of the link it
+// made. Links that were never edited are at version 0.
+type LinkVersion struct {
+	Version int    `json:"version"`
+	At      string `json:"at"`
+	// ID of the API key that made the edit, "admin" for the admin key, "manage" for edits made on the
+	// link's manage page
+	Actor   string                 `json:"actor"`
+	Changes map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange is the value of a setting before and after an edit.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// The edits of a link are kept in a Redis list next to it, oldest first, and expire with the link.
+func linkHistoryKey(key string) string {
+	return "history:" + key
+}
+
+// How often an edit is retried when the link changes while it is being edited, e.g. by the counts of
+// its accesses
+const maxEditAttempts = 5
+
+// A new destination of an edit, screened and classified before the link is edited, so the transaction
+// editing it doesn't wait for the screening lists or the classifier, and retries don't repeat them.
+type destinationEdit struct {
+	// The destination as stored, exactly as given for links with preserve_raw
+	longURL     string
+	preserveRaw bool
+	verdict     ScreeningVerdict
+	category    string
+}
+
+// The function validates, screens and classifies the long_url of an edit request, nil without one.
+// Whether the destination is stored as given depends on the link, which is read for it. Links for
+// which allowed returns false are answered as not found.
+func screenEdit(ctx context.Context, c *gin.Context, rdb *redis.Client, allowed func(URL) bool, key string) (*destinationEdit, error) {
+	value, ok := c.GetPostForm("long_url")
+	if !ok {
+		return nil, nil
+	}
+	val, err := rdb.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		return nil, newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !allowed(urlEntry) {
+		return nil, newAPIError(http.StatusNotFound, "Error finding your short URL. It may have expired or never existed.")
+	}
+
+	longURL, err := normalizeDestination(value)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "Invalid long_url parameter")
+	}
+	if err := checkDestinationPolicy(longURL); err != nil {
+		return nil, err
+	}
+	verdict := screenDestination(ctx, longURL)
+	if verdict.Malicious {
+		flaggedLinks.Add(1)
+	}
+	if verdict.Malicious && config.ScreeningAction == "reject" {
+		return nil, newAPIError(http.StatusBadRequest, "The destination was flagged as unsafe ("+verdict.Source+": "+verdict.Reason+")")
+	}
+	if urlEntry.PreserveRaw {
+		if !isRawSafe(value) {
+			return nil, newAPIError(http.StatusBadRequest, "long_url must be percent-encoded ASCII without spaces when preserve_raw is set")
+		}
+		longURL = value
+	}
+	return &destinationEdit{longURL: longURL, preserveRaw: urlEntry.PreserveRaw, verdict: verdict, category: classifyDestination(ctx, longURL)}, nil
+}
+
+// The function applies the settings of an edit request to a link and returns what changed. The new
+// destination, if any, was screened beforehand. A new max_access must be within the cap of the
+// editor's tier.
+func applyEdit(c *gin.Context, urlEntry *URL, destination *destinationEdit) (map[string]FieldChange, error) {
+	changes := map[string]FieldChange{}
+	var editor *APIKey
+	if key, ok := c.Get(apiKeyContextKey); ok {
+		editor = key.(*APIKey)
+	}
+
+	if destination != nil && destination.longURL != urlEntry.LongURL {
+		verdict := destination.verdict
+		changes["long_url"] = FieldChange{urlEntry.LongURL, destination.longURL}
+		urlEntry.LongURL = destination.longURL
+		urlEntry.Category = destination.category
+		urlEntry.Flagged = verdict.Malicious
+		urlEntry.FlagReason = ""
+		if verdict.Malicious {
+			urlEntry.FlagReason = verdict.Source + ": " + verdict.Reason
+		}
+	}
+
+	if value, ok := c.GetPostForm("title"); ok {
+		title := strings.TrimSpace(value)
+		if title != urlEntry.Title {
+			changes["title"] = FieldChange{urlEntry.Title, title}
+			urlEntry.Title = title
+		}
+	}
+
+	if value, ok := c.GetPostForm("tags"); ok {
+		tags, err := parseTags(value)
+		if err != nil {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid tags parameter: "+err.Error())
+		}
+		if !slices.Equal(tags, urlEntry.Tags) {
+			changes["tags"] = FieldChange{urlEntry.Tags, tags}
+			urlEntry.Tags = tags
+		}
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{
+		{"max_access", &urlEntry.MaxAccess},
+		{"max_per_hour", &urlEntry.MaxPerHour},
+		{"max_per_day", &urlEntry.MaxPerDay},
+		{"max_per_month", &urlEntry.MaxPerMonth},
+	} {
+		value, ok := c.GetPostForm(limit.name)
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < -1 {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid "+limit.name+" parameter")
+		}
+		if parsed != *limit.value && limit.name == "max_access" {
+			if err := linkPolicy(urlEntry.Domain, editor).checkMaxAccess(parsed); err != nil {
+				return nil, err
+			}
+		}
+		if parsed != *limit.value {
+			changes[limit.name] = FieldChange{*limit.value, parsed}
+			*limit.value = parsed
+		}
+	}
+	return changes, nil
+}
+
+// The `editLinkHandler` function changes the destination, title, tags or access limits of a link. Every
+// edit increments the link's version and is recorded in its history with the API key that made it
+// and the old and new values. Frozen links can't be edited.
+func editLinkHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := writeContext(c.Request.Context())
+	defer cancel()
+	// Loading the link moves it back from cold storage, so it can be edited in Redis
+	if _, err := loadLink(opCtx, rdb, key); err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	owns := func(urlEntry URL) bool { return apiKey.owns(urlEntry.CreatorAPIKey) }
+	edited, version, err := editLinkWithRetries(opCtx, c, rdb, apiKey.ID, owns, key)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"link": edited, "version": version})
+}
+
+// The function applies an edit request to a link as actor, retrying while the link changes under it.
+// Links for which allowed returns false are answered as not found.
+func editLinkWithRetries(ctx context.Context, c *gin.Context, rdb *redis.Client, actor string, allowed func(URL) bool, key string) (URL, LinkVersion, error) {
+	destination, err := screenEdit(ctx, c, rdb, allowed, key)
+	if err != nil {
+		return URL{}, LinkVersion{}, err
+	}
+	for attempt := 0; attempt < maxEditAttempts; attempt++ {
+		edited, version, err := editLink(ctx, c, rdb, actor, allowed, key, destination)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err == nil {
+			linkCache.invalidate(key)
+		}
+		return edited, version, err
+	}
+	return URL{}, LinkVersion{}, newAPIError(http.StatusConflict, "The link kept changing while it was edited, please try again")
+}
+
+// The function edits a link in a transaction, which fails with redis.TxFailedErr if the link changed
+// in the meantime. The destination was screened for the link as it was read before.
+func editLink(ctx context.Context, c *gin.Context, rdb *redis.Client, actor string, allowed func(URL) bool, key string, destination *destinationEdit) (URL, LinkVersion, error) {
+	var urlEntry URL
+	var version LinkVersion
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		val, err := tx.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+		}
+		if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !allowed(urlEntry) {
+			return newAPIError(http.StatusNotFound, "Error finding your short URL. It may have expired or never existed.")
+		}
+		if urlEntry.Frozen {
+			return newAPIError(http.StatusConflict, "Frozen links can't be edited")
+		}
+		// A link whose destination is kept as given now was replaced by another one since
+		if destination != nil && destination.preserveRaw != urlEntry.PreserveRaw {
+			return newAPIError(http.StatusConflict, "The link was replaced while it was edited, please try again")
+		}
+		previous := urlEntry
+		loadAccessCount(ctx, tx, &urlEntry)
+
+		changes, err := applyEdit(c, &urlEntry, destination)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return newAPIError(http.StatusBadRequest, "Nothing to change, pass long_url, title, tags or a limit")
+		}
+		urlEntry.Version++
+		version = LinkVersion{Version: urlEntry.Version, At: time.Now().Format(time.RFC3339), Actor: actor, Changes: changes}
+
+		data, _ := json.Marshal(urlEntry)
+		versionData, _ := json.Marshal(version)
+		oldIndexes, newIndexes := indexKeys(previous), indexKeys(urlEntry)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, redis.KeepTTL)
+			for _, index := range oldIndexes {
+				if !slices.Contains(newIndexes, index) {
+					pipe.SRem(ctx, index, key)
+				}
+			}
+			for _, index := range newIndexes {
+				pipe.SAdd(ctx, index, key)
+			}
+			if urlEntry.MaxAccess != previous.MaxAccess {
+				adjustRemainingUses(ctx, pipe, urlEntry, previous.MaxAccess)
+			}
+			pipe.RPush(ctx, linkHistoryKey(key), versionData)
+			pipe.ExpireAt(ctx, linkHistoryKey(key), urlEntry.expiry())
+			recordEvent(ctx, pipe, urlEntry, "updated")
+			invalidateListings(ctx, pipe)
+			return nil
+		})
+		if err != nil && err != redis.TxFailedErr {
+			return newAPIError(http.StatusServiceUnavailable, "Error reaching the URL store, please try again later.")
+		}
+		return err
+	}, key)
+	return urlEntry, version, err
+}
+
+// The function sets the access count of a link to its counter, which is ahead of the record by the
+// accesses that haven't been flushed into it yet.
+func loadAccessCount(ctx context.Context, rdb redis.Cmdable, urlEntry *URL) {
+	if count, err := rdb.HGet(ctx, accessCountsKey(urlEntry.key()), "count").Int(); err == nil {
+		urlEntry.CurrentAccessCount = count
+	}
+}
+
+// The `linkVersionsHandler` function returns the edits of a link, oldest first, along with its current
+// version. Only the link's owner and the admin can read them.
+func linkVersionsHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	key := linkKey(strings.ToLower(c.Query("domain")), c.Param("token"))
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	val, err := loadLink(opCtx, rdb, key)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	var urlEntry URL
+	if err == redis.Nil || json.Unmarshal([]byte(val), &urlEntry) != nil || !apiKey.owns(urlEntry.CreatorAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Error finding your short URL. It may have expired or never existed."})
+		return
+	}
+
+	entries, err := rdb.LRange(opCtx, linkHistoryKey(key), 0, -1).Result()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+	versions := make([]LinkVersion, 0, len(entries))
+	for _, entry := range entries {
+		var version LinkVersion
+		if json.Unmarshal([]byte(entry), &version) == nil {
+			versions = append(versions, version)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"token": urlEntry.Token, "version": urlEntry.Version, "versions": versions})
+}
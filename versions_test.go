@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditLink(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+
+	var apiKey struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	w := performRequest(router, "POST", "/api/admin/keys", "name=editor", map[string]string{apiKeyHeader: "admin-secret"})
+	json.Unmarshal(w.Body.Bytes(), &apiKey)
+	owner := map[string]string{apiKeyHeader: apiKey.Key}
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/old", owner)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := "/api/urls/" + created["token"]
+
+	w = performRequest(router, "PATCH", path, "long_url=https://example.com/new&max_access=10&title=Launch", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var edited struct {
+		Link    URL         `json:"link"`
+		Version LinkVersion `json:"version"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &edited)
+	assert.Equal(t, "https://example.com/new", edited.Link.LongURL)
+	assert.Equal(t, 1, edited.Link.Version)
+	assert.Equal(t, apiKey.ID, edited.Version.Actor)
+	assert.Equal(t, FieldChange{"https://example.com/old", "https://example.com/new"}, edited.Version.Changes["long_url"])
+	assert.Equal(t, FieldChange{float64(-1), float64(10)}, edited.Version.Changes["max_access"])
+
+	w = performRequest(router, "GET", "/"+created["token"], "", nil)
+	assert.Equal(t, "https://example.com/new", w.Header().Get("Location"))
+
+	// Unchanged values aren't an edit
+	w = performRequest(router, "PATCH", path, "title=Launch", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "PATCH", path, "max_per_day=-5", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "PATCH", path, "title=Other", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "PATCH", path, "title=Relaunch", map[string]string{apiKeyHeader: "admin-secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", path+"/history", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history struct {
+		Version  int           `json:"version"`
+		Versions []LinkVersion `json:"versions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &history)
+	assert.Equal(t, 2, history.Version)
+	if assert.Len(t, history.Versions, 2) {
+		assert.Equal(t, 1, history.Versions[0].Version)
+		assert.Equal(t, "admin", history.Versions[1].Actor)
+		assert.Equal(t, FieldChange{"Launch", "Relaunch"}, history.Versions[1].Changes["title"])
+	}
+
+	// The new destination can be looked up, the old one no longer
+	w = performRequest(router, "GET", "/api/lookup?url=https://example.com/old", "", owner)
+	assert.NotContains(t, w.Body.String(), created["token"])
+
+	performRequest(router, "POST", path+"/freeze", "", owner)
+	w = performRequest(router, "PATCH", path, "title=Frozen", owner)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// A classifier that changes the link it classifies, as a concurrent access would
+type touchingClassifier struct {
+	touch func()
+	calls *int
+}
+
+func (t touchingClassifier) Classify(ctx context.Context, longURL string) string {
+	*t.calls++
+	t.touch()
+	return "news"
+}
+
+func TestEditLinkScreensOutsideTransaction(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	config.Classifier = "touching"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var created map[string]string
+	w := performRequest(router, "POST", "/create", "long_url=https://example.com/old", admin)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	token := created["token"]
+
+	calls := 0
+	classifiers["touching"] = touchingClassifier{calls: &calls, touch: func() {
+		rdb.Set(testCtx, token, rdb.Get(testCtx, token).Val(), redis.KeepTTL)
+	}}
+	defer delete(classifiers, "touching")
+
+	// The destination is classified once, before the transaction, which a change of the link during the
+	// classification doesn't fail
+	w = performRequest(router, "PATCH", "/api/urls/"+token, "long_url=https://example.com/news", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, calls)
+	var edited struct {
+		Link URL `json:"link"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &edited)
+	assert.Equal(t, "news", edited.Link.Category)
+}
+
+func TestEditLinkTags(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	previous := config
+	config.AdminAPIKey = "admin-secret"
+	defer func() { config = previous }()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(rdb)
+	admin := map[string]string{apiKeyHeader: "admin-secret"}
+
+	var apiKey map[string]string
+	w := performRequest(router, "POST", "/api/admin/keys", "name=tagger", admin)
+	json.Unmarshal(w.Body.Bytes(), &apiKey)
+	owner := map[string]string{apiKeyHeader: apiKey["key"]}
+
+	var created map[string]string
+	w = performRequest(router, "POST", "/create", "long_url=https://example.com/launch&tags=launch,newsletter", owner)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	performRequest(router, "POST", "/create", "long_url=https://example.com/other&tags=newsletter", owner)
+
+	tagged := func(path string, headers map[string]string) int {
+		var page struct {
+			URLs []json.RawMessage `json:"urls"`
+		}
+		w := performRequest(router, "GET", path, "", headers)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return len(page.URLs)
+	}
+	assert.Equal(t, 1, tagged("/api/urls?tag=launch", owner))
+	assert.Equal(t, 2, tagged("/api/urls?tag=newsletter", owner))
+
+	w = performRequest(router, "PATCH", "/api/urls/"+created["token"], "tags=spring,Launch", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var edited struct {
+		Version LinkVersion `json:"version"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &edited)
+	assert.Equal(t, FieldChange{[]interface{}{"launch", "newsletter"}, []interface{}{"spring", "launch"}}, edited.Version.Changes["tags"])
+
+	// The tag indexes follow the edit
+	assert.Equal(t, 1, tagged("/api/urls?tag=spring", owner))
+	assert.Equal(t, 1, tagged("/api/urls?tag=newsletter", owner))
+	assert.Equal(t, 1, tagged("/api/urls?tag=spring", admin))
+	assert.Equal(t, 1, tagged("/api/urls?tag=newsletter", admin))
+
+	w = performRequest(router, "PATCH", "/api/urls/"+created["token"], "tags=not a tag", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Name of the first-party cookie identifying a visitor across the links of a campaign
+const visitorCookie = "vid"
+
+// At most this many steps of a visitor's path through a campaign are kept
+const maxJourneySteps = 20
+
+// Paths of the visitors of a campaign, a hash from visitor ID to the comma-separated tokens they
+// clicked, in order
+func campaignJourneysKey(id string) string {
+	return "campaign:" + id + ":journeys"
+}
+
+// Appends a token to the path of a visitor, unless it's the last token of the path already (a
+// visitor opening the same link again) or the path is full.
+var appendJourneyScript = redis.NewScript(`
+local path = redis.call('HGET', KEYS[1], ARGV[1])
+if not path then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+end
+local last = string.match(path, '[^,]*$')
+local _, separators = string.gsub(path, ',', '')
+if last == ARGV[2] or separators + 1 >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], path .. ',' .. ARGV[2])
+return 1
+`)
+
+// The `visitorID` function returns the ID of the visitor of a campaign link, assigning one in a cookie
+// if needed. Visitors are only identified when the operator enabled it, the link tracks clicks, and
+// the visitor didn't opt out through Do Not Track or Global Privacy Control. It returns "" otherwise.
+func visitorID(c *gin.Context, urlEntry URL) string {
+	if !config.VisitorCookie || urlEntry.CampaignID == "" || urlEntry.NoTracking {
+		return ""
+	}
+	if c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1" {
+		return ""
+	}
+	if id, err := c.Cookie(visitorCookie); err == nil && isHexID(id) {
+		return id
+	}
+	id := randomHex(16)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     visitorCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(config.VisitorCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+func isHexID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// The function adds a click to the path of a visitor through the link's campaign.
+func recordJourney(ctx context.Context, rdb *redis.Client, urlEntry URL, visitor string) {
+	appendJourneyScript.Run(ctx, rdb, []string{campaignJourneysKey(urlEntry.CampaignID)}, visitor, urlEntry.Token, maxJourneySteps)
+}
+
+// FunnelPath is a sequence of links and the number of visitors who clicked them in that order.
+type FunnelPath struct {
+	Path     []string `json:"path"`
+	Visitors int      `json:"visitors"`
+}
+
+// The `campaignFunnelHandler` function reports how the identified visitors of a campaign moved through
+// its links: how many clicked more than one of them, and the most common paths.
+func campaignFunnelHandler(c *gin.Context, rdb *redis.Client) {
+	apiKey, ok := requireAPIKey(c, rdb)
+	if !ok {
+		return
+	}
+
+	campaign, err := loadCampaign(c.Request.Context(), rdb, c.Param("id"))
+	if err == redis.Nil || (err == nil && !apiKey.owns(campaign.Owner)) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Campaign not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	opCtx, cancel := readContext(c.Request.Context())
+	defer cancel()
+	visitors, multiLink := 0, 0
+	counts := map[string]int{}
+	iter := rdb.HScan(opCtx, campaignJourneysKey(campaign.ID), 0, "", 100).Iterator()
+	for iter.Next(opCtx) {
+		// The iterator yields field and value in turn
+		if !iter.Next(opCtx) {
+			break
+		}
+		path := iter.Val()
+		visitors++
+		if strings.Contains(path, ",") {
+			multiLink++
+		}
+		counts[path]++
+	}
+	if err := iter.Err(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Error reaching the URL store, please try again later."})
+		return
+	}
+
+	paths := make([]FunnelPath, 0, len(counts))
+	for path, n := range counts {
+		paths = append(paths, FunnelPath{Path: strings.Split(path, ","), Visitors: n})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Visitors != paths[j].Visitors {
+			return paths[i].Visitors > paths[j].Visitors
+		}
+		return strings.Join(paths[i].Path, ",") < strings.Join(paths[j].Path, ",")
+	})
+	if len(paths) > 50 {
+		paths = paths[:50]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"visitors":            visitors,
+		"multi_link_visitors": multiLink,
+		"paths":               paths,
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Clicks queued, processed inline because the queue was full, and access counts flushed, published at
+// /debug/vars
+var writeBehindStats = expvar.NewMap("write_behind")
+
+// Access counts are kept in a hash next to the link, incremented atomically with HINCRBY, so
+// concurrent redirects on any number of replicas can't lose counts. The link record gets the counted
+// total when the counts are flushed.
+func accessCountsKey(key string) string {
+	return "clicks:accesses:" + key
+}
+
+// clickJob is the work a counted redirect leaves to be done after its response: counting the access
+// and recording the click in the link's analytics.
+type clickJob struct {
+	ctx         context.Context
+	rdb         *redis.Client
+	key         string
+	urlEntry    URL
+	visitor     string
+	fingerprint string
+	clickedAt   time.Time
+	click       ClickEvent
+}
+
+// pendingAccesses are the accesses of a link counted by a worker since its last flush.
+type pendingAccesses struct {
+	urlEntry URL
+	// Count of the record the first of the accesses was read from, for links counted before their
+	// accesses were kept in a hash
+	base  int
+	count int
+}
+
+// The queue of the write-behind workers, nil when clicks are processed inline
+var clickQueue chan clickJob
+
+// The `startWriteBehind` function starts the workers processing the clicks of redirects. Each
+// worker records the clicks it takes from the queue right away and adds up the access counts, which
+// it flushes in one pipeline every WRITE_BEHIND_INTERVAL. A hot link then costs one record write per
+// interval and worker instead of one per redirect.
+func startWriteBehind() {
+	if config.WriteBehindQueueSize <= 0 || config.WriteBehindWorkers <= 0 {
+		return
+	}
+	clickQueue = make(chan clickJob, config.WriteBehindQueueSize)
+	for i := 0; i < config.WriteBehindWorkers; i++ {
+		go writeBehindWorker(clickQueue, config.WriteBehindInterval)
+	}
+}
+
+// The `enqueueClick` function hands the click of a redirect to the workers. When the queue is full, or
+// there are no workers, the click is processed by the request itself, which slows down redirects
+// rather than piling up goroutines or dropping counts.
+func enqueueClick(job clickJob) {
+	pendingSaves.Add(1)
+	select {
+	case clickQueue <- job:
+		writeBehindStats.Add("queued", 1)
+	default:
+		writeBehindStats.Add("inline", 1)
+		recordClickJob(job)
+		flushAccesses(job.ctx, job.rdb, map[string]*pendingAccesses{job.key: newPendingAccesses(job)})
+		pendingSaves.Add(-1)
+	}
+}
+
+func writeBehindWorker(queue <-chan clickJob, interval time.Duration) {
+	pending := map[*redis.Client]map[string]*pendingAccesses{}
+	held := 0
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case job := <-queue:
+			recordClickJob(job)
+			links := pending[job.rdb]
+			if links == nil {
+				links = map[string]*pendingAccesses{}
+				pending[job.rdb] = links
+			}
+			if accesses, ok := links[job.key]; ok {
+				accesses.urlEntry = job.urlEntry
+				accesses.count++
+			} else {
+				links[job.key] = newPendingAccesses(job)
+			}
+			held++
+		case <-ticker.C:
+			for rdb, links := range pending {
+				flushAccesses(context.Background(), rdb, links)
+			}
+			pendingSaves.Add(-int64(held))
+			pending = map[*redis.Client]map[string]*pendingAccesses{}
+			held = 0
+		}
+	}
+}
+
+func newPendingAccesses(job clickJob) *pendingAccesses {
+	return &pendingAccesses{urlEntry: job.urlEntry, base: job.urlEntry.CurrentAccessCount - 1, count: 1}
+}
+
+// The `flushAccesses` function adds up the pending accesses of links in their count hashes, in one
+// pipeline, and saves their current records with the new totals. A record changed in the meantime is
+// left alone; edits take the total from the counter. Campaign totals are incremented along, also
+// for one-time links, which are gone once they are accessed.
+func flushAccesses(ctx context.Context, rdb *redis.Client, links map[string]*pendingAccesses) {
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	totals := map[string]*redis.IntCmd{}
+	records := map[string]*redis.StringCmd{}
+	rdb.Pipelined(opCtx, func(pipe redis.Pipeliner) error {
+		for key, accesses := range links {
+			if accesses.urlEntry.CampaignID != "" {
+				pipe.IncrBy(opCtx, campaignClicksKey(accesses.urlEntry.CampaignID), int64(accesses.count))
+			}
+			if accesses.urlEntry.OneTime {
+				continue
+			}
+			countsKey := accessCountsKey(key)
+			pipe.HSetNX(opCtx, countsKey, "count", accesses.base)
+			totals[key] = pipe.HIncrBy(opCtx, countsKey, "count", int64(accesses.count))
+			pipe.ExpireAt(opCtx, countsKey, accesses.urlEntry.expiry())
+			records[key] = pipe.Get(opCtx, key)
+		}
+		return nil
+	})
+
+	for key, accesses := range links {
+		if totals[key] == nil {
+			continue
+		}
+		total, err := totals[key].Result()
+		if err != nil {
+			continue
+		}
+		writeBehindStats.Add("flushed", int64(accesses.count))
+
+		// The counts go into the current record, which may have been edited since the accesses read it
+		previous, err := records[key].Result()
+		var urlEntry URL
+		if err != nil || json.Unmarshal([]byte(previous), &urlEntry) != nil {
+			continue
+		}
+		urlEntry.CurrentAccessCount = int(total)
+		if accesses.urlEntry.LastAccessedAt > urlEntry.LastAccessedAt {
+			urlEntry.LastAccessedAt = accesses.urlEntry.LastAccessedAt
+		}
+		data, _ := json.Marshal(urlEntry)
+		if saveAccessedLink(opCtx, rdb, key, urlEntry, previous, data) {
+			linkCache.update(key, string(data))
+			rankOwnedLink(opCtx, rdb, urlEntry)
+		}
+	}
+}
+
+// The function records a click in the analytics of its link: the visitor's journey, conversions,
+// destination, category and time series counters, the click log and unique visitors.
+func recordClickJob(job clickJob) {
+	ctx, rdb, urlEntry := job.ctx, job.rdb, job.urlEntry
+	opCtx, cancel := writeContext(ctx)
+	defer cancel()
+	if job.visitor != "" {
+		recordJourney(opCtx, rdb, urlEntry, job.visitor)
+	}
+	if config.ConversionTracking && urlEntry.CampaignID != "" && !urlEntry.NoTracking {
+		recordClickRef(opCtx, rdb, urlEntry, job.click.ClickID, job.clickedAt)
+	}
+	countDestination(opCtx, rdb, urlEntry, "clicks")
+	countCategory(opCtx, rdb, urlEntry, "clicks")
+	countClickSeries(opCtx, rdb, urlEntry, job.clickedAt)
+	if !urlEntry.NoTracking {
+		recordClick(opCtx, rdb, urlEntry, job.click)
+		countVisitor(opCtx, rdb, urlEntry, job.fingerprint)
+	}
+}
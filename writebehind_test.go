@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBehindCount(name string) int64 {
+	if value, ok := writeBehindStats.Get(name).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
+
+func TestWriteBehindFlushesCounts(t *testing.T) {
+	rdb := setupTestRedis()
+	defer rdb.Close()
+
+	// A link counted before its accesses were kept in a hash
+	urlEntry := URL{Token: "behind1", LongURL: "https://example.com", MaxAccess: -1, CurrentAccessCount: 5, ExpiresAt: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	data, _ := json.Marshal(urlEntry)
+	rdb.Set(testCtx, urlEntry.Token, data, time.Hour)
+
+	queue := make(chan clickJob, 10)
+	go writeBehindWorker(queue, 20*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		// Concurrent redirects all read the same record
+		accessed := urlEntry
+		accessed.CurrentAccessCount++
+		pendingSaves.Add(1)
+		queue <- clickJob{ctx: context.Background(), rdb: rdb, key: urlEntry.Token, urlEntry: accessed, clickedAt: time.Now()}
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	var saved URL
+	json.Unmarshal([]byte(rdb.Get(testCtx, urlEntry.Token).Val()), &saved)
+	assert.Equal(t, 8, saved.CurrentAccessCount)
+	assert.Equal(t, "8", rdb.HGet(testCtx, accessCountsKey(urlEntry.Token), "count").Val())
+}
+
+func TestEnqueueClickInlineWhenFull(t *testing.T) {
+	previous := clickQueue
+	clickQueue = make(chan clickJob, 1)
+	defer func() { clickQueue = previous }()
+
+	rdb := unreachableRedis(t)
+	job := clickJob{ctx: context.Background(), rdb: rdb, key: "full", urlEntry: URL{Token: "full", MaxAccess: -1}}
+	queued, inline := writeBehindCount("queued"), writeBehindCount("inline")
+	enqueueClick(job)
+	enqueueClick(job)
+	assert.Len(t, clickQueue, 1)
+	assert.Equal(t, queued+1, writeBehindCount("queued"))
+	assert.Equal(t, inline+1, writeBehindCount("inline"))
+	<-clickQueue
+	pendingSaves.Add(-1)
+}